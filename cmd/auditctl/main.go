@@ -0,0 +1,300 @@
+package main
+
+/*
+auditctl — проверка целостности журнала аудита агентов (audit_logs).
+
+	auditctl verify [-partition gw-1] [-jwks https://console:8000/.well-known/jwks.json] [-json]
+	auditctl checkpoint
+	auditctl partitions | archives
+	auditctl maintain
+	auditctl restore -partition audit_logs_p20250101 [-file /mnt/cold/audit_logs_p20250101.ndjson.gz]
+	auditctl release audit_logs_p20250101
+
+verify проходит цепочку хешей каждой партиции напрямую в PostgreSQL (без консоли: проверяющий
+не должен зависеть от проверяемой системы) и сообщает о пропусках, измененных строках,
+обрезанном хвосте и несовпадении с подписанными контрольными точками. Код выхода 1 — найдены нарушения.
+checkpoint немедленно подписывает текущие головы партиций (нужен auth.private_key).
+
+partitions и archives показывают партиции хранения audit_logs и архивы удаленных партиций;
+maintain выполняет проход обслуживания (как консоль по audit.retention.interval): создает
+партиции наперед, архивирует и удаляет просроченные. restore возвращает архив в audit_logs
+для расследования и удерживает партицию от удаления до release.
+
+База и ключи берутся из конфига (config.yaml или ENV), как у консоли; -jwks заменяет
+открытые ключи из конфига набором ключей консоли (https; TLS и разрешение http — из
+auth.jwks_tls и auth.jwks_allow_http).
+*/
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/certs"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+type verifyResult struct {
+	Partitions      []*audit.PartitionReport `json:"partitions"`
+	UnchainedEvents int64                    `json:"unchained_events"`
+	OK              bool                     `json:"ok"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := infra.LoadConfig()
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	ctx := context.Background()
+	repo := postgres.NewAgentRepo(ctx, cfg)
+	defer repo.Close()
+
+	switch os.Args[1] {
+	case "verify":
+		err = verify(ctx, repo, cfg, os.Args[2:])
+	case "checkpoint":
+		err = checkpoint(ctx, repo, cfg)
+	case "partitions":
+		err = printJSON(repo.AuditPartitions(ctx))
+	case "archives":
+		err = printJSON(repo.AuditArchives(ctx))
+	case "maintain":
+		err = maintain(ctx, repo, cfg)
+	case "restore":
+		err = restore(ctx, repo, cfg, os.Args[2:])
+	case "release":
+		if len(os.Args) < 3 {
+			usage()
+			os.Exit(2)
+		}
+		err = retention(repo, cfg, nil).Release(ctx, os.Args[2])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func verify(ctx context.Context, repo *postgres.AgentRepo, cfg *infra.Config, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	partition := fs.String("partition", "", "Verify only this chain partition")
+	jwksURL := fs.String("jwks", "", "Console JWKS URL for checkpoint signatures (default: keys from config)")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	fs.Parse(args)
+
+	keys, err := checkpointKeys(ctx, cfg, *jwksURL)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		fmt.Fprintln(os.Stderr, "Warning: no public keys configured, checkpoint signatures are not verified")
+	}
+
+	heads, err := repo.ChainHeads(ctx)
+	if err != nil {
+		return err
+	}
+	res := verifyResult{Partitions: []*audit.PartitionReport{}, OK: true}
+	for _, h := range heads {
+		if *partition != "" && h.Partition != *partition {
+			continue
+		}
+		rep, err := audit.VerifyPartition(ctx, repo, keys, h)
+		if err != nil {
+			return err
+		}
+		res.Partitions = append(res.Partitions, rep)
+		res.OK = res.OK && rep.OK()
+	}
+	if *partition != "" && len(res.Partitions) == 0 {
+		return fmt.Errorf("partition %q not found", *partition)
+	}
+	if res.UnchainedEvents, err = repo.CountUnchainedEvents(ctx); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		printReport(res)
+	}
+	if !res.OK {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func printReport(res verifyResult) {
+	for _, p := range res.Partitions {
+		status := "OK"
+		if !p.OK() {
+			status = fmt.Sprintf("%d PROBLEM(S)", len(p.Problems))
+		}
+		fmt.Printf("%s: %d events, head %d, checkpoints %d/%d verified — %s\n",
+			p.Partition, p.Events, p.HeadSeq, p.VerifiedCheckpoints, p.Checkpoints, status)
+		for _, pr := range p.Problems {
+			fmt.Printf("  [%s] seq %d %s %s\n", pr.Kind, pr.Seq, pr.EventID, pr.Detail)
+		}
+	}
+	if len(res.Partitions) == 0 {
+		fmt.Println("No chained audit events yet.")
+	}
+	if res.UnchainedEvents > 0 {
+		fmt.Printf("Note: %d events were written without a hash chain and are not covered.\n", res.UnchainedEvents)
+	}
+}
+
+// checkpointKeys — открытые ключи консоли для проверки подписей (nil — ключей нет).
+func checkpointKeys(ctx context.Context, cfg *infra.Config, jwksURL string) (audit.PublicKeys, error) {
+	if jwksURL != "" {
+		opts := auth.JWKSOptions{URL: jwksURL, AllowHTTP: cfg.Auth.JWKSAllowHTTP}
+		if tc := cfg.Auth.JWKSTLS; tc.Enabled {
+			// Разовый запрос: сертификаты читаются один раз, без фонового обновления
+			reloader, err := certs.NewReloader(tc.CertFile, tc.KeyFile, tc.CAFile, zap.NewNop())
+			if err != nil {
+				return nil, fmt.Errorf("jwks tls: %w", err)
+			}
+			opts.TLS = certs.NewClientTLS(reloader, certs.PeerPolicy{ServerName: tc.ServerName}, zap.NewNop())
+		}
+		client, err := auth.NewJWKSClient(opts, zap.NewNop())
+		if err != nil {
+			return nil, err
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := client.Fetch(fetchCtx); err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+		}
+		return client, nil
+	}
+
+	var keys []*rsa.PublicKey
+	if len(cfg.Auth.PublicKey) > 0 {
+		k, err := auth.ParseRSAPublicKey(cfg.Auth.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("public key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	for _, data := range cfg.Auth.PreviousPublicKeys {
+		k, err := auth.ParseRSAPublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("previous public key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return auth.NewKeySet(keys...), nil
+}
+
+// privateKey — закрытый ключ консоли из конфига (nil — не настроен).
+func privateKey(cfg *infra.Config) (*rsa.PrivateKey, error) {
+	if len(cfg.Auth.PrivateKey) == 0 {
+		return nil, nil
+	}
+	key, err := auth.ParseRSAPrivateKey(cfg.Auth.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+	return key, nil
+}
+
+func checkpoint(ctx context.Context, repo *postgres.AgentRepo, cfg *infra.Config) error {
+	key, err := privateKey(cfg)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.New("auth.private_key is required to sign checkpoints")
+	}
+	n, err := service.NewAuditCheckpointer(repo, key, zap.NewNop()).Checkpoint(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Signed %d checkpoint(s).\n", n)
+	return nil
+}
+
+func retention(repo *postgres.AgentRepo, cfg *infra.Config, key *rsa.PrivateKey) *service.AuditRetention {
+	return service.NewAuditRetention(repo, key, cfg.Audit.Retention, zap.NewNop())
+}
+
+func maintain(ctx context.Context, repo *postgres.AgentRepo, cfg *infra.Config) error {
+	key, err := privateKey(cfg)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		fmt.Fprintln(os.Stderr, "Warning: auth.private_key is not configured, chain anchors will be unsigned")
+	}
+	res, err := retention(repo, cfg, key).Maintain(ctx)
+	if err != nil {
+		return err
+	}
+	if res.Skipped {
+		return errors.New("maintenance is running on another instance, try again later")
+	}
+	fmt.Printf("Created %d partition(s) %v, expired %d partition(s) %v.\n", len(res.Created), res.Created, len(res.Expired), res.Expired)
+	return nil
+}
+
+func restore(ctx context.Context, repo *postgres.AgentRepo, cfg *infra.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	partition := fs.String("partition", "", "Storage partition to restore (see auditctl archives)")
+	file := fs.String("file", "", "Archive file, if it was moved from the registered path")
+	fs.Parse(args)
+	if *partition == "" {
+		return errors.New("-partition is required")
+	}
+
+	n, err := retention(repo, cfg, nil).Restore(ctx, *partition, *file)
+	if err != nil {
+		return fmt.Errorf("restored %d row(s) before failure: %w", n, err)
+	}
+	fmt.Printf("Restored %d row(s) into %s; it is kept until `auditctl release %s`.\n", n, *partition, *partition)
+	return nil
+}
+
+func printJSON(v any, err error) error {
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  auditctl verify [-partition NAME] [-jwks URL] [-json]
+  auditctl checkpoint
+  auditctl partitions | archives
+  auditctl maintain
+  auditctl restore -partition NAME [-file PATH]
+  auditctl release NAME`)
+}
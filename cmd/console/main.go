@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/rsa"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -10,11 +11,14 @@ import (
 	"os"
 	"time"
 
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/handler"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/server"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/certs"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/repository/postgres" // Пример реализации БД
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
@@ -22,6 +26,13 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// Создание первого администратора: console -bootstrap-admin alice -bootstrap-email alice@corp.io
+// Пароль берется из BOOTSTRAP_ADMIN_PASSWORD или генерируется и печатается один раз.
+var (
+	bootstrapAdmin = flag.String("bootstrap-admin", "", "Create the initial admin user with this username and exit")
+	bootstrapEmail = flag.String("bootstrap-email", "", "Email of the initial admin (default: <username>@localhost)")
+)
+
 func main() {
 	// Проверяем режим запуска
 	checkBycript()
@@ -48,6 +59,20 @@ func main() {
 		}
 	}
 
+	// Набор ключей для JWKS: текущий (первым) и прежние, чьи токены еще не истекли
+	keys := []*rsa.PublicKey{pubKey}
+	for _, data := range cfg.Auth.PreviousPublicKeys {
+		prev, err := auth.ParseRSAPublicKey(data)
+		if err != nil {
+			log.Fatalf("Previous Public Key error: %v", err)
+		}
+		keys = append(keys, prev)
+	}
+	if privKey != nil && auth.KeyID(&privKey.PublicKey) != auth.KeyID(pubKey) {
+		log.Fatal("Private key does not match public key: tokens would be signed with an unpublished kid")
+	}
+	keySet := auth.NewKeySet(keys...)
+
 	logger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatal(fmt.Sprintf("failed to create logger: %v", err))
@@ -58,30 +83,69 @@ func main() {
 	rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr})
 	pgRepo := postgres.NewAgentRepo(context.Background(), cfg) // Твой универсальный AuditStorage/Repo
 
-	// 1.1. Создаем валидатор с публичным ключом
-	pubKey, err := infra.GetPublicKey(cfg)
-	if err != nil {
-		logger.Fatal(fmt.Sprintf("failed to get public key: %v", err))
-	}
-	validatorWithKey := auth.NewBaseValidator(pubKey)
+	// 1.1. Создаем валидатор с набором ключей и списком отзыва
+	revocations := auth.NewRevocationList(rdb, cfg.Auth.MaxTokenTTL(), cfg.Auth.RevocationFailOpen)
+	validatorWithKey := auth.NewBaseValidator(keySet, revocations, domain.AudienceConsole)
 	// 1.2. Прокидываем его в сервис (он там встроится через Embedding)
-	agentService := service.NewAgentService(rdb, pgRepo, validatorWithKey, logger)
+	agentService := service.NewAgentService(rdb, pgRepo, validatorWithKey, revocations, logger)
 
-	privKey, err := infra.GetPrivateKey(cfg)
-	if err != nil {
-		logger.Fatal(fmt.Sprintf("failed to get private key: %v", err))
-	}
-	authService := service.NewAuthService(pgRepo, privKey)
+	authService := service.NewAuthService(pgRepo, privKey, keySet, revocations, cfg.Auth)
 	authHandler := handler.NewAuthHandler(authService)
 
+	// UserService управляет пользователями консоли (bcrypt_cost из конфига)
+	userService := service.NewUserService(pgRepo, revocations, domain.NewRolePermissions(cfg.Auth.Roles), cfg.Auth.BcryptCost, logger)
+	if *bootstrapAdmin != "" {
+		runBootstrapAdmin(userService, *bootstrapAdmin, *bootstrapEmail)
+		return
+	}
+
+	// Вход через корпоративный IdP (опционально)
+	var oidcHandler *handler.OIDCHandler
+	if cfg.Auth.OIDC.Enabled {
+		oidcProvider := auth.NewOIDCProvider(cfg.Auth.OIDC, logger)
+		oidcService := service.NewOIDCService(oidcProvider, authService, pgRepo, rdb, cfg.Auth.OIDC, logger)
+		oidcHandler = handler.NewOIDCHandler(oidcService, logger)
+	}
+
 	// --- 2. Сервисный слой (Бизнес-логика) ---
 	// AgentService теперь — центральный узел для управления агентами и статами
 
 	// PolicyService управляет правилами доступа
 	policyService := service.NewPolicyService(pgRepo, rdb)
+	// ShadowService управляет кандидатным набором политик (Shadow Mode)
+	shadowService := service.NewShadowService(pgRepo, rdb)
 
 	// AuditService отвечает за чтение логов
 	auditService := service.NewAuditService(pgRepo)
+	// Подписанные контрольные точки цепочки хешей аудита (проверка: auditctl verify)
+	if cp := cfg.Audit.Checkpoints; cp.Enabled && cp.Interval > 0 {
+		if privKey == nil {
+			logger.Warn("audit checkpoints disabled: auth.private_key is not configured")
+		} else {
+			go service.NewAuditCheckpointer(pgRepo, privKey, logger).Run(context.Background(), cp.Interval)
+		}
+	}
+	// Партиции хранения audit_logs: создание наперед, архивация и удаление по сроку
+	if rc := cfg.Audit.Retention; rc.Enabled && rc.Interval > 0 {
+		if privKey == nil {
+			logger.Warn("audit retention: auth.private_key is not configured, chain anchors will be unsigned")
+		}
+		go service.NewAuditRetention(pgRepo, privKey, rc, logger).Run(context.Background(), rc.Interval)
+	}
+	// Доставка новых событий аудита в SIEM (syslog или HTTP-коллектор)
+	if fc := cfg.Audit.Forwarder; fc.Enabled {
+		shipper, err := newAuditShipper(fc)
+		if err != nil {
+			logger.Fatal("audit forwarder config error", zap.Error(err))
+		}
+		forwarder := service.NewAuditForwarder(pgRepo, shipper, fc.Name, fc.BatchSize, fc.StartFrom != "earliest", logger)
+		if err := forwarder.CheckChain(context.Background()); err != nil {
+			logger.Fatal("audit forwarder cannot start", zap.Error(err))
+		}
+		go forwarder.Run(context.Background(), fc.Interval)
+	}
+	// AdminAuditService — журнал действий пользователей консоли (пишет PermissionGuard)
+	adminAuditService := service.NewAdminAuditService(pgRepo)
 
 	// --- 3. Слой доставки (Handlers) ---
 	agentHandler := handler.NewAgentHandler(agentService, logger)
@@ -90,7 +154,10 @@ func main() {
 
 	// Не забываем про Policy и Audit хендлеры
 	policyHandler := handler.NewPolicyHandler(policyService)
-	auditHandler := handler.NewAuditHandler(auditService)
+	shadowHandler := handler.NewShadowHandler(shadowService)
+	auditHandler := handler.NewAuditHandler(auditService, logger)
+	adminAuditHandler := handler.NewAdminAuditHandler(adminAuditService, logger)
+	userHandler := handler.NewUserHandler(userService)
 
 	// --- 4. Запуск Console API (Control Plane) ---
 	// Передаем валидатор через конструктор сервера или сервиса (как мы решили через Embedding)
@@ -99,12 +166,17 @@ func main() {
 		cfg,
 		logger,
 		agentService,
+		pgRepo,
 		authHandler,
 		agentHandler,
 		policyHandler,
+		shadowHandler,
 		approvalHandler,
 		dashHandler,
 		auditHandler,
+		adminAuditHandler,
+		userHandler,
+		oidcHandler,
 	)
 
 	// --- Настройка и Запуск Сервера ---
@@ -116,10 +188,26 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// TLS/mTLS консоли (например, шлюзы ходят за JWKS с клиентским сертификатом)
+	if tc := cfg.Server.TLS; tc.Enabled {
+		reloader, err := certs.NewReloader(tc.CertFile, tc.KeyFile, tc.ClientCAFile, logger)
+		if err != nil {
+			log.Fatalf("TLS error: %v", err)
+		}
+		go reloader.Start(context.Background(), tc.ReloadInterval)
+		if srv.TLSConfig, err = certs.NewServerTLS(tc, reloader, certs.ProtosHTTP); err != nil {
+			log.Fatalf("TLS error: %v", err)
+		}
+	}
+
 	// Запуск в отдельной горутине, чтобы не блокировать основной поток для Shutdown сигналов
 	go func() {
-		log.Printf("🚀 Console API started on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("🚀 Console API started on %s (tls: %t)", srv.Addr, srv.TLSConfig != nil)
+		serve := srv.ListenAndServe
+		if srv.TLSConfig != nil {
+			serve = func() error { return srv.ListenAndServeTLS("", "") } // Сертификат из Reloader
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Critical: listen error: %v", err)
 		}
 	}()
@@ -144,7 +232,70 @@ func checkBycript() {
 		fmt.Printf("Password: %s\n", *genHash)
 		fmt.Printf("Bcrypt Hash: %s\n", string(hash))
 		fmt.Printf("-------------------------------\n")
-		fmt.Printf("Copy this hash to your 'users' table in PostgreSQL.\n\n")
+		fmt.Printf("Users are managed via -bootstrap-admin and POST /v1/users; use this hash only for manual recovery.\n\n")
 		os.Exit(0) // Завершаем работу, сервер не запускаем
 	}
 }
+
+// runBootstrapAdmin создает первого администратора, если действующего еще нет.
+func runBootstrapAdmin(users *service.UserService, username, email string) {
+	if email == "" {
+		email = username + "@localhost"
+	}
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = service.NewTemporaryPassword(); err != nil {
+			log.Fatalf("Bootstrap: failed to generate password: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	user, err := users.Bootstrap(ctx, username, email, password)
+	if errors.Is(err, service.ErrAdminExists) {
+		fmt.Println("Bootstrap skipped: an active admin already exists.")
+		return
+	}
+	if err != nil {
+		log.Fatalf("Bootstrap failed: %v", err)
+	}
+
+	fmt.Printf("\n--- INITIAL ADMIN CREATED ---\n")
+	fmt.Printf("Username: %s\n", user.Username)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+		fmt.Printf("Save it now: it is not stored anywhere and will not be shown again.\n")
+	}
+	fmt.Printf("-----------------------------\n\n")
+}
+
+// newAuditShipper создает получателя событий аудита по audit.forwarder.
+func newAuditShipper(fc infra.AuditForwarderConfig) (audit.Shipper, error) {
+	if fc.Name == "" || fc.BatchSize <= 0 || fc.Interval <= 0 {
+		return nil, errors.New("audit.forwarder: name, batch_size and interval are required")
+	}
+	if fc.StartFrom != "latest" && fc.StartFrom != "earliest" {
+		return nil, fmt.Errorf("audit.forwarder.start_from must be latest or earliest, got %q", fc.StartFrom)
+	}
+	switch fc.Target {
+	case "syslog":
+		return audit.NewSyslogShipper(audit.SyslogOptions{
+			Network:  fc.Syslog.Network,
+			Address:  fc.Syslog.Address,
+			AppName:  fc.Syslog.AppName,
+			Facility: fc.Syslog.Facility,
+			Format:   fc.Format,
+			Timeout:  fc.Syslog.Timeout,
+		})
+	case "http":
+		return audit.NewHTTPShipper(audit.HTTPOptions{
+			URL:     fc.HTTP.URL,
+			Headers: fc.HTTP.Headers,
+			Format:  fc.Format,
+			Timeout: fc.HTTP.Timeout,
+		})
+	}
+	return nil, fmt.Errorf("audit.forwarder.target must be syslog or http, got %q", fc.Target)
+}
@@ -0,0 +1,292 @@
+package main
+
+/*
+mock-oidc — локальный OIDC-провайдер для разработки и проверки входа в консоль через IdP.
+Не требует Keycloak: пользователи и их группы задаются флагом, вход — одним кликом.
+
+	mock-oidc -addr :9000 -issuer http://localhost:9000 \
+	    -client-id spaceai-console -client-secret mock-secret \
+	    -users "alice:console-admins;bob:console-operators,sre;carol:"
+
+Консоль: auth.oidc.issuer_url = http://localhost:9000, redirect_url = http://localhost:8000/auth/oidc/callback.
+Поддерживается только то, что нужно консоли: discovery, authorization code + PKCE S256, JWKS.
+Ключ подписи генерируется при старте. НЕ ИСПОЛЬЗОВАТЬ В ПРОДЕ.
+*/
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+)
+
+type mockUser struct {
+	Name   string
+	Groups []string
+}
+
+// authCode — выданный, но еще не обмененный код авторизации.
+type authCode struct {
+	user        mockUser
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiresAt   time.Time
+}
+
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	users        map[string]mockUser
+	key          *rsa.PrivateKey
+	kid          string
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<html><head><title>mock-oidc</title></head><body>
+<h3>mock-oidc: выберите пользователя</h3>
+<ul>{{range .Users}}<li><a href="{{$.Base}}&login_hint={{.Name}}">{{.Name}}</a> {{.Groups}}</li>{{end}}</ul>
+</body></html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "Listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "Issuer URL (must match auth.oidc.issuer_url)")
+	clientID := flag.String("client-id", "spaceai-console", "Registered client_id")
+	clientSecret := flag.String("client-secret", "mock-secret", "Registered client_secret")
+	users := flag.String("users", "alice:console-admins;bob:console-operators;carol:console-viewers",
+		"Users and groups: name:group1,group2;name2:...")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("failed to generate signing key: %v", err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		users:        parseUsers(*users),
+		key:          key,
+		kid:          auth.KeyID(&key.PublicKey),
+		codes:        make(map[string]authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+
+	log.Printf("mock-oidc issuer %s listening on %s (users: %d)", p.issuer, *addr, len(p.users))
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.JWKS{Keys: []auth.JWK{auth.NewJWK(&p.key.PublicKey)}})
+}
+
+// authorize без login_hint показывает список пользователей, с ним — сразу выдает код.
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.clientID {
+		http.Error(w, "unsupported response_type or unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if _, err := url.ParseRequestURI(redirectURI); err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	hint := q.Get("login_hint")
+	if hint == "" {
+		names := make([]string, 0, len(p.users))
+		for name := range p.users {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]mockUser, 0, len(names))
+		for _, n := range names {
+			list = append(list, p.users[n])
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		loginPage.Execute(w, map[string]any{"Base": "/authorize?" + q.Encode(), "Users": list})
+		return
+	}
+
+	user, ok := p.users[hint]
+	if !ok {
+		redirectError(w, r, redirectURI, q.Get("state"), "access_denied", "unknown user")
+		return
+	}
+
+	code, err := auth.RandomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		user:        user,
+		clientID:    p.clientID,
+		redirectURI: redirectURI,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	target, _ := url.Parse(redirectURI)
+	rq := target.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	target.RawQuery = rq.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != p.clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(p.clientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Код одноразовый: удаляем сразу, даже если дальше проверка не пройдет
+	p.mu.Lock()
+	c, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	switch {
+	case !found || time.Now().After(c.expiresAt):
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	case c.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	case auth.PKCEChallenge(r.PostForm.Get("code_verifier")) != c.challenge:
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                p.issuer,
+		"sub":                "mock|" + c.user.Name,
+		"aud":                c.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              c.nonce,
+		"preferred_username": c.user.Name,
+		"email":              c.user.Name + "@mock-oidc.local",
+		"name":               c.user.Name,
+		"groups":             c.user.Groups,
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = p.kid
+	idToken, err := tok.SignedString(p.key)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": idToken,
+		"id_token":     idToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+	})
+}
+
+// parseUsers разбирает "alice:g1,g2;bob:g3".
+func parseUsers(spec string) map[string]mockUser {
+	users := make(map[string]mockUser)
+	for _, entry := range strings.Split(spec, ";") {
+		name, groups, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if name == "" {
+			continue
+		}
+		u := mockUser{Name: name, Groups: []string{}}
+		for _, g := range strings.Split(groups, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				u.Groups = append(u.Groups, g)
+			}
+		}
+		users[name] = u
+	}
+	return users
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, desc string) {
+	target, _ := url.Parse(redirectURI)
+	q := target.Query()
+	q.Set("error", code)
+	q.Set("error_description", desc)
+	q.Set("state", state)
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("encode error:", err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+/*
+policyctl — CLI для Policy-as-Code. Работает через Console API, поэтому изменения
+проходят аутентификацию консоли и попадают в историю версий с автором из токена.
+
+	policyctl export [-format yaml|json] [-o policies.yaml]
+	policyctl plan -f policies.yaml
+	policyctl apply -f policies.yaml [-yes]
+
+Адрес консоли и токен: флаги -console/-token или переменные SPACEAI_CONSOLE_URL/SPACEAI_TOKEN.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+type planResponse struct {
+	Summary string             `json:"summary"`
+	Plan    *domain.BundlePlan `json:"plan"`
+}
+
+func main() {
+	global := flag.NewFlagSet("policyctl", flag.ExitOnError)
+	consoleURL := global.String("console", envOr("SPACEAI_CONSOLE_URL", "http://localhost:8000"), "Console API base URL")
+	token := global.String("token", os.Getenv("SPACEAI_TOKEN"), "Console access token (RS256 JWT)")
+	global.Usage = usage
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		baseURL: strings.TrimSuffix(*consoleURL, "/"),
+		token:   *token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = c.export(args[1:])
+	case "plan":
+		err = c.plan(args[1:])
+	case "apply":
+		err = c.apply(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func (c *client) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "yaml", "Bundle format: yaml or json")
+	out := fs.String("o", "", "Output file (stdout by default)")
+	fs.Parse(args)
+
+	data, err := c.do(http.MethodGet, "/v1/policies/bundle?format="+*format, nil)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0o644)
+}
+
+func (c *client) plan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	file := fs.String("f", "", "Bundle file (YAML or JSON)")
+	fs.Parse(args)
+
+	bundle, err := readBundle(*file)
+	if err != nil {
+		return err
+	}
+	plan, err := c.postBundle("/v1/policies/bundle/plan", bundle)
+	if err != nil {
+		return err
+	}
+	printPlan(plan)
+	return nil
+}
+
+func (c *client) apply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	file := fs.String("f", "", "Bundle file (YAML or JSON)")
+	yes := fs.Bool("yes", false, "Apply without confirmation")
+	fs.Parse(args)
+
+	bundle, err := readBundle(*file)
+	if err != nil {
+		return err
+	}
+
+	plan, err := c.postBundle("/v1/policies/bundle/plan", bundle)
+	if err != nil {
+		return err
+	}
+	printPlan(plan)
+	if plan.Plan.IsEmpty() {
+		return nil
+	}
+
+	if !*yes && !confirm("Apply these changes?") {
+		fmt.Println("Apply cancelled.")
+		return nil
+	}
+
+	// Сервер заново строит план внутри транзакции: выводим то, что применено фактически
+	applied, err := c.postBundle("/v1/policies/bundle/apply", bundle)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nApplied: %s\n", applied.Summary)
+	return nil
+}
+
+func (c *client) postBundle(path string, bundle []byte) (*planResponse, error) {
+	data, err := c.do(http.MethodPost, path, bundle)
+	if err != nil {
+		return nil, err
+	}
+	var resp planResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("unexpected response: %w", err)
+	}
+	if resp.Plan == nil {
+		return nil, fmt.Errorf("unexpected response: empty plan")
+	}
+	return &resp, nil
+}
+
+func (c *client) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("console returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func printPlan(resp *planResponse) {
+	p := resp.Plan
+	for _, a := range p.Added {
+		fmt.Printf("  + %s  %s\n", domain.PolicyKey(a), a.Effect)
+	}
+	for _, ch := range p.Changed {
+		fmt.Printf("  ~ %s\n", domain.PolicyKey(ch.Before))
+		fields := make([]string, 0, len(ch.Diff))
+		for field := range ch.Diff {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Printf("      %s: %v -> %v\n", field, ch.Diff[field].From, ch.Diff[field].To)
+		}
+	}
+	for _, r := range p.Removed {
+		fmt.Printf("  - %s  %s\n", domain.PolicyKey(r), r.Effect)
+	}
+	if p.IsEmpty() {
+		fmt.Println("No changes. Policies match the bundle.")
+	}
+	fmt.Printf("\nPlan: %s (%d unchanged)\n", resp.Summary, p.Unchanged)
+}
+
+func readBundle(path string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("bundle file is required (-f)")
+	}
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func confirm(question string) bool {
+	fmt.Printf("\n%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: policyctl [-console URL] [-token JWT] <command> [flags]
+
+Commands:
+  export  [-format yaml|json] [-o file]   Export active policies as a bundle
+  plan    -f bundle.yaml                  Validate bundle and show the diff
+  apply   -f bundle.yaml [-yes]           Apply bundle atomically
+`)
+}
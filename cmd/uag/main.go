@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,12 +22,17 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/certs"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/redact"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/repository/postgres"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/risk"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/sandbox"
 	"go.uber.org/zap"
 
 	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit/sink"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/connectors"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/engine"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/policy"
 
@@ -30,7 +40,7 @@ import (
 
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -40,10 +50,13 @@ func main() {
 		log.Fatalf("Config error: %v", err)
 	}
 
-	// Парсим Публичный ключ
-	pubKey, err := auth.ParseRSAPublicKey(cfg.Auth.PublicKey)
-	if err != nil {
-		log.Fatalf("Public Key error: %v", err)
+	// Парсим Публичный ключ (необязателен, если ключи берутся из JWKS консоли)
+	var pubKey *rsa.PublicKey
+	if len(cfg.Auth.PublicKey) > 0 || cfg.Auth.JWKSURL == "" {
+		pubKey, err = auth.ParseRSAPublicKey(cfg.Auth.PublicKey)
+		if err != nil {
+			log.Fatalf("Public Key error: %v", err)
+		}
 	}
 
 	logger, err := zap.NewProduction()
@@ -63,17 +76,26 @@ func main() {
 	auditStorage := postgres.NewAgentRepo(context.Background(), cfg)
 	defer auditStorage.Close() // Закрываем пул в самом конце
 
-	// 2. Инициализация Аудита (AgentFS)
-	auditor := audit.NewAgentFS(auditStorage, logger)
-	auditor.Start()      // Запускаем воркера
-	defer auditor.Stop() // Гарантированный flush батча при выходе
+	// Metrics (Prometheus): нужны уже аудиту
+	reg := prometheus.NewRegistry()
+	metrics := engine.NewMetrics(reg)
 
-	// 3. Коннектор (External Systems)
-	conn, err := grpc.Dial("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// 2. Инициализация Аудита (AgentFS): свой AgentFS на каждое хранилище из audit.sinks
+	auditor, sinkClosers, err := newAuditor(appCtx, cfg, auditStorage, metrics, logger)
 	if err != nil {
-		log.Fatalf("failed to connect to connector: %v", err)
+		log.Fatalf("Audit sinks error: %v", err)
+	}
+	for _, c := range sinkClosers {
+		defer c.Close() // После auditor.Stop() в конце main: хранилища закрываются последними
 	}
-	defer conn.Close()
+	auditor.Start() // Запускаем воркеров; остановка — в конце main, после серверов
+
+	// 3. Коннекторы (External Systems): маршруты по префиксу capability, TLS/mTLS и пиннинг личности
+	connectorRouter, err := connectors.DialRoutes(appCtx, cfg.Engine.Connectors, logger)
+	if err != nil {
+		log.Fatalf("failed to connect to connectors: %v", err)
+	}
+	defer connectorRouter.Close()
 
 	// 4. Control Plane Managers (KillSwitch, Sandbox, Quarantine)
 	ksm := engine.NewKillSwitchManager(rdb, auditStorage, logger)
@@ -102,28 +124,33 @@ func main() {
 	if err := enforcer.Refresh(appCtx); err != nil {
 		logger.Fatal("Enforcer warm load policies failed", zap.Error(err))
 	}
-	// 5.3. Запускаем фоновую синхронизацию через Redis Pub/Sub
-	go func() {
-		pubsub := rdb.Subscribe(appCtx, infra.RedisChanPolicyUpdate)
-		for _ = range pubsub.Channel() {
-			err := enforcer.Refresh(appCtx)
-			if err != nil {
-				logger.Error("Enforcer refresh failed by signal", zap.Error(err))
-			} // Мгновенно обновляем кэш при сигнале из админки
-		}
-	}()
+	// 5.3. Фоновая синхронизация: дельты через Redis Pub/Sub и сверка контрольной суммы с БД
+	go enforcer.StartListener(appCtx)
+	go enforcer.StartDriftCheck(appCtx, cfg.Engine.PolicySync.DriftCheckInterval)
 
 	// 6. Execution Layer
-	connectorClient := pb.NewConnectorServiceClient(conn)
-	grpcAdapter := connectors.NewGRPCAdapter(connectorClient)
-	executor := engine.NewReliabilityWrapper(grpcAdapter)
+	executor := engine.NewReliabilityWrapper(connectorRouter)
+
+	// Risk Analyzer + контентные детекторы (секреты, эксфильтрация, URL, prompt-injection)
+	ra := risk.NewAnalyzer(ksm, logger, risk.DefaultDetectors(risk.DetectorConfig{
+		BlockedDomains:  cfg.Engine.Risk.BlockedDomains,
+		MaxArrayLen:     cfg.Engine.Risk.MaxArrayLen,
+		MaxPayloadBytes: cfg.Engine.Risk.MaxPayloadBytes,
+	})...)
+
+	// Поведенческий анализ: автоматический карантин/блокировка через тот же контур сигналов, что и консоль
+	if cfg.Engine.Behavior.Enabled {
+		behaviorCfg, err := newBehaviorConfig(cfg.Engine.Behavior)
+		if err != nil {
+			log.Fatalf("Behavior config error: %v", err)
+		}
+		ra.AttachBehavior(risk.NewBehaviorMonitor(behaviorCfg), engine.NewStateSignaler(rdb, auditStorage, logger))
+	}
 
-	// Risk Analyzer
-	ra := risk.NewAnalyzer(ksm, logger)
+	// Фильтрация PII в ответах агентам и в аудите (правила задаются в Conditions политик)
+	redactor := redact.NewRedactor(redact.DefaultDetectors()...)
 
-	// 7. Metrics (Prometheus)
-	reg := prometheus.NewRegistry()
-	metrics := engine.NewMetrics(reg)
+	// 7. Metrics (Prometheus): экспорт реестра
 	go func() {
 		http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 		log.Printf("Metrics exporter started on :9090")
@@ -132,8 +159,42 @@ func main() {
 		}
 	}()
 
+	// Песочница: ответы из фикстур, по JSON Schema или из обезличенных Live-записей
+	sandboxResp := sandbox.NewResponder(sandbox.Config{
+		FixturesDir: cfg.Engine.Sandbox.FixturesDir,
+		RecordLive:  cfg.Engine.Sandbox.RecordLive,
+		MaxRecorded: cfg.Engine.Sandbox.MaxRecorded,
+	}, rdb, redactor, logger)
+
+	// Shadow Mode: кандидатные политики оцениваются параллельно с активными
+	budgets := risk.NewBudgetTracker(rdb, logger)
+	shadow := engine.NewShadowEvaluator(enforcer, auditStorage, ra, budgets, logger)
+
 	// 8. Core Engine & Middleware Chain
-	v := auth.NewBaseValidator(pubKey)
+	// Ключи проверки: статический public_key_path или JWKS консоли с периодическим обновлением
+	var keys auth.KeyProvider = auth.NewKeySet(pubKey)
+	if cfg.Auth.JWKSURL != "" {
+		jwksTLS, err := newClientTLS(appCtx, cfg.Auth.JWKSTLS, logger)
+		if err != nil {
+			log.Fatalf("JWKS TLS error: %v", err)
+		}
+		jwks, err := auth.NewJWKSClient(auth.JWKSOptions{
+			URL: cfg.Auth.JWKSURL, TLS: jwksTLS, AllowHTTP: cfg.Auth.JWKSAllowHTTP,
+		}, logger, pubKey)
+		if err != nil {
+			log.Fatalf("JWKS error: %v", err)
+		}
+		if err := jwks.Fetch(appCtx); err != nil {
+			if jwks.Len() == 0 {
+				log.Fatalf("JWKS error: %v", err)
+			}
+			logger.Warn("initial jwks fetch failed, using public_key_path until refresh", zap.Error(err))
+		}
+		go jwks.Start(appCtx, cfg.Auth.JWKSRefreshInterval)
+		keys = jwks
+	}
+	revocations := auth.NewRevocationList(rdb, cfg.Auth.MaxTokenTTL(), cfg.Auth.RevocationFailOpen)
+	v := auth.NewBaseValidator(keys, revocations, domain.AudienceGateway)
 	uag := engine.NewUAGCore(engine.UAGDeps{
 		Validator:    v,
 		Policy:       enforcer,
@@ -141,6 +202,10 @@ func main() {
 		Executor:     executor,
 		Approver:     auditStorage,
 		RiskAnalyzer: ra,
+		Budgets:      budgets,
+		SandboxResp:  sandboxResp,
+		Shadow:       shadow,
+		Redactor:     redactor,
 		KillSwitch:   ksm,
 		Quarantine:   qm,
 		Sandbox:      sm,
@@ -175,7 +240,27 @@ func main() {
 		Handler: uagRouter,
 	}
 
-	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(engine.UnaryAuthInterceptor(uag)))
+	grpcOpts := []grpc.ServerOption{grpc.UnaryInterceptor(engine.UnaryAuthInterceptor(uag))}
+
+	// TLS/mTLS слушателей: сертификаты перечитываются с диска без перезапуска
+	if tc := cfg.Server.TLS; tc.Enabled {
+		reloader, err := certs.NewReloader(tc.CertFile, tc.KeyFile, tc.ClientCAFile, logger)
+		if err != nil {
+			log.Fatalf("TLS error: %v", err)
+		}
+		go reloader.Start(appCtx, tc.ReloadInterval)
+
+		if srv.TLSConfig, err = certs.NewServerTLS(tc, reloader, certs.ProtosHTTP); err != nil {
+			log.Fatalf("TLS error: %v", err)
+		}
+		grpcTLS, err := certs.NewServerTLS(tc, reloader, certs.ProtosGRPC)
+		if err != nil {
+			log.Fatalf("TLS error: %v", err)
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(grpcTLS)))
+	}
+
+	grpcSrv := grpc.NewServer(grpcOpts...)
 	pb.RegisterConnectorServiceServer(grpcSrv, engine.NewGRPCGatewayServer(uag))
 
 	go func() {
@@ -183,13 +268,13 @@ func main() {
 		if err != nil {
 			log.Fatalf("gRPC listen error: %v", err)
 		}
-		log.Printf("UAG gRPC Server started on :50052")
+		log.Printf("UAG gRPC Server started on :50052 (tls: %t)", cfg.Server.TLS.Enabled)
 		grpcSrv.Serve(lis)
 	}()
 
 	go func() {
-		log.Printf("UAG HTTP Engine started on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("UAG HTTP Engine started on %s (tls: %t)", srv.Addr, srv.TLSConfig != nil)
+		if err := listenAndServe(srv); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP listen error: %s", err)
 		}
 	}()
@@ -212,3 +297,163 @@ func main() {
 
 	log.Print("UAG Engine exited gracefully")
 }
+
+// listenAndServe запускает HTTP или HTTPS: сертификат берется из TLSConfig (Reloader), не из файлов.
+func listenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// newAuditor строит AgentFS для каждого хранилища из audit.sinks и объединяет их в FanOut.
+// Хранилища из closers закрываются после остановки аудитора.
+func newAuditor(ctx context.Context, cfg *infra.Config, repo *postgres.AgentRepo, metrics *engine.Metrics,
+	logger *zap.Logger) (*audit.FanOut, []io.Closer, error) {
+	var pipelines []*audit.AgentFS
+	var closers []io.Closer
+	names := make(map[string]bool, len(cfg.Audit.Sinks))
+	for _, sc := range cfg.Audit.Sinks {
+		if sc.Name == "" || names[sc.Name] {
+			return nil, closers, fmt.Errorf("audit sink name %q is empty or duplicated", sc.Name)
+		}
+		names[sc.Name] = true
+
+		storage, closer, err := newAuditSink(ctx, sc, repo, logger)
+		if err != nil {
+			return nil, closers, fmt.Errorf("audit sink %q: %w", sc.Name, err)
+		}
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+
+		// У каждого хранилища свой спул: сбой одного не задерживает остальные
+		spoolDir := cfg.Engine.AuditSpool.Dir
+		if spoolDir != "" {
+			spoolDir = filepath.Join(spoolDir, sc.Name)
+		}
+		fs, err := audit.NewAgentFS(storage, audit.AgentFSConfig{
+			BufferSize:      cfg.Engine.AuditBufferSize,
+			BatchSize:       cfg.Engine.AuditBatchSize,
+			BatchMaxBytes:   cfg.Engine.AuditBatchMaxBytes,
+			FlushInterval:   cfg.Engine.AuditFlushInterval,
+			Workers:         cfg.Engine.AuditWorkers,
+			SpoolDir:        spoolDir,
+			SpoolMaxBytes:   cfg.Engine.AuditSpool.MaxBytes,
+			MaxAttempts:     cfg.Engine.AuditRetry.MaxAttempts,
+			RetryBackoff:    cfg.Engine.AuditRetry.Backoff,
+			MaxRetryBackoff: cfg.Engine.AuditRetry.MaxBackoff,
+			Metrics:         metrics.AuditFS(sc.Name),
+		}, logger.With(zap.String("sink", sc.Name)))
+		if err != nil {
+			return nil, closers, fmt.Errorf("audit sink %q: %w", sc.Name, err)
+		}
+		pipelines = append(pipelines, fs)
+	}
+	return audit.NewFanOut(pipelines...), closers, nil
+}
+
+// newAuditSink создает хранилище событий по типу; PostgreSQL — общий пул шлюза (закрывается отдельно).
+func newAuditSink(ctx context.Context, sc infra.AuditSinkConfig, repo *postgres.AgentRepo,
+	logger *zap.Logger) (audit.StorageInterface, io.Closer, error) {
+	switch sc.Type {
+	case "postgres":
+		return repo, nil, nil
+
+	case "clickhouse":
+		c := sc.ClickHouse
+		tlsCfg, err := newClientTLS(ctx, c.TLS, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := sink.NewClickHouse(sink.ClickHouseOptions{
+			URL: c.URL, Database: c.Database, Table: c.Table,
+			Username: c.Username, Password: c.Password, Timeout: c.Timeout, TLS: tlsCfg,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s, nil
+
+	case "kafka":
+		k := sc.Kafka
+		tlsCfg, err := newClientTLS(ctx, k.TLS, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := sink.NewKafka(sink.KafkaOptions{
+			Brokers: k.Brokers, Topic: k.Topic, ClientID: k.ClientID, Format: k.Format, Timeout: k.Timeout,
+			TLS: tlsCfg, SASLMechanism: k.SASL.Mechanism, Username: k.SASL.Username, Password: k.SASL.Password,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s, nil
+
+	case "file":
+		f := sc.File
+		s, err := sink.NewFile(sink.FileOptions{
+			Dir: f.Dir, Format: f.Format, MaxBytes: f.MaxBytes, MaxAge: f.MaxAge, MaxFiles: f.MaxFiles,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s, nil
+	}
+	return nil, nil, fmt.Errorf("unknown type %q (postgres, clickhouse, kafka, file)", sc.Type)
+}
+
+// newClientTLS — TLS/mTLS исходящих соединений с хранилищами аудита и JWKS консоли (nil — без
+// своего TLS). Имя сервера по умолчанию — хост, к которому подключается клиент (у каждого брокера Kafka свое).
+func newClientTLS(ctx context.Context, tc infra.ClientTLSConfig, logger *zap.Logger) (*tls.Config, error) {
+	if !tc.Enabled {
+		return nil, nil
+	}
+	reloader, err := certs.NewReloader(tc.CertFile, tc.KeyFile, tc.CAFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.Start(ctx, tc.ReloadInterval)
+	return certs.NewClientTLS(reloader, certs.PeerPolicy{ServerName: tc.ServerName}, logger), nil
+}
+
+// newBehaviorConfig переводит секцию engine.behavior в параметры risk.BehaviorMonitor.
+func newBehaviorConfig(c infra.BehaviorConfig) (risk.BehaviorConfig, error) {
+	out := risk.BehaviorConfig{
+		MinSamples:      c.MinSamples,
+		RateMultiplier:  c.RateMultiplier,
+		MinRatePerMin:   c.MinRatePerMin,
+		ErrorRatio:      c.ErrorRatio,
+		ErrorWindow:     c.ErrorWindow,
+		WorkHourStart:   c.WorkHourStart,
+		WorkHourEnd:     c.WorkHourEnd,
+		QuarantineScore: c.QuarantineScore,
+		BlockScore:      c.BlockScore,
+		Cooldown:        c.Cooldown,
+	}
+
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return out, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+		out.Location = loc
+	}
+
+	days := map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+	for _, d := range c.WorkDays {
+		key := strings.ToLower(strings.TrimSpace(d))
+		if len(key) > 3 {
+			key = key[:3] // "monday" -> "mon"
+		}
+		wd, ok := days[key]
+		if !ok {
+			return out, fmt.Errorf("invalid work day %q", d)
+		}
+		out.WorkDays = append(out.WorkDays, wd)
+	}
+	return out, nil
+}
@@ -7,60 +7,183 @@ package audit
 Ключевые особенности архитектуры:
 - Non-blocking Logging: Использование неблокирующих каналов для передачи событий
   из Hot Path шлюза. Это гарантирует, что задержки записи в БД не влияют на Response Time.
-- Batching & Efficiency: Накопление событий в памяти и пакетная запись (Bulk Insert)
-  в PostgreSQL по таймеру или при достижении лимита (100 событий).
+- Batching & Efficiency: Накопление событий в памяти и пакетная запись (COPY)
+  в PostgreSQL по таймеру или при достижении лимита событий либо байт в пакете.
+  Несколько воркеров читают общий канал и пишут пакеты параллельно.
 - Drain Pattern & Graceful Shutdown: Реализован механизм полной вычитки буфера
   при остановке сервиса. С помощью sync.WaitGroup и закрытия каналов гарантируется
   Final Flush — отсутствие потерь данных при перезагрузке системы.
-- Reliability: Устойчивость к кратковременным сбоям БД за счет изоляции воркера
-  и использования контекста Background для завершающих операций.
+- Lossless Delivery: пакет, который не удалось записать, повторяется с экспоненциальной
+  задержкой; если хранилище так и не ответило, пакет уходит в дисковый спул (spool.go).
+  Туда же попадают события при переполнении канала и после начала остановки. Спул
+  воспроизводится в хранилище после первой успешной записи или по таймеру. Событие
+  теряется, только если спул выключен или переполнен (счетчик dropped).
+- Dead Letter: пакет, отклоненный хранилищем окончательно (PermanentError: ошибка данных,
+  HTTP 400), не повторяется, а делится пополам, пока «отравленные» события не останутся
+  по одному. Они откладываются в dead-letter спула (счетчик dead_lettered), остальные
+  записываются, и ни запись, ни воспроизведение спула на них не застревают.
 */
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
 // StorageInterface определяет, куда физически будут сохраняться логи
 type StorageInterface interface {
-	// WriteBatch сохраняет пачку событий за один раз
+	// WriteBatch сохраняет пачку событий за один раз. Повторная запись уже сохраненных
+	// событий (повтор после неоднозначного сбоя, воспроизведение спула) должна их пропускать.
 	WriteBatch(ctx context.Context, events []AuditEvent) error
 }
 
+// PermanentError — хранилище отклонило события окончательно: повтор того же пакета не поможет
+// (ошибка данных или кодирования, HTTP 400). Остальные ошибки записи считаются временными.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent помечает ошибку записи как окончательную; nil остается nil.
+func Permanent(err error) error {
+	if err == nil || IsPermanent(err) {
+		return err
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent — ошибка записи окончательная (см. PermanentError).
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
 type Auditor interface {
 	Log(event AuditEvent)
 }
 
+// AgentFSConfig — пакетная запись и надежность доставки событий в хранилище.
+type AgentFSConfig struct {
+	BufferSize    int           // Емкость канала; при переполнении события уходят в спул
+	BatchSize     int           // Событий в пакете
+	BatchMaxBytes int           // Предел пакета в байтах (JSON событий); 0 — без ограничения
+	FlushInterval time.Duration // Запись неполного пакета не реже этого интервала
+	Workers       int           // Параллельных писателей
+
+	SpoolDir        string        // Каталог дискового спула; пусто — спул выключен (события при сбоях теряются)
+	SpoolMaxBytes   int64         // Предел спула на диске; 0 — без ограничения
+	MaxAttempts     int           // Попыток записи пакета до переноса в спул
+	RetryBackoff    time.Duration // Задержка перед первым повтором, далее удваивается
+	MaxRetryBackoff time.Duration // Предел задержки; с этим же интервалом повторяется воспроизведение спула
+	Metrics         AgentFSMetrics
+}
+
+// AgentFSMetrics — метрики AgentFS (engine.Metrics.AuditFS). Пустая структура — метрики никуда не экспортируются.
+type AgentFSMetrics struct {
+	BufferFill   prometheus.Gauge   // Событий в канале
+	SpoolBytes   prometheus.Gauge   // Размер спула на диске
+	Spooled      prometheus.Counter // Событий, ушедших в спул
+	Dropped      prometheus.Counter // Потерянных событий
+	WriteRetries prometheus.Counter // Повторов записи пакета
+	Replayed     prometheus.Counter // Событий, воспроизведенных из спула
+	DeadLettered prometheus.Counter // Событий, окончательно отклоненных хранилищем и отложенных в dead-letter
+}
+
 type AgentFS struct {
 	ch     chan AuditEvent  // Буфер для асинхронности
-	repo   StorageInterface // Интерфейс для Postgres/ClickHouse
+	repo   StorageInterface // Хранилище: Postgres, ClickHouse, Kafka, файлы (audit/sink)
+	spool  *Spool           // nil — спул выключен
+	cfg    AgentFSConfig
 	logger *zap.Logger
 	wg     sync.WaitGroup
 	// «Железобетонная» защита (Bulletproof) вдруго кто-то вызовет Log случайно после остановки,
 	isClosed int32 // Атомарный флаг (0 - открыт, 1 - закрыт)
+	stopOnce sync.Once
+
+	replayMu   sync.Mutex // Спул воспроизводит один воркер
+	nextReplay time.Time  // Не воспроизводить спул раньше (после неудачи); под replayMu
 }
 
-func NewAgentFS(repo StorageInterface, logger *zap.Logger) *AgentFS {
+// Значения по умолчанию для незаданных полей AgentFSConfig.
+const (
+	defaultBufferSize    = 10000
+	defaultBatchSize     = 100
+	defaultFlushInterval = 500 * time.Millisecond
+)
+
+func NewAgentFS(repo StorageInterface, cfg AgentFSConfig, logger *zap.Logger) (*AgentFS, error) {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Metrics.BufferFill == nil {
+		cfg.Metrics = newLocalAgentFSMetrics()
+	}
 	fs := &AgentFS{
-		ch:     make(chan AuditEvent, 10000), // Очередь на 10к событий
+		ch:     make(chan AuditEvent, cfg.BufferSize),
 		repo:   repo,
+		cfg:    cfg,
 		logger: logger.With(zap.String("mod", "agentfs")),
 		wg:     sync.WaitGroup{},
 	}
-	return fs
+	if cfg.SpoolDir != "" {
+		spool, err := OpenSpool(cfg.SpoolDir, cfg.SpoolMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		fs.spool = spool
+		cfg.Metrics.SpoolBytes.Set(float64(spool.Size()))
+		if spool.Size() > 0 {
+			fs.logger.Warn("audit spool is not empty, events will be replayed", zap.Int64("bytes", spool.Size()))
+		}
+	}
+	return fs, nil
+}
+
+// newLocalAgentFSMetrics — Null Object: метрики без регистрации.
+func newLocalAgentFSMetrics() AgentFSMetrics {
+	return AgentFSMetrics{
+		BufferFill:   prometheus.NewGauge(prometheus.GaugeOpts{Name: "audit_buffer"}),
+		SpoolBytes:   prometheus.NewGauge(prometheus.GaugeOpts{Name: "audit_spool_bytes"}),
+		Spooled:      prometheus.NewCounter(prometheus.CounterOpts{Name: "audit_spooled"}),
+		Dropped:      prometheus.NewCounter(prometheus.CounterOpts{Name: "audit_dropped"}),
+		WriteRetries: prometheus.NewCounter(prometheus.CounterOpts{Name: "audit_write_retries"}),
+		Replayed:     prometheus.NewCounter(prometheus.CounterOpts{Name: "audit_replayed"}),
+		DeadLettered: prometheus.NewCounter(prometheus.CounterOpts{Name: "audit_dead_lettered"}),
+	}
 }
 
 func (fs *AgentFS) Start() {
-	fs.wg.Add(1)
-	go fs.worker()
+	for i := 0; i < fs.cfg.Workers; i++ {
+		fs.wg.Add(1)
+		go fs.worker()
+	}
 }
 
-// Stop «запирает» вход в канал и ждет, пока воркер всё допишет.
+// Stop «запирает» вход в канал и ждет, пока воркер всё допишет. Повторный вызов ничего не делает.
 func (fs *AgentFS) Stop() {
+	fs.stopOnce.Do(fs.stop)
+}
+
+func (fs *AgentFS) stop() {
 	// 1. Сначала ставим флаг
 	atomic.StoreInt32(&fs.isClosed, 1)
 
@@ -70,7 +193,12 @@ func (fs *AgentFS) Stop() {
 	// 3. Закрываем (Drain Pattern). Завершение горутины происходит исключительно через закрытие входного канала.
 	fs.logger.Info("stopping auditor: closing channel and flushing buffer...")
 	close(fs.ch) // 1. Закрываем канал. Новые события больше не принимаются.
-	fs.wg.Wait() // 2. Ждем, пока воркер вычитает остатки из канала и вызовет flush().
+	fs.wg.Wait() // 2. Ждем, пока воркеры вычитают остатки из канала и вызовут flush().
+	if fs.spool != nil {
+		if err := fs.spool.Close(); err != nil {
+			fs.logger.Error("audit spool close failed", zap.Error(err))
+		}
+	}
 	fs.logger.Info("auditor stopped gracefully")
 }
 
@@ -82,7 +210,7 @@ func (fs *AgentFS) Log(event AuditEvent) {
 
 	// Атомарно проверяем, не закрыт ли канал
 	if atomic.LoadInt32(&fs.isClosed) == 1 {
-		fs.logger.Warn("audit event dropped: auditor is stopping", zap.String("id", event.ID))
+		fs.spill("auditor is stopping", event)
 		return
 	}
 
@@ -90,30 +218,160 @@ func (fs *AgentFS) Log(event AuditEvent) {
 	select {
 	case fs.ch <- event:
 	default:
-		// Если канал переполнен (Backpressure), пишем в стандартный логгер
-		// Чтобы не терять данные в критических ситуациях
-		fs.logger.Error("audit_buffer_overflow",
-			zap.String("agent_id", event.AgentID),
-			zap.String("trace_id", event.TraceID),
+		// Если канал переполнен (Backpressure), событие уходит в спул: Hot Path не ждет БД
+		fs.spill("audit buffer overflow", event)
+	}
+}
+
+// spill сохраняет события в спул; без спула или при его ошибке события теряются.
+func (fs *AgentFS) spill(reason string, events ...AuditEvent) {
+	err := errors.New("spool is disabled")
+	if fs.spool != nil {
+		if err = fs.spool.Append(events...); err == nil {
+			fs.cfg.Metrics.Spooled.Add(float64(len(events)))
+			fs.cfg.Metrics.SpoolBytes.Set(float64(fs.spool.Size()))
+			return
+		}
+	}
+
+	fs.drop(reason, err, events...)
+}
+
+// drop учитывает потерянные события. Последний рубеж: их идентификаторы остаются хотя бы в логе шлюза.
+func (fs *AgentFS) drop(reason string, err error, events ...AuditEvent) {
+	fs.cfg.Metrics.Dropped.Add(float64(len(events)))
+	for _, e := range events {
+		fs.logger.Error("audit event dropped",
+			zap.String("reason", reason),
+			zap.String("id", e.ID),
+			zap.String("agent_id", e.AgentID),
+			zap.String("trace_id", e.TraceID),
+			zap.Error(err),
 		)
 	}
 }
 
+// deadLetter откладывает событие, окончательно отклоненное хранилищем, в dead-letter спула.
+func (fs *AgentFS) deadLetter(event AuditEvent, cause error) {
+	if fs.spool == nil {
+		fs.drop("rejected by storage, spool is disabled", cause, event)
+		return
+	}
+	if err := fs.spool.DeadLetter(cause, event); err != nil {
+		fs.drop("rejected by storage, dead-letter failed", errors.Join(cause, err), event)
+		return
+	}
+	fs.cfg.Metrics.DeadLettered.Inc()
+	fs.logger.Error("audit event rejected by storage, moved to dead-letter",
+		zap.String("id", event.ID),
+		zap.String("agent_id", event.AgentID),
+		zap.String("trace_id", event.TraceID),
+		zap.Error(cause),
+	)
+}
+
+// deliver записывает пакет через write. Пакет, отклоненный окончательно, делится пополам,
+// пока отклоненные события не останутся по одному — они уходят в dead-letter.
+// При временной ошибке возвращает ее и незаписанный хвост пакета.
+func (fs *AgentFS) deliver(batch []AuditEvent, write func([]AuditEvent) error) ([]AuditEvent, error) {
+	err := write(batch)
+	switch {
+	case err == nil:
+		return nil, nil
+	case !IsPermanent(err):
+		return batch, err
+	case len(batch) == 1:
+		fs.deadLetter(batch[0], err)
+		return nil, nil
+	}
+	mid := len(batch) / 2
+	if rest, err := fs.deliver(batch[:mid], write); err != nil {
+		return batch[mid-len(rest):], err // rest — всегда хвост переданного пакета
+	}
+	return fs.deliver(batch[mid:], write)
+}
+
+// write записывает пакет, повторяя с экспоненциальной задержкой (final — одна попытка: идет остановка).
+func (fs *AgentFS) write(batch []AuditEvent, final bool) error {
+	attempts := fs.cfg.MaxAttempts
+	if final {
+		attempts = 1
+	}
+	backoff := fs.cfg.RetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		// Используем Background, так как основной контекст может быть уже закрыт
+		err = fs.repo.WriteBatch(context.Background(), batch)
+		if err == nil || IsPermanent(err) || attempt >= attempts {
+			return err
+		}
+		fs.cfg.Metrics.WriteRetries.Inc()
+		fs.logger.Warn("audit flush failed, retrying",
+			zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		time.Sleep(backoff)
+		if backoff = 2 * backoff; backoff > fs.cfg.MaxRetryBackoff {
+			backoff = fs.cfg.MaxRetryBackoff
+		}
+	}
+}
+
+// replay дописывает спул в хранилище; после неудачи следующая попытка — не раньше MaxRetryBackoff.
+// Если спул уже воспроизводит другой воркер, возвращается сразу.
+func (fs *AgentFS) replay() {
+	if fs.spool == nil || fs.spool.Size() == 0 || !fs.replayMu.TryLock() {
+		return
+	}
+	defer fs.replayMu.Unlock()
+	if time.Now().Before(fs.nextReplay) {
+		return
+	}
+	n, skipped, err := fs.spool.Replay(fs.cfg.BatchSize, func(events []AuditEvent) error {
+		// Отклоненные события уходят в dead-letter, и воспроизведение идет дальше;
+		// временная ошибка оставляет сегмент в спуле до следующей попытки
+		_, err := fs.deliver(events, func(b []AuditEvent) error {
+			return fs.repo.WriteBatch(context.Background(), b)
+		})
+		return err
+	})
+	fs.cfg.Metrics.Replayed.Add(float64(n))
+	fs.cfg.Metrics.SpoolBytes.Set(float64(fs.spool.Size()))
+	if skipped > 0 {
+		fs.cfg.Metrics.Dropped.Add(float64(skipped))
+		fs.logger.Error("audit spool: unreadable lines skipped", zap.Int("lines", skipped))
+	}
+	if err != nil {
+		fs.nextReplay = time.Now().Add(fs.cfg.MaxRetryBackoff)
+		fs.logger.Warn("audit spool replay failed", zap.Int("replayed", n), zap.Error(err))
+		return
+	}
+	fs.nextReplay = time.Time{}
+	if n > 0 {
+		fs.logger.Info("audit spool replayed", zap.Int("events", n))
+	}
+}
+
 func (fs *AgentFS) worker() {
 	defer fs.wg.Done()
 
-	batch := make([]AuditEvent, 0, 100)
-	ticker := time.NewTicker(500 * time.Millisecond)
+	batch := make([]AuditEvent, 0, fs.cfg.BatchSize)
+	batchBytes := 0
+	ticker := time.NewTicker(fs.cfg.FlushInterval)
 	defer ticker.Stop()
 
-	flush := func() {
-		if len(batch) > 0 {
-			// Используем Background, так как основной контекст может быть уже закрыт
-			if err := fs.repo.WriteBatch(context.Background(), batch); err != nil {
-				fs.logger.Error("audit flush failed", zap.Error(err))
-			}
-			batch = batch[:0]
+	flush := func(final bool) {
+		fs.cfg.Metrics.BufferFill.Set(float64(len(fs.ch)))
+		if len(batch) == 0 {
+			return
+		}
+		rest, err := fs.deliver(batch, func(b []AuditEvent) error { return fs.write(b, final) })
+		if err != nil {
+			fs.logger.Error("audit flush failed, spooling batch", zap.Int("events", len(rest)), zap.Error(err))
+			fs.spill("audit flush failed", rest...)
+		} else if !final {
+			fs.replay() // Хранилище доступно: самое время дописать спул
 		}
+		batch = batch[:0]
+		batchBytes = 0
 	}
 
 	for {
@@ -125,16 +383,30 @@ func (fs *AgentFS) worker() {
 				//		Сначала вычитает всё, что осталось в очереди.
 				//		Только потом получит ok == false.
 				//		Вызовет финальный flush() и выйдет.
-				flush() // Финальный сброс
+				flush(true) // Финальный сброс
 				fs.logger.Info("audit worker finished")
 				return
 			}
+			if fs.cfg.BatchMaxBytes > 0 {
+				size := eventSize(event)
+				// Событие, не влезающее в текущий пакет, начинает следующий
+				if len(batch) > 0 && batchBytes+size > fs.cfg.BatchMaxBytes {
+					flush(false)
+				}
+				batchBytes += size
+			}
 			batch = append(batch, event)
-			if len(batch) >= 100 {
-				flush()
+			if len(batch) >= fs.cfg.BatchSize || (fs.cfg.BatchMaxBytes > 0 && batchBytes >= fs.cfg.BatchMaxBytes) {
+				flush(false)
 			}
 		case <-ticker.C:
-			flush()
+			flush(false)
+			fs.replay()
+			if fs.spool != nil {
+				if err := fs.spool.Sync(); err != nil {
+					fs.logger.Error("audit spool sync failed", zap.Error(err))
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,310 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// fakeStorage — хранилище, которое окончательно отклоняет пакеты с «отравленными» событиями
+// и временно недоступно, пока down == true.
+type fakeStorage struct {
+	mu     sync.Mutex
+	down   bool
+	poison map[string]bool
+	stored map[string]bool
+	calls  int
+}
+
+func newFakeStorage(poison ...string) *fakeStorage {
+	f := &fakeStorage{poison: map[string]bool{}, stored: map[string]bool{}}
+	for _, id := range poison {
+		f.poison[id] = true
+	}
+	return f
+}
+
+func (f *fakeStorage) WriteBatch(_ context.Context, events []AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.down {
+		return errors.New("connection refused")
+	}
+	for _, e := range events {
+		if f.poison[e.ID] {
+			return Permanent(errors.New("invalid input syntax for type uuid"))
+		}
+	}
+	for _, e := range events {
+		f.stored[e.ID] = true
+	}
+	return nil
+}
+
+func (f *fakeStorage) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+func (f *fakeStorage) storedIDs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for id := range f.stored {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func testAgentFS(t *testing.T, repo StorageInterface, dir string, batchSize int) *AgentFS {
+	t.Helper()
+	fs, err := NewAgentFS(repo, AgentFSConfig{
+		BatchSize:       batchSize,
+		FlushInterval:   5 * time.Millisecond,
+		SpoolDir:        dir,
+		MaxAttempts:     2,
+		RetryBackoff:    time.Millisecond,
+		MaxRetryBackoff: 5 * time.Millisecond,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func readDeadLetter(t *testing.T, dir string) []DeadLetterRecord {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, spoolDeadLetter))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []DeadLetterRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec DeadLetterRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func events(ids ...string) []AuditEvent {
+	out := make([]AuditEvent, len(ids))
+	for i, id := range ids {
+		out[i] = AuditEvent{ID: id, AgentID: "agent-1", Timestamp: time.Now()}
+	}
+	return out
+}
+
+func TestAgentFSPoisonedEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		spoolFirst bool // Сначала хранилище недоступно: пакет с ядом уходит в спул и воспроизводится
+	}{
+		{name: "live batch"},
+		{name: "spool replay", spoolFirst: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			repo := newFakeStorage("e3")
+			repo.setDown(tt.spoolFirst)
+			fs := testAgentFS(t, repo, dir, 5)
+			fs.Start()
+
+			for _, e := range events("e1", "e2", "e3", "e4", "e5") {
+				fs.Log(e)
+			}
+			if tt.spoolFirst {
+				waitFor(t, func() bool { return fs.spool.Size() > 0 })
+				repo.setDown(false)
+			}
+			waitFor(t, func() bool { return len(repo.storedIDs()) == 4 })
+			if tt.spoolFirst {
+				waitFor(t, func() bool { return fs.spool.Size() == 0 })
+			}
+			fs.Stop()
+
+			if got := repo.storedIDs(); len(got) != 4 || got[2] != "e4" {
+				t.Fatalf("stored = %v, want all but e3", got)
+			}
+			dl := readDeadLetter(t, dir)
+			if len(dl) != 1 || dl[0].Event.ID != "e3" || dl[0].Error == "" {
+				t.Fatalf("dead-letter = %+v, want e3 with reason", dl)
+			}
+			if n := counterValue(t, fs.cfg.Metrics.DeadLettered); n != 1 {
+				t.Errorf("dead_lettered = %v, want 1", n)
+			}
+			if n := counterValue(t, fs.cfg.Metrics.Dropped); n != 0 {
+				t.Errorf("dropped = %v, want 0", n)
+			}
+		})
+	}
+}
+
+// Отравленное событие в старом сегменте не должно блокировать воспроизведение следующих.
+func TestAgentFSReplayContinuesPastPoisonedSegment(t *testing.T) {
+	dir := t.TempDir()
+	for _, batch := range [][]AuditEvent{events("a1", "bad", "a2"), events("b1", "b2")} {
+		s, err := OpenSpool(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Append(batch...); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := newFakeStorage("bad")
+	fs := testAgentFS(t, repo, dir, 10)
+	fs.Start()
+	waitFor(t, func() bool { return len(repo.storedIDs()) == 4 })
+	fs.Stop()
+
+	segments, err := fs.spool.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("segments left: %v", segments)
+	}
+	if dl := readDeadLetter(t, dir); len(dl) != 1 || dl[0].Event.ID != "bad" {
+		t.Errorf("dead-letter = %+v, want bad", dl)
+	}
+}
+
+// Временная ошибка не должна уводить события в dead-letter: пакет ждет в спуле.
+func TestAgentFSTransientErrorSpools(t *testing.T) {
+	dir := t.TempDir()
+	repo := newFakeStorage()
+	repo.setDown(true)
+	fs := testAgentFS(t, repo, dir, 2)
+	fs.Start()
+	for _, e := range events("e1", "e2") {
+		fs.Log(e)
+	}
+	waitFor(t, func() bool { return fs.spool.Size() > 0 })
+	fs.Stop()
+
+	if dl := readDeadLetter(t, dir); len(dl) != 0 {
+		t.Fatalf("dead-letter = %+v, want empty", dl)
+	}
+	if n := counterValue(t, fs.cfg.Metrics.Spooled); n != 2 {
+		t.Errorf("spooled = %v, want 2", n)
+	}
+}
+
+// batchRecorder запоминает состав пакетов.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (r *batchRecorder) WriteBatch(_ context.Context, events []AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	r.batches = append(r.batches, ids)
+	return nil
+}
+
+func TestAgentFSBatchMaxBytes(t *testing.T) {
+	// Событие с note из n символов; размеры считаются так же, как в воркере
+	event := func(id string, n int) AuditEvent {
+		return AuditEvent{ID: id, Payload: map[string]interface{}{"note": strings.Repeat("x", n)}, Timestamp: time.Unix(0, 0).UTC()}
+	}
+	small := eventSize(event("a", 100))
+
+	tests := []struct {
+		name     string
+		maxBytes int
+		events   []AuditEvent
+		want     [][]string
+	}{
+		{name: "no limit", events: []AuditEvent{event("a", 100), event("b", 100), event("c", 100)}, want: [][]string{{"a", "b", "c"}}},
+		{
+			name:     "next event starts new batch",
+			maxBytes: 2*small + 10,
+			events:   []AuditEvent{event("a", 100), event("b", 100), event("c", 100)},
+			want:     [][]string{{"a", "b"}, {"c"}},
+		},
+		{
+			name:     "oversized event goes alone",
+			maxBytes: 2*small + 10,
+			events:   []AuditEvent{event("a", 100), event("big", 10_000), event("c", 100)},
+			want:     [][]string{{"a"}, {"big"}, {"c"}},
+		},
+		{
+			name:     "batch flushed when limit is reached",
+			maxBytes: 2 * small,
+			events:   []AuditEvent{event("a", 100), event("b", 100), event("c", 100)},
+			want:     [][]string{{"a", "b"}, {"c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &batchRecorder{}
+			fs, err := NewAgentFS(rec, AgentFSConfig{BatchSize: 100, BatchMaxBytes: tt.maxBytes, FlushInterval: time.Hour}, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range tt.events {
+				fs.Log(e)
+			}
+			fs.Start()
+			fs.Stop()
+
+			if !reflect.DeepEqual(rec.batches, tt.want) {
+				t.Errorf("batches = %v, want %v", rec.batches, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package audit
+
+/*
+Файл archive.go пишет и читает архивы партиций audit_logs: gzip NDJSON, одна строка —
+один ChainRecord со всеми колонками, включая поля цепочки хешей. Архив переносит строки
+без потерь: после восстановления hash каждой строки сходится с ее содержимым.
+
+Файл пишется во временный *.tmp и переименовывается после успешного закрытия, поэтому
+неполный архив (сбой посреди записи) никогда не выглядит готовым.
+*/
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Archive — метаданные архива партиции (таблица audit_archives).
+type Archive struct {
+	Partition  string     `json:"partition"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Path       string     `json:"path"`
+	Rows       int64      `json:"rows"`
+	SHA256     string     `json:"sha256"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RestoredAt *time.Time `json:"restored_at,omitempty"` // Восстановлен и удерживается от удаления
+}
+
+// ErrArchiveChecksum — содержимое файла не совпадает с записанной при архивации суммой.
+var ErrArchiveChecksum = errors.New("audit: archive checksum mismatch")
+
+// ArchivePath — путь к архиву партиции в каталоге dir.
+func ArchivePath(dir, partition string) string {
+	return filepath.Join(dir, partition+".ndjson.gz")
+}
+
+// ArchiveWriter записывает строки партиции в архив.
+type ArchiveWriter struct {
+	meta *Archive
+	file *os.File
+	sum  hash.Hash
+	buf  *bufio.Writer
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// NewArchiveWriter создает архив партиции p в каталоге dir.
+func NewArchiveWriter(dir string, p Partition) (*ArchiveWriter, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("audit: archive dir: %w", err)
+	}
+	path := ArchivePath(dir, p.Name)
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("audit: archive file: %w", err)
+	}
+	w := &ArchiveWriter{
+		meta: &Archive{Partition: p.Name, From: p.From, To: p.To, Path: path},
+		file: f,
+		sum:  sha256.New(),
+	}
+	w.buf = bufio.NewWriter(io.MultiWriter(f, w.sum))
+	w.gz = gzip.NewWriter(w.buf)
+	w.enc = json.NewEncoder(w.gz)
+	return w, nil
+}
+
+// Write добавляет строку партиции.
+func (w *ArchiveWriter) Write(rec *ChainRecord) error {
+	if err := w.enc.Encode(rec); err != nil {
+		return fmt.Errorf("audit: archive write: %w", err)
+	}
+	w.meta.Rows++
+	return nil
+}
+
+// Close дописывает архив на диск (fsync) и публикует его под итоговым именем.
+func (w *ArchiveWriter) Close() (*Archive, error) {
+	err := errors.Join(w.gz.Close(), w.buf.Flush(), w.file.Sync(), w.file.Close())
+	if err == nil {
+		err = os.Rename(w.file.Name(), w.meta.Path)
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return nil, fmt.Errorf("audit: archive close: %w", err)
+	}
+	w.meta.SHA256 = hex.EncodeToString(w.sum.Sum(nil))
+	w.meta.CreatedAt = time.Now().UTC()
+	return w.meta, nil
+}
+
+// Abort удаляет незавершенный архив.
+func (w *ArchiveWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// ReadArchive передает строки архива в fn. Если wantSHA256 задан, сумма файла сверяется
+// до чтения строк: поврежденный или подмененный архив не восстанавливается даже частично.
+func ReadArchive(path, wantSHA256 string, fn func(*ChainRecord) error) error {
+	if wantSHA256 != "" {
+		got, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		if got != wantSHA256 {
+			return fmt.Errorf("%w: %s", ErrArchiveChecksum, path)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("audit: archive open: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("audit: archive %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	for {
+		rec := &ChainRecord{}
+		if err := dec.Decode(rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("audit: archive %s: %w", path, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("audit: archive open: %w", err)
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", fmt.Errorf("audit: archive read: %w", err)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
@@ -0,0 +1,268 @@
+package audit
+
+/*
+Файл chain.go реализует цепочку хешей журнала аудита (tamper-evident log).
+
+Каждое событие партиции цепочки (обычно — инстанс шлюза) получает порядковый номер
+chain_seq и hash = SHA-256(prev_hash || каноническое представление события). Изменение
+строки ломает ее hash, удаление — непрерывность chain_seq, а переписывание хвоста целиком
+выявляется подписанными контрольными точками: консоль периодически подписывает голову
+каждой партиции своим закрытым ключом (RS256). Чтобы подпись контрольной точки нельзя было
+предъявить как токен доступа, у нее свой typ, своя аудитория, свой kid (с префиксом audit-)
+и нет exp — auth.BaseValidator отклоняет ее по каждому из этих признаков.
+
+Каноническое представление строится из значений в том виде, в каком они лежат в БД:
+JSONB переупорядочивает ключи и меняет пробелы, поэтому JSON-поля нормализуются
+(decode + encode, ключи по алфавиту), время — UTC с точностью до микросекунды.
+*/
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+)
+
+// GenesisHash — prev_hash первого события партиции.
+var GenesisHash = strings.Repeat("0", 64)
+
+// ChainRecord — поля события, покрываемые хешем, в том виде, в каком они хранятся в audit_logs.
+// Он же — строка архива партиции: восстановление из архива возвращает строки без изменений.
+type ChainRecord struct {
+	Partition string `json:"chain_partition,omitempty"`
+	Seq       int64  `json:"chain_seq,omitempty"`
+	PrevHash  string `json:"prev_hash,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+
+	ID            string          `json:"id"`
+	TraceID       string          `json:"trace_id"`
+	AgentID       string          `json:"agent_id"`
+	CapabilityID  string          `json:"capability_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Mode          string          `json:"mode"`
+	Status        string          `json:"status"`
+	Response      json.RawMessage `json:"response"`
+	DurationMs    int64           `json:"duration_ms"`
+	Timestamp     time.Time       `json:"timestamp"`
+	RiskScore     int             `json:"risk_score"`
+	RiskFindings  json.RawMessage `json:"risk_findings"`
+	PolicyID      string          `json:"policy_id,omitempty"`
+	PolicyVersion int             `json:"policy_version"`
+	BreakGlass    bool            `json:"break_glass"`
+}
+
+// NewChainRecord готовит событие к записи: JSON-поля сериализуются, время усекается до точности БД.
+func NewChainRecord(e AuditEvent) (*ChainRecord, error) {
+	payload, err := json.Marshal(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("audit: payload: %w", err)
+	}
+	resp, err := json.Marshal(e.Response)
+	if err != nil {
+		return nil, fmt.Errorf("audit: response: %w", err)
+	}
+	findings, err := json.Marshal(e.RiskFindings)
+	if err != nil {
+		return nil, fmt.Errorf("audit: risk findings: %w", err)
+	}
+	return &ChainRecord{
+		ID:            e.ID,
+		TraceID:       e.TraceID,
+		AgentID:       e.AgentID,
+		CapabilityID:  e.CapabilityID,
+		Payload:       payload,
+		Mode:          e.Mode,
+		Status:        e.Status,
+		Response:      resp,
+		DurationMs:    e.DurationMs,
+		Timestamp:     e.Timestamp.UTC().Truncate(time.Microsecond),
+		RiskScore:     e.RiskScore,
+		RiskFindings:  findings,
+		PolicyID:      e.PolicyID,
+		PolicyVersion: e.PolicyVersion,
+		BreakGlass:    e.BreakGlass,
+	}, nil
+}
+
+// Link присоединяет запись к цепочке после (seq, hash) предыдущего события.
+func (r *ChainRecord) Link(partition string, prevSeq int64, prevHash string) error {
+	r.Partition, r.Seq, r.PrevHash = partition, prevSeq+1, prevHash
+	h, err := r.ComputeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = h
+	return nil
+}
+
+// ComputeHash вычисляет hash записи по ее полям и PrevHash (поле Hash не участвует).
+func (r *ChainRecord) ComputeHash() (string, error) {
+	doc, err := r.canonical()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	sum.Write([]byte(r.PrevHash))
+	sum.Write([]byte{'\n'})
+	sum.Write(doc)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func (r *ChainRecord) canonical() ([]byte, error) {
+	payload, err := canonicalJSON(r.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("audit: payload of %s: %w", r.ID, err)
+	}
+	resp, err := canonicalJSON(r.Response)
+	if err != nil {
+		return nil, fmt.Errorf("audit: response of %s: %w", r.ID, err)
+	}
+	findings, err := canonicalJSON(r.RiskFindings)
+	if err != nil {
+		return nil, fmt.Errorf("audit: risk findings of %s: %w", r.ID, err)
+	}
+	// Порядок полей фиксирован структурой; UUID в Postgres всегда в нижнем регистре
+	return json.Marshal(struct {
+		Partition     string          `json:"partition"`
+		Seq           int64           `json:"seq"`
+		ID            string          `json:"id"`
+		TraceID       string          `json:"trace_id"`
+		AgentID       string          `json:"agent_id"`
+		CapabilityID  string          `json:"capability_id"`
+		Payload       json.RawMessage `json:"payload"`
+		Mode          string          `json:"mode"`
+		Status        string          `json:"status"`
+		Response      json.RawMessage `json:"response"`
+		DurationMs    int64           `json:"duration_ms"`
+		Timestamp     string          `json:"timestamp"`
+		RiskScore     int             `json:"risk_score"`
+		RiskFindings  json.RawMessage `json:"risk_findings"`
+		PolicyID      string          `json:"policy_id"`
+		PolicyVersion int             `json:"policy_version"`
+		BreakGlass    bool            `json:"break_glass"`
+	}{
+		Partition:     r.Partition,
+		Seq:           r.Seq,
+		ID:            strings.ToLower(r.ID),
+		TraceID:       strings.ToLower(r.TraceID),
+		AgentID:       strings.ToLower(r.AgentID),
+		CapabilityID:  r.CapabilityID,
+		Payload:       payload,
+		Mode:          r.Mode,
+		Status:        r.Status,
+		Response:      resp,
+		DurationMs:    r.DurationMs,
+		Timestamp:     r.Timestamp.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		RiskScore:     r.RiskScore,
+		RiskFindings:  findings,
+		PolicyID:      r.PolicyID,
+		PolicyVersion: r.PolicyVersion,
+		BreakGlass:    r.BreakGlass,
+	})
+}
+
+// canonicalJSON нормализует JSON: порядок ключей, пробелы и запись чисел перестают зависеть от JSONB.
+func canonicalJSON(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("null"), nil // SQL NULL и JSON null неразличимы для цепочки
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// ChainHead — последнее событие партиции (таблица audit_chain_heads).
+type ChainHead struct {
+	Partition string    `json:"partition"`
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Checkpoint — подписанная консолью голова партиции на момент CreatedAt.
+type Checkpoint struct {
+	ID        int64     `json:"id"`
+	Partition string    `json:"partition"`
+	Seq       int64     `json:"seq"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	KeyID     string    `json:"key_id"`
+	Signature string    `json:"signature"` // Компактный JWS (RS256) с полями контрольной точки
+}
+
+// Отличительные признаки подписи контрольной точки (см. описание файла).
+const (
+	CheckpointType        = "audit-checkpoint+jwt"
+	CheckpointAudience    = "spaceai-audit"
+	checkpointKeyIDPrefix = "audit-"
+)
+
+// checkpointClaims — подписываемое содержимое контрольной точки.
+type checkpointClaims struct {
+	Partition string `json:"partition"`
+	Seq       int64  `json:"seq"`
+	Hash      string `json:"hash"`
+	jwt.RegisteredClaims
+}
+
+// ErrCheckpointInvalid — подпись контрольной точки не проверяется или не совпадает с ее полями.
+var ErrCheckpointInvalid = errors.New("audit: checkpoint signature is invalid")
+
+// SignCheckpoint подписывает контрольную точку закрытым ключом консоли (заполняет KeyID и Signature).
+func SignCheckpoint(key *rsa.PrivateKey, cp *Checkpoint) error {
+	cp.KeyID = checkpointKeyIDPrefix + auth.KeyID(&key.PublicKey)
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, checkpointClaims{
+		Partition: cp.Partition,
+		Seq:       cp.Seq,
+		Hash:      cp.Hash,
+		// exp нет намеренно: контрольная точка проверяется и через годы
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{CheckpointAudience},
+			IssuedAt: jwt.NewNumericDate(cp.CreatedAt),
+		},
+	})
+	tok.Header["typ"] = CheckpointType
+	tok.Header["kid"] = cp.KeyID
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		return fmt.Errorf("audit: failed to sign checkpoint: %w", err)
+	}
+	cp.Signature = signed
+	return nil
+}
+
+// PublicKeys — открытые ключи консоли по kid (auth.KeySet или auth.JWKSClient).
+type PublicKeys interface {
+	PublicKey(kid string) (*rsa.PublicKey, error)
+}
+
+// VerifyCheckpoint проверяет подпись и то, что подписаны именно поля cp (а не другой строки).
+func VerifyCheckpoint(keys PublicKeys, cp Checkpoint) error {
+	var claims checkpointClaims
+	_, err := jwt.ParseWithClaims(cp.Signature, &claims, func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); typ != CheckpointType {
+			return nil, fmt.Errorf("unexpected typ %q", typ)
+		}
+		kid, _ := t.Header["kid"].(string)
+		if !strings.HasPrefix(kid, checkpointKeyIDPrefix) {
+			return nil, fmt.Errorf("unexpected kid %q", kid)
+		}
+		return keys.PublicKey(strings.TrimPrefix(kid, checkpointKeyIDPrefix))
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithAudience(CheckpointAudience))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCheckpointInvalid, err)
+	}
+	if claims.Partition != cp.Partition || claims.Seq != cp.Seq || claims.Hash != cp.Hash {
+		return fmt.Errorf("%w: signed %s#%d, stored %s#%d", ErrCheckpointInvalid, claims.Partition, claims.Seq, cp.Partition, cp.Seq)
+	}
+	return nil
+}
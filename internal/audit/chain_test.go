@@ -0,0 +1,351 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+)
+
+func testSigningKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// memChain — ChainSource в памяти.
+type memChain struct {
+	records     []*ChainRecord
+	checkpoints []Checkpoint
+	anchor      *Checkpoint
+	pruned      []Checkpoint
+}
+
+func (m *memChain) StreamChain(_ context.Context, _ string, fn func(*ChainRecord) error) error {
+	for _, r := range m.records {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memChain) ListCheckpoints(context.Context, string) ([]Checkpoint, error) {
+	return m.checkpoints, nil
+}
+
+func (m *memChain) ChainAnchor(context.Context, string) (*Checkpoint, error) { return m.anchor, nil }
+
+func (m *memChain) PrunedLinks(context.Context, string) ([]Checkpoint, error) { return m.pruned, nil }
+
+// buildChain связывает n событий в партиции p1.
+func buildChain(t *testing.T, n int) []*ChainRecord {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var out []*ChainRecord
+	prevSeq, prevHash := int64(0), GenesisHash
+	for i := 0; i < n; i++ {
+		rec, err := NewChainRecord(AuditEvent{
+			ID:           fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1),
+			AgentID:      "agent-1",
+			CapabilityID: "crm.read",
+			Payload:      map[string]any{"n": i},
+			Status:       "SUCCESS",
+			Timestamp:    base.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Link("p1", prevSeq, prevHash); err != nil {
+			t.Fatal(err)
+		}
+		prevSeq, prevHash = rec.Seq, rec.Hash
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestCheckpointSignature(t *testing.T) {
+	key := testSigningKey(t)
+	keys := auth.NewKeySet(&key.PublicKey)
+
+	cp := Checkpoint{Partition: "p1", Seq: 7, Hash: "abc", CreatedAt: time.Now()}
+	if err := SignCheckpoint(key, &cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCheckpoint(keys, cp); err != nil {
+		t.Fatalf("VerifyCheckpoint() = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*Checkpoint)
+	}{
+		{"other seq", func(c *Checkpoint) { c.Seq = 8 }},
+		{"other hash", func(c *Checkpoint) { c.Hash = "abd" }},
+		{"other partition", func(c *Checkpoint) { c.Partition = "p2" }},
+		{"foreign key", func(c *Checkpoint) {
+			if err := SignCheckpoint(testSigningKey(t), c); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cp
+			tt.mutate(&c)
+			if err := VerifyCheckpoint(keys, c); !errors.Is(err, ErrCheckpointInvalid) {
+				t.Fatalf("VerifyCheckpoint() = %v, want ErrCheckpointInvalid", err)
+			}
+		})
+	}
+}
+
+// Подпись контрольной точки сделана ключом консоли, но не должна проходить как токен доступа.
+func TestCheckpointIsNotAccessToken(t *testing.T) {
+	key := testSigningKey(t)
+	cp := Checkpoint{Partition: "p1", Seq: 1, Hash: "abc", CreatedAt: time.Now()}
+	if err := SignCheckpoint(key, &cp); err != nil {
+		t.Fatal(err)
+	}
+	for _, aud := range []string{domain.AudienceGateway, domain.AudienceConsole, CheckpointAudience} {
+		v := auth.NewBaseValidator(auth.NewKeySet(&key.PublicKey), nil, aud)
+		if _, err := v.VerifyToken(cp.Signature); err == nil {
+			t.Errorf("checkpoint accepted as token with audience %s", aud)
+		}
+	}
+}
+
+func TestVerifyPartition(t *testing.T) {
+	key := testSigningKey(t)
+	keys := auth.NewKeySet(&key.PublicKey)
+	sign := func(rec *ChainRecord) Checkpoint {
+		cp := Checkpoint{ID: rec.Seq, Partition: rec.Partition, Seq: rec.Seq, Hash: rec.Hash, CreatedAt: time.Now()}
+		if err := SignCheckpoint(key, &cp); err != nil {
+			t.Fatal(err)
+		}
+		return cp
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(m *memChain) int64 // Возвращает head.Seq
+		want   []string
+	}{
+		{
+			name:   "intact",
+			mutate: func(m *memChain) int64 { return 5 },
+		},
+		{
+			name: "modified payload",
+			mutate: func(m *memChain) int64 {
+				m.records[2].Payload = json.RawMessage(`{"n":100}`)
+				return 5
+			},
+			want: []string{ProblemModified},
+		},
+		{
+			name: "rewritten row with recomputed hash",
+			mutate: func(m *memChain) int64 {
+				m.records[2].Payload = json.RawMessage(`{"n":100}`)
+				m.records[2].Hash, _ = m.records[2].ComputeHash()
+				return 5
+			},
+			want: []string{ProblemBrokenLink},
+		},
+		{
+			name: "deleted row",
+			mutate: func(m *memChain) int64 {
+				m.records = append(m.records[:2], m.records[3:]...)
+				return 5
+			},
+			want: []string{ProblemGap},
+		},
+		{
+			name: "truncated tail",
+			mutate: func(m *memChain) int64 {
+				m.records = m.records[:3]
+				return 5
+			},
+			want: []string{ProblemTruncated},
+		},
+		{
+			name: "tail rewritten past checkpoint",
+			mutate: func(m *memChain) int64 {
+				m.checkpoints = []Checkpoint{sign(m.records[3])}
+				rebuilt := buildChain(t, 5)
+				rebuilt[3].Status = "FAILED"
+				rebuilt[3].Hash, _ = rebuilt[3].ComputeHash()
+				rebuilt[4].PrevHash = rebuilt[3].Hash
+				rebuilt[4].Hash, _ = rebuilt[4].ComputeHash()
+				m.records = rebuilt
+				return 5
+			},
+			want: []string{ProblemCheckpointMismatch},
+		},
+		{
+			name: "forged checkpoint",
+			mutate: func(m *memChain) int64 {
+				cp := sign(m.records[1])
+				cp.Hash = m.records[2].Hash
+				m.checkpoints = []Checkpoint{cp}
+				return 5
+			},
+			want: []string{ProblemCheckpointInvalid},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &memChain{records: buildChain(t, 5)}
+			head := ChainHead{Partition: "p1", Seq: tt.mutate(m)}
+			rep, err := VerifyPartition(context.Background(), m, keys, head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range rep.Problems {
+				got = append(got, p.Kind)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("problems = %v, want %v (%+v)", got, tt.want, rep.Problems)
+			}
+		})
+	}
+}
+
+// expire повторяет postgres.ExpireAuditPartition для партиции хранения, в которой лежат события drop.
+func (m *memChain) expire(t *testing.T, key *rsa.PrivateKey, drop ...int64) {
+	t.Helper()
+	dropSet := make(map[int64]bool, len(drop))
+	for _, seq := range drop {
+		dropSet[seq] = true
+	}
+	var anchorSeq, retainedSeq int64
+	if m.anchor != nil {
+		anchorSeq = m.anchor.Seq
+	}
+	var dropped []ChainLink
+	var kept []*ChainRecord
+	for _, rec := range m.records {
+		switch {
+		case dropSet[rec.Seq]:
+			if rec.Seq > anchorSeq {
+				dropped = append(dropped, ChainLink{Seq: rec.Seq, Hash: rec.Hash})
+			}
+		default:
+			kept = append(kept, rec)
+			if rec.Seq > anchorSeq && (retainedSeq == 0 || rec.Seq < retainedSeq) {
+				retainedSeq = rec.Seq
+			}
+		}
+	}
+	pruned := make(map[int64]string)
+	for _, l := range m.pruned {
+		pruned[l.Seq] = l.Hash
+	}
+
+	plan := PlanAnchor("p1", anchorSeq, dropped, pruned, retainedSeq)
+	if plan.Anchor != nil {
+		if err := SignCheckpoint(key, plan.Anchor); err != nil {
+			t.Fatal(err)
+		}
+		m.anchor = plan.Anchor
+		var rest []Checkpoint
+		for _, l := range m.pruned {
+			if l.Seq > m.anchor.Seq {
+				rest = append(rest, l)
+			}
+		}
+		m.pruned = rest
+	}
+	for _, l := range plan.Pruned {
+		if err := SignCheckpoint(key, &l); err != nil {
+			t.Fatal(err)
+		}
+		m.pruned = append(m.pruned, l)
+	}
+	m.records = kept
+}
+
+// Номера цепочки и партиции хранения перемежаются: проверка после удаления по сроку
+// не должна пропускать оставшиеся строки ниже удаленных номеров и сообщать о них gap.
+func TestVerifyAfterRetention(t *testing.T) {
+	key := testSigningKey(t)
+	keys := auth.NewKeySet(&key.PublicKey)
+
+	tests := []struct {
+		name        string
+		expire      [][]int64 // События каждой удаляемой партиции хранения, по очереди
+		mutate      func(m *memChain)
+		want        []string
+		wantEvents  int64
+		wantPruned  int64
+		wantAnchor  int64
+		wantSkipped int64
+	}{
+		{name: "interleaved", expire: [][]int64{{1, 2, 4}}, wantEvents: 3, wantPruned: 1, wantAnchor: 2},
+		{name: "dropped tail", expire: [][]int64{{1, 2, 6}}, wantEvents: 3, wantPruned: 1, wantAnchor: 2},
+		{name: "second expiry absorbs pruned", expire: [][]int64{{1, 2, 4}, {3, 5}}, wantEvents: 1, wantAnchor: 5},
+		{name: "retained row keeps anchor at start", expire: [][]int64{{2, 3}}, wantEvents: 4, wantPruned: 2},
+		{
+			name:       "retained row below dropped number is verified",
+			expire:     [][]int64{{1, 2, 4}},
+			mutate:     func(m *memChain) { m.records[0].Status = "FAILED" },
+			want:       []string{ProblemModified},
+			wantEvents: 3, wantPruned: 1, wantAnchor: 2,
+		},
+		{
+			name:       "deleted retained row is a gap",
+			expire:     [][]int64{{1, 2, 4}},
+			mutate:     func(m *memChain) { m.records = append(m.records[:1], m.records[2:]...) },
+			want:       []string{ProblemGap},
+			wantEvents: 2, wantPruned: 1, wantAnchor: 2,
+		},
+		{
+			name:       "forged pruned link",
+			expire:     [][]int64{{1, 2, 4}},
+			mutate:     func(m *memChain) { m.pruned[0].Hash = m.records[0].Hash },
+			want:       []string{ProblemAnchorInvalid, ProblemGap},
+			wantEvents: 3, wantAnchor: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &memChain{records: buildChain(t, 6)}
+			for _, drop := range tt.expire {
+				m.expire(t, key, drop...)
+			}
+			if tt.mutate != nil {
+				tt.mutate(m)
+			}
+			rep, err := VerifyPartition(context.Background(), m, keys, ChainHead{Partition: "p1", Seq: 6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range rep.Problems {
+				got = append(got, p.Kind)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("problems = %v, want %v (%+v)", got, tt.want, rep.Problems)
+			}
+			if rep.Events != tt.wantEvents || rep.Pruned != tt.wantPruned || rep.AnchorSeq != tt.wantAnchor || rep.BeforeAnchor != tt.wantSkipped {
+				t.Errorf("events=%d pruned=%d anchor=%d before_anchor=%d, want %d %d %d %d",
+					rep.Events, rep.Pruned, rep.AnchorSeq, rep.BeforeAnchor,
+					tt.wantEvents, tt.wantPruned, tt.wantAnchor, tt.wantSkipped)
+			}
+		})
+	}
+}
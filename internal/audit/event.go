@@ -1,6 +1,10 @@
 package audit
 
-import "time"
+import (
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
 
 type AuditEvent struct {
 	ID           string                 `json:"id"`            // UUID события
@@ -10,8 +14,14 @@ type AuditEvent struct {
 	Payload      map[string]interface{} `json:"payload"`       // С какими данными
 
 	// Контекст исполнения
-	Mode     string `json:"mode"`      // "LIVE" или "SANDBOX"
-	PolicyID string `json:"policy_id"` // Какая политика разрешила/перехватила
+	Mode          string `json:"mode"`           // "LIVE" или "SANDBOX"
+	PolicyID      string `json:"policy_id"`      // Какая политика разрешила/перехватила
+	PolicyVersion int    `json:"policy_version"` // Версия политики на момент решения
+	BreakGlass    bool   `json:"break_glass"`    // Решение принято по временному аварийному доступу
+
+	// Риск-анализ (контентные детекторы)
+	RiskScore    int                  `json:"risk_score"`              // Итоговый риск 0..100
+	RiskFindings []domain.RiskFinding `json:"risk_findings,omitempty"` // Сработавшие правила
 
 	// Результат
 	Status     string      `json:"status"`   // "SUCCESS", "FAILED", "INTERCEPTED"
@@ -0,0 +1,55 @@
+package audit
+
+/*
+Файл fanout.go раздает события аудита нескольким хранилищам (PostgreSQL, ClickHouse,
+Kafka, файлы — см. пакет audit/sink).
+
+Каждое хранилище обслуживает собственный AgentFS: свой канал, пакеты, повторы, дисковый
+спул и метрики. Поэтому недоступность одного хранилища не задерживает и не дублирует
+запись в остальные, а после восстановления оно получает пропущенное из своего спула.
+*/
+
+import (
+	"sync"
+	"time"
+)
+
+// FanOut — Auditor, передающий каждое событие всем подключенным AgentFS.
+type FanOut struct {
+	pipelines []*AgentFS
+}
+
+func NewFanOut(pipelines ...*AgentFS) *FanOut {
+	return &FanOut{pipelines: pipelines}
+}
+
+func (f *FanOut) Start() {
+	for _, p := range f.pipelines {
+		p.Start()
+	}
+}
+
+// Stop останавливает хранилища параллельно: каждое дописывает свой буфер.
+func (f *FanOut) Stop() {
+	var wg sync.WaitGroup
+	for _, p := range f.pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+// Log не блокирует: каждое хранилище кладет событие в свой канал (или в свой спул).
+// Payload и Response разделяются между хранилищами и только читаются.
+func (f *FanOut) Log(event AuditEvent) {
+	// Время проставляется один раз, иначе у хранилищ оно бы разошлось
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	for _, p := range f.pipelines {
+		p.Log(event)
+	}
+}
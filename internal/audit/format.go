@@ -0,0 +1,230 @@
+package audit
+
+/*
+Файл format.go сериализует события аудита для выгрузки и передачи в SIEM.
+
+- ndjson — событие как есть (поля AuditEvent), одна строка — одно событие.
+- ecs — Elastic Common Schema: стандартные поля event.*, trace.id, user.id (агент),
+  специфичные поля шлюза — в пространстве spaceai.*.
+- cef — ArcSight Common Event Format: одна строка без payload и ответа (их размер
+  и структура не подходят для CEF), идентификаторы — в полях cs1..cs4 и cn1..cn3.
+- csv — только для выгрузки: первая строка — заголовок, JSON-поля — строкой.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы выгрузки
+const (
+	FormatNDJSON = "ndjson"
+	FormatECS    = "ecs"
+	FormatCEF    = "cef"
+	FormatCSV    = "csv"
+)
+
+// Источник событий в CEF и ECS
+const (
+	cefVendor  = "SpaceAI"
+	cefProduct = "UAG"
+	cefVersion = "1.0"
+	ecsVersion = "8.11.0"
+)
+
+// ContentType возвращает MIME-тип выгрузки в формате format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatCEF:
+		return "text/plain; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// ValidFormat — формат поддерживается выгрузкой; lineOnly — только построчные (для форвардера).
+func ValidFormat(format string, lineOnly bool) bool {
+	switch format {
+	case FormatNDJSON, FormatECS, FormatCEF:
+		return true
+	case FormatCSV:
+		return !lineOnly
+	}
+	return false
+}
+
+// MarshalLine сериализует событие в одну строку (без перевода строки) в построчном формате.
+func MarshalLine(format string, e *AuditEvent) ([]byte, error) {
+	switch format {
+	case FormatNDJSON:
+		return json.Marshal(e)
+	case FormatECS:
+		return json.Marshal(toECS(e))
+	case FormatCEF:
+		return []byte(toCEF(e)), nil
+	}
+	return nil, fmt.Errorf("audit: unsupported line format %q", format)
+}
+
+// Encoder пишет поток событий в w в заданном формате.
+type Encoder struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+}
+
+// NewEncoder создает кодировщик; для csv сразу пишет заголовок.
+func NewEncoder(w io.Writer, format string) (*Encoder, error) {
+	if !ValidFormat(format, false) {
+		return nil, fmt.Errorf("audit: unsupported format %q", format)
+	}
+	enc := &Encoder{format: format, w: w}
+	if format == FormatCSV {
+		enc.csv = csv.NewWriter(w)
+		if err := enc.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+	}
+	return enc, nil
+}
+
+// Encode пишет одно событие.
+func (enc *Encoder) Encode(e *AuditEvent) error {
+	if enc.csv != nil {
+		return enc.csv.Write(csvRecord(e))
+	}
+	line, err := MarshalLine(enc.format, e)
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(append(line, '\n'))
+	return err
+}
+
+// Flush дописывает буферизованные данные (csv).
+func (enc *Encoder) Flush() error {
+	if enc.csv != nil {
+		enc.csv.Flush()
+		return enc.csv.Error()
+	}
+	return nil
+}
+
+var csvHeader = []string{
+	"id", "timestamp", "trace_id", "agent_id", "capability_id", "mode", "status", "duration_ms",
+	"risk_score", "policy_id", "policy_version", "break_glass", "payload", "response", "risk_findings",
+}
+
+func csvRecord(e *AuditEvent) []string {
+	return []string{
+		e.ID, e.Timestamp.UTC().Format(time.RFC3339Nano), e.TraceID, e.AgentID, e.CapabilityID, e.Mode, e.Status,
+		strconv.FormatInt(e.DurationMs, 10), strconv.Itoa(e.RiskScore), e.PolicyID, strconv.Itoa(e.PolicyVersion),
+		strconv.FormatBool(e.BreakGlass), jsonString(e.Payload), jsonString(e.Response), jsonString(e.RiskFindings),
+	}
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Severity — важность события 0..10 (CEF) по риску и исходу.
+func Severity(e *AuditEvent) int {
+	sev := e.RiskScore / 10
+	switch e.Status {
+	case "BLOCKED", "DENIED", "REJECTED":
+		sev = max(sev, 6)
+	case "FAILED":
+		sev = max(sev, 4)
+	default:
+		sev = max(sev, 2)
+	}
+	return min(sev, 10)
+}
+
+// ecsOutcome переводит статус шлюза в event.outcome ECS.
+func ecsOutcome(status string) string {
+	switch status {
+	case "SUCCESS", "INTERCEPTED":
+		return "success"
+	case "BLOCKED", "DENIED", "REJECTED", "FAILED":
+		return "failure"
+	}
+	return "unknown"
+}
+
+func toECS(e *AuditEvent) map[string]any {
+	return map[string]any{
+		"@timestamp": e.Timestamp.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]any{"version": ecsVersion},
+		"event": map[string]any{
+			"id":         e.ID,
+			"kind":       "event",
+			"category":   []string{"api"},
+			"action":     e.CapabilityID,
+			"outcome":    ecsOutcome(e.Status),
+			"duration":   e.DurationMs * int64(time.Millisecond), // ECS: наносекунды
+			"risk_score": e.RiskScore,
+			"severity":   Severity(e),
+		},
+		"trace": map[string]any{"id": e.TraceID},
+		"user":  map[string]any{"id": e.AgentID},
+		"rule":  map[string]any{"id": e.PolicyID, "version": strconv.Itoa(e.PolicyVersion)},
+		"observer": map[string]any{
+			"vendor":  cefVendor,
+			"product": cefProduct,
+			"type":    "gateway",
+		},
+		"spaceai": map[string]any{
+			"agent_id":      e.AgentID,
+			"mode":          e.Mode,
+			"status":        e.Status,
+			"break_glass":   e.BreakGlass,
+			"payload":       e.Payload,
+			"response":      e.Response,
+			"risk_findings": e.RiskFindings,
+		},
+	}
+}
+
+func toCEF(e *AuditEvent) string {
+	ext := []string{
+		"rt=" + strconv.FormatInt(e.Timestamp.UnixMilli(), 10),
+		"externalId=" + cefValue(e.ID),
+		"suser=" + cefValue(e.AgentID),
+		"act=" + cefValue(e.Status),
+		"outcome=" + ecsOutcome(e.Status),
+		"cs1Label=traceId", "cs1=" + cefValue(e.TraceID),
+		"cs2Label=policyId", "cs2=" + cefValue(e.PolicyID),
+		"cs3Label=mode", "cs3=" + cefValue(e.Mode),
+		"cn1Label=durationMs", "cn1=" + strconv.FormatInt(e.DurationMs, 10),
+		"cn2Label=riskScore", "cn2=" + strconv.Itoa(e.RiskScore),
+		"cn3Label=policyVersion", "cn3=" + strconv.Itoa(e.PolicyVersion),
+	}
+	if e.BreakGlass {
+		ext = append(ext, "cs4Label=breakGlass", "cs4=true")
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefVendor, cefProduct, cefVersion,
+		cefHeader(e.CapabilityID), cefHeader(e.CapabilityID+" "+strings.ToLower(e.Status)), Severity(e),
+		strings.Join(ext, " "))
+}
+
+// cefHeader экранирует поле заголовка CEF: "\" и "|".
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// cefValue экранирует значение расширения CEF: "\", "=" и переводы строк.
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
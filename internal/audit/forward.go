@@ -0,0 +1,228 @@
+package audit
+
+/*
+Файл forward.go доставляет события аудита во внешние системы (SIEM).
+
+Shipper возвращает nil только после того, как пакет принят получателем: для HTTP — ответ 2xx,
+для syslog по TCP — запись в соединение без ошибки. Форвардер сдвигает курсор лишь после
+успешной отправки, поэтому доставка — at-least-once: после сбоя пакет отправляется повторно.
+Syslog по UDP подтверждений не дает и подходит только там, где потери допустимы.
+*/
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Shipper отправляет пакет событий во внешнюю систему.
+type Shipper interface {
+	Ship(ctx context.Context, events []AuditEvent) error
+	Close() error
+}
+
+// SyslogOptions — параметры доставки по RFC 5424.
+type SyslogOptions struct {
+	Network  string // tcp или udp
+	Address  string // host:port
+	AppName  string
+	Hostname string // По умолчанию — имя хоста
+	Facility int    // По умолчанию 13 (log audit)
+	Format   string // ndjson, ecs, cef — содержимое MSG
+	Timeout  time.Duration
+}
+
+// SyslogShipper пишет события в syslog-коллектор: TCP с октетным фреймингом (RFC 6587), UDP — датаграмма на событие.
+type SyslogShipper struct {
+	opts SyslogOptions
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewSyslogShipper(opts SyslogOptions) (*SyslogShipper, error) {
+	if opts.Network != "tcp" && opts.Network != "udp" {
+		return nil, fmt.Errorf("audit: syslog network must be tcp or udp, got %q", opts.Network)
+	}
+	if opts.Address == "" {
+		return nil, errors.New("audit: syslog address is required")
+	}
+	if !ValidFormat(opts.Format, true) {
+		return nil, fmt.Errorf("audit: unsupported syslog format %q", opts.Format)
+	}
+	if opts.AppName == "" {
+		opts.AppName = "uag-audit"
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.Facility == 0 {
+		opts.Facility = 13
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &SyslogShipper{opts: opts}, nil
+}
+
+func (s *SyslogShipper) Ship(ctx context.Context, events []AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		d := net.Dialer{Timeout: s.opts.Timeout}
+		conn, err := d.DialContext(ctx, s.opts.Network, s.opts.Address)
+		if err != nil {
+			return fmt.Errorf("audit: syslog dial: %w", err)
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.opts.Timeout))
+
+	var buf bytes.Buffer
+	for i := range events {
+		msg, err := s.message(&events[i])
+		if err != nil {
+			return err
+		}
+		if s.opts.Network == "udp" {
+			if _, err := s.conn.Write(msg); err != nil {
+				return s.fail(err)
+			}
+			continue
+		}
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.Write(msg)
+	}
+	if buf.Len() > 0 {
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			return s.fail(err)
+		}
+	}
+	return nil
+}
+
+// message строит запись RFC 5424: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+func (s *SyslogShipper) message(e *AuditEvent) ([]byte, error) {
+	line, err := MarshalLine(s.opts.Format, e)
+	if err != nil {
+		return nil, err
+	}
+	pri := s.opts.Facility*8 + syslogSeverity(e)
+	header := fmt.Sprintf("<%d>1 %s %s %s - %s - ",
+		pri, e.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogField(s.opts.Hostname, 255), syslogField(s.opts.AppName, 48), syslogField(e.CapabilityID, 32))
+	return append([]byte(header), line...), nil
+}
+
+// fail закрывает соединение после ошибки записи: следующий Ship переподключится.
+func (s *SyslogShipper) fail(err error) error {
+	s.conn.Close()
+	s.conn = nil
+	return fmt.Errorf("audit: syslog write: %w", err)
+}
+
+func (s *SyslogShipper) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogSeverity: 4 (warning) для отказов и высокого риска, 6 (informational) для остального.
+func syslogSeverity(e *AuditEvent) int {
+	if Severity(e) >= 6 {
+		return 4
+	}
+	return 6
+}
+
+// syslogField приводит значение к полю заголовка RFC 5424: печатный ASCII без пробелов, не длиннее limit.
+func syslogField(s string, limit int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < limit; i++ {
+		if c := s[i]; c > 32 && c < 127 {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// HTTPOptions — параметры доставки в HTTP-коллектор.
+type HTTPOptions struct {
+	URL     string
+	Headers map[string]string // Например, Authorization для коллектора
+	Format  string            // ndjson, ecs, cef — тело запроса: строки через "\n"
+	Timeout time.Duration
+}
+
+// HTTPShipper отправляет пакет одним POST; успех — любой ответ 2xx.
+type HTTPShipper struct {
+	opts   HTTPOptions
+	client *http.Client
+}
+
+func NewHTTPShipper(opts HTTPOptions) (*HTTPShipper, error) {
+	if opts.URL == "" {
+		return nil, errors.New("audit: http collector url is required")
+	}
+	if !ValidFormat(opts.Format, true) {
+		return nil, fmt.Errorf("audit: unsupported http format %q", opts.Format)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &HTTPShipper{opts: opts, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+func (s *HTTPShipper) Ship(ctx context.Context, events []AuditEvent) error {
+	var body bytes.Buffer
+	for i := range events {
+		line, err := MarshalLine(s.opts.Format, &events[i])
+		if err != nil {
+			return err
+		}
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType(s.opts.Format))
+	for k, v := range s.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit: http collector: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Дочитываем, чтобы переиспользовать соединение
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit: http collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *HTTPShipper) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,143 @@
+package audit
+
+/*
+Файл partition.go описывает партиции хранения audit_logs (PARTITION BY RANGE (timestamp)).
+
+Границы партиции закодированы в имени: audit_logs_pYYYYMMDD — сутки, audit_logs_pYYYYMM —
+месяц (UTC). Имя — единственный источник границ: менеджер партиций не разбирает
+pg_get_expr, а гранулярность можно сменить без миграции (новые партиции просто
+не пересекаются со старыми). Строки вне всех партиций попадают в audit_logs_default.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Гранулярность партиций хранения
+const (
+	PartitionDaily   = "daily"
+	PartitionMonthly = "monthly"
+)
+
+const (
+	partitionPrefix = "audit_logs_p"
+	dayLayout       = "20060102"
+	monthLayout     = "200601"
+)
+
+// DefaultPartition — партиция для строк вне диапазонов (часы шлюза ушли вперед, партиция не создана).
+const DefaultPartition = "audit_logs_default"
+
+// Partition — партиция хранения audit_logs с диапазоном [From, To).
+type Partition struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Held — партиция восстановлена из архива для расследования и не удаляется по сроку хранения
+	Held bool `json:"held,omitempty"`
+}
+
+// PartitionFor возвращает партицию заданной гранулярности, содержащую момент t.
+func PartitionFor(granularity string, t time.Time) (Partition, error) {
+	t = t.UTC()
+	switch granularity {
+	case PartitionDaily:
+		from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return Partition{Name: partitionPrefix + from.Format(dayLayout), From: from, To: from.AddDate(0, 0, 1)}, nil
+	case PartitionMonthly:
+		from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return Partition{Name: partitionPrefix + from.Format(monthLayout), From: from, To: from.AddDate(0, 1, 0)}, nil
+	}
+	return Partition{}, fmt.Errorf("audit: unknown partition granularity %q", granularity)
+}
+
+// ParsePartition восстанавливает границы партиции по имени; ok == false — имя не из этой схемы.
+func ParsePartition(name string) (p Partition, ok bool) {
+	suffix, found := strings.CutPrefix(name, partitionPrefix)
+	if !found {
+		return Partition{}, false
+	}
+	switch len(suffix) {
+	case len(dayLayout):
+		from, err := time.Parse(dayLayout, suffix)
+		if err != nil {
+			return Partition{}, false
+		}
+		return Partition{Name: name, From: from, To: from.AddDate(0, 0, 1)}, true
+	case len(monthLayout):
+		from, err := time.Parse(monthLayout, suffix)
+		if err != nil {
+			return Partition{}, false
+		}
+		return Partition{Name: name, From: from, To: from.AddDate(0, 1, 0)}, true
+	}
+	return Partition{}, false
+}
+
+// Overlaps — диапазоны партиций пересекаются.
+func (p Partition) Overlaps(o Partition) bool {
+	return p.From.Before(o.To) && o.From.Before(p.To)
+}
+
+// Expired — все события партиции старше cutoff.
+func (p Partition) Expired(cutoff time.Time) bool {
+	return !p.To.After(cutoff)
+}
+
+// ChainLink — номер и hash события цепочки (без содержимого строки).
+type ChainLink struct {
+	Seq  int64
+	Hash string
+}
+
+// AnchorPlan — как сдвинуть начало партиции цепочки при удалении партиции хранения.
+type AnchorPlan struct {
+	Anchor *Checkpoint  // Новый якорь; nil — прежний не меняется
+	Pruned []Checkpoint // Удаляемые события выше якоря: по ним проверка связывает цепочку через пропуск
+}
+
+// PlanAnchor вычисляет новое начало партиции цепочки при удалении партиции хранения.
+//
+// Номера цепочки выдаются в порядке записи, а партиции хранения делятся по времени события,
+// поэтому диапазоны номеров перемежаются: событие из спула с прошлым временем получает номер
+// больше, чем уже записанные события следующего дня. Якорь не может быть выше первого
+// оставшегося события (retainedSeq; 0 — не осталось ни одного), иначе проверка пропустила бы
+// оставшиеся строки ниже якоря. Якорь — наибольший номер ниже retainedSeq с известным hash:
+// из удаляемых строк (dropped) или удаленных раньше (pruned); строки, пропавшие без записи,
+// так и остаются пропуском (gap). Удаляемые события выше якоря возвращаются в Pruned.
+//
+// anchorSeq — прежний якорь (0 — нет); dropped — события удаляемой партиции хранения выше
+// anchorSeq по возрастанию номера; pruned — hash событий выше anchorSeq, удаленных раньше.
+func PlanAnchor(partition string, anchorSeq int64, dropped []ChainLink, pruned map[int64]string, retainedSeq int64) AnchorPlan {
+	var plan AnchorPlan
+	if len(dropped) == 0 {
+		return plan
+	}
+	limit := dropped[len(dropped)-1].Seq
+	if retainedSeq > 0 && retainedSeq-1 < limit {
+		limit = retainedSeq - 1
+	}
+
+	anchor := ChainLink{Seq: anchorSeq}
+	for _, l := range dropped {
+		if l.Seq <= limit && l.Seq > anchor.Seq {
+			anchor = l
+		}
+	}
+	for seq, hash := range pruned {
+		if seq <= limit && seq > anchor.Seq {
+			anchor = ChainLink{Seq: seq, Hash: hash}
+		}
+	}
+	if anchor.Seq > anchorSeq {
+		plan.Anchor = &Checkpoint{Partition: partition, Seq: anchor.Seq, Hash: anchor.Hash}
+	}
+	for _, l := range dropped {
+		if l.Seq > anchor.Seq {
+			plan.Pruned = append(plan.Pruned, Checkpoint{Partition: partition, Seq: l.Seq, Hash: l.Hash})
+		}
+	}
+	return plan
+}
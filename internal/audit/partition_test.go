@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlanAnchor(t *testing.T) {
+	links := func(seqs ...int64) []ChainLink {
+		out := make([]ChainLink, 0, len(seqs))
+		for _, s := range seqs {
+			out = append(out, ChainLink{Seq: s, Hash: fmt.Sprintf("h%d", s)})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name        string
+		anchorSeq   int64
+		dropped     []ChainLink
+		pruned      map[int64]string
+		retainedSeq int64
+		wantAnchor  string // "seq:hash"; пусто — якорь не меняется
+		wantPruned  []int64
+	}{
+		{name: "nothing dropped", anchorSeq: 3, retainedSeq: 4},
+		{name: "whole prefix", dropped: links(1, 2, 3), retainedSeq: 4, wantAnchor: "3:h3"},
+		{name: "nothing retained", anchorSeq: 2, dropped: links(3, 4), wantAnchor: "4:h4"},
+		{name: "interleaved", dropped: links(1, 2, 4, 7), retainedSeq: 3, wantAnchor: "2:h2", wantPruned: []int64{4, 7}},
+		{name: "first event retained", dropped: links(2, 3), retainedSeq: 1, wantPruned: []int64{2, 3}},
+		{name: "pruned earlier becomes anchor", anchorSeq: 2, dropped: links(3, 6), pruned: map[int64]string{4: "h4"}, retainedSeq: 5, wantAnchor: "4:h4", wantPruned: []int64{6}},
+		{name: "missing row stays a gap", dropped: links(1, 2), retainedSeq: 4, wantAnchor: "2:h2"},
+		{name: "anchor never moves back", anchorSeq: 5, dropped: links(8), retainedSeq: 6, wantPruned: []int64{8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := PlanAnchor("p1", tt.anchorSeq, tt.dropped, tt.pruned, tt.retainedSeq)
+
+			var anchor string
+			if plan.Anchor != nil {
+				anchor = fmt.Sprintf("%d:%s", plan.Anchor.Seq, plan.Anchor.Hash)
+			}
+			if anchor != tt.wantAnchor {
+				t.Errorf("anchor = %q, want %q", anchor, tt.wantAnchor)
+			}
+			var pruned []int64
+			for _, cp := range plan.Pruned {
+				if cp.Partition != "p1" || cp.Hash != fmt.Sprintf("h%d", cp.Seq) {
+					t.Errorf("pruned link %+v", cp)
+				}
+				pruned = append(pruned, cp.Seq)
+			}
+			if fmt.Sprint(pruned) != fmt.Sprint(tt.wantPruned) {
+				t.Errorf("pruned = %v, want %v", pruned, tt.wantPruned)
+			}
+		})
+	}
+}
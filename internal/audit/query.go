@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля сортировки выборки аудита (с префиксом "-" — по убыванию)
+const (
+	SortTimestamp = "timestamp"
+	SortDuration  = "duration_ms"
+	SortRisk      = "risk_score"
+)
+
+// DefaultSort — новые события первыми.
+const DefaultSort = "-" + SortTimestamp
+
+// Query — фильтры выборки audit_logs (пустые поля не ограничивают).
+type Query struct {
+	AgentID      string
+	CapabilityID string
+	TraceID      string
+	PolicyID     string
+	Statuses     []string // Любой из статусов
+	Modes        []string // Любой из режимов (LIVE, SANDBOX)
+	From         *time.Time
+	To           *time.Time // Не включительно
+	// Payload — фрагмент JSON, который должен содержаться в payload (payload @> ..., GIN-индекс)
+	Payload map[string]any
+	Sort    string // timestamp, -timestamp, duration_ms, -duration_ms, risk_score, -risk_score
+	Cursor  *Cursor
+	Limit   int
+}
+
+// SortSpec разбирает Sort: поле и направление.
+func (q Query) SortSpec() (field string, desc bool, err error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = DefaultSort
+	}
+	field, desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	switch field {
+	case SortTimestamp, SortDuration, SortRisk:
+		return field, desc, nil
+	}
+	return "", false, fmt.Errorf("unknown sort %q", q.Sort)
+}
+
+// Page — страница выборки. NextCursor пуст на последней странице.
+type Page struct {
+	Items      []AuditEvent `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// Cursor — позиция keyset-пагинации: значение поля сортировки и id последнего события страницы.
+// Курсор привязан к сортировке: продолжать выборку с другой сортировкой нельзя.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// ErrInvalidCursor — курсор поврежден или выдан для другой сортировки.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorAfter строит курсор для продолжения выборки после события e.
+func CursorAfter(sort string, e AuditEvent) string {
+	if sort == "" {
+		sort = DefaultSort
+	}
+	c := Cursor{Sort: sort, ID: e.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case SortDuration:
+		c.Value = strconv.FormatInt(e.DurationMs, 10)
+	case SortRisk:
+		c.Value = strconv.Itoa(e.RiskScore)
+	default:
+		c.Value = e.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor декодирует курсор из ответа API.
+func ParseCursor(raw string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// SortValue возвращает значение курсора в типе поля сортировки.
+func (c *Cursor) SortValue() (any, error) {
+	switch strings.TrimPrefix(c.Sort, "-") {
+	case SortTimestamp:
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	case SortDuration, SortRisk:
+		n, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return n, nil
+	}
+	return nil, ErrInvalidCursor
+}
+
+// PayloadFilter строит фрагмент для payload @> из пути через точку: "issue.project" = "X"
+// дает {"issue": {"project": "X"}}. Значение, являющееся JSON (число, true, "строка в кавычках"),
+// сравнивается как JSON, остальное — как строка.
+func PayloadFilter(dst map[string]any, path, raw string) error {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("invalid payload path %q", path)
+		}
+	}
+
+	var value any = raw
+	var parsed any
+	if err := json.Unmarshal([]byte(raw), &parsed); err == nil {
+		value = parsed
+	}
+
+	node := dst
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := node[k].(map[string]any)
+		if !ok {
+			if _, taken := node[k]; taken {
+				return fmt.Errorf("conflicting payload filters at %q", path)
+			}
+			next = make(map[string]any)
+			node[k] = next
+		}
+		node = next
+	}
+	last := keys[len(keys)-1]
+	if _, taken := node[last]; taken {
+		return fmt.Errorf("conflicting payload filters at %q", path)
+	}
+	node[last] = value
+	return nil
+}
+
+// TraceTimeline — все события одного запроса (trace_id) в порядке времени.
+type TraceTimeline struct {
+	TraceID    string       `json:"trace_id"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Agents     []string     `json:"agents"`
+	Events     []AuditEvent `json:"events"`
+	Truncated  bool         `json:"truncated,omitempty"` // Событий больше MaxTraceEvents
+}
+
+// MaxTraceEvents ограничивает размер ответа по одной трассе.
+const MaxTraceEvents = 1000
+
+// ErrTraceNotFound — по trace_id нет событий.
+var ErrTraceNotFound = errors.New("trace not found")
+
+// NewTraceTimeline собирает хронологию из событий, упорядоченных по времени.
+func NewTraceTimeline(traceID string, events []AuditEvent) *TraceTimeline {
+	t := &TraceTimeline{TraceID: traceID, Agents: []string{}, Events: events}
+	if len(events) > MaxTraceEvents {
+		t.Events, t.Truncated = events[:MaxTraceEvents], true
+	}
+	seen := make(map[string]bool)
+	for i, e := range t.Events {
+		if i == 0 || e.Timestamp.Before(t.StartedAt) {
+			t.StartedAt = e.Timestamp
+		}
+		if end := e.Timestamp.Add(time.Duration(e.DurationMs) * time.Millisecond); end.After(t.FinishedAt) {
+			t.FinishedAt = end
+		}
+		if !seen[e.AgentID] {
+			seen[e.AgentID] = true
+			t.Agents = append(t.Agents, e.AgentID)
+		}
+	}
+	return t
+}
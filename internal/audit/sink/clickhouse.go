@@ -0,0 +1,177 @@
+package sink
+
+/*
+Файл clickhouse.go пишет события аудита в ClickHouse через HTTP-интерфейс
+(INSERT ... FORMAT JSONEachRow), без нативного драйвера.
+
+JSON-поля (payload, response, risk_findings) передаются строками, время — в UTC с
+микросекундами, поэтому подходит любая схема со String и DateTime64(6, 'UTC') (см. docs).
+Повтор пакета после сбоя может записать дубли: таблица должна быть ReplacingMergeTree
+по id, а для Replicated*-таблиц дубль одного и того же пакета отсекает
+insert_deduplication_token (хеш идентификаторов событий пакета).
+Ответ 400 (данные не разобрались) и 413 (пакет слишком велик) — audit.PermanentError;
+остальные ошибки временные.
+*/
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+// clickHouseTimeLayout — формат DateTime64(6) в JSONEachRow.
+const clickHouseTimeLayout = "2006-01-02 15:04:05.000000"
+
+var clickHouseIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ClickHouseOptions — параметры HTTP-интерфейса ClickHouse.
+type ClickHouseOptions struct {
+	URL      string // http(s)://clickhouse:8123
+	Database string // Пусто — база пользователя по умолчанию
+	Table    string
+	Username string
+	Password string
+	Timeout  time.Duration
+	TLS      *tls.Config // nil — системные корневые сертификаты для https
+}
+
+// ClickHouse — audit.StorageInterface поверх HTTP-интерфейса ClickHouse.
+type ClickHouse struct {
+	opts   ClickHouseOptions
+	query  string
+	client *http.Client
+}
+
+// clickHouseRow — строка таблицы аудита в ClickHouse.
+type clickHouseRow struct {
+	ID            string `json:"id"`
+	TraceID       string `json:"trace_id"`
+	AgentID       string `json:"agent_id"`
+	CapabilityID  string `json:"capability_id"`
+	Payload       string `json:"payload"`
+	Mode          string `json:"mode"`
+	Status        string `json:"status"`
+	Response      string `json:"response"`
+	DurationMs    int64  `json:"duration_ms"`
+	Timestamp     string `json:"timestamp"`
+	RiskScore     int    `json:"risk_score"`
+	RiskFindings  string `json:"risk_findings"`
+	PolicyID      string `json:"policy_id"`
+	PolicyVersion int    `json:"policy_version"`
+	BreakGlass    bool   `json:"break_glass"`
+}
+
+func NewClickHouse(opts ClickHouseOptions) (*ClickHouse, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("clickhouse: invalid url %q", opts.URL)
+	}
+	if !clickHouseIdent.MatchString(opts.Table) {
+		return nil, fmt.Errorf("clickhouse: invalid table %q", opts.Table)
+	}
+	table := "`" + opts.Table + "`"
+	if opts.Database != "" {
+		if !clickHouseIdent.MatchString(opts.Database) {
+			return nil, fmt.Errorf("clickhouse: invalid database %q", opts.Database)
+		}
+		table = "`" + opts.Database + "`." + table
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	opts.URL = strings.TrimRight(opts.URL, "/")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLS != nil {
+		transport.TLSClientConfig = opts.TLS
+	}
+	return &ClickHouse{
+		opts:   opts,
+		query:  "INSERT INTO " + table + " FORMAT JSONEachRow",
+		client: &http.Client{Timeout: opts.Timeout, Transport: transport},
+	}, nil
+}
+
+// WriteBatch отправляет пакет одним INSERT; любой ответ кроме 2xx — ошибка (пакет повторит AgentFS).
+func (c *ClickHouse) WriteBatch(ctx context.Context, events []audit.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	token := sha256.New()
+	for _, e := range events {
+		rec, err := audit.NewChainRecord(e)
+		if err != nil {
+			return audit.Permanent(err)
+		}
+		if err := enc.Encode(clickHouseRow{
+			ID:            rec.ID,
+			TraceID:       rec.TraceID,
+			AgentID:       rec.AgentID,
+			CapabilityID:  rec.CapabilityID,
+			Payload:       string(rec.Payload),
+			Mode:          rec.Mode,
+			Status:        rec.Status,
+			Response:      string(rec.Response),
+			DurationMs:    rec.DurationMs,
+			Timestamp:     rec.Timestamp.UTC().Format(clickHouseTimeLayout),
+			RiskScore:     rec.RiskScore,
+			RiskFindings:  string(rec.RiskFindings),
+			PolicyID:      rec.PolicyID,
+			PolicyVersion: rec.PolicyVersion,
+			BreakGlass:    rec.BreakGlass,
+		}); err != nil {
+			return audit.Permanent(fmt.Errorf("clickhouse: encode: %w", err))
+		}
+		token.Write([]byte(rec.ID))
+	}
+
+	params := url.Values{}
+	params.Set("query", c.query)
+	params.Set("insert_deduplication_token", hex.EncodeToString(token.Sum(nil)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.URL+"/?"+params.Encode(), &body)
+	if err != nil {
+		return fmt.Errorf("clickhouse: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.opts.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.opts.Username)
+		req.Header.Set("X-ClickHouse-Key", c.opts.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("clickhouse: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("clickhouse: insert failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+			return audit.Permanent(err)
+		}
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close освобождает соединения.
+func (c *ClickHouse) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,192 @@
+package sink
+
+/*
+Файл file.go пишет события аудита в локальные файлы с ротацией: для сбора внешним
+агентом (Filebeat, Vector, Fluent Bit) или как резервная копия рядом со шлюзом.
+
+Файлы audit-<время открытия UTC>.<ext> (ndjson, ecs — .ndjson; cef — .log) сменяются
+по размеру или возрасту, старые сверх max_files удаляются. Пакет дописывается одной
+записью и сбрасывается на диск (fsync); если запись не удалась, файл обрезается до
+прежнего размера, чтобы повтор пакета не оставил недописанную строку.
+*/
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+const (
+	filePrefix     = "audit-"
+	fileTimeLayout = "20060102T150405.000000000Z"
+)
+
+// FileOptions — каталог и политика ротации.
+type FileOptions struct {
+	Dir      string
+	Format   string        // ndjson (по умолчанию), ecs, cef
+	MaxBytes int64         // Ротация по размеру; 0 — без ограничения
+	MaxAge   time.Duration // Ротация по возрасту файла; 0 — без ограничения
+	MaxFiles int           // Сколько файлов хранить, включая текущий; 0 — все
+}
+
+// File — audit.StorageInterface поверх ротируемых локальных файлов.
+type File struct {
+	opts FileOptions
+	ext  string
+
+	mu     sync.Mutex
+	cur    *os.File
+	size   int64
+	opened time.Time
+}
+
+func NewFile(opts FileOptions) (*File, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("file sink: dir is required")
+	}
+	if opts.Format == "" {
+		opts.Format = audit.FormatNDJSON
+	}
+	if !audit.ValidFormat(opts.Format, true) {
+		return nil, fmt.Errorf("file sink: unsupported format %q", opts.Format)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("file sink: %w", err)
+	}
+	ext := ".ndjson"
+	if opts.Format == audit.FormatCEF {
+		ext = ".log"
+	}
+	return &File{opts: opts, ext: ext}, nil
+}
+
+// WriteBatch дописывает пакет в текущий файл, при необходимости открывая следующий.
+func (f *File) WriteBatch(_ context.Context, events []audit.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for i := range events {
+		line, err := audit.MarshalLine(f.opts.Format, &events[i])
+		if err != nil {
+			return audit.Permanent(err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.needRotate(int64(buf.Len())) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.cur.Write(buf.Bytes()); err != nil {
+		f.rollback()
+		return fmt.Errorf("file sink: write: %w", err)
+	}
+	if err := f.cur.Sync(); err != nil {
+		f.rollback()
+		return fmt.Errorf("file sink: sync: %w", err)
+	}
+	f.size += int64(buf.Len())
+	return nil
+}
+
+// rollback возвращает файл к размеру до неудачного пакета; если это не удалось,
+// следующий пакет начнет новый файл.
+func (f *File) rollback() {
+	if f.cur.Truncate(f.size) != nil {
+		f.closeCurrent()
+		return
+	}
+	if _, err := f.cur.Seek(f.size, io.SeekStart); err != nil {
+		f.closeCurrent()
+	}
+}
+
+func (f *File) needRotate(next int64) bool {
+	switch {
+	case f.cur == nil:
+		return true
+	case f.size == 0:
+		return false // Пакет больше max_bytes все равно пишется целиком в пустой файл
+	case f.opts.MaxBytes > 0 && f.size+next > f.opts.MaxBytes:
+		return true
+	case f.opts.MaxAge > 0 && time.Since(f.opened) >= f.opts.MaxAge:
+		return true
+	}
+	return false
+}
+
+func (f *File) rotate() error {
+	if err := f.closeCurrent(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(f.opts.Dir, filePrefix+now.Format(fileTimeLayout)+f.ext)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("file sink: %w", err)
+	}
+	f.cur, f.size, f.opened = file, 0, now
+	return f.prune()
+}
+
+// prune удаляет самые старые файлы сверх MaxFiles.
+func (f *File) prune() error {
+	if f.opts.MaxFiles <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(f.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("file sink: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), f.ext) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names) // Время в имени: лексикографический порядок совпадает с порядком создания
+	for len(names) > f.opts.MaxFiles {
+		if err := os.Remove(filepath.Join(f.opts.Dir, names[0])); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("file sink: %w", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+func (f *File) closeCurrent() error {
+	if f.cur == nil {
+		return nil
+	}
+	err := f.cur.Close()
+	f.cur = nil
+	if err != nil {
+		return fmt.Errorf("file sink: close: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает текущий файл.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closeCurrent()
+}
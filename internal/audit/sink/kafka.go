@@ -0,0 +1,148 @@
+package sink
+
+/*
+Файл kafka.go публикует события аудита в топик Kafka (и совместимые брокеры: Redpanda,
+WarpStream и т.п.) через franz-go.
+
+Ключ записи — agent_id: события одного агента попадают в одну партицию топика и читаются
+в порядке записи. Значение — строка в формате выгрузки (ndjson, ecs или cef, см. audit/format.go),
+заголовки event_id и trace_id позволяют потребителю отсеять дубли без разбора значения.
+Пакет считается записанным, когда его подтвердили все синхронные реплики (acks=all,
+идемпотентный продюсер); повтор пакета AgentFS после таймаута может дать дубли.
+Запись, которую брокер не примет никогда (больше max.message.bytes, не прошла валидацию),
+возвращается как audit.PermanentError.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+// KafkaOptions — подключение к брокерам и топик.
+type KafkaOptions struct {
+	Brokers  []string
+	Topic    string
+	ClientID string
+	Format   string        // ndjson (по умолчанию), ecs, cef
+	Timeout  time.Duration // Предел доставки пакета, включая внутренние повторы клиента
+	TLS      *tls.Config   // nil — без TLS
+
+	// SASL: plain, scram-sha-256, scram-sha-512; пусто — без аутентификации
+	SASLMechanism string
+	Username      string
+	Password      string
+}
+
+// Kafka — audit.StorageInterface поверх продюсера Kafka.
+type Kafka struct {
+	client  *kgo.Client
+	format  string
+	timeout time.Duration
+}
+
+func NewKafka(opts KafkaOptions) (*Kafka, error) {
+	if len(opts.Brokers) == 0 || opts.Topic == "" {
+		return nil, errors.New("kafka: brokers and topic are required")
+	}
+	if opts.Format == "" {
+		opts.Format = audit.FormatNDJSON
+	}
+	if !audit.ValidFormat(opts.Format, true) {
+		return nil, fmt.Errorf("kafka: unsupported format %q", opts.Format)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	kopts := []kgo.Opt{
+		kgo.SeedBrokers(opts.Brokers...),
+		kgo.DefaultProduceTopic(opts.Topic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProducerBatchCompression(kgo.ZstdCompression(), kgo.SnappyCompression(), kgo.NoCompression()),
+		// Без предела клиент повторяет запись бесконечно и ProduceSync не вернет ошибку
+		kgo.RecordDeliveryTimeout(opts.Timeout),
+	}
+	if opts.ClientID != "" {
+		kopts = append(kopts, kgo.ClientID(opts.ClientID))
+	}
+	if opts.TLS != nil {
+		kopts = append(kopts, kgo.DialTLSConfig(opts.TLS))
+	}
+	if opts.SASLMechanism != "" {
+		mech, err := kafkaSASL(opts.SASLMechanism, opts.Username, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		kopts = append(kopts, kgo.SASL(mech))
+	}
+
+	client, err := kgo.NewClient(kopts...)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return &Kafka{client: client, format: opts.Format, timeout: opts.Timeout}, nil
+}
+
+func kafkaSASL(mechanism, user, pass string) (sasl.Mechanism, error) {
+	switch mechanism {
+	case "plain":
+		return plain.Auth{User: user, Pass: pass}.AsMechanism(), nil
+	case "scram-sha-256":
+		return scram.Auth{User: user, Pass: pass}.AsSha256Mechanism(), nil
+	case "scram-sha-512":
+		return scram.Auth{User: user, Pass: pass}.AsSha512Mechanism(), nil
+	}
+	return nil, fmt.Errorf("kafka: unsupported sasl mechanism %q", mechanism)
+}
+
+// WriteBatch публикует пакет и ждет подтверждения всех записей.
+func (k *Kafka) WriteBatch(ctx context.Context, events []audit.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	records := make([]*kgo.Record, 0, len(events))
+	for i := range events {
+		e := &events[i]
+		value, err := audit.MarshalLine(k.format, e)
+		if err != nil {
+			return audit.Permanent(err)
+		}
+		records = append(records, &kgo.Record{
+			Key:       []byte(e.AgentID),
+			Value:     value,
+			Timestamp: e.Timestamp,
+			Headers: []kgo.RecordHeader{
+				{Key: "event_id", Value: []byte(e.ID)},
+				{Key: "trace_id", Value: []byte(e.TraceID)},
+			},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, k.timeout)
+	defer cancel()
+	if err := k.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		err = fmt.Errorf("kafka: produce: %w", err)
+		if errors.Is(err, kerr.MessageTooLarge) || errors.Is(err, kerr.RecordListTooLarge) || errors.Is(err, kerr.InvalidRecord) {
+			return audit.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close закрывает соединения с брокерами.
+func (k *Kafka) Close() error {
+	k.client.Close()
+	return nil
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// zeroEventSize — JSON пустого события: имена полей и значения по умолчанию.
+// eventSize прибавляет к нему разницу между реальными и нулевыми значениями.
+var (
+	zeroEventSize = func() int {
+		data, _ := json.Marshal(AuditEvent{})
+		return len(data)
+	}()
+	zeroTimestampSize = len(time.Time{}.Format(time.RFC3339Nano))
+)
+
+// eventSize — размер события в JSON (вес в пакете для BatchMaxBytes), посчитанный обходом
+// значений без сериализации: событие кодируется один раз — в хранилище. Для payload и response
+// из декодированного JSON результат совпадает с json.Marshal; значения прочих типов сериализуются.
+func eventSize(e AuditEvent) int {
+	size := zeroEventSize
+	for _, s := range []string{e.ID, e.TraceID, e.AgentID, e.CapabilityID, e.Mode, e.PolicyID, e.Status, e.Error} {
+		size += stringSize(s) - len(`""`)
+	}
+	size += valueSize(e.Payload) - len("null")
+	size += valueSize(e.Response) - len("null")
+	size += intSize(int64(e.PolicyVersion)) + intSize(int64(e.RiskScore)) + intSize(e.DurationMs) - 3*len("0")
+	if e.BreakGlass {
+		size -= len("false") - len("true")
+	}
+	var buf [64]byte
+	size += len(e.Timestamp.AppendFormat(buf[:0], time.RFC3339Nano)) - zeroTimestampSize
+	if len(e.RiskFindings) > 0 {
+		size += len(`,"risk_findings":`) + marshalSize(e.RiskFindings)
+	}
+	return size
+}
+
+// valueSize — длина JSON значения; для типов, которые дает json.Unmarshal в interface{}, — без аллокаций.
+func valueSize(v any) int {
+	switch v := v.(type) {
+	case nil:
+		return len("null")
+	case string:
+		return stringSize(v)
+	case bool:
+		if v {
+			return len("true")
+		}
+		return len("false")
+	case float64:
+		return floatSize(v)
+	case int:
+		return intSize(int64(v))
+	case int64:
+		return intSize(v)
+	case json.Number:
+		return len(v)
+	case json.RawMessage:
+		if v == nil {
+			return len("null")
+		}
+		return len(v)
+	case []byte:
+		if v == nil {
+			return len("null")
+		}
+		return base64.StdEncoding.EncodedLen(len(v)) + len(`""`)
+	case map[string]any:
+		if v == nil {
+			return len("null")
+		}
+		size := len("{}")
+		for k, item := range v {
+			size += stringSize(k) + len(":") + valueSize(item)
+		}
+		if len(v) > 1 {
+			size += len(v) - 1 // Запятые
+		}
+		return size
+	case []any:
+		if v == nil {
+			return len("null")
+		}
+		size := len("[]")
+		for _, item := range v {
+			size += valueSize(item)
+		}
+		if len(v) > 1 {
+			size += len(v) - 1
+		}
+		return size
+	}
+	return marshalSize(v)
+}
+
+func marshalSize(v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// stringSize — длина строки в кавычках с экранированием encoding/json (включая HTML-символы).
+func stringSize(s string) int {
+	size := len(`""`)
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\' || c == '\b' || c == '\f' || c == '\n' || c == '\r' || c == '\t':
+				size += 2
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				size += len(`\u0000`)
+			default:
+				size++
+			}
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			size += utf8.RuneLen(utf8.RuneError) // Битый байт заменяется на U+FFFD
+		case r == '\u2028' || r == '\u2029':
+			size += len(`\u2028`)
+		default:
+			size += n
+		}
+		i += n
+	}
+	return size
+}
+
+func intSize(n int64) int {
+	var buf [24]byte
+	return len(strconv.AppendInt(buf[:0], n, 10))
+}
+
+// floatSize повторяет формат encoding/json: экспонента для очень малых и больших чисел, e-07 -> e-7.
+func floatSize(f float64) int {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	var buf [32]byte
+	b := strconv.AppendFloat(buf[:0], f, format, -1, 64)
+	if n := len(b); format == 'e' && n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+		return n - 1
+	}
+	return len(b)
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+func decoded(t *testing.T, raw string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestEventSize(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 30, 0, 123456789, time.FixedZone("MSK", 3*3600))
+	payload := func(raw string) map[string]interface{} {
+		m, _ := decoded(t, raw).(map[string]any)
+		return m
+	}
+
+	tests := []struct {
+		name  string
+		event AuditEvent
+	}{
+		{name: "zero"},
+		{
+			name: "typical",
+			event: AuditEvent{
+				ID: "0b9f7c7e-8d4e-4bb1-9f0e-2a8f5c3d1e77", TraceID: "trace-1", AgentID: "agent-1", CapabilityID: "bank.transfer",
+				Payload: payload(`{"amount":1500.5,"currency":"RUB","to":{"iban":"DE89370400440532013000"},"tags":["a","b"],"urgent":true,"memo":null}`),
+				Mode:    "LIVE", PolicyID: "p-1", PolicyVersion: 12, BreakGlass: true,
+				RiskScore: 85, Status: "SUCCESS", Response: decoded(t, `[{"id":1},{"id":2}]`),
+				Timestamp: ts, DurationMs: 1234, Error: "",
+			},
+		},
+		{
+			name: "escaping",
+			event: AuditEvent{
+				Payload:   payload(`{"html":"<b>a&b</b>","quote":"say \"hi\"\\","ctl":"tab\there\nnew\u0001\b\f","uni":"привет ✓ \u2028 😀"}`),
+				Error:     "line1\nline2 <EOF>",
+				Timestamp: ts.UTC(),
+			},
+		},
+		{name: "invalid utf-8", event: AuditEvent{Status: "bad\xff\xfe", Payload: map[string]interface{}{"k\xc3": "v"}}},
+		{
+			name: "numbers",
+			event: AuditEvent{
+				Payload:    payload(`{"tiny":1e-7,"small":0.000001,"big":1e21,"huge":1.5e300,"neg":-42,"zero":0,"frac":0.1}`),
+				DurationMs: -1, RiskScore: 100,
+			},
+		},
+		{name: "empty containers", event: AuditEvent{Payload: map[string]interface{}{}, Response: []any{}}},
+		{name: "raw response", event: AuditEvent{Response: json.RawMessage(`{"ok":true}`)}},
+		{
+			name: "typed values fall back to json",
+			event: AuditEvent{
+				Response:     map[string]string{"status": "queued"},
+				RiskFindings: []domain.RiskFinding{{Detector: "secrets", Rule: "aws_access_key", Score: 40, Evidence: "AKIA****"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := eventSize(tt.event); got != len(data) {
+				t.Errorf("eventSize() = %d, want %d (%s)", got, len(data), data)
+			}
+		})
+	}
+}
+
+// Размер считается без сериализации: событие кодируется только при записи в хранилище.
+func TestEventSizeAllocs(t *testing.T) {
+	payload, _ := decoded(t, `{"amount":1500.5,"items":[{"sku":"A-1","qty":2}],"note":"доставка до двери"}`).(map[string]any)
+	e := AuditEvent{ID: "id", AgentID: "agent-1", Payload: payload, Response: payload, Timestamp: time.Now()}
+	if allocs := testing.AllocsPerRun(100, func() { eventSize(e) }); allocs != 0 {
+		t.Errorf("eventSize() allocs = %v, want 0", allocs)
+	}
+}
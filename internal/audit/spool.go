@@ -0,0 +1,275 @@
+package audit
+
+/*
+Файл spool.go реализует локальный журнал предзаписи (write-ahead spool) для AgentFS:
+события, которые не удалось записать в хранилище (БД недоступна, канал переполнен,
+шлюз останавливается), сохраняются на диск и дописываются в хранилище после восстановления.
+
+Спул — каталог сегментов NDJSON (segment-<номер>.ndjson), одна строка — одно AuditEvent.
+Новые события дописываются в активный сегмент; Replay сначала закрывает его, поэтому
+воспроизводятся только запечатанные сегменты, а параллельные Append пишут уже в новый.
+Сегмент удаляется только после успешной записи всех его событий. Повтор после сбоя
+посреди сегмента снова отправляет уже записанные события — хранилище обязано
+пропускать дубли (см. postgres.WriteBatch). Сегменты, оставшиеся от прошлого запуска,
+подхватываются при открытии.
+
+События, окончательно отклоненные хранилищем (audit.PermanentError), дописываются в
+dead-letter.ndjson того же каталога вместе с причиной. Этот файл не воспроизводится и не
+входит в Size: его разбирает оператор (исправить событие и вернуть в сегмент или удалить).
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolSegmentPrefix = "segment-"
+	spoolSegmentExt    = ".ndjson"
+	spoolDeadLetter    = "dead-letter.ndjson"
+	// spoolMaxLine — предел строки сегмента при чтении (payload ограничен risk.max_payload_bytes)
+	spoolMaxLine = 64 << 20
+)
+
+var (
+	// ErrSpoolFull — спул достиг max_bytes; событие не сохранено.
+	ErrSpoolFull = errors.New("audit: spool is full")
+	// ErrSpoolClosed — спул закрыт (шлюз остановлен).
+	ErrSpoolClosed = errors.New("audit: spool is closed")
+)
+
+// Spool — дисковый буфер событий, не попавших в хранилище.
+type Spool struct {
+	dir      string
+	maxBytes int64 // 0 — без ограничения
+
+	mu     sync.Mutex
+	active *os.File
+	size   int64 // Байт во всех сегментах, включая активный
+	closed bool
+}
+
+// OpenSpool открывает (создает) спул в каталоге dir.
+func OpenSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("audit: spool dir: %w", err)
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range segments {
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("audit: spool: %w", err)
+		}
+		s.size += st.Size()
+	}
+	return s, nil
+}
+
+// Append дописывает события одной записью в активный сегмент. Запись попадает в page cache ОС
+// и переживает падение процесса; fsync выполняет Sync (воркер AgentFS делает это по таймеру).
+func (s *Spool) Append(events ...AuditEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return fmt.Errorf("audit: spool encode: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSpoolClosed
+	}
+	if s.maxBytes > 0 && s.size+int64(buf.Len()) > s.maxBytes {
+		return ErrSpoolFull
+	}
+	if s.active == nil {
+		// Номер сегмента — время создания: лексикографический порядок совпадает с порядком записи
+		name := fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, time.Now().UnixNano(), spoolSegmentExt)
+		f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			return fmt.Errorf("audit: spool segment: %w", err)
+		}
+		s.active = f
+	}
+	n, err := s.active.Write(buf.Bytes())
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("audit: spool write: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterRecord — строка dead-letter: событие и причина, по которой хранилище его отклонило.
+type DeadLetterRecord struct {
+	FailedAt time.Time  `json:"failed_at"`
+	Error    string     `json:"error"`
+	Event    AuditEvent `json:"event"`
+}
+
+// DeadLetter дописывает окончательно отклоненные события в dead-letter и сразу сбрасывает его на диск.
+func (s *Spool) DeadLetter(cause error, events ...AuditEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	now := time.Now().UTC()
+	for _, e := range events {
+		if err := enc.Encode(DeadLetterRecord{FailedAt: now, Error: cause.Error(), Event: e}); err != nil {
+			return fmt.Errorf("audit: dead-letter encode: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSpoolClosed
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, spoolDeadLetter), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("audit: dead-letter: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err = errors.Join(err, f.Sync(), f.Close()); err != nil {
+		return fmt.Errorf("audit: dead-letter write: %w", err)
+	}
+	return nil
+}
+
+// Sync сбрасывает активный сегмент на диск.
+func (s *Spool) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	return s.active.Sync()
+}
+
+// Size — байт в спуле (0 — воспроизводить нечего).
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Replay передает события запечатанных сегментов в fn пачками до batchSize, от старых к новым.
+// Ошибка fn прерывает воспроизведение: текущий и следующие сегменты остаются в спуле.
+// Возвращает число переданных событий и число пропущенных нечитаемых строк
+// (недописанный хвост сегмента при аварийной остановке).
+func (s *Spool) Replay(batchSize int, fn func([]AuditEvent) error) (replayed, skipped int, err error) {
+	s.mu.Lock()
+	sealErr := s.sealLocked()
+	segments, listErr := s.segments()
+	s.mu.Unlock()
+	if err := errors.Join(sealErr, listErr); err != nil {
+		return 0, 0, err
+	}
+
+	for _, path := range segments {
+		n, bad, err := replaySegment(path, batchSize, fn)
+		replayed += n
+		skipped += bad
+		if err != nil {
+			return replayed, skipped, err
+		}
+		st, statErr := os.Stat(path)
+		if err := os.Remove(path); err != nil {
+			return replayed, skipped, fmt.Errorf("audit: spool remove: %w", err)
+		}
+		if statErr == nil {
+			s.mu.Lock()
+			s.size -= st.Size()
+			s.mu.Unlock()
+		}
+	}
+	return replayed, skipped, nil
+}
+
+func replaySegment(path string, batchSize int, fn func([]AuditEvent) error) (replayed, skipped int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("audit: spool open: %w", err)
+	}
+	defer f.Close()
+
+	batch := make([]AuditEvent, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		replayed += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), spoolMaxLine)
+	for sc.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			skipped++
+			continue
+		}
+		if batch = append(batch, e); len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return replayed, skipped, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return replayed, skipped, fmt.Errorf("audit: spool read %s: %w", path, err)
+	}
+	return replayed, skipped, flush()
+}
+
+// Close сбрасывает и закрывает активный сегмент; дальнейшие Append возвращают ErrSpoolClosed.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.sealLocked()
+}
+
+func (s *Spool) sealLocked() error {
+	if s.active == nil {
+		return nil
+	}
+	err := errors.Join(s.active.Sync(), s.active.Close())
+	s.active = nil
+	if err != nil {
+		return fmt.Errorf("audit: spool seal: %w", err)
+	}
+	return nil
+}
+
+// segments — пути сегментов от старых к новым.
+func (s *Spool) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("audit: spool: %w", err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), spoolSegmentPrefix) && strings.HasSuffix(e.Name(), spoolSegmentExt) {
+			paths = append(paths, filepath.Join(s.dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
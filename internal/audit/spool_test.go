@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpoolReplay(t *testing.T) {
+	errDown := errors.New("storage is down")
+
+	tests := []struct {
+		name         string
+		failAt       int    // Номер вызова fn, который вернет ошибку (0 — без ошибок)
+		garbage      string // Дописывается в конец первого сегмента (недописанная строка)
+		wantReplayed int
+		wantSkipped  int
+		wantLeft     int // Сегментов после Replay
+	}{
+		{name: "all segments", wantReplayed: 5},
+		{name: "torn tail is skipped", garbage: `{"id":"tor`, wantReplayed: 5, wantSkipped: 1},
+		{name: "error keeps current and later segments", failAt: 2, wantReplayed: 2, wantLeft: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// Два сегмента от «прошлого запуска» и один в активном спуле
+			for i, batch := range [][]AuditEvent{events("a1", "a2"), events("b1", "b2")} {
+				s, err := OpenSpool(dir, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Append(batch...); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 && tt.garbage != "" {
+					segs, _ := s.segments()
+					f, err := os.OpenFile(segs[0], os.O_APPEND|os.O_WRONLY, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					f.WriteString(tt.garbage)
+					f.Close()
+				}
+			}
+			s, err := OpenSpool(dir, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Size() == 0 {
+				t.Fatal("segments of previous run are not counted")
+			}
+			if err := s.Append(events("c1")...); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			calls := 0
+			replayed, skipped, err := s.Replay(2, func(batch []AuditEvent) error {
+				calls++
+				if calls == tt.failAt {
+					return errDown
+				}
+				for _, e := range batch {
+					got = append(got, e.ID)
+				}
+				return nil
+			})
+			if tt.failAt > 0 && !errors.Is(err, errDown) {
+				t.Fatalf("Replay() error = %v, want %v", err, errDown)
+			}
+			if tt.failAt == 0 && err != nil {
+				t.Fatal(err)
+			}
+			if replayed != tt.wantReplayed || skipped != tt.wantSkipped {
+				t.Errorf("replayed, skipped = %d, %d; want %d, %d", replayed, skipped, tt.wantReplayed, tt.wantSkipped)
+			}
+			if tt.failAt == 0 && (len(got) != 5 || got[0] != "a1" || got[4] != "c1") {
+				t.Errorf("order = %v, want a1..c1", got)
+			}
+			left, _ := s.segments()
+			if len(left) != tt.wantLeft {
+				t.Errorf("segments left = %d, want %d", len(left), tt.wantLeft)
+			}
+			if tt.wantLeft == 0 && s.Size() != 0 {
+				t.Errorf("Size() = %d after full replay", s.Size())
+			}
+		})
+	}
+}
+
+func TestSpoolLimitsAndDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	one, _ := json.Marshal(events("e1")[0])
+	s, err := OpenSpool(dir, int64(2*len(one)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(events("e1")...); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(events("e2", "e3", "e4")...); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("Append() over max_bytes = %v, want ErrSpoolFull", err)
+	}
+
+	size := s.Size()
+	if err := s.DeadLetter(errors.New("bad row"), events("d1")...); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != size {
+		t.Error("dead-letter is counted as pending replay")
+	}
+	var replayed []string
+	if _, _, err := s.Replay(10, func(b []AuditEvent) error {
+		for _, e := range b {
+			replayed = append(replayed, e.ID)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 1 || replayed[0] != "e1" {
+		t.Errorf("replayed = %v, want only e1 (dead-letter is not replayed)", replayed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, spoolDeadLetter)); err != nil {
+		t.Errorf("dead-letter file: %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(events("late")...); !errors.Is(err, ErrSpoolClosed) {
+		t.Errorf("Append() after Close = %v, want ErrSpoolClosed", err)
+	}
+}
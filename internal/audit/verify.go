@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Виды нарушений цепочки
+const (
+	ProblemGap                = "gap"                 // Пропущены номера: строки удалены
+	ProblemModified           = "modified"            // Hash не сходится с содержимым строки
+	ProblemBrokenLink         = "broken_link"         // prev_hash не равен hash предыдущей строки
+	ProblemTruncated          = "truncated"           // Хвост партиции удален (голова или контрольная точка дальше последней строки)
+	ProblemCheckpointInvalid  = "checkpoint_invalid"  // Подпись контрольной точки не проверяется
+	ProblemCheckpointMismatch = "checkpoint_mismatch" // Строка на подписанной позиции отличается от подписанной
+	ProblemDuplicate          = "duplicate"           // Две строки с одним chain_seq: форк цепочки
+	ProblemAnchorInvalid      = "anchor_invalid"      // Подпись якоря (начала цепочки после удаления по сроку) не проверяется
+)
+
+// ChainProblem — найденное нарушение.
+type ChainProblem struct {
+	Kind    string `json:"kind"`
+	Seq     int64  `json:"seq"`
+	EventID string `json:"event_id,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// PartitionReport — результат проверки одной партиции.
+type PartitionReport struct {
+	Partition           string         `json:"partition"`
+	Events              int64          `json:"events"`
+	LastSeq             int64          `json:"last_seq"`
+	HeadSeq             int64          `json:"head_seq"`
+	AnchorSeq           int64          `json:"anchor_seq,omitempty"`    // Цепочка до этого номера удалена по сроку хранения
+	BeforeAnchor        int64          `json:"before_anchor,omitempty"` // Строки не новее якоря (например, восстановленные из архива) не проверяются
+	Pruned              int64          `json:"pruned,omitempty"`        // Номера выше якоря, удаленные по сроку: цепочка связана через их подписанный hash
+	Checkpoints         int            `json:"checkpoints"`
+	VerifiedCheckpoints int            `json:"verified_checkpoints"`
+	Problems            []ChainProblem `json:"problems"`
+}
+
+// OK — в партиции нет нарушений.
+func (r *PartitionReport) OK() bool { return len(r.Problems) == 0 }
+
+func (r *PartitionReport) add(kind string, seq int64, eventID, format string, args ...any) {
+	r.Problems = append(r.Problems, ChainProblem{Kind: kind, Seq: seq, EventID: eventID, Detail: fmt.Sprintf(format, args...)})
+}
+
+// ChainSource — чтение цепочки из хранилища (реализуется postgres.AgentRepo).
+type ChainSource interface {
+	StreamChain(ctx context.Context, partition string, fn func(*ChainRecord) error) error
+	ListCheckpoints(ctx context.Context, partition string) ([]Checkpoint, error)
+	// ChainAnchor — подписанное начало цепочки после удаления старых партиций хранения (nil — цепочка целиком).
+	ChainAnchor(ctx context.Context, partition string) (*Checkpoint, error)
+	// PrunedLinks — подписанные hash событий выше якоря, удаленных по сроку (см. PlanAnchor).
+	PrunedLinks(ctx context.Context, partition string) ([]Checkpoint, error)
+}
+
+// VerifyPartition проходит цепочку партиции от первого события (или от якоря, если начало
+// удалено по сроку хранения) и сверяет ее с головой и контрольными точками.
+// keys == nil — подписи контрольных точек и якоря не проверяются.
+func VerifyPartition(ctx context.Context, src ChainSource, keys PublicKeys, head ChainHead) (*PartitionReport, error) {
+	rep := &PartitionReport{Partition: head.Partition, HeadSeq: head.Seq, Problems: []ChainProblem{}}
+
+	prevSeq, prevHash := int64(0), GenesisHash
+	anchor, err := src.ChainAnchor(ctx, head.Partition)
+	if err != nil {
+		return nil, err
+	}
+	if anchor != nil {
+		if keys != nil {
+			if err := VerifyCheckpoint(keys, *anchor); err != nil {
+				rep.add(ProblemAnchorInvalid, anchor.Seq, "", "anchor: %v", err)
+			}
+		}
+		prevSeq, prevHash = anchor.Seq, anchor.Hash
+		rep.AnchorSeq = anchor.Seq
+	}
+
+	checkpoints, err := src.ListCheckpoints(ctx, head.Partition)
+	if err != nil {
+		return nil, err
+	}
+	signed := make(map[int64]Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		if cp.Seq <= rep.AnchorSeq {
+			continue // Подписанные строки удалены по сроку вместе с партицией хранения
+		}
+		rep.Checkpoints++
+		if keys != nil {
+			if err := VerifyCheckpoint(keys, cp); err != nil {
+				rep.add(ProblemCheckpointInvalid, cp.Seq, "", "checkpoint %d: %v", cp.ID, err)
+				continue
+			}
+		}
+		signed[cp.Seq] = cp
+	}
+
+	links, err := src.PrunedLinks(ctx, head.Partition)
+	if err != nil {
+		return nil, err
+	}
+	pruned := make(map[int64]Checkpoint, len(links))
+	for _, l := range links {
+		if l.Seq <= rep.AnchorSeq {
+			continue
+		}
+		if keys != nil {
+			if err := VerifyCheckpoint(keys, l); err != nil {
+				rep.add(ProblemAnchorInvalid, l.Seq, "", "pruned event %d: %v", l.Seq, err)
+				continue
+			}
+		}
+		pruned[l.Seq] = l
+	}
+
+	matchCheckpoint := func(seq int64, hash, eventID string) {
+		cp, ok := signed[seq]
+		if !ok {
+			return
+		}
+		if cp.Hash != hash {
+			rep.add(ProblemCheckpointMismatch, seq, eventID, "checkpoint %d signed hash %s, stored %s", cp.ID, short(cp.Hash), short(hash))
+		} else {
+			rep.VerifiedCheckpoints++
+		}
+		delete(signed, seq)
+	}
+	// bridge проходит удаленные по сроку номера между prevSeq и to: следующая строка
+	// сверяет prev_hash с hash последнего из них, а не считается пропуском
+	bridge := func(to int64) {
+		for prevSeq+1 < to {
+			l, ok := pruned[prevSeq+1]
+			if !ok {
+				return
+			}
+			rep.Pruned++
+			matchCheckpoint(l.Seq, l.Hash, "")
+			prevSeq, prevHash = l.Seq, l.Hash
+		}
+	}
+
+	err = src.StreamChain(ctx, head.Partition, func(rec *ChainRecord) error {
+		if rec.Seq <= rep.AnchorSeq {
+			rep.BeforeAnchor++
+			return nil
+		}
+		rep.Events++
+		bridge(rec.Seq)
+		switch {
+		case rec.Seq <= prevSeq:
+			rep.add(ProblemDuplicate, rec.Seq, rec.ID, "chain_seq %d is already taken", rec.Seq)
+			return nil
+		case rec.Seq > prevSeq+1:
+			rep.add(ProblemGap, rec.Seq, rec.ID, "events %d..%d are missing", prevSeq+1, rec.Seq-1)
+		case rec.PrevHash != prevHash:
+			rep.add(ProblemBrokenLink, rec.Seq, rec.ID, "prev_hash %s does not match hash of event %d", short(rec.PrevHash), prevSeq)
+		}
+
+		computed, err := rec.ComputeHash()
+		if err != nil {
+			return err
+		}
+		if computed != rec.Hash {
+			rep.add(ProblemModified, rec.Seq, rec.ID, "stored hash %s, computed %s", short(rec.Hash), short(computed))
+		}
+		matchCheckpoint(rec.Seq, rec.Hash, rec.ID)
+
+		// Дальше сверяемся с сохраненным hash: строка, измененная без пересчета hash, дает modified,
+		// с пересчетом — broken_link у следующей строки
+		prevSeq, prevHash = rec.Seq, rec.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("audit: failed to read chain %s: %w", head.Partition, err)
+	}
+	bridge(head.Seq + 1) // Хвост цепочки тоже мог быть удален по сроку раньше более ранних номеров
+	rep.LastSeq = prevSeq
+
+	if head.Seq > prevSeq {
+		rep.add(ProblemTruncated, prevSeq+1, "", "head is at %d, last stored event is %d", head.Seq, prevSeq)
+	}
+	for _, seq := range slices.Sorted(maps.Keys(signed)) {
+		cp := signed[seq]
+		if seq > prevSeq {
+			rep.add(ProblemTruncated, seq, "", "checkpoint %d signed event %d, last stored event is %d", cp.ID, seq, prevSeq)
+		} else {
+			rep.add(ProblemGap, seq, "", "checkpoint %d signed event %d, which is missing", cp.ID, seq)
+		}
+	}
+	return rep, nil
+}
+
+func short(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
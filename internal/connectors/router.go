@@ -0,0 +1,148 @@
+package connectors
+
+/*
+Файл router.go реализует маршрутизацию вызовов способностей по коннекторам.
+
+Каждый маршрут — отдельное gRPC-соединение со своим TLS: коннектор Jira не может
+выдать себя за коннектор платежей, даже если оба подписаны одним корпоративным CA,
+потому что у маршрута закреплена личность (SAN или SPKI) его коннектора.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/certs"
+	pb "github.com/xela07ax/spaceai-infra-prototype/pkg/api/connector/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultConnectorAddress — коннектор по умолчанию, если маршруты не заданы.
+const DefaultConnectorAddress = "localhost:50051"
+
+// ErrNoRoute — для capability не настроен коннектор.
+var ErrNoRoute = errors.New("no connector route for capability")
+
+// Caller — исполнитель вызова способности (GRPCAdapter, MockSystemsConnector).
+type Caller interface {
+	Call(ctx context.Context, capID string, payload []byte) ([]byte, error)
+}
+
+type route struct {
+	name   string
+	prefix string
+	caller Caller
+}
+
+// Router выбирает коннектор по самому длинному совпавшему префиксу capability.
+type Router struct {
+	routes []route
+	conns  []*grpc.ClientConn
+}
+
+// Call реализует ActionExecutor шлюза.
+func (r *Router) Call(ctx context.Context, capID string, payload []byte) ([]byte, error) {
+	for _, rt := range r.routes {
+		if strings.HasPrefix(capID, rt.prefix) {
+			return rt.caller.Call(ctx, capID, payload)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoRoute, capID)
+}
+
+// Close закрывает соединения с коннекторами.
+func (r *Router) Close() error {
+	var errs []error
+	for _, c := range r.conns {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DialRoutes открывает соединения со всеми коннекторами из engine.connectors.
+// Перечитывание сертификатов работает до отмены ctx.
+func DialRoutes(ctx context.Context, cfg infra.ConnectorsConfig, logger *zap.Logger) (*Router, error) {
+	logger = logger.Named("connectors")
+	routes := cfg.Routes
+	if len(routes) == 0 {
+		routes = []infra.ConnectorRoute{{Name: "default", Address: DefaultConnectorAddress}}
+	}
+
+	r := &Router{}
+	seen := make(map[string]bool, len(routes))
+	for _, rc := range routes {
+		if rc.Address == "" {
+			r.Close()
+			return nil, fmt.Errorf("connector route %q: address is required", rc.Name)
+		}
+		if seen[rc.Prefix] {
+			r.Close()
+			return nil, fmt.Errorf("connector route %q: duplicate prefix %q", rc.Name, rc.Prefix)
+		}
+		seen[rc.Prefix] = true
+
+		creds, err := routeCredentials(ctx, cfg.TLS, rc, logger)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("connector route %q: %w", rc.Name, err)
+		}
+		conn, err := grpc.NewClient(rc.Address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("connector route %q: %w", rc.Name, err)
+		}
+		r.conns = append(r.conns, conn)
+		r.routes = append(r.routes, route{
+			name:   rc.Name,
+			prefix: rc.Prefix,
+			caller: NewGRPCAdapter(pb.NewConnectorServiceClient(conn)),
+		})
+		logger.Info("connector route", zap.String("name", rc.Name), zap.String("prefix", rc.Prefix),
+			zap.String("address", rc.Address), zap.String("security", creds.Info().SecurityProtocol))
+	}
+
+	// Самый длинный префикс проверяется первым
+	sort.SliceStable(r.routes, func(i, j int) bool { return len(r.routes[i].prefix) > len(r.routes[j].prefix) })
+	return r, nil
+}
+
+// routeCredentials: TLS маршрута перекрывает общий engine.connectors.tls.
+func routeCredentials(ctx context.Context, defaults infra.ClientTLSConfig, rc infra.ConnectorRoute, logger *zap.Logger) (credentials.TransportCredentials, error) {
+	tc := defaults
+	if rc.TLS != nil {
+		tc = *rc.TLS
+		if tc.ReloadInterval == 0 {
+			tc.ReloadInterval = defaults.ReloadInterval
+		}
+	}
+	if !tc.Enabled {
+		if len(rc.PinnedSANs) > 0 || len(rc.PinnedSPKI) > 0 {
+			return nil, errors.New("pinned identity requires tls.enabled")
+		}
+		logger.Warn("connector route without TLS", zap.String("name", rc.Name))
+		return insecure.NewCredentials(), nil
+	}
+
+	reloader, err := certs.NewReloader(tc.CertFile, tc.KeyFile, tc.CAFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.Start(ctx, tc.ReloadInterval)
+
+	serverName := tc.ServerName
+	if serverName == "" {
+		serverName = certs.HostFromAddress(rc.Address)
+	}
+	return credentials.NewTLS(certs.NewClientTLS(reloader, certs.PeerPolicy{
+		ServerName: serverName,
+		SANs:       rc.PinnedSANs,
+		SPKIPins:   rc.PinnedSPKI,
+	}, logger.With(zap.String("route", rc.Name)))), nil
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"go.uber.org/zap"
+)
+
+type AdminAuditHandler struct {
+	service *service.AdminAuditService
+	logger  *zap.Logger
+}
+
+func NewAdminAuditHandler(s *service.AdminAuditService, logger *zap.Logger) *AdminAuditHandler {
+	return &AdminAuditHandler{service: s, logger: logger.Named("admin-audit")}
+}
+
+// List возвращает журнал административных действий (новые первыми).
+// GET /v1/admin-audit?user_id=...&action=policies:write&target_type=agents&target_id=...&outcome=denied&from=...&to=...&limit=100
+func (h *AdminAuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	f, err := parseAdminAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.service.Query(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// Export выгружает журнал в NDJSON потоком, без ограничения числа записей.
+// GET /v1/admin-audit/export?from=2025-01-01T00:00:00Z&to=...
+func (h *AdminAuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	f, err := parseAdminAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.Limit = 0
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="admin-audit-%s.ndjson"`, time.Now().UTC().Format("20060102T150405Z")))
+	out := &countingWriter{w: w}
+	if err := h.service.Export(r.Context(), f, out); err != nil {
+		h.logger.Error("admin audit export failed", zap.Error(err))
+		// Если строки уже ушли клиенту, статус не поменять: обрыв виден по неполной выгрузке
+		if out.n == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), errorStatus(err))
+		}
+	}
+}
+
+// countingWriter считает отправленные байты, чтобы понять, можно ли еще вернуть ошибку статусом.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func parseAdminAuditFilter(q url.Values) (domain.AdminAuditFilter, error) {
+	f := domain.AdminAuditFilter{
+		UserID:     q.Get("user_id"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Outcome:    q.Get("outcome"),
+	}
+	for name, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		if raw := q.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return f, fmt.Errorf("%s must be RFC3339", name)
+			}
+			*dst = &t
+		}
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return f, errors.New("limit must be a non-negative integer")
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
@@ -2,10 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"go.uber.org/zap"
 
 	"github.com/go-chi/chi/v5"
@@ -45,7 +48,7 @@ func (h *AgentHandler) SetSandbox(w http.ResponseWriter, r *http.Request) {
 
 // ListAgents — список всех агентов для админки
 func (h *AgentHandler) ListAgents(w http.ResponseWriter, r *http.Request) {
-	agents, err := h.service.ListAgents(r.Context())
+	agents, err := h.service.ListAgents(r.Context(), agentFilterFromQuery(r))
 	if err != nil {
 		h.sendError(w, "failed to list agents", err, 500)
 		return
@@ -93,12 +96,13 @@ func (h *AgentHandler) GetAgent(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(agent)
 }
 
-// List возвращает список всех агентов.
+// List возвращает список агентов.
 // Используется для рендеринга главной таблицы в Console UI.
+// GET /v1/agents?team=payments&environment=prod&owner=alice@corp.io&label=tier=critical&include_deleted=true
 func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
 	// 1. Вызываем бизнес-логику через сервис
 	// Контекст r.Context() несет в себе Trace-ID и таймауты
-	agents, err := h.service.ListAgents(r.Context())
+	agents, err := h.service.ListAgents(r.Context(), agentFilterFromQuery(r))
 	if err != nil {
 		// Используем наш вспомогательный метод для логирования и ответа
 		h.sendError(w, "Could not retrieve agents list", err, http.StatusInternalServerError)
@@ -116,6 +120,55 @@ func (h *AgentHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Create регистрирует нового агента.
+// POST /v1/agents
+func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var agent domain.Agent
+	if err := json.NewDecoder(r.Body).Decode(&agent); err != nil {
+		h.sendError(w, "Invalid request body", err, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.CreateAgent(r.Context(), &agent); err != nil {
+		h.sendError(w, "Failed to register agent", err, agentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(agent)
+}
+
+// Update частично изменяет агента: имя, описание, владельцев, команду, окружение, метки, scopes, metadata.
+// PATCH /v1/agents/{id}
+func (h *AgentHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var patch domain.AgentPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.sendError(w, "Invalid request body", err, http.StatusBadRequest)
+		return
+	}
+
+	agent, err := h.service.UpdateAgent(r.Context(), chi.URLParam(r, "id"), &patch)
+	if err != nil {
+		h.sendError(w, "Failed to update agent", err, agentErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agent)
+}
+
+// Delete выводит агента из эксплуатации (мягкое удаление + постоянный kill-switch).
+// DELETE /v1/agents/{id}
+func (h *AgentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	agentID := chi.URLParam(r, "id")
+	if err := h.service.DecommissionAgent(r.Context(), agentID); err != nil {
+		h.sendError(w, "Failed to decommission agent", err, agentErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Get возвращает детальную информацию об одном агенте по его ID.
 // GET /v1/agents/{id}
 func (h *AgentHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -187,3 +240,36 @@ func (h *AgentHandler) Unblock(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("agent unblocked", zap.String("agent_id", agentID))
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// agentFilterFromQuery собирает фильтры списка из query-параметров. label повторяемый: label=k=v.
+func agentFilterFromQuery(r *http.Request) domain.AgentFilter {
+	q := r.URL.Query()
+	f := domain.AgentFilter{
+		Team:           q.Get("team"),
+		Environment:    q.Get("environment"),
+		Owner:          q.Get("owner"),
+		IncludeDeleted: q.Get("include_deleted") == "true",
+	}
+	for _, l := range q["label"] {
+		k, v, _ := strings.Cut(l, "=")
+		if k == "" {
+			continue
+		}
+		if f.Labels == nil {
+			f.Labels = make(map[string]string)
+		}
+		f.Labels[k] = v
+	}
+	return f
+}
+
+// agentErrorStatus транслирует ошибки реестра агентов в HTTP-статус.
+func agentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrAgentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrAgentNameTaken):
+		return http.StatusConflict
+	}
+	return errorStatus(err)
+}
@@ -2,32 +2,161 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"go.uber.org/zap"
 )
 
 type AuditHandler struct {
 	service *service.AuditService
+	logger  *zap.Logger
 }
 
-func NewAuditHandler(s *service.AuditService) *AuditHandler {
-	return &AuditHandler{service: s}
+func NewAuditHandler(s *service.AuditService, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{service: s, logger: logger.Named("audit")}
 }
 
-// GetLogs возвращает список событий аудита с поддержкой фильтрации
-// GET /v1/audit?agent_id=...&cap_id=...
+// GetLogs возвращает страницу событий аудита с поддержкой фильтрации и курсорной пагинации
+// GET /v1/audit?agent_id=...&capability_id=...&status=FAILED,BLOCKED&mode=LIVE&trace_id=...&policy_id=...
+//
+//	&from=...&to=...&payload.project=X&sort=-risk_score&limit=100&cursor=...
 func (h *AuditHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
-	// Извлекаем фильтры из Query-параметров
-	agentID := r.URL.Query().Get("agent_id")
-	capID := r.URL.Query().Get("cap_id")
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.Query(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// Export выгружает события по фильтрам GetLogs потоком, без ограничения числа записей
+// GET /v1/audit/export?format=ndjson|ecs|cef|csv&from=2025-01-01T00:00:00Z&to=...&status=...
+func (h *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = audit.FormatNDJSON
+	}
+	if !audit.ValidFormat(format, false) {
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
 
-	logs, err := h.service.FetchLogs(r.Context(), agentID, capID)
+	ext := format
+	if format == audit.FormatECS {
+		ext = audit.FormatNDJSON // ECS — тот же NDJSON с другой схемой полей
+	}
+	w.Header().Set("Content-Type", audit.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, time.Now().UTC().Format("20060102T150405Z"), ext))
+	out := &countingWriter{w: w}
+	if err := h.service.Export(r.Context(), q, format, out); err != nil {
+		h.logger.Error("audit export failed", zap.String("format", format), zap.Error(err))
+		// Если строки уже ушли клиенту, статус не поменять: обрыв виден по неполной выгрузке
+		if out.n == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), errorStatus(err))
+		}
+	}
+}
+
+// GetTrace возвращает хронологию всех событий одного запроса
+// GET /v1/audit/traces/{trace_id}
+func (h *AuditHandler) GetTrace(w http.ResponseWriter, r *http.Request) {
+	timeline, err := h.service.Trace(r.Context(), chi.URLParam(r, "trace_id"))
+	if errors.Is(err, audit.ErrTraceNotFound) {
+		http.Error(w, "Trace not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to fetch audit logs", http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(logs)
+	json.NewEncoder(w).Encode(timeline)
+}
+
+func parseAuditQuery(v url.Values) (audit.Query, error) {
+	q := audit.Query{
+		AgentID:      v.Get("agent_id"),
+		CapabilityID: v.Get("capability_id"),
+		TraceID:      v.Get("trace_id"),
+		PolicyID:     v.Get("policy_id"),
+		Statuses:     listParam(v["status"]),
+		Modes:        listParam(v["mode"]),
+		Sort:         v.Get("sort"),
+	}
+	if q.CapabilityID == "" {
+		q.CapabilityID = v.Get("cap_id") // Прежнее имя параметра
+	}
+	for name, dst := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		if raw := v.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return q, fmt.Errorf("%s must be RFC3339", name)
+			}
+			*dst = &t
+		}
+	}
+	if raw := v.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return q, errors.New("limit must be a non-negative integer")
+		}
+		q.Limit = limit
+	}
+	if raw := v.Get("cursor"); raw != "" {
+		c, err := audit.ParseCursor(raw)
+		if err != nil {
+			return q, err
+		}
+		q.Cursor = c
+	}
+	for key, values := range v {
+		path, ok := strings.CutPrefix(key, "payload.")
+		if !ok {
+			continue
+		}
+		if q.Payload == nil {
+			q.Payload = make(map[string]any)
+		}
+		if err := audit.PayloadFilter(q.Payload, path, values[0]); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// listParam объединяет повторяющиеся параметры и списки через запятую: status=A,B&status=C.
+func listParam(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, strings.ToUpper(item))
+			}
+		}
+	}
+	return out
 }
@@ -2,8 +2,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 )
@@ -25,11 +28,145 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.service.GenerateToken(r.Context(), req.Username, req.Password)
 	if err != nil {
-		// не уточняем, что именно неверно (логин или пароль) для защиты от перебора
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// не уточняем, что именно неверно (логин, пароль, блокировка) для защиты от перебора
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// IssueAgentToken — токен-эндпоинт OAuth2 для агентов (grant_type=client_credentials).
+// Учетные данные принимаются в HTTP Basic (рекомендуется RFC 6749) или в теле формы.
+// POST /oauth/token
+func (h *AuthHandler) IssueAgentToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &domain.OAuthError{Code: domain.OAuthInvalidRequest, Description: "malformed form body"})
+		return
+	}
+
+	req := domain.ClientCredentialsRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		Scope:        r.PostForm.Get("scope"),
+	}
+	if id, secret, ok := r.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	resp, err := h.service.IssueAgentToken(r.Context(), req)
+	if err != nil {
+		var oauthErr *domain.OAuthError
+		if errors.As(err, &oauthErr) {
+			writeOAuthError(w, oauthErr)
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Токен нельзя кэшировать (RFC 6749, раздел 5.1)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RotateAgentSecret выпускает агенту новый client_secret. Секрет показывается один раз.
+// Тело необязательно: {"grace": "30m"} — сколько еще действуют прежние секреты ("0s" — отозвать сразу).
+// POST /v1/agents/{id}/credentials
+func (h *AuthHandler) RotateAgentSecret(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Grace *string `json:"grace"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	var grace *time.Duration
+	if body.Grace != nil {
+		g, err := time.ParseDuration(*body.Grace)
+		if err != nil {
+			http.Error(w, "Invalid grace (expected duration, e.g. 30m or 0s)", http.StatusBadRequest)
+			return
+		}
+		grace = &g
+	}
+
+	secret, err := h.service.RotateAgentSecret(r.Context(), chi.URLParam(r, "id"), grace)
+	if err != nil {
+		http.Error(w, err.Error(), agentErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(secret)
+}
+
+// ListAgentSecrets возвращает действующие секреты агента (метаданные, без самих секретов).
+// GET /v1/agents/{id}/credentials
+func (h *AuthHandler) ListAgentSecrets(w http.ResponseWriter, r *http.Request) {
+	creds, err := h.service.ListAgentSecrets(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), agentErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creds)
+}
+
+// RevokeAgentSecrets немедленно отзывает все секреты агента.
+// DELETE /v1/agents/{id}/credentials
+func (h *AuthHandler) RevokeAgentSecrets(w http.ResponseWriter, r *http.Request) {
+	n, err := h.service.RevokeAgentSecrets(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), agentErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": n})
+}
+
+// writeOAuthError отвечает в формате RFC 6749: invalid_client — 401 с WWW-Authenticate, остальное — 400.
+func writeOAuthError(w http.ResponseWriter, e *domain.OAuthError) {
+	status := http.StatusBadRequest
+	if e.Code == domain.OAuthInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="spaceai"`)
+		status = http.StatusUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// JWKS публикует открытые ключи подписи (текущий и прежние) для шлюзов и внешних проверяющих.
+// GET /.well-known/jwks.json
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.service.JWKS())
+}
+
+// Revoke отзывает токен по jti или все токены пользователя/агента по subject.
+// POST /v1/auth/revoke {"jti": "...", "expires_at": "..."} | {"subject": "..."}
+func (h *AuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	var req service.RevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.RevokeTokens(r.Context(), req); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"go.uber.org/zap"
+)
+
+// oidcBindingCookie — секрет, связывающий callback с браузером, начавшим вход.
+// Path ограничен /auth/oidc, чтобы cookie не уходила с остальными запросами к консоли.
+const (
+	oidcBindingCookie = "spaceai_oidc_binding"
+	oidcCookiePath    = "/auth/oidc"
+)
+
+type OIDCHandler struct {
+	service *service.OIDCService
+	logger  *zap.Logger
+}
+
+func NewOIDCHandler(s *service.OIDCService, logger *zap.Logger) *OIDCHandler {
+	return &OIDCHandler{service: s, logger: logger.Named("http-oidc")}
+}
+
+// Login перенаправляет браузер на страницу входа IdP.
+// GET /auth/oidc/login?return_to=/agents
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	redirect, binding, err := h.service.BeginLogin(r.Context(), r.URL.Query().Get("return_to"))
+	if err != nil {
+		status := errorStatus(err)
+		if status == http.StatusInternalServerError {
+			h.logger.Error("oidc login start failed", zap.Error(err))
+			status = http.StatusBadGateway // Чаще всего недоступен IdP (discovery)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// SameSite=Lax: cookie уходит при возврате с IdP (навигация верхнего уровня),
+	// но не при запросах, инициированных чужими сайтами в фоне
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		Path:     oidcCookiePath,
+		MaxAge:   int(h.service.StateTTL().Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// Callback принимает код от IdP и выдает токен консоли. Если вход начинался с return_to,
+// браузер возвращается туда с токеном во фрагменте URL (не попадает в логи серверов);
+// иначе токен отдается JSON, как в /auth/token.
+// Callback принимается только в браузере, где начинался вход (cookie привязки).
+// GET /auth/oidc/callback?code=...&state=...
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var binding string
+	if c, err := r.Cookie(oidcBindingCookie); err == nil {
+		binding = c.Value
+	}
+	// Cookie одноразовая, как и state: удаляем при любом исходе
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := r.URL.Query()
+	if idpErr := q.Get("error"); idpErr != "" {
+		h.logger.Warn("oidc provider returned error", zap.String("error", idpErr),
+			zap.String("description", q.Get("error_description")))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp, returnTo, err := h.service.CompleteLogin(r.Context(), q.Get("state"), q.Get("code"), binding)
+	switch {
+	case errors.Is(err, service.ErrOIDCState):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrOIDCAccessDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		// Детали (подпись, nonce, ответ IdP) — только в лог
+		h.logger.Error("oidc login failed", zap.Error(err))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if returnTo != "" {
+		fragment := url.Values{
+			"access_token": {resp.AccessToken},
+			"token_type":   {resp.TokenType},
+			"expires_in":   {strconv.FormatInt(resp.ExpiresIn, 10)},
+		}
+		http.Redirect(w, r, returnTo+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
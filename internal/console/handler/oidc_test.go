@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"go.uber.org/zap"
+)
+
+// fakeIdP — минимальный OIDC-провайдер: discovery, token endpoint и JWKS.
+// Код авторизации выдает тест (idp.authorize), id_token несет nonce из запроса входа.
+type fakeIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	nonces map[string]string // code -> nonce
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, nonces: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(auth.NewKeySet(&key.PublicKey).JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		nonce, ok := idp.nonces[r.FormValue("code")]
+		delete(idp.nonces, r.FormValue("code"))
+		idp.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                idp.URL,
+			"aud":                "console",
+			"sub":                "u-1",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"nonce":              nonce,
+			"preferred_username": "alice",
+			"email":              "alice@corp.io",
+			"groups":             []string{"operators"},
+		})
+		token.Header["kid"] = auth.KeyID(&key.PublicKey)
+		raw, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": raw, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize имитирует успешный вход пользователя на IdP и возвращает code и state для callback.
+func (idp *fakeIdP) authorize(t *testing.T, location string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, idp.URL+"/authorize") {
+		t.Fatalf("login redirect = %q, want IdP authorize endpoint", location)
+	}
+	code = "code-" + u.Query().Get("state")
+	idp.mu.Lock()
+	idp.nonces[code] = u.Query().Get("nonce")
+	idp.mu.Unlock()
+	return code, u.Query().Get("state")
+}
+
+// memOIDCUsers — OIDCUserRepository в памяти.
+type memOIDCUsers struct {
+	users map[string]*domain.User
+}
+
+func (r *memOIDCUsers) GetUserByExternalID(_ context.Context, _, externalID string) (*domain.User, error) {
+	if u, ok := r.users[externalID]; ok {
+		return u, nil
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *memOIDCUsers) CreateUser(_ context.Context, u *domain.User) error {
+	u.ID = "user-" + u.Username
+	r.users[u.ExternalID] = u
+	return nil
+}
+
+func (r *memOIDCUsers) SyncExternalUser(context.Context, *domain.User) error { return nil }
+func (r *memOIDCUsers) RecordLoginSuccess(context.Context, string) error     { return nil }
+
+func testOIDCHandler(t *testing.T, idp *fakeIdP) *OIDCHandler {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	consoleKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := infra.OIDCConfig{
+		Enabled:         true,
+		IssuerURL:       idp.URL,
+		ClientID:        "console",
+		ClientSecret:    "secret",
+		RedirectURL:     "https://console.corp.io/auth/oidc/callback",
+		UsernameClaim:   "preferred_username",
+		GroupsClaim:     "groups",
+		GroupMappings:   []infra.OIDCGroupMapping{{Group: "operators", Role: "operator"}},
+		JITProvisioning: true,
+		StateTTL:        10 * time.Minute,
+	}
+	tokens := service.NewAuthService(nil, consoleKey, auth.NewKeySet(&consoleKey.PublicKey), nil,
+		infra.AuthConfig{TokenTTL: time.Hour, BcryptCost: 4})
+	svc := service.NewOIDCService(auth.NewOIDCProvider(cfg, zap.NewNop()), tokens,
+		&memOIDCUsers{users: make(map[string]*domain.User)}, rdb, cfg, zap.NewNop())
+	return NewOIDCHandler(svc, zap.NewNop())
+}
+
+// login начинает вход и возвращает выданную cookie привязки и адрес IdP.
+func login(t *testing.T, h *OIDCHandler) (*http.Cookie, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?return_to=/agents", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", rec.Code, rec.Body)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcBindingCookie {
+			return c, rec.Header().Get("Location")
+		}
+	}
+	t.Fatalf("login did not set %s cookie", oidcBindingCookie)
+	return nil, ""
+}
+
+func callback(h *OIDCHandler, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	q := url.Values{"code": {code}, "state": {state}}
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+q.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	h.Callback(rec, req)
+	return rec
+}
+
+func TestOIDCLoginCookie(t *testing.T) {
+	h := testOIDCHandler(t, newFakeIdP(t))
+	c, _ := login(t, h)
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie HttpOnly=%v Secure=%v SameSite=%v, want HttpOnly, Secure, Lax", c.HttpOnly, c.Secure, c.SameSite)
+	}
+	if c.Path != oidcCookiePath || c.MaxAge != 600 || c.Value == "" {
+		t.Errorf("cookie path=%q max-age=%d value=%q", c.Path, c.MaxAge, c.Value)
+	}
+}
+
+func TestOIDCCallbackBinding(t *testing.T) {
+	tests := []struct {
+		name       string
+		cookie     func(own, foreign *http.Cookie) *http.Cookie
+		wantStatus int
+	}{
+		{name: "same browser", cookie: func(own, _ *http.Cookie) *http.Cookie { return own }, wantStatus: http.StatusFound},
+		{name: "no cookie", cookie: func(_, _ *http.Cookie) *http.Cookie { return nil }, wantStatus: http.StatusBadRequest},
+		{
+			name: "tampered cookie",
+			cookie: func(own, _ *http.Cookie) *http.Cookie {
+				return &http.Cookie{Name: own.Name, Value: own.Value + "x"}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		// Login CSRF: атакующий начал вход сам и подсовывает жертве свой callback
+		{name: "cookie of another login", cookie: func(_, foreign *http.Cookie) *http.Cookie { return foreign }, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			h := testOIDCHandler(t, idp)
+			own, location := login(t, h)
+			foreign, _ := login(t, h)
+			code, state := idp.authorize(t, location)
+
+			rec := callback(h, code, state, tt.cookie(own, foreign))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("callback status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusFound && !strings.HasPrefix(rec.Header().Get("Location"), "/agents#access_token=") {
+				t.Errorf("redirect = %q, want /agents with token fragment", rec.Header().Get("Location"))
+			}
+			cleared := false
+			for _, c := range rec.Result().Cookies() {
+				cleared = cleared || (c.Name == oidcBindingCookie && c.MaxAge < 0)
+			}
+			if !cleared {
+				t.Error("callback did not clear binding cookie")
+			}
+
+			// State одноразовый: даже верная cookie после первой попытки не поможет
+			if rec := callback(h, code, state, own); rec.Code != http.StatusBadRequest {
+				t.Errorf("replay status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
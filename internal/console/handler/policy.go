@@ -1,14 +1,22 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/policy"
 )
 
+// maxBundleSize ограничивает размер загружаемого бандла политик
+const maxBundleSize = 10 << 20
+
 type PolicyHandler struct {
 	service *service.PolicyService
 }
@@ -67,7 +75,7 @@ func (h *PolicyHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.service.Create(r.Context(), &p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -84,12 +92,41 @@ func (h *PolicyHandler) Update(w http.ResponseWriter, r *http.Request) {
 	p.ID = id
 
 	if err := h.service.Update(r.Context(), &p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// BreakGlass выдает временный аварийный доступ, который истекает автоматически
+// POST /v1/policies/break-glass {"agent_id": "...", "capability_id": "...", "ttl": "2h", "reason": "INC-42"}
+func (h *PolicyHandler) BreakGlass(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		service.BreakGlassRequest
+		TTL string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ttl, err := time.ParseDuration(body.TTL)
+	if err != nil {
+		http.Error(w, "Invalid ttl (expected duration, e.g. 30m or 2h)", http.StatusBadRequest)
+		return
+	}
+	req := body.BreakGlassRequest
+	req.TTL = ttl
+
+	p, err := h.service.GrantBreakGlass(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
 // Delete удаляет политику и инициирует инвалидацию кэша
 func (h *PolicyHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -99,3 +136,143 @@ func (h *PolicyHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Versions возвращает историю изменений политики (автор, diff, время)
+// GET /v1/policies/{id}/versions
+func (h *PolicyHandler) Versions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.service.Versions(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Failed to fetch policy versions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// Rollback возвращает политику к указанной версии
+// POST /v1/policies/{id}/rollback {"version": 3}
+func (h *PolicyHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.service.Rollback(r.Context(), chi.URLParam(r, "id"), req.Version)
+	if errors.Is(err, domain.ErrPolicyVersionNotFound) {
+		http.Error(w, "Policy version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Откат к версии-удалению возвращает пустой ответ: политики больше нет
+	if p == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// RollbackAll приводит весь набор политик к состоянию на момент времени
+// POST /v1/policies/rollback {"at": "2025-01-31T12:00:00Z"}
+func (h *PolicyHandler) RollbackAll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		At time.Time `json:"at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.At.IsZero() {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.At.After(time.Now()) {
+		http.Error(w, "Rollback point is in the future", http.StatusBadRequest)
+		return
+	}
+
+	changed, err := h.service.RollbackAll(r.Context(), req.At)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"changed": changed})
+}
+
+// ExportBundle выгружает все политики одним бандлом
+// GET /v1/policies/bundle?format=yaml|json
+func (h *PolicyHandler) ExportBundle(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+
+	bundle, err := h.service.ExportBundle(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to export policies: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := bundle.Marshal(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/yaml")
+	}
+	w.Write(data)
+}
+
+// PlanBundle показывает изменения без применения (dry-run)
+// POST /v1/policies/bundle/plan (тело — YAML или JSON бандл)
+func (h *PolicyHandler) PlanBundle(w http.ResponseWriter, r *http.Request) {
+	h.handleBundle(w, r, h.service.PlanBundle)
+}
+
+// ApplyBundle атомарно применяет бандл
+// POST /v1/policies/bundle/apply
+func (h *PolicyHandler) ApplyBundle(w http.ResponseWriter, r *http.Request) {
+	h.handleBundle(w, r, h.service.ApplyBundle)
+}
+
+func (h *PolicyHandler) handleBundle(w http.ResponseWriter, r *http.Request,
+	action func(ctx context.Context, b *policy.Bundle) (*domain.BundlePlan, error)) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBundleSize))
+	if err != nil {
+		http.Error(w, "Failed to read bundle", http.StatusBadRequest)
+		return
+	}
+	bundle, err := policy.ParseBundle(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := action(r.Context(), bundle)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundlePlanResponse{Summary: plan.Summary(), Plan: plan})
+}
+
+// bundlePlanResponse — ответ plan/apply: сводка и детальный план.
+type bundlePlanResponse struct {
+	Summary string             `json:"summary"`
+	Plan    *domain.BundlePlan `json:"plan"`
+}
+
+// errorStatus транслирует ошибки сервиса в HTTP-статус: ошибки валидации — 400, остальное — 500.
+func errorStatus(err error) int {
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
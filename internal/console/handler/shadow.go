@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// ShadowHandler — CRUD теневых политик и отчеты о расхождениях (Shadow Mode).
+type ShadowHandler struct {
+	service *service.ShadowService
+}
+
+func NewShadowHandler(s *service.ShadowService) *ShadowHandler {
+	return &ShadowHandler{service: s}
+}
+
+// List возвращает весь кандидатный набор
+// GET /v1/policies/shadow
+func (h *ShadowHandler) List(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.service.GetAll(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch shadow policies", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// Get GET /v1/policies/shadow/{id}
+func (h *ShadowHandler) Get(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.service.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve shadow policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if policy == nil {
+		http.Error(w, "Shadow policy not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// Create POST /v1/policies/shadow
+func (h *ShadowHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var p domain.Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Create(r.Context(), &p); err != nil {
+		http.Error(w, err.Error(), shadowErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Update PUT /v1/policies/shadow/{id}
+func (h *ShadowHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var p domain.Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	p.ID = chi.URLParam(r, "id")
+
+	if err := h.service.Update(r.Context(), &p); err != nil {
+		http.Error(w, err.Error(), shadowErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete DELETE /v1/policies/shadow/{id}
+func (h *ShadowHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Summary агрегирует расхождения по теневым политикам
+// GET /v1/policies/shadow/summary?window=24h
+func (h *ShadowHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	summary, err := h.service.Summary(r.Context(), window)
+	if err != nil {
+		http.Error(w, "Failed to build shadow summary", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// Divergences возвращает последние расхождения
+// GET /v1/policies/shadow/divergences?shadow_policy_id=...&limit=100
+func (h *ShadowHandler) Divergences(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	items, err := h.service.Divergences(r.Context(), r.URL.Query().Get("shadow_policy_id"), limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch shadow divergences", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// shadowErrorStatus транслирует ошибки теневого набора в HTTP-статус.
+func shadowErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrShadowPolicyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrShadowPolicyExists):
+		return http.StatusConflict
+	}
+	return errorStatus(err)
+}
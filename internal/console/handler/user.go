@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+type UserHandler struct {
+	service *service.UserService
+}
+
+func NewUserHandler(s *service.UserService) *UserHandler {
+	return &UserHandler{service: s}
+}
+
+// List возвращает пользователей консоли.
+// GET /v1/users
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	users, err := h.service.List(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// Get возвращает пользователя.
+// GET /v1/users/{id}
+func (h *UserHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user, err := h.service.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), userErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// Create создает пользователя.
+// POST /v1/users {"username": "alice", "email": "alice@corp.io", "password": "...", "role": "operator"}
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req domain.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), userErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// Update меняет роль, email, scopes или отключает пользователя.
+// PATCH /v1/users/{id} {"role": "viewer"} | {"disabled": true}
+func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var patch domain.UserPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Update(r.Context(), chi.URLParam(r, "id"), patch)
+	if err != nil {
+		http.Error(w, err.Error(), userErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ResetPassword задает пароль пользователю (администратор). Без тела генерируется
+// временный пароль, который показывается один раз.
+// POST /v1/users/{id}/password {"password": "..."}
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Password string `json:"password"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	generated, err := h.service.ResetPassword(r.Context(), chi.URLParam(r, "id"), body.Password)
+	if err != nil {
+		http.Error(w, err.Error(), userErrorStatus(err))
+		return
+	}
+	if generated == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"temporary_password": generated})
+}
+
+// ChangePassword меняет пароль текущего пользователя. После смены нужно войти заново.
+// POST /v1/auth/password {"current_password": "...", "new_password": "..."}
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ChangePassword(r.Context(), body.CurrentPassword, body.NewPassword); err != nil {
+		http.Error(w, err.Error(), userErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrUserExists), errors.Is(err, domain.ErrLastAdmin):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		return http.StatusForbidden
+	}
+	return errorStatus(err)
+}
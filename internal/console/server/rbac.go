@@ -0,0 +1,168 @@
+package server
+
+/*
+Файл rbac.go реализует проверку прав на уровне маршрутов консоли.
+
+Права вычисляются из роли пользователя (claim role, колонка users.role) и его персональных
+scopes. Отказ — это 403 и запись в admin_audit: попытка оператора удалить политику или
+принять решение по заявке должна быть видна службе безопасности, а не только в логах.
+
+Разрешенные изменяющие вызовы (POST/PUT/PATCH/DELETE) тоже попадают в admin_audit: кто,
+какое действие, над каким объектом, с каким результатом и состояние объекта до и после
+(снимки кладут сервисы, см. service/admin_audit.go).
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"go.uber.org/zap"
+)
+
+// AdminAuditRecorder — хранилище журнала административных действий.
+type AdminAuditRecorder interface {
+	WriteAdminAudit(ctx context.Context, e *domain.AdminAuditEntry) error
+}
+
+// PermissionGuard выдает middleware проверки прав для маршрутов.
+type PermissionGuard struct {
+	roles    domain.RolePermissions
+	recorder AdminAuditRecorder
+	logger   *zap.Logger
+}
+
+func NewPermissionGuard(roles domain.RolePermissions, recorder AdminAuditRecorder, logger *zap.Logger) *PermissionGuard {
+	return &PermissionGuard{roles: roles, recorder: recorder, logger: logger.Named("rbac")}
+}
+
+// Require пропускает запрос, только если у пользователя есть право perm.
+// Должен стоять после auth.NewMiddleware (user_id, user_role и user_scopes в контексте).
+// Изменяющие вызовы записываются в admin_audit с action = perm.
+func (g *PermissionGuard) Require(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			role, _ := ctx.Value("user_role").(string)
+			scopes, _ := ctx.Value("user_scopes").(map[string]bool)
+
+			if g.roles.Allowed(role, scopes, perm) {
+				g.serveAudited(w, r, perm, next)
+				return
+			}
+
+			g.recordDenied(r, role, perm)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":      "forbidden",
+				"permission": perm,
+			})
+		})
+	}
+}
+
+// Audit записывает изменяющие вызовы маршрута без проверки права (например, смена своего пароля).
+func (g *PermissionGuard) Audit(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			g.serveAudited(w, r, action, next)
+		})
+	}
+}
+
+// serveAudited вызывает обработчик и записывает результат изменяющего вызова в admin_audit.
+func (g *PermissionGuard) serveAudited(w http.ResponseWriter, r *http.Request, action string, next http.Handler) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, change := service.WithAdminChange(r.Context())
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	defer func() {
+		// Паника обработчика — тоже неудачная попытка изменения; дальше ее обработает Recoverer
+		if rec := recover(); rec != nil {
+			g.recordChange(r, action, change, http.StatusInternalServerError)
+			panic(rec)
+		}
+	}()
+	next.ServeHTTP(ww, r.WithContext(ctx))
+
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK // Обработчик ничего не записал — net/http ответит 200
+	}
+	g.recordChange(r, action, change, status)
+}
+
+func (g *PermissionGuard) recordChange(r *http.Request, action string, change *service.AdminChange, status int) {
+	outcome := domain.AdminOutcomeSuccess
+	if status >= http.StatusBadRequest {
+		outcome = domain.AdminOutcomeFailed
+	}
+	entry := g.newEntry(r, action, outcome)
+	entry.Status = status
+	entry.TargetType, entry.TargetID = change.TargetType, change.TargetID
+	entry.Before, entry.After = change.Before, change.After
+
+	// Сервис не отметил объект (ошибка до изменения) — берем ресурс из права и id из маршрута
+	if entry.TargetType == "" {
+		entry.TargetType, _, _ = strings.Cut(action, ":")
+	}
+	if entry.TargetID == "" {
+		entry.TargetID = chi.URLParam(r, "id")
+	}
+	g.write(r, entry)
+}
+
+func (g *PermissionGuard) recordDenied(r *http.Request, role, perm string) {
+	entry := g.newEntry(r, perm, domain.AdminOutcomeDenied)
+	entry.Status = http.StatusForbidden
+	entry.TargetType, _, _ = strings.Cut(perm, ":")
+	entry.TargetID = chi.URLParam(r, "id")
+
+	g.logger.Warn("permission denied",
+		zap.String("user_id", entry.UserID),
+		zap.String("role", role),
+		zap.String("permission", perm),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path))
+
+	g.write(r, entry)
+}
+
+func (g *PermissionGuard) newEntry(r *http.Request, action, outcome string) *domain.AdminAuditEntry {
+	userID, _ := r.Context().Value("user_id").(string)
+	role, _ := r.Context().Value("user_role").(string)
+	return &domain.AdminAuditEntry{
+		UserID:     userID,
+		Role:       role,
+		Action:     action,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Outcome:    outcome,
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  middleware.GetReqID(r.Context()),
+	}
+}
+
+func (g *PermissionGuard) write(r *http.Request, entry *domain.AdminAuditEntry) {
+	// Запись не должна зависеть от отмены клиентского запроса
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 2*time.Second)
+	defer cancel()
+	if err := g.recorder.WriteAdminAudit(ctx, entry); err != nil {
+		g.logger.Error("failed to record admin action",
+			zap.String("action", entry.Action),
+			zap.String("outcome", entry.Outcome),
+			zap.Error(err))
+	}
+}
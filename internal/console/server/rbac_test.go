@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"go.uber.org/zap"
+)
+
+type memAdminAudit struct {
+	entries []domain.AdminAuditEntry
+}
+
+func (m *memAdminAudit) WriteAdminAudit(_ context.Context, e *domain.AdminAuditEntry) error {
+	m.entries = append(m.entries, *e)
+	return nil
+}
+
+// TestPermissionGuard: отказ RBAC — 403 без вызова обработчика и запись denied в admin_audit;
+// разрешенные изменяющие вызовы записываются с результатом, чтение — нет.
+func TestPermissionGuard(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		method      string
+		status      int // Ответ обработчика
+		wantCode    int
+		wantCalled  bool
+		wantOutcome string // "" — записи нет
+	}{
+		{name: "viewer deletes policy", role: domain.RoleViewer, method: http.MethodDelete, wantCode: http.StatusForbidden, wantOutcome: domain.AdminOutcomeDenied},
+		{name: "viewer reads policy", role: domain.RoleViewer, method: http.MethodGet, status: http.StatusOK, wantCode: http.StatusOK, wantCalled: true},
+		{name: "admin deletes policy", role: domain.RoleAdmin, method: http.MethodDelete, status: http.StatusNoContent, wantCode: http.StatusNoContent, wantCalled: true, wantOutcome: domain.AdminOutcomeSuccess},
+		{name: "failed change", role: domain.RoleAdmin, method: http.MethodDelete, status: http.StatusConflict, wantCode: http.StatusConflict, wantCalled: true, wantOutcome: domain.AdminOutcomeFailed},
+		{name: "no role", method: http.MethodGet, wantCode: http.StatusForbidden, wantOutcome: domain.AdminOutcomeDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &memAdminAudit{}
+			guard := NewPermissionGuard(domain.NewRolePermissions(nil), recorder, zap.NewNop())
+
+			called := false
+			r := chi.NewRouter()
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					ctx := context.WithValue(req.Context(), "user_id", "u1")
+					ctx = context.WithValue(ctx, "user_role", tt.role)
+					next.ServeHTTP(w, req.WithContext(ctx))
+				})
+			})
+			r.With(guard.Require(domain.PermPoliciesWrite)).Delete("/v1/policies/{id}", func(w http.ResponseWriter, _ *http.Request) {
+				called = true
+				w.WriteHeader(tt.status)
+			})
+			r.With(guard.Require(domain.PermPoliciesRead)).Get("/v1/policies/{id}", func(w http.ResponseWriter, _ *http.Request) {
+				called = true
+				w.WriteHeader(tt.status)
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, "/v1/policies/p-1", nil))
+			if rec.Code != tt.wantCode || called != tt.wantCalled {
+				t.Fatalf("status = %d, handler called = %v, want %d, %v", rec.Code, called, tt.wantCode, tt.wantCalled)
+			}
+
+			if tt.wantOutcome == "" {
+				if len(recorder.entries) != 0 {
+					t.Errorf("unexpected admin audit entries: %+v", recorder.entries)
+				}
+				return
+			}
+			if len(recorder.entries) != 1 {
+				t.Fatalf("admin audit entries = %d, want 1", len(recorder.entries))
+			}
+			e := recorder.entries[0]
+			if e.Outcome != tt.wantOutcome || e.Status != tt.wantCode || e.UserID != "u1" || e.Role != tt.role ||
+				e.TargetType != "policies" || e.TargetID != "p-1" || e.Method != tt.method {
+				t.Errorf("admin audit entry = %+v", e)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/handler"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/console/service"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
 	"go.uber.org/zap"
@@ -20,14 +21,20 @@ type ConsoleServer struct {
 	// Интерфейс для проверки токенов (RS256)
 	// Реализуется через embedding BaseValidator в AuthService
 	authValidator auth.TokenValidator
+	// Проверка прав на маршрутах (RBAC)
+	guard *PermissionGuard
 
 	// Обработчики бизнес-доменов
-	authHandler     *handler.AuthHandler      // /auth/token
-	agentHandler    *handler.AgentHandler     // /v1/agents
-	policyHandler   *handler.PolicyHandler    // /v1/policies
-	approvalHandler *handler.ApprovalHandler  // /v1/approvals (HITL)
-	dashHandler     *handler.DashboardHandler // /api/v1/dashboard
-	auditHandler    *handler.AuditHandler     // /v1/audit (Logs)
+	authHandler     *handler.AuthHandler       // /auth/token
+	agentHandler    *handler.AgentHandler      // /v1/agents
+	policyHandler   *handler.PolicyHandler     // /v1/policies
+	shadowHandler   *handler.ShadowHandler     // /v1/policies/shadow (Shadow Mode)
+	approvalHandler *handler.ApprovalHandler   // /v1/approvals (HITL)
+	dashHandler     *handler.DashboardHandler  // /api/v1/dashboard
+	auditHandler    *handler.AuditHandler      // /v1/audit (Logs)
+	adminAuditH     *handler.AdminAuditHandler // /v1/admin-audit (действия пользователей консоли)
+	userHandler     *handler.UserHandler       // /v1/users
+	oidcHandler     *handler.OIDCHandler       // /auth/oidc (nil — вход через IdP выключен)
 }
 
 // NewConsoleServer инициализирует сервер админки со всеми зависимостями
@@ -35,24 +42,34 @@ func NewConsoleServer(
 	cfg *infra.Config,
 	logger *zap.Logger,
 	agentService *service.AgentService,
+	adminAudit AdminAuditRecorder,
 	authH *handler.AuthHandler,
 	agentH *handler.AgentHandler,
 	policyH *handler.PolicyHandler,
+	shadowH *handler.ShadowHandler,
 	approvalH *handler.ApprovalHandler,
 	dashH *handler.DashboardHandler,
 	auditH *handler.AuditHandler,
+	adminAuditH *handler.AdminAuditHandler,
+	userH *handler.UserHandler,
+	oidcH *handler.OIDCHandler,
 ) *ConsoleServer {
 	s := &ConsoleServer{
 		router:          chi.NewRouter(),
 		logger:          logger.Named("console-api"),
 		cfg:             cfg,
-		authService:     agentService,
+		authValidator:   agentService,
+		guard:           NewPermissionGuard(domain.NewRolePermissions(cfg.Auth.Roles), adminAudit, logger),
 		authHandler:     authH,
 		agentHandler:    agentH,
 		policyHandler:   policyH,
+		shadowHandler:   shadowH,
 		approvalHandler: approvalH,
 		dashHandler:     dashH,
 		auditHandler:    auditH,
+		adminAuditH:     adminAuditH,
+		userHandler:     userH,
+		oidcHandler:     oidcH,
 	}
 
 	s.routes()
@@ -72,6 +89,15 @@ func (s *ConsoleServer) routes() {
 	r.Group(func(r chi.Router) {
 		// Логин должен быть доступен без токена
 		r.Post("/auth/token", s.authHandler.Login)
+		// Токены агентов: OAuth2 Client Credentials (client_id/client_secret вместо пароля)
+		r.Post("/oauth/token", s.authHandler.IssueAgentToken)
+		// Открытые ключи подписи: шлюзы обновляют по ним набор ключей при ротации
+		r.Get("/.well-known/jwks.json", s.authHandler.JWKS)
+		// Единый вход через корпоративный IdP (OIDC Authorization Code + PKCE)
+		if s.oidcHandler != nil {
+			r.Get("/auth/oidc/login", s.oidcHandler.Login)
+			r.Get("/auth/oidc/callback", s.oidcHandler.Callback)
+		}
 
 		// Опционально: Healthcheck для мониторинга
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -80,45 +106,105 @@ func (s *ConsoleServer) routes() {
 	})
 
 	// --- 3. ЗАЩИЩЕННЫЙ ПЕРИМЕТР (Требуют RS256 токен) ---
+	// Каждый маршрут дополнительно требует право (RBAC): роль пользователя -> права, см. domain/rbac.go
 	r.Group(func(r chi.Router) {
 		// Подключаем универсальный Middleware только для этой группы
-		r.Use(auth.NewMiddleware(s.authService, s.logger))
+		r.Use(auth.NewMiddleware(s.authValidator, s.logger))
+		can := s.guard.Require
 
 		// Dashboard & Stats
-		r.Get("/api/v1/dashboard/stats", s.dashHandler.GetStats)
+		r.With(can(domain.PermDashboardRead)).Get("/api/v1/dashboard/stats", s.dashHandler.GetStats)
+
+		// Отзыв токенов до истечения срока (по jti или subject)
+		r.With(can(domain.PermTokensRevoke)).Post("/v1/auth/revoke", s.authHandler.Revoke)
+		// Смена собственного пароля доступна любому пользователю (но попадает в журнал)
+		r.With(s.guard.Audit("auth:password")).Post("/v1/auth/password", s.userHandler.ChangePassword)
+
+		// Пользователи консоли
+		r.Route("/v1/users", func(r chi.Router) {
+			r.With(can(domain.PermUsersRead)).Get("/", s.userHandler.List)
+			r.With(can(domain.PermUsersWrite)).Post("/", s.userHandler.Create)
+			r.Route("/{id}", func(r chi.Router) {
+				r.With(can(domain.PermUsersRead)).Get("/", s.userHandler.Get)
+				r.With(can(domain.PermUsersWrite)).Patch("/", s.userHandler.Update)               // Роль, email, scopes, отключение
+				r.With(can(domain.PermUsersWrite)).Post("/password", s.userHandler.ResetPassword) // Сброс пароля и снятие блокировки
+			})
+		})
 
 		// Управление Агентами (Status, Kill-Switch)
 		r.Route("/v1/agents", func(r chi.Router) {
-			r.Get("/", s.agentHandler.List) // Список всех агентов
+			r.With(can(domain.PermAgentsRead)).Get("/", s.agentHandler.List)     // Список агентов (фильтры: team, environment, owner, label)
+			r.With(can(domain.PermAgentsWrite)).Post("/", s.agentHandler.Create) // Регистрация агента
 			r.Route("/{id}", func(r chi.Router) {
-				r.Get("/", s.agentHandler.Get)                // Информация об агенте
-				r.Post("/block", s.agentHandler.Block)        // Мгновенная блокировка (Kill-switch)
-				r.Post("/unblock", s.agentHandler.Unblock)    // Разблокировка
-				r.Post("/sandbox", s.agentHandler.SetSandbox) // Перевод в режим песочницы
+				r.With(can(domain.PermAgentsRead)).Get("/", s.agentHandler.Get)                 // Информация об агенте
+				r.With(can(domain.PermAgentsWrite)).Patch("/", s.agentHandler.Update)           // Переименование, метки, владельцы, scopes
+				r.With(can(domain.PermAgentsWrite)).Delete("/", s.agentHandler.Delete)          // Вывод из эксплуатации (soft delete)
+				r.With(can(domain.PermAgentsBlock)).Post("/block", s.agentHandler.Block)        // Мгновенная блокировка (Kill-switch)
+				r.With(can(domain.PermAgentsBlock)).Post("/unblock", s.agentHandler.Unblock)    // Разблокировка
+				r.With(can(domain.PermAgentsBlock)).Post("/sandbox", s.agentHandler.SetSandbox) // Перевод в режим песочницы
+
+				// Секреты Client Credentials агента
+				r.With(can(domain.PermAgentsRead)).Get("/credentials", s.authHandler.ListAgentSecrets)
+				r.With(can(domain.PermAgentsCredentials)).Post("/credentials", s.authHandler.RotateAgentSecret)    // Выпуск/ротация с льготным периодом
+				r.With(can(domain.PermAgentsCredentials)).Delete("/credentials", s.authHandler.RevokeAgentSecrets) // Немедленный отзыв всех секретов
 			})
 		})
 
 		// Управление Политиками (Policy Engine)
 		r.Route("/v1/policies", func(r chi.Router) {
-			r.Get("/", s.policyHandler.List)    // Все активные политики
-			r.Post("/", s.policyHandler.Create) // Создание новой (например, Wildcard '*')
+			r.With(can(domain.PermPoliciesRead)).Get("/", s.policyHandler.List)                         // Все активные политики
+			r.With(can(domain.PermPoliciesWrite)).Post("/", s.policyHandler.Create)                     // Создание новой (например, Wildcard '*')
+			r.With(can(domain.PermPoliciesWrite)).Post("/rollback", s.policyHandler.RollbackAll)        // Откат всего набора на момент времени
+			r.With(can(domain.PermPoliciesBreakGlass)).Post("/break-glass", s.policyHandler.BreakGlass) // Временный аварийный доступ с TTL
+
+			// Policy-as-Code: экспорт, dry-run и атомарное применение бандла
+			r.Route("/bundle", func(r chi.Router) {
+				r.With(can(domain.PermPoliciesRead)).Get("/", s.policyHandler.ExportBundle)
+				r.With(can(domain.PermPoliciesRead)).Post("/plan", s.policyHandler.PlanBundle) // Dry-run ничего не меняет
+				r.With(can(domain.PermPoliciesWrite)).Post("/apply", s.policyHandler.ApplyBundle)
+			})
+
+			// Теневой набор: оценивается на реальном трафике, но не влияет на решение
+			r.Route("/shadow", func(r chi.Router) {
+				r.With(can(domain.PermPoliciesRead)).Get("/", s.shadowHandler.List)
+				r.With(can(domain.PermPoliciesWrite)).Post("/", s.shadowHandler.Create)
+				r.With(can(domain.PermPoliciesRead)).Get("/summary", s.shadowHandler.Summary)         // Агрегат расхождений за окно
+				r.With(can(domain.PermPoliciesRead)).Get("/divergences", s.shadowHandler.Divergences) // Последние расхождения
+				r.Route("/{id}", func(r chi.Router) {
+					r.With(can(domain.PermPoliciesRead)).Get("/", s.shadowHandler.Get)
+					r.With(can(domain.PermPoliciesWrite)).Put("/", s.shadowHandler.Update)
+					r.With(can(domain.PermPoliciesWrite)).Delete("/", s.shadowHandler.Delete)
+				})
+			})
+
 			r.Route("/{id}", func(r chi.Router) {
-				r.Get("/", s.policyHandler.Get)       // Детали политики
-				r.Put("/", s.policyHandler.Update)    // Редактирование (Conditions/Effect)
-				r.Delete("/", s.policyHandler.Delete) // Удаление
+				r.With(can(domain.PermPoliciesRead)).Get("/", s.policyHandler.Get)                // Детали политики
+				r.With(can(domain.PermPoliciesWrite)).Put("/", s.policyHandler.Update)            // Редактирование (Conditions/Effect)
+				r.With(can(domain.PermPoliciesWrite)).Delete("/", s.policyHandler.Delete)         // Удаление
+				r.With(can(domain.PermPoliciesRead)).Get("/versions", s.policyHandler.Versions)   // История изменений
+				r.With(can(domain.PermPoliciesWrite)).Post("/rollback", s.policyHandler.Rollback) // Откат к версии
 			})
 		})
 
 		// Human-in-the-loop (Approvals)
 		r.Route("/v1/approvals", func(r chi.Router) {
-			r.Get("/", s.approvalHandler.List) // Очередь запросов на проверку
+			r.With(can(domain.PermApprovalsRead)).Get("/", s.approvalHandler.List) // Очередь запросов на проверку
 			r.Route("/{id}", func(r chi.Router) {
-				r.Get("/", s.approvalHandler.GetDetails)
-				r.Post("/decide", s.approvalHandler.Decide) // Approve/Reject + Redis Publish
+				r.With(can(domain.PermApprovalsRead)).Get("/", s.approvalHandler.GetDetails)
+				r.With(can(domain.PermApprovalsDecide)).Post("/decide", s.approvalHandler.Decide) // Approve/Reject + Redis Publish
 			})
 		})
 		// Аудит и Логи (Observability)
-		r.Get("/v1/audit", s.auditHandler.GetLogs)
+		r.Route("/v1/audit", func(r chi.Router) {
+			r.With(can(domain.PermAuditRead)).Get("/", s.auditHandler.GetLogs)
+			r.With(can(domain.PermAuditRead)).Get("/export", s.auditHandler.Export)              // NDJSON, ECS, CEF, CSV
+			r.With(can(domain.PermAuditRead)).Get("/traces/{trace_id}", s.auditHandler.GetTrace) // Хронология запроса
+		})
+		// Журнал административных действий: кто и что менял в консоли (до/после)
+		r.Route("/v1/admin-audit", func(r chi.Router) {
+			r.With(can(domain.PermAdminAuditRead)).Get("/", s.adminAuditH.List)
+			r.With(can(domain.PermAdminAuditRead)).Get("/export", s.adminAuditH.Export) // NDJSON
+		})
 	})
 }
 
@@ -0,0 +1,142 @@
+package service
+
+/*
+Файл admin_audit.go — журнал административных действий консоли.
+
+Кто, когда и с какого адреса вызвал изменяющий маршрут, фиксирует PermissionGuard (server/rbac.go).
+Что именно изменилось, знает только сервис: он записывает снимки объекта до и после изменения
+в AdminChange из контекста запроса. Снимки сериализуются сразу, поэтому дальнейшие мутации
+объекта (patch.Apply и т.п.) их не затрагивают.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// Типы объектов в admin_audit.target_type. Совпадают с ресурсом права ("agents:block" -> agents),
+// которым журнал помечает вызов, если сервис не успел отметить объект.
+const (
+	TargetAgent        = "agents"
+	TargetPolicy       = "policies"
+	TargetShadowPolicy = "shadow-policies"
+	TargetPolicySet    = "policy-set" // Бандл и откат всего набора
+	TargetApproval     = "approvals"
+	TargetUser         = "users"
+	TargetTokens       = "tokens"
+)
+
+// Пределы выборки журнала через API (экспорт не ограничен)
+const (
+	DefaultAdminAuditLimit = 100
+	MaxAdminAuditLimit     = 1000
+)
+
+// AdminChange — объект и его состояние до/после изменения в рамках одного запроса.
+type AdminChange struct {
+	TargetType string
+	TargetID   string
+	Before     json.RawMessage
+	After      json.RawMessage
+}
+
+type adminChangeKey struct{}
+
+// WithAdminChange подготавливает контекст запроса к сбору изменения.
+func WithAdminChange(ctx context.Context) (context.Context, *AdminChange) {
+	c := &AdminChange{}
+	return context.WithValue(ctx, adminChangeKey{}, c), c
+}
+
+// recordBefore сохраняет состояние объекта до изменения (no-op вне запроса консоли).
+func recordBefore(ctx context.Context, targetType, targetID string, v any) {
+	if c := changeFrom(ctx, targetType, targetID); c != nil {
+		c.Before = snapshot(v)
+	}
+}
+
+// recordAfter сохраняет состояние объекта после изменения.
+func recordAfter(ctx context.Context, targetType, targetID string, v any) {
+	if c := changeFrom(ctx, targetType, targetID); c != nil {
+		c.After = snapshot(v)
+	}
+}
+
+func changeFrom(ctx context.Context, targetType, targetID string) *AdminChange {
+	c, _ := ctx.Value(adminChangeKey{}).(*AdminChange)
+	if c == nil {
+		return nil
+	}
+	c.TargetType = targetType
+	if targetID != "" {
+		c.TargetID = targetID
+	}
+	return c
+}
+
+func snapshot(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// AdminAuditReader — чтение журнала административных действий.
+type AdminAuditReader interface {
+	QueryAdminAudit(ctx context.Context, f domain.AdminAuditFilter) ([]domain.AdminAuditEntry, error)
+	StreamAdminAudit(ctx context.Context, f domain.AdminAuditFilter, fn func(*domain.AdminAuditEntry) error) error
+}
+
+type AdminAuditService struct {
+	repo AdminAuditReader
+}
+
+func NewAdminAuditService(repo AdminAuditReader) *AdminAuditService {
+	return &AdminAuditService{repo: repo}
+}
+
+// Query возвращает записи журнала по фильтрам (новые первыми).
+func (s *AdminAuditService) Query(ctx context.Context, f domain.AdminAuditFilter) ([]domain.AdminAuditEntry, error) {
+	if err := validateAdminAuditFilter(f); err != nil {
+		return nil, err
+	}
+	switch {
+	case f.Limit <= 0:
+		f.Limit = DefaultAdminAuditLimit
+	case f.Limit > MaxAdminAuditLimit:
+		f.Limit = MaxAdminAuditLimit
+	}
+	entries, err := s.repo.QueryAdminAudit(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("admin_audit: failed to query: %w", err)
+	}
+	return entries, nil
+}
+
+// Export пишет записи в w в формате NDJSON (одна запись — одна строка) потоком из БД.
+func (s *AdminAuditService) Export(ctx context.Context, f domain.AdminAuditFilter, w io.Writer) error {
+	if err := validateAdminAuditFilter(f); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	return s.repo.StreamAdminAudit(ctx, f, func(e *domain.AdminAuditEntry) error {
+		return enc.Encode(e)
+	})
+}
+
+func validateAdminAuditFilter(f domain.AdminAuditFilter) error {
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return &ValidationError{Err: errors.New("from must be before to")}
+	}
+	switch f.Outcome {
+	case "", domain.AdminOutcomeDenied, domain.AdminOutcomeSuccess, domain.AdminOutcomeFailed:
+		return nil
+	}
+	return &ValidationError{Err: fmt.Errorf("unknown outcome %q", f.Outcome)}
+}
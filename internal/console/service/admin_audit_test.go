@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// memAdminAuditReader возвращает записи как есть и запоминает фильтр последней выборки.
+type memAdminAuditReader struct {
+	entries []domain.AdminAuditEntry
+	last    *domain.AdminAuditFilter
+}
+
+func (m *memAdminAuditReader) QueryAdminAudit(_ context.Context, f domain.AdminAuditFilter) ([]domain.AdminAuditEntry, error) {
+	m.last = &f
+	return m.entries, nil
+}
+
+func (m *memAdminAuditReader) StreamAdminAudit(_ context.Context, f domain.AdminAuditFilter, fn func(*domain.AdminAuditEntry) error) error {
+	m.last = &f
+	for i := range m.entries {
+		if err := fn(&m.entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAdminAuditQuery(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		filter    domain.AdminAuditFilter
+		wantErr   bool
+		wantLimit int
+	}{
+		{name: "default limit", filter: domain.AdminAuditFilter{}, wantLimit: DefaultAdminAuditLimit},
+		{name: "explicit limit", filter: domain.AdminAuditFilter{Limit: 10}, wantLimit: 10},
+		{name: "limit capped", filter: domain.AdminAuditFilter{Limit: MaxAdminAuditLimit + 1}, wantLimit: MaxAdminAuditLimit},
+		{name: "period", filter: domain.AdminAuditFilter{From: &now, To: &later}, wantLimit: DefaultAdminAuditLimit},
+		{name: "inverted period", filter: domain.AdminAuditFilter{From: &later, To: &now}, wantErr: true},
+		{name: "empty period", filter: domain.AdminAuditFilter{From: &now, To: &now}, wantErr: true},
+		{name: "known outcome", filter: domain.AdminAuditFilter{Outcome: domain.AdminOutcomeDenied}, wantLimit: DefaultAdminAuditLimit},
+		{name: "unknown outcome", filter: domain.AdminAuditFilter{Outcome: "maybe"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &memAdminAuditReader{}
+			_, err := NewAdminAuditService(repo).Query(context.Background(), tt.filter)
+			if tt.wantErr {
+				var verr *ValidationError
+				if !errors.As(err, &verr) || repo.last != nil {
+					t.Fatalf("Query() error = %v, repository queried = %v; want ValidationError without query", err, repo.last != nil)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if repo.last.Limit != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", repo.last.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestAdminAuditExport(t *testing.T) {
+	repo := &memAdminAuditReader{entries: []domain.AdminAuditEntry{
+		{ID: "1", Action: "policies:write", Outcome: domain.AdminOutcomeSuccess, After: json.RawMessage(`{"effect":"ALLOW"}`)},
+		{ID: "2", Action: "agents:block", Outcome: domain.AdminOutcomeDenied},
+	}}
+	svc := NewAdminAuditService(repo)
+
+	var buf bytes.Buffer
+	if err := svc.Export(context.Background(), domain.AdminAuditFilter{}, &buf); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	// Экспорт не ограничен пределом API
+	if repo.last.Limit != 0 {
+		t.Errorf("export limit = %d, want 0", repo.last.Limit)
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e domain.AdminAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %q is not an entry: %v", scanner.Text(), err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("exported ids = %v, want [1 2]", ids)
+	}
+
+	if err := svc.Export(context.Background(), domain.AdminAuditFilter{Outcome: "maybe"}, &buf); err == nil {
+		t.Error("Export() with invalid filter succeeded")
+	}
+}
+
+func TestAdminChangeSnapshots(t *testing.T) {
+	ctx, change := WithAdminChange(context.Background())
+	policy := &domain.Policy{ID: "p-1", Effect: domain.EffectAllow}
+
+	recordBefore(ctx, TargetPolicy, policy.ID, policy)
+	policy.Effect = domain.EffectDeny // Мутация после снимка не меняет его
+	recordAfter(ctx, TargetPolicy, "", policy)
+
+	var before, after domain.Policy
+	if err := json.Unmarshal(change.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(change.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Effect != domain.EffectAllow || after.Effect != domain.EffectDeny {
+		t.Errorf("before %s, after %s; want ALLOW, DENY", before.Effect, after.Effect)
+	}
+	// Пустой id не затирает ранее отмеченный объект
+	if change.TargetType != TargetPolicy || change.TargetID != "p-1" {
+		t.Errorf("target = %s/%s, want %s/p-1", change.TargetType, change.TargetID, TargetPolicy)
+	}
+
+	// Удаление: состояния «после» нет
+	ctx, change = WithAdminChange(context.Background())
+	var deleted *domain.Policy
+	recordAfter(ctx, TargetPolicy, "p-1", deleted)
+	if change.After != nil {
+		t.Errorf("after of deleted object = %s, want nil", change.After)
+	}
+
+	// Вне запроса консоли запись — no-op
+	recordAfter(context.Background(), TargetPolicy, "p-1", policy)
+}
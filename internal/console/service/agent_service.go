@@ -21,25 +21,45 @@ type AgentRepository interface {
 	GetGlobalStats(ctx context.Context) (*domain.GlobalStats, error)
 	GetApprovalByID(ctx context.Context, id string) (*domain.ApprovalRequest, error)
 	FindApprovals(ctx context.Context, status domain.ApprovalStatus) ([]*domain.ApprovalRequest, error)
-	ListAgents(ctx context.Context) ([]*domain.Agent, error)
+	ListAgents(ctx context.Context, f domain.AgentFilter) ([]*domain.Agent, error)
+
+	// Реестр агентов
+	CreateAgent(ctx context.Context, a *domain.Agent) error
+	UpdateAgent(ctx context.Context, a *domain.Agent) error
+	DecommissionAgent(ctx context.Context, id, author string) error
 }
 
 type AgentService struct {
 	*auth.BaseValidator
-	repo   AgentRepository
-	rdb    *redis.Client
-	logger *zap.Logger
+	repo        AgentRepository
+	rdb         *redis.Client
+	revocations *auth.RevocationList // Отзыв токенов агента при блокировке и выводе из эксплуатации
+	logger      *zap.Logger
 }
 
-func NewAgentService(rdb *redis.Client, repo AgentRepository, validator *auth.BaseValidator, logger *zap.Logger) *AgentService {
+func NewAgentService(rdb *redis.Client, repo AgentRepository, validator *auth.BaseValidator, revocations *auth.RevocationList, logger *zap.Logger) *AgentService {
 	return &AgentService{
 		BaseValidator: validator,
 		repo:          repo,
 		rdb:           rdb,
+		revocations:   revocations,
 		logger:        logger.Named("agent-service"),
 	}
 }
 
+// VerifyToken перекрывает BaseValidator: токены агентов (Client Credentials) выдаются для шлюза,
+// и консоль их не принимает.
+func (s *AgentService) VerifyToken(tokenStr string) (*domain.CustomClaims, error) {
+	claims, err := s.BaseValidator.VerifyToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IsAgent() {
+		return nil, fmt.Errorf("agent token %s is not accepted by console", claims.AgentID)
+	}
+	return claims, nil
+}
+
 // updateAgentState — унифицированный механизм переключения состояний.
 // Обновляет БД и транслирует сигнал в Redis.
 func (s *AgentService) updateAgentState(
@@ -50,6 +70,8 @@ func (s *AgentService) updateAgentState(
 	signalValue string,
 	actionName string,
 ) error {
+	prev := s.snapshotAgent(ctx, agentID)
+
 	// 1. Persistence Layer
 	if err := s.repo.UpdateAgentStatus(ctx, agentID, string(status)); err != nil {
 		s.logger.Error("failed to update agent status in DB",
@@ -58,6 +80,11 @@ func (s *AgentService) updateAgentState(
 			zap.Error(err))
 		return fmt.Errorf("%s database error: %w", actionName, err)
 	}
+	if prev != nil {
+		next := *prev
+		next.Status = status
+		recordAfter(ctx, TargetAgent, agentID, &next)
+	}
 
 	// 2. Real-time Signaling
 	payload := fmt.Sprintf("%s:%s", agentID, signalValue)
@@ -76,8 +103,17 @@ func (s *AgentService) updateAgentState(
 	return nil
 }
 
+// BlockAgent включает kill-switch и отзывает выданные агенту токены:
+// после разблокировки агент должен получить новый токен.
 func (s *AgentService) BlockAgent(ctx context.Context, id string) error {
-	return s.updateAgentState(ctx, id, domain.StatusBlocked, infra.RedisChanKillSwitch, "true", "kill-switch-block")
+	if err := s.updateAgentState(ctx, id, domain.StatusBlocked, infra.RedisChanKillSwitch, "true", "kill-switch-block"); err != nil {
+		return err
+	}
+	if err := s.revocations.RevokeSubject(ctx, id); err != nil {
+		// Kill-switch уже действует в шлюзах, отзыв токенов — дополнительный рубеж
+		s.logger.Warn("agent blocked but token revocation failed", zap.String("agent_id", id), zap.Error(err))
+	}
+	return nil
 }
 
 func (s *AgentService) UnblockAgent(ctx context.Context, id string) error {
@@ -89,11 +125,18 @@ func (s *AgentService) QuarantineAgent(ctx context.Context, id string) error {
 }
 
 func (s *AgentService) SetSandboxMode(ctx context.Context, agentID string, enabled bool) error {
+	prev := s.snapshotAgent(ctx, agentID)
+
 	// 1. Обновляем ТОЛЬКО поле is_sandbox в базе
 	if err := s.repo.SetAgentSandbox(ctx, agentID, enabled); err != nil {
 		s.logger.Error("failed to update sandbox in DB", zap.Error(err))
 		return err
 	}
+	if prev != nil {
+		next := *prev
+		next.IsSandbox = enabled
+		recordAfter(ctx, TargetAgent, agentID, &next)
+	}
 
 	// 2. Шлем сигнал в Redis (как и раньше)
 	val := "off"
@@ -122,6 +165,10 @@ func (s *AgentService) GetGlobalStats(ctx context.Context) (*domain.GlobalStats,
 // DecideApproval фиксирует решение оператора по запросу из карантина.
 // Мы передаем reviewerID для обеспечения подотчетности (Accountability).
 func (s *AgentService) DecideApproval(ctx context.Context, approvalID string, approved bool, reviewerID, comment string) error {
+	if prev, err := s.repo.GetApprovalByID(ctx, approvalID); err == nil {
+		recordBefore(ctx, TargetApproval, approvalID, approvalState(prev))
+	}
+
 	// 1. Определяем финальный статус на основе решения
 	status := domain.StatusRejected
 	if approved {
@@ -138,6 +185,12 @@ func (s *AgentService) DecideApproval(ctx context.Context, approvalID string, ap
 			zap.Error(err))
 		return fmt.Errorf("database update failed: %w", err)
 	}
+	recordAfter(ctx, TargetApproval, approvalID, map[string]any{
+		"status":       status,
+		"execution_id": executionID,
+		"reviewer_id":  reviewerID,
+		"comment":      comment,
+	})
 
 	// 3. Публикуем сигнал "пробуждения" для горутины шлюза
 	// Канал уникален для конкретного запроса: devit:approvals:execution:{executionID}
@@ -192,21 +245,137 @@ func (s *AgentService) GetAgent(ctx context.Context, agentID string) (*domain.Ag
 	return agent, nil
 }
 
-// ListAgents возвращает список всех зарегистрированных агентов.
+// ListAgents возвращает список зарегистрированных агентов с фильтрами реестра.
 // Используется для отображения основной таблицы в Console API.
-func (s *AgentService) ListAgents(ctx context.Context) ([]*domain.Agent, error) {
-	agents, err := s.repo.ListAgents(ctx)
+func (s *AgentService) ListAgents(ctx context.Context, f domain.AgentFilter) ([]*domain.Agent, error) {
+	agents, err := s.repo.ListAgents(ctx, f)
 	if err != nil {
 		s.logger.Error("failed to list agents from repository", zap.Error(err))
 		return nil, fmt.Errorf("service: could not fetch agents: %w", err)
 	}
 
-	// Senior-акцент: гарантируем, что фронтенд получит пустой массив [], а не null,
-	// если в базе еще нет ни одного агента.
-	if agents == nil {
-		return []*domain.Agent{}, nil
-	}
-
 	s.logger.Debug("agents listed successfully", zap.Int("count", len(agents)))
 	return agents, nil
 }
+
+// CreateAgent регистрирует нового агента. Агент создается активным и вне песочницы.
+func (s *AgentService) CreateAgent(ctx context.Context, a *domain.Agent) error {
+	a.Normalize()
+	if err := a.Validate(); err != nil {
+		return &ValidationError{Err: err}
+	}
+	a.Status = domain.StatusActive
+	a.IsSandbox = false
+	a.CreatedBy = authorFromContext(ctx)
+
+	if err := s.repo.CreateAgent(ctx, a); err != nil {
+		return err
+	}
+	recordAfter(ctx, TargetAgent, a.ID, a)
+	s.logger.Info("agent registered",
+		zap.String("agent_id", a.ID),
+		zap.String("name", a.Name),
+		zap.String("by", a.CreatedBy))
+	return nil
+}
+
+// UpdateAgent применяет частичное изменение (переименование, метки, владельцы, scopes).
+func (s *AgentService) UpdateAgent(ctx context.Context, id string, patch *domain.AgentPatch) (*domain.Agent, error) {
+	a, err := s.repo.GetAgent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || a.DeletedAt != nil {
+		return nil, domain.ErrAgentNotFound
+	}
+	recordBefore(ctx, TargetAgent, id, a)
+
+	patch.Apply(a)
+	a.Normalize()
+	if err := a.Validate(); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if err := s.repo.UpdateAgent(ctx, a); err != nil {
+		return nil, err
+	}
+	recordAfter(ctx, TargetAgent, id, a)
+	s.logger.Info("agent updated", zap.String("agent_id", id), zap.String("by", authorFromContext(ctx)))
+	return a, nil
+}
+
+// DecommissionAgent выводит агента из эксплуатации: мягкое удаление в БД, постоянный kill-switch
+// (все выданные агенту токены перестают проходить шлюз) и очистка его состояния в Redis.
+func (s *AgentService) DecommissionAgent(ctx context.Context, id string) error {
+	author := authorFromContext(ctx)
+	s.snapshotAgent(ctx, id)
+	if err := s.repo.DecommissionAgent(ctx, id, author); err != nil {
+		return err
+	}
+
+	// БД уже источник истины: сбой Redis не откатывает удаление, шлюзы подхватят его при прогреве
+	if err := s.revocations.RevokeSubject(ctx, id); err != nil {
+		s.logger.Warn("agent decommissioned but token revocation failed",
+			zap.String("agent_id", id),
+			zap.Error(err))
+	}
+	if err := s.clearRuntimeState(ctx, id); err != nil {
+		s.logger.Warn("agent decommissioned but runtime state cleanup failed",
+			zap.String("agent_id", id),
+			zap.Error(err))
+	}
+
+	s.logger.Info("agent decommissioned", zap.String("agent_id", id), zap.String("by", author))
+	return nil
+}
+
+// snapshotAgent записывает состояние агента до изменения в журнал административных действий.
+// Ошибка чтения не мешает самому изменению: журнал получит запись без снимка.
+func (s *AgentService) snapshotAgent(ctx context.Context, id string) *domain.Agent {
+	a, err := s.repo.GetAgent(ctx, id)
+	if err != nil || a == nil {
+		return nil
+	}
+	recordBefore(ctx, TargetAgent, id, a)
+	return a
+}
+
+// approvalState — снимок заявки для журнала без payload: данные агента не дублируются в admin_audit.
+func approvalState(a *domain.ApprovalRequest) map[string]any {
+	return map[string]any{
+		"status":       a.Status,
+		"execution_id": a.ExecutionID,
+		"agent_id":     a.AgentID,
+		"capability":   a.Capability,
+		"reviewer_id":  a.ReviewerID,
+		"comment":      a.Comment,
+	}
+}
+
+// clearRuntimeState переводит агента в заблокированные и удаляет его оперативное состояние
+// (песочница, карантин, окна риск-бюджетов) во всех инстансах шлюза.
+func (s *AgentService) clearRuntimeState(ctx context.Context, id string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.SAdd(ctx, infra.RedisKeyBlockedAgents, id)
+	pipe.SRem(ctx, infra.RedisKeySandboxAgents, id)
+	pipe.SRem(ctx, infra.RedisKeyQuarantineAgents, id)
+	pipe.Publish(ctx, infra.RedisChanKillSwitch, id+":true")
+	pipe.Publish(ctx, infra.RedisChanSandbox, id+":off")
+	pipe.Publish(ctx, infra.RedisChanQuarantine, id+":off")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// Ключи бюджетов: {prefix}{agent}:{capability}:{budget}
+	iter := s.rdb.Scan(ctx, 0, infra.RedisKeyBudgetPrefix+id+":*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return s.rdb.Del(ctx, keys...).Err()
+	}
+	return nil
+}
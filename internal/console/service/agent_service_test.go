@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"go.uber.org/zap"
+)
+
+// memAgentRepo — реестр агентов в памяти; выведенные из эксплуатации помечаются DeletedAt.
+type memAgentRepo struct {
+	AgentRepository // Заявки HITL и статистика в этих тестах не используются
+	agents          map[string]*domain.Agent
+	updates         int
+}
+
+func (r *memAgentRepo) GetAgent(_ context.Context, id string) (*domain.Agent, error) {
+	a, ok := r.agents[id]
+	if !ok {
+		return nil, nil
+	}
+	c := *a
+	return &c, nil
+}
+
+func (r *memAgentRepo) CreateAgent(_ context.Context, a *domain.Agent) error {
+	a.ID = "agent-new"
+	c := *a
+	r.agents[a.ID] = &c
+	return nil
+}
+
+func (r *memAgentRepo) UpdateAgent(_ context.Context, a *domain.Agent) error {
+	r.updates++
+	c := *a
+	r.agents[a.ID] = &c
+	return nil
+}
+
+func (r *memAgentRepo) DecommissionAgent(_ context.Context, id, author string) error {
+	a, ok := r.agents[id]
+	if !ok || a.DeletedAt != nil {
+		return domain.ErrAgentNotFound
+	}
+	now := time.Now()
+	a.Status, a.DeletedAt, a.DeletedBy = domain.StatusDecommissioned, &now, author
+	return nil
+}
+
+func newAgentTestService(t *testing.T, agents ...*domain.Agent) (*AgentService, *memAgentRepo, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	repo := &memAgentRepo{agents: make(map[string]*domain.Agent)}
+	for _, a := range agents {
+		a.Normalize()
+		repo.agents[a.ID] = a
+	}
+	return NewAgentService(rdb, repo, nil, auth.NewRevocationList(rdb, time.Hour, false), zap.NewNop()), repo, mr
+}
+
+func TestCreateAgent(t *testing.T) {
+	svc, repo, _ := newAgentTestService(t)
+	ctx := context.WithValue(context.Background(), "user_id", "admin-1")
+
+	// Статус и песочницу задает сервер, а не клиент
+	a := &domain.Agent{Name: " billing-bot ", Status: domain.StatusBlocked, IsSandbox: true}
+	if err := svc.CreateAgent(ctx, a); err != nil {
+		t.Fatalf("CreateAgent() error = %v", err)
+	}
+	got := repo.agents[a.ID]
+	if got.Name != "billing-bot" || got.Status != domain.StatusActive || got.IsSandbox || got.CreatedBy != "admin-1" || got.Environment != domain.EnvDev {
+		t.Errorf("created agent = %+v", got)
+	}
+
+	var verr *ValidationError
+	if err := svc.CreateAgent(ctx, &domain.Agent{Name: "bot", Environment: "qa"}); !errors.As(err, &verr) {
+		t.Errorf("invalid agent error = %v, want ValidationError", err)
+	}
+}
+
+func TestUpdateAgent(t *testing.T) {
+	now := time.Now()
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name        string
+		id          string
+		patch       domain.AgentPatch
+		wantErr     error
+		wantInvalid bool // Ожидается ValidationError
+		wantTeam    string
+	}{
+		{name: "team changed", id: "a1", patch: domain.AgentPatch{Team: str(" payments ")}, wantTeam: "payments"},
+		{name: "invalid patch", id: "a1", patch: domain.AgentPatch{Environment: str("qa")}, wantInvalid: true},
+		{name: "decommissioned", id: "a2", patch: domain.AgentPatch{Team: str("payments")}, wantErr: domain.ErrAgentNotFound},
+		{name: "unknown", id: "a3", patch: domain.AgentPatch{Team: str("payments")}, wantErr: domain.ErrAgentNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo, _ := newAgentTestService(t,
+				&domain.Agent{ID: "a1", Name: "bot", Team: "crm", Status: domain.StatusQuarantine},
+				&domain.Agent{ID: "a2", Name: "old-bot", Status: domain.StatusDecommissioned, DeletedAt: &now})
+
+			got, err := svc.UpdateAgent(context.Background(), tt.id, &tt.patch)
+			if tt.wantErr != nil || tt.wantInvalid {
+				var verr *ValidationError
+				if tt.wantInvalid && !errors.As(err, &verr) || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("UpdateAgent() error = %v, want %v (validation %v)", err, tt.wantErr, tt.wantInvalid)
+				}
+				if repo.updates != 0 {
+					t.Error("rejected patch reached repository")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateAgent() error = %v", err)
+			}
+			// Патч не трогает статус: он меняется только block/unblock/quarantine
+			if got.Team != tt.wantTeam || repo.agents[tt.id].Team != tt.wantTeam || got.Status != domain.StatusQuarantine {
+				t.Errorf("updated agent = team %q (stored %q), status %s", got.Team, repo.agents[tt.id].Team, got.Status)
+			}
+		})
+	}
+}
+
+func TestDecommissionAgent(t *testing.T) {
+	svc, repo, mr := newAgentTestService(t,
+		&domain.Agent{ID: "a1", Name: "bot", Status: domain.StatusActive},
+		&domain.Agent{ID: "a2", Name: "neighbour", Status: domain.StatusActive})
+	mr.SAdd(infra.RedisKeySandboxAgents, "a1", "a2")
+	mr.ZAdd(infra.RedisKeyBudgetPrefix+"a1:bank.transfer:volume", 1, "ev-1")
+	mr.ZAdd(infra.RedisKeyBudgetPrefix+"a2:bank.transfer:volume", 1, "ev-2")
+
+	ctx := context.WithValue(context.Background(), "user_id", "admin-1")
+	if err := svc.DecommissionAgent(ctx, "a1"); err != nil {
+		t.Fatalf("DecommissionAgent() error = %v", err)
+	}
+
+	if a := repo.agents["a1"]; a.DeletedAt == nil || a.DeletedBy != "admin-1" {
+		t.Errorf("agent not soft-deleted: %+v", a)
+	}
+	if !mr.Exists(infra.RedisKeyRevokedSubjectPrefix + "a1") {
+		t.Error("issued tokens were not revoked")
+	}
+	if ok, _ := mr.SIsMember(infra.RedisKeyBlockedAgents, "a1"); !ok {
+		t.Error("agent is not in the blocked set")
+	}
+	if ok, _ := mr.SIsMember(infra.RedisKeySandboxAgents, "a1"); ok {
+		t.Error("agent is still in the sandbox set")
+	}
+	if mr.Exists(infra.RedisKeyBudgetPrefix + "a1:bank.transfer:volume") {
+		t.Error("budget window of decommissioned agent was kept")
+	}
+	// Состояние других агентов не затрагивается
+	if ok, _ := mr.SIsMember(infra.RedisKeySandboxAgents, "a2"); !ok || !mr.Exists(infra.RedisKeyBudgetPrefix+"a2:bank.transfer:volume") {
+		t.Error("state of another agent was cleared")
+	}
+
+	if err := svc.DecommissionAgent(ctx, "a1"); !errors.Is(err, domain.ErrAgentNotFound) {
+		t.Errorf("repeated decommission error = %v, want %v", err, domain.ErrAgentNotFound)
+	}
+}
@@ -2,15 +2,26 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
+	"github.com/google/uuid"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
 )
 
+// Лимиты страницы выборки аудита
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
 // AuditLogProvider описывает контракт для чтения данных аудита.
 // Мы используем структуру AuditEvent из пакета audit, чтобы сохранить единую модель данных.
 type AuditLogProvider interface {
-	FetchLogs(ctx context.Context, agentID, capID string) ([]audit.AuditEvent, error)
+	QueryAuditEvents(ctx context.Context, q audit.Query) ([]audit.AuditEvent, error)
+	TraceEvents(ctx context.Context, traceID string, limit int) ([]audit.AuditEvent, error)
+	StreamAuditEvents(ctx context.Context, q audit.Query, fn func(*audit.AuditEvent) error) error
 }
 
 type AuditService struct {
@@ -23,12 +34,98 @@ func NewAuditService(repo AuditLogProvider) *AuditService {
 	}
 }
 
-// FetchLogs запрашивает логи с фильтрацией.
-// Логика фильтрации (пустые строки или конкретные ID) инкапсулирована в репозитории.
-func (s *AuditService) FetchLogs(ctx context.Context, agentID, capID string) ([]audit.AuditEvent, error) {
-	logs, err := s.repo.FetchLogs(ctx, agentID, capID)
+// Query возвращает страницу событий по фильтрам. Следующая страница — тот же запрос с NextCursor.
+func (s *AuditService) Query(ctx context.Context, q audit.Query) (*audit.Page, error) {
+	if err := validateAuditQuery(q); err != nil {
+		return nil, err
+	}
+	switch {
+	case q.Limit <= 0:
+		q.Limit = DefaultAuditLimit
+	case q.Limit > MaxAuditLimit:
+		q.Limit = MaxAuditLimit
+	}
+
+	// Запрашиваем на одну строку больше: так известно, есть ли следующая страница
+	limit := q.Limit
+	q.Limit++
+	events, err := s.repo.QueryAuditEvents(ctx, q)
 	if err != nil {
 		return nil, fmt.Errorf("audit_service: failed to fetch logs: %w", err)
 	}
-	return logs, nil
+
+	page := &audit.Page{Items: events}
+	if len(events) > limit {
+		page.Items = events[:limit]
+		page.NextCursor = audit.CursorAfter(q.Sort, page.Items[limit-1])
+	}
+	return page, nil
+}
+
+// Trace возвращает хронологию всех событий одного запроса.
+func (s *AuditService) Trace(ctx context.Context, traceID string) (*audit.TraceTimeline, error) {
+	if _, err := uuid.Parse(traceID); err != nil {
+		return nil, audit.ErrTraceNotFound
+	}
+	events, err := s.repo.TraceEvents(ctx, traceID, audit.MaxTraceEvents+1)
+	if err != nil {
+		return nil, fmt.Errorf("audit_service: failed to fetch trace: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, audit.ErrTraceNotFound
+	}
+	return audit.NewTraceTimeline(traceID, events), nil
+}
+
+// Export пишет события в w в формате format (ndjson, ecs, cef, csv) потоком из БД, без лимита.
+// По умолчанию — в хронологическом порядке.
+func (s *AuditService) Export(ctx context.Context, q audit.Query, format string, w io.Writer) error {
+	if q.Sort == "" {
+		q.Sort = audit.SortTimestamp
+	}
+	q.Cursor, q.Limit = nil, 0
+	if err := validateAuditQuery(q); err != nil {
+		return err
+	}
+	enc, err := audit.NewEncoder(w, format)
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+	if err := s.repo.StreamAuditEvents(ctx, q, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func validateAuditQuery(q audit.Query) error {
+	for name, id := range map[string]string{"agent_id": q.AgentID, "trace_id": q.TraceID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return &ValidationError{Err: fmt.Errorf("%s must be a UUID", name)}
+		}
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return &ValidationError{Err: errors.New("from must be before to")}
+	}
+	if _, _, err := q.SortSpec(); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if q.Cursor != nil {
+		sort := q.Sort
+		if sort == "" {
+			sort = audit.DefaultSort
+		}
+		if q.Cursor.Sort != sort {
+			return &ValidationError{Err: fmt.Errorf("%w: issued for sort %q", audit.ErrInvalidCursor, q.Cursor.Sort)}
+		}
+		if _, err := q.Cursor.SortValue(); err != nil {
+			return &ValidationError{Err: err}
+		}
+		if _, err := uuid.Parse(q.Cursor.ID); err != nil {
+			return &ValidationError{Err: audit.ErrInvalidCursor}
+		}
+	}
+	return nil
 }
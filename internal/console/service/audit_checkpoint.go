@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"go.uber.org/zap"
+)
+
+// AuditCheckpointStore — головы цепочки аудита и контрольные точки.
+type AuditCheckpointStore interface {
+	ChainHeads(ctx context.Context) ([]audit.ChainHead, error)
+	LastCheckpoints(ctx context.Context) (map[string]int64, error)
+	SaveCheckpoint(ctx context.Context, cp *audit.Checkpoint) error
+}
+
+// AuditCheckpointer периодически подписывает головы партиций цепочки аудита закрытым ключом консоли.
+// Подпись фиксирует состояние журнала: переписать хвост цепочки задним числом без ключа нельзя.
+type AuditCheckpointer struct {
+	repo   AuditCheckpointStore
+	key    *rsa.PrivateKey
+	logger *zap.Logger
+}
+
+func NewAuditCheckpointer(repo AuditCheckpointStore, key *rsa.PrivateKey, logger *zap.Logger) *AuditCheckpointer {
+	return &AuditCheckpointer{repo: repo, key: key, logger: logger.Named("audit-checkpoint")}
+}
+
+// Checkpoint подписывает головы партиций, сдвинувшиеся с прошлой контрольной точки. Возвращает число новых точек.
+func (c *AuditCheckpointer) Checkpoint(ctx context.Context) (int, error) {
+	heads, err := c.repo.ChainHeads(ctx)
+	if err != nil {
+		return 0, err
+	}
+	last, err := c.repo.LastCheckpoints(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, h := range heads {
+		if h.Seq == 0 || h.Seq <= last[h.Partition] {
+			continue
+		}
+		cp := &audit.Checkpoint{
+			Partition: h.Partition,
+			Seq:       h.Seq,
+			Hash:      h.Hash,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if err := audit.SignCheckpoint(c.key, cp); err != nil {
+			return created, err
+		}
+		if err := c.repo.SaveCheckpoint(ctx, cp); err != nil {
+			return created, fmt.Errorf("checkpoint %s#%d: %w", h.Partition, h.Seq, err)
+		}
+		created++
+		c.logger.Info("audit checkpoint signed",
+			zap.String("partition", cp.Partition),
+			zap.Int64("seq", cp.Seq),
+			zap.String("kid", cp.KeyID))
+	}
+	return created, nil
+}
+
+// Run ставит контрольные точки с заданным интервалом до отмены ctx.
+func (c *AuditCheckpointer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Checkpoint(ctx); err != nil {
+				c.logger.Error("audit checkpoint failed", zap.Error(err))
+			}
+		}
+	}
+}
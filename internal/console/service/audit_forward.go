@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"go.uber.org/zap"
+)
+
+// AuditForwardStore — партиции цепочки и пакетная вычитка после курсора.
+type AuditForwardStore interface {
+	ChainHeads(ctx context.Context) ([]audit.ChainHead, error)
+	UnchainedAuditEvents(ctx context.Context) (int64, time.Time, error)
+	ForwardChainBatch(ctx context.Context, consumer, partition string, fromHead bool, limit int,
+		ship func([]audit.AuditEvent) error) (int, error)
+}
+
+// AuditForwarder непрерывно доставляет новые события аудита во внешнюю систему (SIEM).
+// События читаются по цепочке хешей (chain_seq растет без пропусков в порядке фиксации),
+// поэтому курсор не пропускает пакеты, записанные с опозданием. Доставка — at-least-once.
+type AuditForwarder struct {
+	repo      AuditForwardStore
+	shipper   audit.Shipper
+	name      string
+	batchSize int
+	fromHead  bool
+	logger    *zap.Logger
+}
+
+func NewAuditForwarder(repo AuditForwardStore, shipper audit.Shipper, name string, batchSize int, fromHead bool, logger *zap.Logger) *AuditForwarder {
+	return &AuditForwarder{
+		repo:      repo,
+		shipper:   shipper,
+		name:      name,
+		batchSize: batchSize,
+		fromHead:  fromHead,
+		logger:    logger.Named("audit-forward"),
+	}
+}
+
+// CheckChain проверяет, что события пишутся в цепочку хешей: пересылка читает только по chain_seq.
+// Если цепочки нет совсем, а события есть, возвращает ошибку — пересылать нечего. Если часть событий
+// вне цепочки (история до включения audit.chain или шлюз без него), только предупреждает.
+func (f *AuditForwarder) CheckChain(ctx context.Context) error {
+	unchained, latest, err := f.repo.UnchainedAuditEvents(ctx)
+	if err != nil {
+		return err
+	}
+	if unchained == 0 {
+		return nil
+	}
+	heads, err := f.repo.ChainHeads(ctx)
+	if err != nil {
+		return err
+	}
+	if len(heads) == 0 {
+		return fmt.Errorf("audit forwarder requires audit.chain.enabled on gateways: %d events without chain_seq will not be forwarded", unchained)
+	}
+	f.logger.Warn("audit events without chain_seq are not forwarded; enable audit.chain on all gateways",
+		zap.Int64("events", unchained),
+		zap.Time("latest", latest))
+	return nil
+}
+
+// Forward доставляет все накопленные события каждой партиции. Возвращает число отправленных событий.
+func (f *AuditForwarder) Forward(ctx context.Context) (int, error) {
+	heads, err := f.repo.ChainHeads(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, h := range heads {
+		for {
+			n, err := f.repo.ForwardChainBatch(ctx, f.name, h.Partition, f.fromHead, f.batchSize, func(events []audit.AuditEvent) error {
+				return f.shipper.Ship(ctx, events)
+			})
+			total += n
+			if err != nil {
+				// Курсор не сдвинут: пакет уйдет повторно на следующем цикле
+				return total, err
+			}
+			if n < f.batchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// Run опрашивает новые события с заданным интервалом до отмены ctx.
+func (f *AuditForwarder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer f.shipper.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := f.Forward(ctx)
+			if err != nil {
+				f.logger.Error("audit forward failed, will retry", zap.Int("shipped", n), zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				f.logger.Debug("audit events forwarded", zap.Int("count", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"go.uber.org/zap"
+)
+
+// memForwardStore повторяет postgres.ForwardChainBatch: курсор создается при первом чтении
+// (с головы цепочки или с начала) и сдвигается только после успешной отправки пакета.
+type memForwardStore struct {
+	chains    map[string][]string         // partition -> id событий по chain_seq (seq = индекс + 1)
+	cursors   map[string]map[string]int64 // consumer -> partition -> seq
+	unchained int64                       // События без chain_seq (шлюз без audit.chain)
+}
+
+func (s *memForwardStore) UnchainedAuditEvents(context.Context) (int64, time.Time, error) {
+	if s.unchained == 0 {
+		return 0, time.Time{}, nil
+	}
+	return s.unchained, time.Now(), nil
+}
+
+func (s *memForwardStore) ChainHeads(context.Context) ([]audit.ChainHead, error) {
+	var heads []audit.ChainHead
+	for _, p := range []string{"uag-1", "uag-2"} {
+		if chain, ok := s.chains[p]; ok {
+			heads = append(heads, audit.ChainHead{Partition: p, Seq: int64(len(chain))})
+		}
+	}
+	return heads, nil
+}
+
+func (s *memForwardStore) ForwardChainBatch(_ context.Context, consumer, partition string, fromHead bool, limit int,
+	ship func([]audit.AuditEvent) error) (int, error) {
+	chain := s.chains[partition]
+	if s.cursors[consumer] == nil {
+		s.cursors[consumer] = make(map[string]int64)
+	}
+	cursor, ok := s.cursors[consumer][partition]
+	if !ok && fromHead {
+		cursor = int64(len(chain))
+	}
+
+	var events []audit.AuditEvent
+	for seq := cursor + 1; seq <= int64(len(chain)) && len(events) < limit; seq++ {
+		events = append(events, audit.AuditEvent{ID: chain[seq-1]})
+	}
+	if len(events) == 0 {
+		s.cursors[consumer][partition] = cursor
+		return 0, nil
+	}
+	if err := ship(events); err != nil {
+		return 0, err
+	}
+	s.cursors[consumer][partition] = cursor + int64(len(events))
+	return len(events), nil
+}
+
+// recordingShipper запоминает отправленные события; failAt — номер вызова Ship, который вернет ошибку.
+type recordingShipper struct {
+	shipped []string
+	calls   int
+	failAt  int
+}
+
+func (s *recordingShipper) Ship(_ context.Context, events []audit.AuditEvent) error {
+	s.calls++
+	if s.calls == s.failAt {
+		return errors.New("siem unavailable")
+	}
+	for _, e := range events {
+		s.shipped = append(s.shipped, e.ID)
+	}
+	return nil
+}
+
+func (s *recordingShipper) Close() error { return nil }
+
+func chainOf(prefix string, n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s-%d", prefix, i+1)
+	}
+	return ids
+}
+
+func TestAuditForwarderCursor(t *testing.T) {
+	tests := []struct {
+		name      string
+		chains    map[string][]string
+		batchSize int
+		fromHead  bool
+		failAt    int
+		// Ожидания после первого и второго цикла Forward
+		wantFirst, wantSecond []string
+		wantErr               bool
+	}{
+		{
+			name:      "backlog in batches",
+			chains:    map[string][]string{"uag-1": chainOf("a", 5)},
+			batchSize: 2,
+			wantFirst: chainOf("a", 5),
+		},
+		{
+			name:      "exact multiple of batch size",
+			chains:    map[string][]string{"uag-1": chainOf("a", 4)},
+			batchSize: 2,
+			wantFirst: chainOf("a", 4),
+		},
+		{
+			name:      "all partitions",
+			chains:    map[string][]string{"uag-1": chainOf("a", 2), "uag-2": chainOf("b", 3)},
+			batchSize: 10,
+			wantFirst: append(chainOf("a", 2), chainOf("b", 3)...),
+		},
+		{
+			name:      "from head skips history",
+			chains:    map[string][]string{"uag-1": chainOf("a", 3)},
+			batchSize: 10,
+			fromHead:  true,
+		},
+		{
+			// Пакет не ушел: курсор стоит, следующий цикл повторяет его (at-least-once)
+			name:       "failed batch is redelivered",
+			chains:     map[string][]string{"uag-1": chainOf("a", 5), "uag-2": chainOf("b", 1)},
+			batchSize:  2,
+			failAt:     2,
+			wantFirst:  []string{"a-1", "a-2"},
+			wantSecond: []string{"a-3", "a-4", "a-5", "b-1"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memForwardStore{chains: tt.chains, cursors: make(map[string]map[string]int64)}
+			shipper := &recordingShipper{failAt: tt.failAt}
+			f := NewAuditForwarder(store, shipper, "siem", tt.batchSize, tt.fromHead, zap.NewNop())
+
+			n, err := f.Forward(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Forward() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n != len(tt.wantFirst) || !equalIDs(shipper.shipped, tt.wantFirst) {
+				t.Fatalf("first cycle shipped %d %v, want %v", n, shipper.shipped, tt.wantFirst)
+			}
+
+			shipper.shipped = nil
+			if _, err := f.Forward(context.Background()); err != nil {
+				t.Fatalf("second Forward() error = %v", err)
+			}
+			if !equalIDs(shipper.shipped, tt.wantSecond) {
+				t.Errorf("second cycle shipped %v, want %v", shipper.shipped, tt.wantSecond)
+			}
+
+			// Новые события после цикла уходят следующим, история не повторяется
+			store.chains["uag-1"] = append(store.chains["uag-1"], "new")
+			shipper.shipped = nil
+			if _, err := f.Forward(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if !equalIDs(shipper.shipped, []string{"new"}) {
+				t.Errorf("after append shipped %v, want [new]", shipper.shipped)
+			}
+		})
+	}
+}
+
+func TestAuditForwarderCheckChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		chains    map[string][]string
+		unchained int64
+		wantErr   bool
+	}{
+		{name: "empty journal"},
+		{name: "chained events", chains: map[string][]string{"uag-1": chainOf("a", 2)}},
+		// История до включения цепочки: пересылка работает, в лог — предупреждение
+		{name: "partly unchained", chains: map[string][]string{"uag-1": chainOf("a", 2)}, unchained: 10},
+		{name: "chain disabled", unchained: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memForwardStore{chains: tt.chains, unchained: tt.unchained}
+			f := NewAuditForwarder(store, &recordingShipper{}, "siem", 10, true, zap.NewNop())
+			if err := f.CheckChain(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("CheckChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func equalIDs(got, want []string) bool {
+	return len(got) == len(want) && (len(got) == 0 || reflect.DeepEqual(got, want))
+}
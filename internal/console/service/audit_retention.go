@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"go.uber.org/zap"
+)
+
+// restoreBatchSize — строк архива в одной вставке при восстановлении.
+const restoreBatchSize = 500
+
+// AuditRetentionStore — партиции хранения audit_logs и их архивы.
+type AuditRetentionStore interface {
+	WithAuditMaintenanceLock(ctx context.Context, fn func() error) (bool, error)
+	AuditPartitions(ctx context.Context) ([]audit.Partition, error)
+	CreateAuditPartition(ctx context.Context, p audit.Partition) error
+	ExpireAuditPartition(ctx context.Context, p audit.Partition, archive *audit.ArchiveWriter, sign func(*audit.Checkpoint) error) error
+	AuditArchive(ctx context.Context, partition string) (*audit.Archive, error)
+	SetArchiveHold(ctx context.Context, partition string, held bool) error
+	RestoreAuditRecords(ctx context.Context, records []*audit.ChainRecord) (int64, error)
+}
+
+// MaintenanceResult — что сделал один проход обслуживания.
+type MaintenanceResult struct {
+	Created []string `json:"created"`
+	Expired []string `json:"expired"`
+	Skipped bool     `json:"skipped,omitempty"` // Обслуживание уже выполняет другая реплика
+}
+
+// AuditRetention создает партиции audit_logs наперед и удаляет партиции старше срока хранения,
+// предварительно архивируя их. Начало цепочки хешей, уходящее вместе с партицией, фиксируется
+// подписанным якорем (key == nil — якорь без подписи), чтобы auditctl verify не считал это удалением.
+type AuditRetention struct {
+	repo   AuditRetentionStore
+	key    *rsa.PrivateKey
+	cfg    infra.AuditRetentionConfig
+	logger *zap.Logger
+}
+
+func NewAuditRetention(repo AuditRetentionStore, key *rsa.PrivateKey, cfg infra.AuditRetentionConfig, logger *zap.Logger) *AuditRetention {
+	return &AuditRetention{repo: repo, key: key, cfg: cfg, logger: logger.Named("audit-retention")}
+}
+
+// Maintain выполняет один проход: создание недостающих партиций и удаление просроченных.
+func (s *AuditRetention) Maintain(ctx context.Context) (*MaintenanceResult, error) {
+	res := &MaintenanceResult{Created: []string{}, Expired: []string{}}
+	locked, err := s.repo.WithAuditMaintenanceLock(ctx, func() error {
+		parts, err := s.repo.AuditPartitions(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if err := s.createAhead(ctx, parts, now, res); err != nil {
+			return err
+		}
+		if s.cfg.Days > 0 {
+			return s.expire(ctx, parts, now.AddDate(0, 0, -s.cfg.Days), res)
+		}
+		return nil
+	})
+	res.Skipped = !locked
+	return res, err
+}
+
+func (s *AuditRetention) createAhead(ctx context.Context, parts []audit.Partition, now time.Time, res *MaintenanceResult) error {
+	t := now
+	for i := 0; i <= s.cfg.CreateAhead; i++ {
+		p, err := audit.PartitionFor(s.cfg.Partition, t)
+		if err != nil {
+			return err
+		}
+		t = p.To
+		if overlapsAny(p, parts) {
+			continue // Диапазон уже покрыт (в том числе партицией другой гранулярности)
+		}
+		if err := s.repo.CreateAuditPartition(ctx, p); err != nil {
+			return err
+		}
+		res.Created = append(res.Created, p.Name)
+		s.logger.Info("audit partition created", zap.String("partition", p.Name))
+	}
+	return nil
+}
+
+func (s *AuditRetention) expire(ctx context.Context, parts []audit.Partition, cutoff time.Time, res *MaintenanceResult) error {
+	var sign func(*audit.Checkpoint) error
+	if s.key != nil {
+		sign = func(cp *audit.Checkpoint) error { return audit.SignCheckpoint(s.key, cp) }
+	}
+
+	for _, p := range parts {
+		if !p.Expired(cutoff) || p.Held {
+			continue
+		}
+		archive, err := s.archiveWriter(ctx, p)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.ExpireAuditPartition(ctx, p, archive, sign); err != nil {
+			return err
+		}
+		res.Expired = append(res.Expired, p.Name)
+		s.logger.Info("audit partition expired",
+			zap.String("partition", p.Name),
+			zap.Bool("archived", archive != nil))
+	}
+	return nil
+}
+
+// archiveWriter — архив для удаляемой партиции; nil, если архивация выключена или партиция
+// уже архивировалась (восстановленная и отпущенная партиция удаляется без повторного архива).
+func (s *AuditRetention) archiveWriter(ctx context.Context, p audit.Partition) (*audit.ArchiveWriter, error) {
+	if !s.cfg.Archive.Enabled {
+		return nil, nil
+	}
+	existing, err := s.repo.AuditArchive(ctx, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, nil
+	}
+	return audit.NewArchiveWriter(s.cfg.Archive.Dir, p)
+}
+
+// Restore возвращает архив партиции в audit_logs для расследования и удерживает партицию
+// от удаления по сроку до Release. path переопределяет путь из audit_archives (архив перенесен);
+// контрольная сумма сверяется всегда. Возвращает число восстановленных строк.
+func (s *AuditRetention) Restore(ctx context.Context, partition, path string) (int64, error) {
+	a, err := s.repo.AuditArchive(ctx, partition)
+	if err != nil {
+		return 0, err
+	}
+	if a == nil {
+		return 0, fmt.Errorf("archive of partition %s not found", partition)
+	}
+	if path == "" {
+		path = a.Path
+	}
+	p, ok := audit.ParsePartition(partition)
+	if !ok {
+		return 0, fmt.Errorf("invalid partition name %q", partition)
+	}
+
+	// Удержание ставится до вставки: иначе проход обслуживания мог бы удалить партицию посреди восстановления
+	if err := s.repo.SetArchiveHold(ctx, partition, true); err != nil {
+		return 0, err
+	}
+	parts, err := s.repo.AuditPartitions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !overlapsAny(p, parts) {
+		if err := s.repo.CreateAuditPartition(ctx, p); err != nil {
+			return 0, err
+		}
+	}
+
+	var restored int64
+	batch := make([]*audit.ChainRecord, 0, restoreBatchSize)
+	flush := func() error {
+		n, err := s.repo.RestoreAuditRecords(ctx, batch)
+		restored += n
+		batch = batch[:0]
+		return err
+	}
+	err = audit.ReadArchive(path, a.SHA256, func(rec *audit.ChainRecord) error {
+		if batch = append(batch, rec); len(batch) == restoreBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return restored, err
+	}
+
+	s.logger.Info("audit archive restored", zap.String("partition", partition), zap.Int64("rows", restored))
+	return restored, nil
+}
+
+// Release снимает удержание восстановленной партиции: следующий проход удалит ее по сроку.
+func (s *AuditRetention) Release(ctx context.Context, partition string) error {
+	if _, ok := audit.ParsePartition(partition); !ok {
+		return fmt.Errorf("invalid partition name %q", partition)
+	}
+	return s.repo.SetArchiveHold(ctx, partition, false)
+}
+
+// Run выполняет обслуживание сразу и затем с заданным интервалом до отмены ctx.
+func (s *AuditRetention) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		res, err := s.Maintain(ctx)
+		switch {
+		case errors.Is(err, context.Canceled):
+			return
+		case err != nil:
+			s.logger.Error("audit maintenance failed", zap.Error(err))
+		case res.Skipped:
+			s.logger.Debug("audit maintenance is running on another replica")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func overlapsAny(p audit.Partition, parts []audit.Partition) bool {
+	for _, o := range parts {
+		if p.Overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
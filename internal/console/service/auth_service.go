@@ -2,59 +2,323 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthProvider interface {
 	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	RecordLoginFailure(ctx context.Context, id string, maxAttempts int, lockFor time.Duration) (*time.Time, error)
+	RecordLoginSuccess(ctx context.Context, id string) error
+
+	// Client Credentials агентов
+	GetAgent(ctx context.Context, id string) (*domain.Agent, error)
+	ListAgentCredentials(ctx context.Context, agentID string) ([]domain.AgentCredential, error)
+	RotateAgentCredential(ctx context.Context, agentID, secretHash, author string, grace time.Duration) (*domain.AgentCredential, *time.Time, error)
+	RevokeAgentCredentials(ctx context.Context, agentID, author string) (int64, error)
 }
 
 type AuthService struct {
-	repo       AuthProvider
-	privateKey *rsa.PrivateKey
+	repo        AuthProvider
+	privateKey  *rsa.PrivateKey
+	keys        *auth.KeySet // Публикуется в JWKS: текущий ключ и прежние (ротация)
+	revocations *auth.RevocationList
+	cfg         infra.AuthConfig
+	// dummyHash сравнивается с секретом неизвестного клиента (или паролем неизвестного
+	// пользователя), чтобы время ответа не выдавало, существует ли учетная запись
+	dummyHash []byte
 }
 
-func NewAuthService(repo AuthProvider, privateKey *rsa.PrivateKey) *AuthService {
+func NewAuthService(repo AuthProvider, privateKey *rsa.PrivateKey, keys *auth.KeySet, revocations *auth.RevocationList, cfg infra.AuthConfig) *AuthService {
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+	dummy, _ := bcrypt.GenerateFromPassword([]byte(uuid.NewString()), cfg.BcryptCost)
+
 	return &AuthService{
-		repo:       repo,
-		privateKey: privateKey,
+		repo:        repo,
+		privateKey:  privateKey,
+		keys:        keys,
+		revocations: revocations,
+		cfg:         cfg,
+		dummyHash:   dummy,
 	}
 }
 
 func (s *AuthService) GenerateToken(ctx context.Context, username, password string) (*domain.TokenResponse, error) {
 	// 1. Аутентификация (Источник правды — Postgres)
-	user, err := s.repo.GetUserByUsername(ctx, username)
-	if err != nil || user == nil {
-		return nil, errors.New("invalid credentials")
+	user, err := s.repo.GetUserByUsername(ctx, strings.ToLower(strings.TrimSpace(username)))
+	if err != nil {
+		return nil, err
+	}
+	// Неизвестный, отключенный, заблокированный и внешний (OIDC) пользователь получают
+	// тот же ответ, что и неверный пароль, и за то же время
+	if user == nil || !user.IsActive() || user.IsLocked(time.Now()) || user.IsExternal() {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, domain.ErrInvalidCredentials
 	}
 
 	// 2. Проверка пароля (используем bcrypt)
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		if lc := s.cfg.Lockout; lc.MaxAttempts > 0 {
+			if _, err := s.repo.RecordLoginFailure(ctx, user.ID, lc.MaxAttempts, lc.Duration); err != nil {
+				return nil, err
+			}
+		}
+		return nil, domain.ErrInvalidCredentials
+	}
+	if err := s.repo.RecordLoginSuccess(ctx, user.ID); err != nil {
+		return nil, err
 	}
 
-	// 3. Формирование Claims (Scopes берем из прав пользователя в БД)
-	expiresAt := time.Now().Add(time.Hour * 24)
+	return s.issueUserToken(user)
+}
+
+// issueUserToken выдает токен консоли аутентифицированному пользователю (пароль или OIDC).
+func (s *AuthService) issueUserToken(user *domain.User) (*domain.TokenResponse, error) {
+	// 3. Формирование Claims (роль и персональные Scopes берем из БД)
+	scopes := make(map[string]bool, len(user.Scopes)+1)
+	for sc, ok := range user.Scopes {
+		scopes[sc] = ok
+	}
+	if user.Role == domain.RoleAdmin {
+		scopes["admin"] = true // RBAC консоли пропускает админа к любому действию
+	}
 	claims := &domain.CustomClaims{
 		UserID: user.ID,
-		Scopes: user.Scopes, // Напр. map[string]bool{"admin": true}
+		Role:   user.Role,
+		Scopes: scopes, // Напр. map[string]bool{"policies:write": true}
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "spaceai-console",
-			Subject:   user.ID,
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:  user.ID,
+			Audience: jwt.ClaimStrings{domain.AudienceConsole},
 		},
 	}
 
 	// 4. Подпись токена ЗАКРЫТЫМ КЛЮЧОМ (RS256)
+	return s.sign(claims, s.cfg.TokenTTL)
+}
+
+// MaxRotationGrace — предельный льготный период прежнего секрета при ротации.
+const MaxRotationGrace = 7 * 24 * time.Hour
+
+// IssueAgentToken выдает агенту токен по OAuth2 Client Credentials.
+// Scopes токена берутся из реестра (Agent.Scopes) и могут быть сужены параметром scope.
+// Ошибки возвращаются как *domain.OAuthError.
+func (s *AuthService) IssueAgentToken(ctx context.Context, req domain.ClientCredentialsRequest) (*domain.TokenResponse, error) {
+	if req.GrantType != domain.GrantTypeClientCredentials {
+		return nil, &domain.OAuthError{Code: domain.OAuthUnsupportedGrantType}
+	}
+	if req.ClientID == "" || req.ClientSecret == "" {
+		return nil, &domain.OAuthError{Code: domain.OAuthInvalidRequest, Description: "client_id and client_secret are required"}
+	}
+
+	agent, err := s.authenticateAgent(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Заблокированный агент токен не получает. Карантин и песочница — режимы шлюза, токен им нужен.
+	if agent.Status == domain.StatusBlocked {
+		return nil, &domain.OAuthError{Code: domain.OAuthInvalidClient, Description: "agent is blocked"}
+	}
+
+	granted := agent.Scopes
+	if requested := req.RequestedScopes(); len(requested) > 0 {
+		allowed := make(map[string]bool, len(agent.Scopes))
+		for _, sc := range agent.Scopes {
+			allowed[sc] = true
+		}
+		for _, sc := range requested {
+			if !domain.ScopeAllows(allowed, sc) {
+				return nil, &domain.OAuthError{Code: domain.OAuthInvalidScope, Description: fmt.Sprintf("scope %q is not granted to agent", sc)}
+			}
+		}
+		granted = requested
+	}
+
+	scopes := make(map[string]bool, len(granted))
+	for _, sc := range granted {
+		scopes[sc] = true
+	}
+
+	claims := &domain.CustomClaims{
+		AgentID: agent.ID,
+		Scopes:  scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  agent.ID,
+			Audience: jwt.ClaimStrings{domain.AudienceGateway},
+		},
+	}
+
+	resp, err := s.sign(claims, s.agentTokenTTL(agent))
+	if err != nil {
+		return nil, err
+	}
+	resp.Scope = strings.Join(granted, " ")
+	return resp, nil
+}
+
+// authenticateAgent проверяет client_id/client_secret. Любая неудача — invalid_client без деталей.
+func (s *AuthService) authenticateAgent(ctx context.Context, clientID, secret string) (*domain.Agent, error) {
+	invalid := &domain.OAuthError{Code: domain.OAuthInvalidClient}
+
+	var agent *domain.Agent
+	var creds []domain.AgentCredential
+	if _, err := uuid.Parse(clientID); err == nil {
+		if agent, err = s.repo.GetAgent(ctx, clientID); err != nil {
+			return nil, err
+		}
+		if agent != nil && agent.DeletedAt == nil {
+			if creds, err = s.repo.ListAgentCredentials(ctx, agent.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(creds) == 0 {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(secret))
+		return nil, invalid
+	}
+	for _, c := range creds {
+		if bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret)) == nil {
+			return agent, nil
+		}
+	}
+	return nil, invalid
+}
+
+// agentTokenTTL — персональный TTL агента, ограниченный сверху auth.agent_tokens.max_ttl.
+func (s *AuthService) agentTokenTTL(a *domain.Agent) time.Duration {
+	ttl := s.cfg.AgentTokens.DefaultTTL
+	if a.TokenTTLSeconds > 0 {
+		ttl = time.Duration(a.TokenTTLSeconds) * time.Second
+	}
+	if limit := s.cfg.AgentTokens.MaxTTL; limit > 0 && ttl > limit {
+		ttl = limit
+	}
+	return ttl
+}
+
+// RotateAgentSecret выпускает агенту новый секрет. Прежние действуют еще grace
+// (nil — auth.agent_tokens.rotation_grace, 0 — отзываются сразу).
+func (s *AuthService) RotateAgentSecret(ctx context.Context, agentID string, grace *time.Duration) (*domain.AgentSecret, error) {
+	g := s.cfg.AgentTokens.RotationGrace
+	if grace != nil {
+		g = *grace
+	}
+	if g < 0 || g > MaxRotationGrace {
+		return nil, &ValidationError{Err: fmt.Errorf("grace must be in [0, %s]", MaxRotationGrace)}
+	}
+	if _, err := uuid.Parse(agentID); err != nil {
+		return nil, domain.ErrAgentNotFound
+	}
+
+	secret, err := newClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), s.cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, previous, err := s.repo.RotateAgentCredential(ctx, agentID, string(hash), authorFromContext(ctx), g)
+	if err != nil {
+		return nil, err
+	}
+	// Секрет в журнал не попадает: только идентификатор и срок прежних секретов
+	recordAfter(ctx, TargetAgent, agentID, map[string]any{
+		"credential_id":       cred.ID,
+		"previous_expires_at": previous,
+		"grace":               g.String(),
+	})
+	// Ротация без льготного периода — реакция на компрометацию: гасим и выданные токены
+	if g == 0 {
+		if err := s.revocations.RevokeSubject(ctx, agentID); err != nil {
+			return nil, fmt.Errorf("secret rotated, but token revocation failed: %w", err)
+		}
+	}
+	return &domain.AgentSecret{
+		ClientID:          agentID,
+		ClientSecret:      secret,
+		CredentialID:      cred.ID,
+		PreviousExpiresAt: previous,
+	}, nil
+}
+
+// ListAgentSecrets возвращает действующие секреты агента (без хешей).
+func (s *AuthService) ListAgentSecrets(ctx context.Context, agentID string) ([]domain.AgentCredential, error) {
+	if _, err := uuid.Parse(agentID); err != nil {
+		return nil, domain.ErrAgentNotFound
+	}
+	return s.repo.ListAgentCredentials(ctx, agentID)
+}
+
+// RevokeAgentSecrets немедленно отзывает все секреты агента (компрометация)
+// вместе с уже выданными ему токенами.
+func (s *AuthService) RevokeAgentSecrets(ctx context.Context, agentID string) (int64, error) {
+	if _, err := uuid.Parse(agentID); err != nil {
+		return 0, domain.ErrAgentNotFound
+	}
+	n, err := s.repo.RevokeAgentCredentials(ctx, agentID, authorFromContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	recordAfter(ctx, TargetAgent, agentID, map[string]int64{"revoked_credentials": n})
+	return n, s.revocations.RevokeSubject(ctx, agentID)
+}
+
+// RevokeRequest — отзыв токенов: конкретного (jti) или всех токенов subject (user_id или agent_id).
+type RevokeRequest struct {
+	JTI       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"` // Срок токена, если известен: столько хранится запись об отзыве
+	Subject   string    `json:"subject"`
+}
+
+// RevokeTokens вносит токены в список отзыва. Действует сразу для консоли и всех шлюзов.
+func (s *AuthService) RevokeTokens(ctx context.Context, req RevokeRequest) error {
+	if (req.JTI == "") == (req.Subject == "") {
+		return &ValidationError{Err: errors.New("exactly one of jti or subject is required")}
+	}
+	recordAfter(ctx, TargetTokens, req.JTI+req.Subject, req)
+	if req.JTI != "" {
+		return s.revocations.RevokeToken(ctx, req.JTI, req.ExpiresAt)
+	}
+	return s.revocations.RevokeSubject(ctx, req.Subject)
+}
+
+// JWKS возвращает открытые ключи для проверки токенов (текущий и прежние).
+func (s *AuthService) JWKS() auth.JWKS {
+	return s.keys.JWKS()
+}
+
+// sign подписывает токен ЗАКРЫТЫМ КЛЮЧОМ (RS256) и заполняет общие claims.
+func (s *AuthService) sign(claims *domain.CustomClaims, ttl time.Duration) (*domain.TokenResponse, error) {
+	if s.privateKey == nil {
+		return nil, errors.New("token signing is not configured: private key is missing")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims.Issuer = "spaceai-console"
+	claims.ID = uuid.NewString() // jti — для точечного отзыва
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = auth.KeyID(&s.privateKey.PublicKey)
 	signedToken, err := token.SignedString(s.privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign token: %w", err)
@@ -63,6 +327,15 @@ func (s *AuthService) GenerateToken(ctx context.Context, username, password stri
 	return &domain.TokenResponse{
 		AccessToken: signedToken,
 		TokenType:   "Bearer",
-		ExpiresIn:   int64(time.Until(expiresAt).Seconds()),
+		ExpiresIn:   int64(ttl.Seconds()),
 	}, nil
 }
+
+// newClientSecret генерирует 256-битный секрет. Префикс помогает сканерам утечек узнать его в коде.
+func newClientSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "sas_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memCredential struct {
+	domain.AgentCredential
+	revoked bool
+}
+
+// memAgentAuthRepo повторяет семантику postgres.AgentRepo для секретов агентов:
+// ротация с льготным периодом ограничивает срок прежних секретов, без него — отзывает их.
+type memAgentAuthRepo struct {
+	AuthProvider // Вход пользователей в этих тестах не используется
+	agents       map[string]*domain.Agent
+	creds        []*memCredential
+	rotations    int
+}
+
+func (r *memAgentAuthRepo) GetAgent(_ context.Context, id string) (*domain.Agent, error) {
+	a, ok := r.agents[id]
+	if !ok {
+		return nil, nil
+	}
+	c := *a
+	return &c, nil
+}
+
+func (r *memAgentAuthRepo) ListAgentCredentials(_ context.Context, agentID string) ([]domain.AgentCredential, error) {
+	now := time.Now()
+	var list []domain.AgentCredential
+	for _, c := range r.creds {
+		if c.AgentID == agentID && !c.revoked && (c.ExpiresAt == nil || c.ExpiresAt.After(now)) {
+			list = append(list, c.AgentCredential)
+		}
+	}
+	return list, nil
+}
+
+func (r *memAgentAuthRepo) RotateAgentCredential(_ context.Context, agentID, secretHash, author string, grace time.Duration) (*domain.AgentCredential, *time.Time, error) {
+	r.rotations++
+	if _, ok := r.agents[agentID]; !ok {
+		return nil, nil, domain.ErrAgentNotFound
+	}
+	var previous *time.Time
+	until := time.Now().Add(grace)
+	for _, c := range r.creds {
+		if c.AgentID != agentID || c.revoked {
+			continue
+		}
+		if grace == 0 {
+			c.revoked = true
+			continue
+		}
+		if c.ExpiresAt == nil || c.ExpiresAt.After(until) {
+			c.ExpiresAt = &until
+		}
+		previous = &until
+	}
+	return r.add(agentID, secretHash, author), previous, nil
+}
+
+func (r *memAgentAuthRepo) RevokeAgentCredentials(_ context.Context, agentID, _ string) (int64, error) {
+	var n int64
+	for _, c := range r.creds {
+		if c.AgentID == agentID && !c.revoked {
+			c.revoked = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memAgentAuthRepo) add(agentID, secretHash, author string) *domain.AgentCredential {
+	c := &memCredential{AgentCredential: domain.AgentCredential{ID: uuid.NewString(), AgentID: agentID,
+		SecretHash: secretHash, CreatedAt: time.Now(), CreatedBy: author}}
+	r.creds = append(r.creds, c)
+	return &c.AgentCredential
+}
+
+const agentSecret = "uag_initial_secret"
+
+type agentAuthEnv struct {
+	repo *memAgentAuthRepo
+	auth *AuthService
+	mr   *miniredis.Miniredis
+}
+
+// newAgentAuthEnv регистрирует агентов с секретом agentSecret.
+func newAgentAuthEnv(t *testing.T, cfg infra.AgentTokenConfig, agents ...*domain.Agent) *agentAuthEnv {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(agentSecret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memAgentAuthRepo{agents: make(map[string]*domain.Agent)}
+	for _, a := range agents {
+		repo.agents[a.ID] = a
+		repo.add(a.ID, string(hash), "admin")
+	}
+	authCfg := infra.AuthConfig{BcryptCost: bcrypt.MinCost, TokenTTL: time.Hour, AgentTokens: cfg}
+	return &agentAuthEnv{
+		repo: repo,
+		auth: NewAuthService(repo, key, auth.NewKeySet(&key.PublicKey), auth.NewRevocationList(rdb, time.Hour, false), authCfg),
+		mr:   mr,
+	}
+}
+
+func (e *agentAuthEnv) issue(clientID, secret, scope string) (*domain.TokenResponse, error) {
+	return e.auth.IssueAgentToken(context.Background(), domain.ClientCredentialsRequest{
+		GrantType: domain.GrantTypeClientCredentials, ClientID: clientID, ClientSecret: secret, Scope: scope,
+	})
+}
+
+func oauthCode(err error) string {
+	var oerr *domain.OAuthError
+	if errors.As(err, &oerr) {
+		return oerr.Code
+	}
+	return ""
+}
+
+func TestIssueAgentToken(t *testing.T) {
+	now := time.Now()
+	active := &domain.Agent{ID: uuid.NewString(), Status: domain.StatusActive, Scopes: []string{"crm.read", "bank.*"}}
+	quarantined := &domain.Agent{ID: uuid.NewString(), Status: domain.StatusQuarantine, Scopes: []string{"crm.read"}}
+	blocked := &domain.Agent{ID: uuid.NewString(), Status: domain.StatusBlocked, Scopes: []string{"crm.read"}}
+	deleted := &domain.Agent{ID: uuid.NewString(), Status: domain.StatusActive, Scopes: []string{"crm.read"}, DeletedAt: &now}
+	env := newAgentAuthEnv(t, infra.AgentTokenConfig{DefaultTTL: 15 * time.Minute}, active, quarantined, blocked, deleted)
+
+	tests := []struct {
+		name      string
+		req       domain.ClientCredentialsRequest
+		wantCode  string // Код OAuth-ошибки; "" — токен выдан
+		wantScope string
+	}{
+		{name: "all registered scopes", req: domain.ClientCredentialsRequest{ClientID: active.ID}, wantScope: "crm.read bank.*"},
+		{name: "narrowed", req: domain.ClientCredentialsRequest{ClientID: active.ID, Scope: "crm.read"}, wantScope: "crm.read"},
+		{name: "narrowed within wildcard", req: domain.ClientCredentialsRequest{ClientID: active.ID, Scope: "bank.transfer crm.read"}, wantScope: "bank.transfer crm.read"},
+		{name: "scope not granted", req: domain.ClientCredentialsRequest{ClientID: active.ID, Scope: "crm.read crm.write"}, wantCode: domain.OAuthInvalidScope},
+		{name: "broader than registered", req: domain.ClientCredentialsRequest{ClientID: active.ID, Scope: "*"}, wantCode: domain.OAuthInvalidScope},
+		{name: "quarantined agent", req: domain.ClientCredentialsRequest{ClientID: quarantined.ID}, wantScope: "crm.read"},
+		{name: "blocked agent", req: domain.ClientCredentialsRequest{ClientID: blocked.ID}, wantCode: domain.OAuthInvalidClient},
+		{name: "deleted agent", req: domain.ClientCredentialsRequest{ClientID: deleted.ID}, wantCode: domain.OAuthInvalidClient},
+		{name: "wrong secret", req: domain.ClientCredentialsRequest{ClientID: active.ID, ClientSecret: "uag_wrong"}, wantCode: domain.OAuthInvalidClient},
+		{name: "unknown client", req: domain.ClientCredentialsRequest{ClientID: uuid.NewString()}, wantCode: domain.OAuthInvalidClient},
+		{name: "malformed client id", req: domain.ClientCredentialsRequest{ClientID: "agent-1"}, wantCode: domain.OAuthInvalidClient},
+		{name: "missing secret", req: domain.ClientCredentialsRequest{ClientID: active.ID, ClientSecret: "-"}, wantCode: domain.OAuthInvalidRequest},
+		{name: "wrong grant type", req: domain.ClientCredentialsRequest{GrantType: "password", ClientID: active.ID}, wantCode: domain.OAuthUnsupportedGrantType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			if req.GrantType == "" {
+				req.GrantType = domain.GrantTypeClientCredentials
+			}
+			switch req.ClientSecret {
+			case "":
+				req.ClientSecret = agentSecret
+			case "-":
+				req.ClientSecret = ""
+			}
+
+			resp, err := env.auth.IssueAgentToken(context.Background(), req)
+			if tt.wantCode != "" {
+				if code := oauthCode(err); code != tt.wantCode {
+					t.Fatalf("IssueAgentToken() error = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("IssueAgentToken() error = %v", err)
+			}
+			if resp.Scope != tt.wantScope || resp.AccessToken == "" {
+				t.Errorf("token scope = %q, want %q", resp.Scope, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestAgentTokenTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      infra.AgentTokenConfig
+		agentTTL int
+		want     int64
+	}{
+		{name: "default", cfg: infra.AgentTokenConfig{DefaultTTL: 15 * time.Minute, MaxTTL: time.Hour}, want: 900},
+		{name: "per agent", cfg: infra.AgentTokenConfig{DefaultTTL: 15 * time.Minute, MaxTTL: time.Hour}, agentTTL: 600, want: 600},
+		{name: "capped by max", cfg: infra.AgentTokenConfig{DefaultTTL: 15 * time.Minute, MaxTTL: time.Hour}, agentTTL: 7200, want: 3600},
+		{name: "no cap", cfg: infra.AgentTokenConfig{DefaultTTL: 15 * time.Minute}, agentTTL: 7200, want: 7200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &domain.Agent{ID: uuid.NewString(), Status: domain.StatusActive, Scopes: []string{"crm.read"}, TokenTTLSeconds: tt.agentTTL}
+			env := newAgentAuthEnv(t, tt.cfg, agent)
+			resp, err := env.issue(agent.ID, agentSecret, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.ExpiresIn != tt.want {
+				t.Errorf("expires_in = %d, want %d", resp.ExpiresIn, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateAgentSecret(t *testing.T) {
+	agent := &domain.Agent{ID: uuid.NewString(), Status: domain.StatusActive, Scopes: []string{"crm.read"}}
+	dur := func(d time.Duration) *time.Duration { return &d }
+	revoked := func(env *agentAuthEnv) bool { return env.mr.Exists(infra.RedisKeyRevokedSubjectPrefix + agent.ID) }
+
+	t.Run("invalid grace", func(t *testing.T) {
+		env := newAgentAuthEnv(t, infra.AgentTokenConfig{DefaultTTL: time.Minute}, agent)
+		for _, g := range []time.Duration{-time.Second, MaxRotationGrace + time.Second} {
+			var verr *ValidationError
+			if _, err := env.auth.RotateAgentSecret(context.Background(), agent.ID, &g); !errors.As(err, &verr) {
+				t.Errorf("grace %s: error = %v, want ValidationError", g, err)
+			}
+		}
+		if env.repo.rotations != 0 {
+			t.Errorf("repository called %d times for invalid grace", env.repo.rotations)
+		}
+	})
+
+	t.Run("with grace", func(t *testing.T) {
+		env := newAgentAuthEnv(t, infra.AgentTokenConfig{DefaultTTL: time.Minute}, agent)
+		secret, err := env.auth.RotateAgentSecret(context.Background(), agent.ID, dur(time.Hour))
+		if err != nil {
+			t.Fatalf("RotateAgentSecret() error = %v", err)
+		}
+		if secret.PreviousExpiresAt == nil || secret.ClientID != agent.ID {
+			t.Errorf("secret = %+v, want previous expiry", secret)
+		}
+		// Оба секрета действуют до конца льготного периода, выданные токены не отзываются
+		for _, s := range []string{agentSecret, secret.ClientSecret} {
+			if _, err := env.issue(agent.ID, s, ""); err != nil {
+				t.Errorf("token with secret during grace: %v", err)
+			}
+		}
+		if revoked(env) {
+			t.Error("rotation with grace revoked issued tokens")
+		}
+	})
+
+	t.Run("configured grace", func(t *testing.T) {
+		env := newAgentAuthEnv(t, infra.AgentTokenConfig{DefaultTTL: time.Minute, RotationGrace: time.Hour}, agent)
+		secret, err := env.auth.RotateAgentSecret(context.Background(), agent.ID, nil)
+		if err != nil || secret.PreviousExpiresAt == nil {
+			t.Fatalf("RotateAgentSecret(nil) = %+v, %v; want configured grace", secret, err)
+		}
+	})
+
+	t.Run("without grace", func(t *testing.T) {
+		env := newAgentAuthEnv(t, infra.AgentTokenConfig{DefaultTTL: time.Minute, RotationGrace: time.Hour}, agent)
+		secret, err := env.auth.RotateAgentSecret(context.Background(), agent.ID, dur(0))
+		if err != nil {
+			t.Fatalf("RotateAgentSecret() error = %v", err)
+		}
+		if _, err := env.issue(agent.ID, agentSecret, ""); oauthCode(err) != domain.OAuthInvalidClient {
+			t.Errorf("old secret after rotation without grace: error = %v, want invalid_client", err)
+		}
+		if _, err := env.issue(agent.ID, secret.ClientSecret, ""); err != nil {
+			t.Errorf("new secret: %v", err)
+		}
+		if !revoked(env) {
+			t.Error("rotation without grace did not revoke issued tokens")
+		}
+	})
+
+	t.Run("unknown agent", func(t *testing.T) {
+		env := newAgentAuthEnv(t, infra.AgentTokenConfig{DefaultTTL: time.Minute})
+		if _, err := env.auth.RotateAgentSecret(context.Background(), "agent-1", nil); !errors.Is(err, domain.ErrAgentNotFound) {
+			t.Errorf("malformed id error = %v, want %v", err, domain.ErrAgentNotFound)
+		}
+	})
+}
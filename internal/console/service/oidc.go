@@ -0,0 +1,290 @@
+package service
+
+/*
+Файл oidc.go реализует вход операторов в консоль через корпоративный IdP (OIDC).
+
+1. BeginLogin: state, nonce и PKCE verifier сохраняются в Redis (одноразово, auth.oidc.state_ttl),
+   браузер получает cookie с секретом привязки и уходит на страницу входа IdP.
+2. CompleteLogin: state погашается, cookie должна совпасть с хешем в state — чужой callback
+   (login CSRF, подсунутая ссылка) в другом браузере не завершится. Код обменивается на id_token,
+   группы IdP сопоставляются с ролью и scopes консоли (auth.oidc.group_mappings).
+3. Пользователь создается при первом входе (JIT) или синхронизируется с IdP,
+   после чего выдается обычный RS256-токен консоли — RBAC и шлюзы работают как с паролем.
+*/
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"go.uber.org/zap"
+)
+
+// OIDCUserRepository — хранилище внешних пользователей.
+type OIDCUserRepository interface {
+	GetUserByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error)
+	CreateUser(ctx context.Context, u *domain.User) error
+	SyncExternalUser(ctx context.Context, u *domain.User) error
+	RecordLoginSuccess(ctx context.Context, id string) error
+}
+
+var (
+	// ErrOIDCState — state неизвестен, истек, уже использован (повтор callback)
+	// или начат в другом браузере (нет cookie привязки).
+	ErrOIDCState = errors.New("oidc login state is invalid or expired")
+	// ErrOIDCAccessDenied — IdP подтвердил личность, но доступа к консоли у пользователя нет.
+	ErrOIDCAccessDenied = errors.New("access to console is not granted")
+)
+
+// externalPasswordHash — заглушка password_hash внешнего пользователя: не является bcrypt-хешем,
+// поэтому никакой пароль с ней не совпадет.
+const externalPasswordHash = "!oidc"
+
+type oidcLoginState struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	ReturnTo string `json:"return_to,omitempty"`
+	// BrowserHash — SHA-256 секрета из cookie браузера, начавшего вход. Сам секрет в Redis не хранится.
+	BrowserHash string `json:"browser_hash"`
+}
+
+type OIDCService struct {
+	provider *auth.OIDCProvider
+	tokens   *AuthService
+	repo     OIDCUserRepository
+	rdb      *redis.Client
+	cfg      infra.OIDCConfig
+	logger   *zap.Logger
+}
+
+func NewOIDCService(provider *auth.OIDCProvider, tokens *AuthService, repo OIDCUserRepository, rdb *redis.Client, cfg infra.OIDCConfig, logger *zap.Logger) *OIDCService {
+	return &OIDCService{
+		provider: provider,
+		tokens:   tokens,
+		repo:     repo,
+		rdb:      rdb,
+		cfg:      cfg,
+		logger:   logger.Named("oidc-service"),
+	}
+}
+
+// BeginLogin начинает вход и возвращает адрес IdP для редиректа и секрет привязки,
+// который обработчик кладет в cookie браузера. returnTo — относительный путь консоли,
+// куда вернуть браузер с токеном после входа.
+func (s *OIDCService) BeginLogin(ctx context.Context, returnTo string) (redirect, binding string, err error) {
+	if returnTo != "" && !isLocalPath(returnTo) {
+		return "", "", &ValidationError{Err: errors.New("return_to must be a relative path")}
+	}
+
+	var st oidcLoginState
+	state, err := auth.RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	if st.Verifier, err = auth.RandomToken(); err != nil {
+		return "", "", err
+	}
+	if st.Nonce, err = auth.RandomToken(); err != nil {
+		return "", "", err
+	}
+	if binding, err = auth.RandomToken(); err != nil {
+		return "", "", err
+	}
+	st.ReturnTo = returnTo
+	st.BrowserHash = bindingHash(binding)
+
+	data, _ := json.Marshal(st)
+	if err := s.rdb.Set(ctx, infra.RedisKeyOIDCStatePrefix+state, data, s.cfg.StateTTL).Err(); err != nil {
+		return "", "", fmt.Errorf("failed to save oidc state: %w", err)
+	}
+	redirect, err = s.provider.AuthCodeURL(ctx, state, st.Nonce, st.Verifier)
+	if err != nil {
+		return "", "", err
+	}
+	return redirect, binding, nil
+}
+
+// StateTTL — сколько живет незавершенный вход; столько же живет cookie привязки.
+func (s *OIDCService) StateTTL() time.Duration {
+	return s.cfg.StateTTL
+}
+
+// CompleteLogin завершает вход по коду из callback и выдает токен консоли.
+// binding — значение cookie, выданной в BeginLogin; без него state не принимается.
+// Возвращает также returnTo, переданный в BeginLogin.
+func (s *OIDCService) CompleteLogin(ctx context.Context, state, code, binding string) (*domain.TokenResponse, string, error) {
+	if state == "" || code == "" {
+		return nil, "", ErrOIDCState
+	}
+	// GETDEL: state одноразовый, повтор перехваченного callback не сработает
+	data, err := s.rdb.GetDel(ctx, infra.RedisKeyOIDCStatePrefix+state).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", ErrOIDCState
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load oidc state: %w", err)
+	}
+	var st oidcLoginState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, "", ErrOIDCState
+	}
+	// State уже погашен: callback, открытый в чужом браузере, сжигает попытку, но не входит
+	if subtle.ConstantTimeCompare([]byte(bindingHash(binding)), []byte(st.BrowserHash)) != 1 {
+		s.logger.Warn("oidc callback without matching browser binding")
+		return nil, "", ErrOIDCState
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+
+	role, scopes, ok := MapOIDCGroups(s.cfg, identity.Groups)
+	if !ok {
+		s.logger.Warn("oidc login denied: no group mapping",
+			zap.String("subject", identity.Subject), zap.Strings("groups", identity.Groups))
+		return nil, "", ErrOIDCAccessDenied
+	}
+
+	user, err := s.syncUser(ctx, identity, role, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if !user.IsActive() {
+		s.logger.Warn("oidc login denied: user is disabled", zap.String("user_id", user.ID))
+		return nil, "", ErrOIDCAccessDenied
+	}
+	if err := s.repo.RecordLoginSuccess(ctx, user.ID); err != nil {
+		return nil, "", err
+	}
+
+	resp, err := s.tokens.issueUserToken(user)
+	if err != nil {
+		return nil, "", err
+	}
+	s.logger.Info("oidc login", zap.String("user_id", user.ID), zap.String("username", user.Username),
+		zap.String("role", user.Role))
+	return resp, st.ReturnTo, nil
+}
+
+// syncUser находит пользователя по {issuer}|{sub} и обновляет роль и scopes по данным IdP
+// либо создает его (JIT), если это разрешено.
+func (s *OIDCService) syncUser(ctx context.Context, id *auth.OIDCIdentity, role string, scopes map[string]bool) (*domain.User, error) {
+	externalID := id.Issuer + "|" + id.Subject
+	email := strings.TrimSpace(id.Email)
+
+	user, err := s.repo.GetUserByExternalID(ctx, domain.AuthProviderOIDC, externalID)
+	switch {
+	case err == nil:
+		if email != "" {
+			user.Email = email
+		}
+		user.Role, user.Scopes = role, scopes
+		if err := s.repo.SyncExternalUser(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case !errors.Is(err, domain.ErrUserNotFound):
+		return nil, err
+	case !s.cfg.JITProvisioning:
+		s.logger.Warn("oidc login denied: user is not provisioned", zap.String("external_id", externalID))
+		return nil, ErrOIDCAccessDenied
+	}
+
+	username := oidcUsername(id)
+	if email == "" {
+		email = username + "@oidc.invalid" // users.email обязателен; домен .invalid зарезервирован (RFC 2606)
+	}
+	user = &domain.User{
+		Username:     username,
+		Email:        email,
+		PasswordHash: externalPasswordHash,
+		Role:         role,
+		Scopes:       scopes,
+		CreatedBy:    "oidc",
+		AuthProvider: domain.AuthProviderOIDC,
+		ExternalID:   externalID,
+	}
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, domain.ErrUserExists) {
+			// Имя или email заняты локальной учетной записью: не склеиваем их молча
+			s.logger.Warn("oidc login denied: username or email is taken by another user",
+				zap.String("username", username), zap.String("external_id", externalID))
+			return nil, ErrOIDCAccessDenied
+		}
+		return nil, err
+	}
+	s.logger.Info("oidc user provisioned", zap.String("user_id", user.ID), zap.String("username", username))
+	return user, nil
+}
+
+// MapOIDCGroups сопоставляет группы IdP с ролью и scopes консоли: роль — из первого
+// совпавшего правила, scopes — объединение по всем совпавшим. ok=false — доступа нет.
+func MapOIDCGroups(cfg infra.OIDCConfig, groups []string) (role string, scopes map[string]bool, ok bool) {
+	member := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		member[g] = true
+	}
+
+	scopes = make(map[string]bool)
+	for _, m := range cfg.GroupMappings {
+		if !member[m.Group] {
+			continue
+		}
+		if role == "" && m.Role != "" {
+			role = strings.ToLower(m.Role)
+		}
+		for _, sc := range m.Scopes {
+			scopes[sc] = true
+		}
+	}
+	if role == "" {
+		role = strings.ToLower(cfg.DefaultRole)
+	}
+	return role, scopes, role != ""
+}
+
+// oidcUsername выбирает имя пользователя консоли: claim username_claim, затем локальная часть email.
+func oidcUsername(id *auth.OIDCIdentity) string {
+	for _, candidate := range []string{id.Username, strings.Split(id.Email, "@")[0]} {
+		if u := strings.ToLower(strings.TrimSpace(candidate)); domain.ValidUsername(u) {
+			return u
+		}
+	}
+	// Последний вариант — детерминированное имя из subject
+	sub := strings.ToLower(id.Subject)
+	var b strings.Builder
+	for _, r := range sub {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	name := "oidc-" + b.String()
+	if len(name) > 50 {
+		name = name[:50]
+	}
+	return name
+}
+
+func bindingHash(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(sum[:])
+}
+
+// isLocalPath не допускает открытого редиректа: только путь внутри консоли.
+func isLocalPath(p string) bool {
+	u, err := url.Parse(p)
+	return err == nil && u.Scheme == "" && u.Host == "" &&
+		strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.Contains(p, "\\")
+}
@@ -2,19 +2,34 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/policy"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/redact"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/risk"
 )
 
 // PolicyRepository описывает требования сервиса к хранилищу политик
 type PolicyRepository interface {
 	GetPolicyByID(ctx context.Context, id string) (*domain.Policy, error)
 	GetAllPolicies(ctx context.Context) ([]domain.Policy, error)
-	CreatePolicy(ctx context.Context, p *domain.Policy) error
-	UpdatePolicy(ctx context.Context, p *domain.Policy) error
-	DeletePolicy(ctx context.Context, id string) error
+	CreatePolicy(ctx context.Context, p *domain.Policy, author string) error
+	UpdatePolicy(ctx context.Context, p *domain.Policy, author string) error
+	DeletePolicy(ctx context.Context, id string, author string) error
+
+	// История версий и откат
+	ListPolicyVersions(ctx context.Context, policyID string) ([]domain.PolicyVersion, error)
+	RollbackPolicy(ctx context.Context, policyID string, version int, author string) (*domain.Policy, error)
+	RollbackPoliciesTo(ctx context.Context, at time.Time, author string) (int, error)
+
+	// Policy-as-Code
+	ApplyPolicyBundle(ctx context.Context, desired []domain.Policy, author string) (*domain.BundlePlan, error)
 }
 
 type PolicyService struct {
@@ -40,31 +55,271 @@ func (s *PolicyService) GetAll(ctx context.Context) ([]domain.Policy, error) {
 
 // Create сохраняет политику и уведомляет шлюзы об обновлении
 func (s *PolicyService) Create(ctx context.Context, p *domain.Policy) error {
-	if err := s.repo.CreatePolicy(ctx, p); err != nil {
+	if p.BreakGlass {
+		return &ValidationError{Err: errors.New("break-glass grants are created via /v1/policies/break-glass")}
+	}
+	if err := p.ValidateTiming(); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if err := validateConditions(p.Conditions); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if err := s.repo.CreatePolicy(ctx, p, authorFromContext(ctx)); err != nil {
 		return err
 	}
-	return s.notifyUpdate(ctx)
+	recordAfter(ctx, TargetPolicy, p.ID, p)
+	return s.notifyChange(ctx, upsertEvent(p))
 }
 
-// Update обновляет политику и инициирует инвалидацию кэша
+// Update обновляет политику и инициирует инвалидацию кэша.
+// Break-glass доступ через Update не меняется: иначе его срок можно было бы снять или продлить
+// в обход TTL и причины, которые проверяет GrantBreakGlass.
 func (s *PolicyService) Update(ctx context.Context, p *domain.Policy) error {
-	if err := s.repo.UpdatePolicy(ctx, p); err != nil {
+	if err := p.ValidateTiming(); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if err := validateConditions(p.Conditions); err != nil {
+		return &ValidationError{Err: err}
+	}
+	stored, err := s.repo.GetPolicyByID(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		if stored.BreakGlass {
+			return &ValidationError{Err: domain.ErrBreakGlassImmutable}
+		}
+		recordBefore(ctx, TargetPolicy, p.ID, stored)
+	}
+	if err := s.repo.UpdatePolicy(ctx, p, authorFromContext(ctx)); err != nil {
+		// Строку могли заменить на break-glass между чтением и блокировкой
+		if errors.Is(err, domain.ErrBreakGlassImmutable) {
+			return &ValidationError{Err: err}
+		}
 		return err
 	}
-	return s.notifyUpdate(ctx)
+	recordAfter(ctx, TargetPolicy, p.ID, p)
+	return s.notifyChange(ctx, upsertEvent(p))
+}
+
+// MaxBreakGlassTTL — предельный срок аварийного доступа. Дольше — это уже обычная политика.
+const MaxBreakGlassTTL = 24 * time.Hour
+
+// BreakGlassRequest — запрос временного аварийного доступа.
+type BreakGlassRequest struct {
+	AgentID      string              `json:"agent_id"`
+	CapabilityID string              `json:"capability_id"`
+	Effect       domain.PolicyEffect `json:"effect"` // По умолчанию ALLOW
+	TTL          time.Duration       `json:"-"`
+	Reason       string              `json:"reason"`
+}
+
+// GrantBreakGlass выдает временный доступ: политика с break_glass и valid_until = now + TTL.
+// Она перекрывает постоянные правила пары, истекает в шлюзах сама (без Refresh),
+// а каждое решение по ней помечается в аудите. Причина сохраняется в conditions.reason.
+func (s *PolicyService) GrantBreakGlass(ctx context.Context, req BreakGlassRequest) (*domain.Policy, error) {
+	if req.Effect == "" {
+		req.Effect = domain.EffectAllow
+	}
+	switch {
+	case req.AgentID == "" || req.CapabilityID == "":
+		return nil, &ValidationError{Err: errors.New("agent_id and capability_id are required")}
+	case !req.Effect.Valid():
+		return nil, &ValidationError{Err: fmt.Errorf("unsupported effect %q", req.Effect)}
+	case req.Reason == "":
+		return nil, &ValidationError{Err: errors.New("reason is required for break-glass grant")}
+	case req.TTL <= 0 || req.TTL > MaxBreakGlassTTL:
+		return nil, &ValidationError{Err: fmt.Errorf("ttl must be in (0, %s]", MaxBreakGlassTTL)}
+	}
+
+	conditions, err := json.Marshal(map[string]string{"reason": req.Reason})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	until := now.Add(req.TTL)
+	p := &domain.Policy{
+		AgentID:      req.AgentID,
+		CapabilityID: req.CapabilityID,
+		Effect:       req.Effect,
+		Conditions:   conditions,
+		ValidFrom:    &now,
+		ValidUntil:   &until,
+		BreakGlass:   true,
+	}
+
+	if err := s.repo.CreatePolicy(ctx, p, authorFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	recordAfter(ctx, TargetPolicy, p.ID, p)
+	return p, s.notifyChange(ctx, upsertEvent(p))
 }
 
 // Delete удаляет политику
 func (s *PolicyService) Delete(ctx context.Context, id string) error {
-	if err := s.repo.DeletePolicy(ctx, id); err != nil {
+	s.snapshotPolicy(ctx, id)
+	if err := s.repo.DeletePolicy(ctx, id, authorFromContext(ctx)); err != nil {
 		return err
 	}
-	return s.notifyUpdate(ctx)
+	return s.notifyChange(ctx, deleteEvent(id))
+}
+
+// Versions возвращает историю изменений политики (последняя версия первой)
+func (s *PolicyService) Versions(ctx context.Context, id string) ([]domain.PolicyVersion, error) {
+	return s.repo.ListPolicyVersions(ctx, id)
+}
+
+// Rollback возвращает политику к указанной версии. Откат оформляется новой версией (ROLLBACK).
+func (s *PolicyService) Rollback(ctx context.Context, id string, version int) (*domain.Policy, error) {
+	s.snapshotPolicy(ctx, id)
+	p, err := s.repo.RollbackPolicy(ctx, id, version, authorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	recordAfter(ctx, TargetPolicy, id, p)
+	if p == nil {
+		return nil, s.notifyChange(ctx, deleteEvent(id))
+	}
+	return p, s.notifyChange(ctx, upsertEvent(p))
+}
+
+// RollbackAll приводит весь набор политик к состоянию на момент at.
+func (s *PolicyService) RollbackAll(ctx context.Context, at time.Time) (int, error) {
+	changed, err := s.repo.RollbackPoliciesTo(ctx, at, authorFromContext(ctx))
+	if err == nil {
+		recordAfter(ctx, TargetPolicySet, "", map[string]any{"rollback_to": at, "changed": changed})
+	}
+	if err != nil || changed == 0 {
+		return changed, err
+	}
+	return changed, s.notifyUpdate(ctx)
+}
+
+// ExportBundle выгружает активный набор политик в формате бандла (для хранения в git).
+func (s *PolicyService) ExportBundle(ctx context.Context) (*policy.Bundle, error) {
+	policies, err := s.repo.GetAllPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return policy.NewBundle(policies)
+}
+
+// PlanBundle валидирует бандл и показывает, что изменится при его применении (dry-run).
+func (s *PolicyService) PlanBundle(ctx context.Context, b *policy.Bundle) (*domain.BundlePlan, error) {
+	desired, err := s.validateBundle(b)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.repo.GetAllPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return domain.PlanBundle(current, desired), nil
+}
+
+// ApplyBundle применяет бандл одной транзакцией и отправляет шлюзам ОДИН сигнал обновления.
+func (s *PolicyService) ApplyBundle(ctx context.Context, b *policy.Bundle) (*domain.BundlePlan, error) {
+	desired, err := s.validateBundle(b)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.repo.ApplyPolicyBundle(ctx, desired, authorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	recordAfter(ctx, TargetPolicySet, "", plan)
+	if plan.IsEmpty() {
+		return plan, nil
+	}
+	return plan, s.notifyUpdate(ctx)
+}
+
+// validateBundle проверяет структуру бандла и семантику Conditions (бюджеты, фильтры PII),
+// чтобы ошибка в правилах обнаружилась при plan, а не на живом трафике шлюза.
+func (s *PolicyService) validateBundle(b *policy.Bundle) ([]domain.Policy, error) {
+	if err := b.Validate(); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	desired, err := b.ToPolicies()
+	if err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+
+	var errs []error
+	for i, p := range desired {
+		if err := validateConditions(p.Conditions); err != nil {
+			errs = append(errs, fmt.Errorf("policies[%d]: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Err: errors.Join(errs...)}
+	}
+	return desired, nil
+}
+
+// validateConditions проверяет семантику Conditions (контентный риск, бюджеты, фильтры PII) одинаково
+// для одиночных изменений и бандлов: шлюз не должен получить правило, которое не сможет применить.
+func validateConditions(conditions json.RawMessage) error {
+	var errs []error
+	if _, err := risk.ParseContentRisk(conditions, risk.DefaultDetectors(risk.DetectorConfig{})); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := risk.ParseBudgets(conditions); err != nil {
+		errs = append(errs, err)
+	}
+	filters, err := redact.FromConditions(conditions)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	redactor := redact.NewRedactor(redact.DefaultDetectors()...)
+	for _, rules := range []*redact.Rules{filters.Response, filters.Audit} {
+		if err := redactor.Validate(rules); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidationError — ошибка во входных данных (в HTTP транслируется в 400).
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return "validation failed: " + e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// snapshotPolicy записывает состояние политики до изменения в журнал административных действий.
+func (s *PolicyService) snapshotPolicy(ctx context.Context, id string) {
+	if p, err := s.repo.GetPolicyByID(ctx, id); err == nil && p != nil {
+		recordBefore(ctx, TargetPolicy, id, p)
+	}
 }
 
-// notifyUpdate отправляет широковещательный сигнал в Redis.
-// Все инстансы UAG, подписанные на этот канал, вызовут Refresh() своего MemoEnforcer.
+// authorFromContext извлекает автора изменения из токена консоли (см. auth.NewMiddleware)
+func authorFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value("user_id").(string); ok && id != "" {
+		return id
+	}
+	return "unknown"
+}
+
+// notifyUpdate отправляет сигнал полной перезагрузки — для массовых изменений
+// (бандл, откат набора), где перечитать таблицу дешевле, чем разослать сотни дельт.
 func (s *PolicyService) notifyUpdate(ctx context.Context) error {
-	// Сигнал может быть простым "refresh", так как шлюз сам перечитает всю таблицу
-	return s.rdb.Publish(ctx, infra.RedisChanPolicyUpdate, "refresh").Err()
+	return s.notifyChange(ctx, domain.PolicyChangeEvent{Op: domain.PolicyEventRefresh})
+}
+
+// notifyChange отправляет шлюзам дельту: MemoEnforcer перечитает только одну политику.
+func (s *PolicyService) notifyChange(ctx context.Context, ev domain.PolicyChangeEvent) error {
+	return s.rdb.Publish(ctx, infra.RedisChanPolicyUpdate, ev.Encode()).Err()
+}
+
+func upsertEvent(p *domain.Policy) domain.PolicyChangeEvent {
+	return domain.PolicyChangeEvent{Op: domain.PolicyEventUpsert, PolicyID: p.ID, Version: p.Version}
+}
+
+// deleteEvent без версии: удаленная строка не возвращает номер версии-удаления,
+// а гонку с повторным созданием закрывает сверка контрольной суммы в шлюзе.
+func deleteEvent(id string) domain.PolicyChangeEvent {
+	return domain.PolicyChangeEvent{Op: domain.PolicyEventDelete, PolicyID: id}
 }
@@ -0,0 +1,438 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+)
+
+// memPolicyRepo — PolicyRepository в памяти; неиспользуемые методы паникуют через встроенный nil-интерфейс.
+type memPolicyRepo struct {
+	PolicyRepository
+	policies map[string]domain.Policy
+	versions map[string][]domain.PolicyVersion // История для откатов (заполняется тестом)
+	seq      int
+}
+
+func newMemPolicyRepo(policies ...domain.Policy) *memPolicyRepo {
+	r := &memPolicyRepo{policies: make(map[string]domain.Policy)}
+	for _, p := range policies {
+		r.policies[p.ID] = p
+	}
+	return r
+}
+
+func (r *memPolicyRepo) GetPolicyByID(_ context.Context, id string) (*domain.Policy, error) {
+	p, ok := r.policies[id]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (r *memPolicyRepo) CreatePolicy(_ context.Context, p *domain.Policy, _ string) error {
+	r.seq++
+	p.ID, p.Version = fmt.Sprintf("p%d", r.seq), 1
+	r.policies[p.ID] = *p
+	return nil
+}
+
+// UpdatePolicy повторяет проверку postgres.UpdatePolicy под блокировкой строки.
+func (r *memPolicyRepo) UpdatePolicy(_ context.Context, p *domain.Policy, _ string) error {
+	current, ok := r.policies[p.ID]
+	if !ok {
+		return errors.New("policy not found")
+	}
+	if current.BreakGlass {
+		return domain.ErrBreakGlassImmutable
+	}
+	current.Effect, current.Conditions = p.Effect, p.Conditions
+	current.ValidFrom, current.ValidUntil, current.Schedule = p.ValidFrom, p.ValidUntil, p.Schedule
+	current.Version++
+	r.policies[p.ID] = current
+	*p = current
+	return nil
+}
+
+// RollbackPolicy повторяет postgres.RollbackPolicy: откат — новая версия с состоянием целевой.
+func (r *memPolicyRepo) RollbackPolicy(_ context.Context, id string, version int, _ string) (*domain.Policy, error) {
+	history := r.versions[id]
+	for _, v := range history {
+		if v.Version != version {
+			continue
+		}
+		if v.Deleted {
+			delete(r.policies, id)
+			return nil, nil
+		}
+		p := v.Policy()
+		p.Version = history[len(history)-1].Version + 1
+		r.policies[id] = p
+		return &p, nil
+	}
+	return nil, domain.ErrPolicyVersionNotFound
+}
+
+// RollbackPoliciesTo повторяет postgres.RollbackPoliciesTo: снимок на момент at — последняя
+// версия каждой политики не позже at; меняются только политики, отличающиеся от снимка.
+func (r *memPolicyRepo) RollbackPoliciesTo(_ context.Context, at time.Time, _ string) (int, error) {
+	desired := make(map[string]*domain.Policy)
+	for id, versions := range r.versions {
+		for _, v := range versions {
+			if v.CreatedAt.After(at) {
+				break
+			}
+			desired[id] = nil
+			if !v.Deleted {
+				p := v.Policy()
+				desired[id] = &p
+			}
+		}
+	}
+	changed := 0
+	for id := range r.policies {
+		if _, ok := desired[id]; !ok {
+			desired[id] = nil // Создана после at
+		}
+	}
+	for id, want := range desired {
+		cur, ok := r.policies[id]
+		switch {
+		case !ok && want == nil:
+			continue
+		case ok && want != nil && len(domain.DiffPolicies(&cur, want)) == 0:
+			continue
+		case want == nil:
+			delete(r.policies, id)
+		default:
+			r.policies[id] = *want
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+func testPolicyService(t *testing.T, repo PolicyRepository) *PolicyService {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewPolicyService(repo, rdb)
+}
+
+func TestPolicyUpdateBreakGlass(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+	later := now.Add(30 * 24 * time.Hour)
+	grant := domain.Policy{
+		ID: "bg", AgentID: "agent-1", CapabilityID: "bank.transfer", Effect: domain.EffectAllow,
+		ValidFrom: &now, ValidUntil: &until, BreakGlass: true,
+	}
+	regular := domain.Policy{ID: "reg", AgentID: "agent-1", CapabilityID: "bank.balance", Effect: domain.EffectAllow}
+
+	tests := []struct {
+		name    string
+		update  domain.Policy
+		wantErr bool
+	}{
+		{name: "clear valid_until", update: domain.Policy{ID: "bg", Effect: domain.EffectAllow, ValidFrom: &now}, wantErr: true},
+		{name: "extend valid_until", update: domain.Policy{ID: "bg", Effect: domain.EffectAllow, ValidFrom: &now, ValidUntil: &later}, wantErr: true},
+		{name: "change effect", update: domain.Policy{ID: "bg", Effect: domain.EffectDeny, ValidFrom: &now, ValidUntil: &until}, wantErr: true},
+		{name: "regular policy", update: domain.Policy{ID: "reg", Effect: domain.EffectDeny}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemPolicyRepo(grant, regular)
+			svc := testPolicyService(t, repo)
+
+			update := tt.update
+			err := svc.Update(context.Background(), &update)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Update() error = %v", err)
+				}
+				if got := repo.policies[tt.update.ID].Effect; got != tt.update.Effect {
+					t.Errorf("stored effect = %s, want %s", got, tt.update.Effect)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, domain.ErrBreakGlassImmutable) {
+				t.Fatalf("Update() error = %v, want ValidationError(ErrBreakGlassImmutable)", err)
+			}
+			stored := repo.policies["bg"]
+			if stored.ValidUntil == nil || !stored.ValidUntil.Equal(until) || stored.Effect != domain.EffectAllow {
+				t.Errorf("break-glass grant changed: %+v", stored)
+			}
+		})
+	}
+}
+
+// Строка стала break-glass между чтением в сервисе и блокировкой в хранилище.
+func TestPolicyUpdateBreakGlassRace(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	repo := &racingPolicyRepo{memPolicyRepo: newMemPolicyRepo(domain.Policy{ID: "p", Effect: domain.EffectAllow})}
+	repo.swap = domain.Policy{ID: "p", Effect: domain.EffectAllow, ValidUntil: &until, BreakGlass: true}
+	svc := testPolicyService(t, repo)
+
+	err := svc.Update(context.Background(), &domain.Policy{ID: "p", Effect: domain.EffectAllow})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, domain.ErrBreakGlassImmutable) {
+		t.Fatalf("Update() error = %v, want ValidationError(ErrBreakGlassImmutable)", err)
+	}
+}
+
+type racingPolicyRepo struct {
+	*memPolicyRepo
+	swap domain.Policy
+}
+
+func (r *racingPolicyRepo) GetPolicyByID(ctx context.Context, id string) (*domain.Policy, error) {
+	p, err := r.memPolicyRepo.GetPolicyByID(ctx, id)
+	r.policies[id] = r.swap
+	return p, err
+}
+
+func TestGrantBreakGlass(t *testing.T) {
+	valid := BreakGlassRequest{AgentID: "agent-1", CapabilityID: "bank.transfer", TTL: time.Hour, Reason: "INC-42"}
+	with := func(f func(*BreakGlassRequest)) BreakGlassRequest {
+		req := valid
+		f(&req)
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		req        BreakGlassRequest
+		wantErr    bool
+		wantEffect domain.PolicyEffect
+	}{
+		{name: "default effect", req: valid, wantEffect: domain.EffectAllow},
+		{name: "quarantine", req: with(func(r *BreakGlassRequest) { r.Effect = domain.EffectQuarantine }), wantEffect: domain.EffectQuarantine},
+		{name: "unknown effect", req: with(func(r *BreakGlassRequest) { r.Effect = "ALLOW_ALL" }), wantErr: true},
+		{name: "lowercase effect", req: with(func(r *BreakGlassRequest) { r.Effect = "allow" }), wantErr: true},
+		{name: "no reason", req: with(func(r *BreakGlassRequest) { r.Reason = "" }), wantErr: true},
+		{name: "no agent", req: with(func(r *BreakGlassRequest) { r.AgentID = "" }), wantErr: true},
+		{name: "ttl too long", req: with(func(r *BreakGlassRequest) { r.TTL = MaxBreakGlassTTL + time.Second }), wantErr: true},
+		{name: "zero ttl", req: with(func(r *BreakGlassRequest) { r.TTL = 0 }), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemPolicyRepo()
+			svc := testPolicyService(t, repo)
+
+			p, err := svc.GrantBreakGlass(context.Background(), tt.req)
+			if tt.wantErr {
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("GrantBreakGlass() error = %v, want ValidationError", err)
+				}
+				if len(repo.policies) != 0 {
+					t.Errorf("grant stored despite error: %+v", repo.policies)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GrantBreakGlass() error = %v", err)
+			}
+			if p.Effect != tt.wantEffect || !p.BreakGlass || p.ValidUntil == nil {
+				t.Errorf("grant = %+v", p)
+			}
+		})
+	}
+}
+
+func TestPolicyConditionsValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		wantErr    bool
+	}{
+		{name: "no conditions"},
+		{name: "valid filters", conditions: `{"response_filter":{"mask":["email"]},"audit_filter":{"drop_fields":["ssn"]}}`},
+		{name: "malformed filter", conditions: `{"response_filter":"ssn"}`, wantErr: true},
+		{name: "unknown detector", conditions: `{"audit_filter":{"mask":["passport"]}}`, wantErr: true},
+		{name: "valid content risk", conditions: `{"content_risk":{"detectors":["secrets","injection"],"deny_score":80}}`},
+		{name: "malformed content risk", conditions: `{"content_risk":{"deny_score":"high"}}`, wantErr: true},
+		{name: "unknown risk detector", conditions: `{"content_risk":{"detectors":["secret"]}}`, wantErr: true},
+		{name: "risk threshold out of range", conditions: `{"content_risk":{"hitl_score":150}}`, wantErr: true},
+		{name: "invalid budget", conditions: `{"budgets":[{"name":"calls","agg":"count","window":"forever","limit":10}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		for _, op := range []string{"create", "update"} {
+			t.Run(tt.name+"/"+op, func(t *testing.T) {
+				repo := newMemPolicyRepo(domain.Policy{ID: "reg", AgentID: "agent-1", CapabilityID: "crm.read", Effect: domain.EffectAllow})
+				svc := testPolicyService(t, repo)
+
+				p := domain.Policy{AgentID: "agent-1", CapabilityID: "crm.read", Effect: domain.EffectAllow}
+				if tt.conditions != "" {
+					p.Conditions = json.RawMessage(tt.conditions)
+				}
+				var err error
+				if op == "create" {
+					err = svc.Create(context.Background(), &p)
+				} else {
+					p.ID = "reg"
+					err = svc.Update(context.Background(), &p)
+				}
+
+				if !tt.wantErr {
+					if err != nil {
+						t.Fatalf("%s error = %v", op, err)
+					}
+					return
+				}
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("%s error = %v, want ValidationError", op, err)
+				}
+				if stored := repo.policies["reg"]; len(stored.Conditions) != 0 || len(repo.policies) != 1 {
+					t.Errorf("invalid policy stored: %+v", repo.policies)
+				}
+			})
+		}
+	}
+}
+
+// policyEvents подписывается на канал policy-update того же Redis, что и сервис.
+func policyEvents(t *testing.T, mr *miniredis.Miniredis) func() []domain.PolicyChangeEvent {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sub := rdb.Subscribe(context.Background(), infra.RedisChanPolicyUpdate)
+	if _, err := sub.Receive(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close(); rdb.Close() })
+
+	return func() []domain.PolicyChangeEvent {
+		var events []domain.PolicyChangeEvent
+		for {
+			msg, err := sub.ReceiveTimeout(context.Background(), 50*time.Millisecond)
+			if err != nil {
+				return events
+			}
+			if m, ok := msg.(*redis.Message); ok {
+				events = append(events, domain.ParsePolicyChangeEvent(m.Payload))
+			}
+		}
+	}
+}
+
+func TestPolicyRollback(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	version := func(id string, v int, effect domain.PolicyEffect, at time.Time, deleted bool) domain.PolicyVersion {
+		return domain.PolicyVersion{PolicyID: id, Version: v, AgentID: "agent-1", CapabilityID: "cap." + id,
+			Effect: effect, Deleted: deleted, CreatedAt: at}
+	}
+	history := map[string][]domain.PolicyVersion{
+		"p1": {
+			version("p1", 1, domain.EffectAllow, t0, false),
+			version("p1", 2, domain.EffectDeny, t0.Add(time.Hour), false),
+		},
+		"p2": {
+			version("p2", 1, domain.EffectSandbox, t0, false),
+			version("p2", 2, domain.EffectSandbox, t0.Add(time.Hour), true),
+		},
+		"p3": {version("p3", 1, domain.EffectAllow, t0.Add(2*time.Hour), false)},
+	}
+	newRepo := func() *memPolicyRepo {
+		repo := newMemPolicyRepo(history["p1"][1].Policy(), history["p3"][0].Policy())
+		repo.versions = history
+		return repo
+	}
+	newService := func(t *testing.T, repo *memPolicyRepo) (*PolicyService, func() []domain.PolicyChangeEvent) {
+		mr := miniredis.RunT(t)
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { rdb.Close() })
+		return NewPolicyService(repo, rdb), policyEvents(t, mr)
+	}
+
+	t.Run("one policy", func(t *testing.T) {
+		repo := newRepo()
+		svc, events := newService(t, repo)
+
+		p, err := svc.Rollback(context.Background(), "p1", 1)
+		if err != nil {
+			t.Fatalf("Rollback() error = %v", err)
+		}
+		// Откат не переписывает историю: версия растет, состояние — как у версии 1
+		if p.Effect != domain.EffectAllow || p.Version != 3 {
+			t.Errorf("rolled back policy = %s v%d, want ALLOW v3", p.Effect, p.Version)
+		}
+		want := []domain.PolicyChangeEvent{{Op: domain.PolicyEventUpsert, PolicyID: "p1", Version: 3}}
+		if got := events(); !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("to deleted version", func(t *testing.T) {
+		repo := newRepo()
+		repo.policies["p2"] = history["p2"][0].Policy()
+		svc, events := newService(t, repo)
+
+		p, err := svc.Rollback(context.Background(), "p2", 2)
+		if err != nil || p != nil {
+			t.Fatalf("Rollback() = %+v, %v; want nil policy", p, err)
+		}
+		if _, ok := repo.policies["p2"]; ok {
+			t.Error("policy still exists after rollback to deleted version")
+		}
+		want := []domain.PolicyChangeEvent{{Op: domain.PolicyEventDelete, PolicyID: "p2"}}
+		if got := events(); !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		svc, events := newService(t, newRepo())
+		if _, err := svc.Rollback(context.Background(), "p1", 9); !errors.Is(err, domain.ErrPolicyVersionNotFound) {
+			t.Errorf("Rollback() error = %v, want ErrPolicyVersionNotFound", err)
+		}
+		if got := events(); len(got) != 0 {
+			t.Errorf("events after failed rollback = %+v", got)
+		}
+	})
+
+	t.Run("whole set", func(t *testing.T) {
+		repo := newRepo()
+		svc, events := newService(t, repo)
+
+		// На t0+30m: p1 — ALLOW, p2 — существует, p3 — еще не создана
+		changed, err := svc.RollbackAll(context.Background(), t0.Add(30*time.Minute))
+		if err != nil || changed != 3 {
+			t.Fatalf("RollbackAll() = %d, %v; want 3 changed", changed, err)
+		}
+		if repo.policies["p1"].Effect != domain.EffectAllow {
+			t.Errorf("p1 effect = %s, want ALLOW", repo.policies["p1"].Effect)
+		}
+		if _, ok := repo.policies["p2"]; !ok {
+			t.Error("p2 deleted after at was not restored")
+		}
+		if _, ok := repo.policies["p3"]; ok {
+			t.Error("p3 created after at was not removed")
+		}
+		// Массовое изменение — один сигнал полной перезагрузки
+		want := []domain.PolicyChangeEvent{{Op: domain.PolicyEventRefresh}}
+		if got := events(); !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %+v, want %+v", got, want)
+		}
+
+		// Повторный откат к тому же моменту ничего не меняет и шлюзы не дергает
+		if changed, err := svc.RollbackAll(context.Background(), t0.Add(30*time.Minute)); err != nil || changed != 0 {
+			t.Errorf("repeated RollbackAll() = %d, %v; want 0", changed, err)
+		}
+		if got := events(); len(got) != 0 {
+			t.Errorf("events after no-op rollback = %+v", got)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+)
+
+// ShadowRepository описывает требования к хранилищу теневых политик и расхождений.
+type ShadowRepository interface {
+	GetAllShadowPolicies(ctx context.Context) ([]domain.Policy, error)
+	GetShadowPolicyByID(ctx context.Context, id string) (*domain.Policy, error)
+	CreateShadowPolicy(ctx context.Context, p *domain.Policy) error
+	UpdateShadowPolicy(ctx context.Context, p *domain.Policy) error
+	DeleteShadowPolicy(ctx context.Context, id string) error
+	GetShadowSummary(ctx context.Context, since time.Time) ([]domain.ShadowSummary, error)
+	ListShadowDivergences(ctx context.Context, shadowPolicyID string, limit int) ([]domain.ShadowDivergence, error)
+}
+
+// ErrShadowPolicyNotFound — теневой политики с таким id нет.
+var ErrShadowPolicyNotFound = errors.New("shadow policy not found")
+
+// ShadowService управляет кандидатным набором политик (Shadow Mode).
+// Изменения теневого набора рассылаются по тому же каналу, что и активные политики:
+// MemoEnforcer перечитывает оба набора за один Refresh.
+type ShadowService struct {
+	repo ShadowRepository
+	rdb  *redis.Client
+}
+
+func NewShadowService(repo ShadowRepository, rdb *redis.Client) *ShadowService {
+	return &ShadowService{repo: repo, rdb: rdb}
+}
+
+func (s *ShadowService) GetAll(ctx context.Context) ([]domain.Policy, error) {
+	return s.repo.GetAllShadowPolicies(ctx)
+}
+
+func (s *ShadowService) GetByID(ctx context.Context, id string) (*domain.Policy, error) {
+	return s.repo.GetShadowPolicyByID(ctx, id)
+}
+
+func (s *ShadowService) Create(ctx context.Context, p *domain.Policy) error {
+	if err := validateShadowPolicy(p); err != nil {
+		return err
+	}
+	if err := s.repo.CreateShadowPolicy(ctx, p); err != nil {
+		return err
+	}
+	recordAfter(ctx, TargetShadowPolicy, p.ID, p)
+	return s.notifyUpdate(ctx)
+}
+
+// Update меняет эффект и условия. Агент и способность задают место политики в наборе
+// и не меняются: для другой пары создается новая теневая политика.
+func (s *ShadowService) Update(ctx context.Context, p *domain.Policy) error {
+	stored, err := s.repo.GetShadowPolicyByID(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrShadowPolicyNotFound
+	}
+	if (p.AgentID != "" && p.AgentID != stored.AgentID) || (p.CapabilityID != "" && p.CapabilityID != stored.CapabilityID) {
+		return &ValidationError{Err: errors.New("agent_id and capability_id of a shadow policy cannot be changed")}
+	}
+	p.AgentID, p.CapabilityID = stored.AgentID, stored.CapabilityID
+	if err := validateShadowPolicy(p); err != nil {
+		return err
+	}
+
+	recordBefore(ctx, TargetShadowPolicy, p.ID, stored)
+	if err := s.repo.UpdateShadowPolicy(ctx, p); err != nil {
+		return err
+	}
+	recordAfter(ctx, TargetShadowPolicy, p.ID, p)
+	return s.notifyUpdate(ctx)
+}
+
+func (s *ShadowService) Delete(ctx context.Context, id string) error {
+	s.snapshot(ctx, id)
+	if err := s.repo.DeleteShadowPolicy(ctx, id); err != nil {
+		return err
+	}
+	return s.notifyUpdate(ctx)
+}
+
+// Summary агрегирует расхождения за окно (например, последние 24 часа).
+func (s *ShadowService) Summary(ctx context.Context, window time.Duration) ([]domain.ShadowSummary, error) {
+	summary, err := s.repo.GetShadowSummary(ctx, time.Now().Add(-window))
+	if err != nil {
+		return nil, fmt.Errorf("shadow_service: failed to build summary: %w", err)
+	}
+	return summary, nil
+}
+
+// Divergences возвращает последние расхождения для детального разбора.
+func (s *ShadowService) Divergences(ctx context.Context, shadowPolicyID string, limit int) ([]domain.ShadowDivergence, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	return s.repo.ListShadowDivergences(ctx, shadowPolicyID, limit)
+}
+
+// snapshot записывает состояние теневой политики до изменения в журнал административных действий.
+func (s *ShadowService) snapshot(ctx context.Context, id string) {
+	if p, err := s.repo.GetShadowPolicyByID(ctx, id); err == nil && p != nil {
+		recordBefore(ctx, TargetShadowPolicy, id, p)
+	}
+}
+
+// notifyUpdate: теневой набор небольшой и дельтами не синхронизируется — шлюз перечитывает его целиком
+func (s *ShadowService) notifyUpdate(ctx context.Context) error {
+	ev := domain.PolicyChangeEvent{Op: domain.PolicyEventRefresh}
+	return s.rdb.Publish(ctx, infra.RedisChanPolicyUpdate, ev.Encode()).Err()
+}
+
+// validateShadowPolicy — общая проверка для Create и Update.
+func validateShadowPolicy(p *domain.Policy) error {
+	if p.AgentID == "" || p.CapabilityID == "" {
+		return &ValidationError{Err: errors.New("agent_id and capability_id are required")}
+	}
+	if !p.Effect.Valid() {
+		return &ValidationError{Err: fmt.Errorf("unsupported effect %q", p.Effect)}
+	}
+	if err := validateConditions(p.Conditions); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
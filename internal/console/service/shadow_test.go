@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// memShadowRepo — ShadowRepository в памяти; неиспользуемые методы паникуют через встроенный nil-интерфейс.
+type memShadowRepo struct {
+	ShadowRepository
+	policies map[string]domain.Policy
+	seq      int
+}
+
+func (r *memShadowRepo) GetShadowPolicyByID(_ context.Context, id string) (*domain.Policy, error) {
+	p, ok := r.policies[id]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (r *memShadowRepo) CreateShadowPolicy(_ context.Context, p *domain.Policy) error {
+	r.seq++
+	p.ID = fmt.Sprintf("s%d", r.seq)
+	r.policies[p.ID] = *p
+	return nil
+}
+
+func (r *memShadowRepo) UpdateShadowPolicy(_ context.Context, p *domain.Policy) error {
+	current, ok := r.policies[p.ID]
+	if !ok {
+		return errors.New("shadow policy not found")
+	}
+	current.Effect, current.Conditions = p.Effect, p.Conditions
+	r.policies[p.ID] = current
+	return nil
+}
+
+func testShadowService(t *testing.T, repo ShadowRepository) *ShadowService {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewShadowService(repo, rdb)
+}
+
+func TestShadowPolicyValidation(t *testing.T) {
+	stored := domain.Policy{ID: "s0", AgentID: "agent-1", CapabilityID: "crm.read", Effect: domain.EffectAllow}
+
+	tests := []struct {
+		name      string
+		policy    domain.Policy // Для update ID подставляется тестом
+		wantErr   bool
+		updateErr bool // Ошибка только при update (поля, которые нельзя менять)
+	}{
+		{name: "valid", policy: domain.Policy{AgentID: "agent-1", CapabilityID: "crm.read", Effect: domain.EffectDeny}},
+		{name: "unknown effect", policy: domain.Policy{AgentID: "agent-1", CapabilityID: "crm.read", Effect: "BLOCK"}, wantErr: true},
+		{name: "empty effect", policy: domain.Policy{AgentID: "agent-1", CapabilityID: "crm.read"}, wantErr: true},
+		{
+			name:    "malformed conditions",
+			policy:  domain.Policy{AgentID: "agent-1", CapabilityID: "crm.read", Effect: domain.EffectAllow, Conditions: json.RawMessage(`{"audit_filter":"ssn"}`)},
+			wantErr: true,
+		},
+		{name: "another capability", policy: domain.Policy{AgentID: "agent-1", CapabilityID: "crm.write", Effect: domain.EffectDeny}, updateErr: true},
+	}
+	for _, tt := range tests {
+		for _, op := range []string{"create", "update"} {
+			t.Run(tt.name+"/"+op, func(t *testing.T) {
+				repo := &memShadowRepo{policies: make(map[string]domain.Policy)}
+				p := tt.policy
+				var err error
+				if op == "create" {
+					err = testShadowService(t, repo).Create(context.Background(), &p)
+				} else {
+					repo.policies[stored.ID] = stored
+					p.ID = stored.ID
+					err = testShadowService(t, repo).Update(context.Background(), &p)
+				}
+
+				wantErr := tt.wantErr || (op == "update" && tt.updateErr)
+				if !wantErr {
+					if err != nil {
+						t.Fatalf("%s error = %v", op, err)
+					}
+					return
+				}
+				var verr *ValidationError
+				if !errors.As(err, &verr) {
+					t.Fatalf("%s error = %v, want ValidationError", op, err)
+				}
+				if op == "update" && repo.policies[stored.ID].Effect != stored.Effect {
+					t.Errorf("invalid update stored: %+v", repo.policies[stored.ID])
+				}
+			})
+		}
+	}
+}
+
+func TestShadowPolicyUpdate(t *testing.T) {
+	repo := &memShadowRepo{policies: map[string]domain.Policy{
+		"s0": {ID: "s0", AgentID: "agent-1", CapabilityID: "crm.read", Effect: domain.EffectAllow},
+	}}
+	svc := testShadowService(t, repo)
+
+	// PUT без agent_id и capability_id: пара берется из сохраненной политики
+	if err := svc.Update(context.Background(), &domain.Policy{ID: "s0", Effect: domain.EffectDeny}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := repo.policies["s0"]; got.Effect != domain.EffectDeny || got.AgentID != "agent-1" {
+		t.Errorf("stored = %+v", got)
+	}
+
+	err := svc.Update(context.Background(), &domain.Policy{ID: "missing", Effect: domain.EffectDeny})
+	if !errors.Is(err, ErrShadowPolicyNotFound) {
+		t.Errorf("Update(missing) error = %v, want ErrShadowPolicyNotFound", err)
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+/*
+Файл user.go реализует управление пользователями консоли: создание, роли, отключение,
+смену и сброс пароля, а также создание первого администратора (bootstrap).
+
+Пароли хешируются bcrypt с auth.bcrypt_cost. Любое изменение, сужающее доступ
+(смена роли, отключение, новый пароль), отзывает уже выданные токены пользователя.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserRepository описывает требования сервиса к хранилищу пользователей
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id string) (*domain.User, error)
+	ListUsers(ctx context.Context) ([]*domain.User, error)
+	CreateUser(ctx context.Context, u *domain.User) error
+	UpdateUser(ctx context.Context, u *domain.User) error
+	SetUserPassword(ctx context.Context, id, passwordHash string) error
+	CountActiveAdmins(ctx context.Context) (int, error)
+}
+
+// ErrAdminExists — bootstrap не нужен: действующий администратор уже есть.
+var ErrAdminExists = errors.New("an active admin already exists")
+
+type UserService struct {
+	repo        UserRepository
+	revocations *auth.RevocationList
+	roles       domain.RolePermissions
+	bcryptCost  int
+	logger      *zap.Logger
+}
+
+func NewUserService(repo UserRepository, revocations *auth.RevocationList, roles domain.RolePermissions, bcryptCost int, logger *zap.Logger) *UserService {
+	if bcryptCost == 0 {
+		bcryptCost = bcrypt.DefaultCost
+	}
+	return &UserService{
+		repo:        repo,
+		revocations: revocations,
+		roles:       roles,
+		bcryptCost:  bcryptCost,
+		logger:      logger.Named("user-service"),
+	}
+}
+
+// List возвращает всех пользователей консоли.
+func (s *UserService) List(ctx context.Context) ([]*domain.User, error) {
+	return s.repo.ListUsers(ctx)
+}
+
+// Get возвращает пользователя по ID.
+func (s *UserService) Get(ctx context.Context, id string) (*domain.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return s.repo.GetUserByID(ctx, id)
+}
+
+// Create создает пользователя с заданным паролем.
+func (s *UserService) Create(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+	return s.create(ctx, req, authorFromContext(ctx))
+}
+
+// Bootstrap создает первого администратора. Работает, только пока в консоли нет
+// ни одного действующего администратора, поэтому повторный запуск безопасен.
+func (s *UserService) Bootstrap(ctx context.Context, username, email, password string) (*domain.User, error) {
+	n, err := s.repo.CountActiveAdmins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrAdminExists
+	}
+	return s.create(ctx, domain.CreateUserRequest{
+		Username: username,
+		Email:    email,
+		Password: password,
+		Role:     domain.RoleAdmin,
+	}, "bootstrap")
+}
+
+func (s *UserService) create(ctx context.Context, req domain.CreateUserRequest, author string) (*domain.User, error) {
+	req.Normalize()
+	if err := req.Validate(s.roles); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), s.bcryptCost)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &domain.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: string(hash),
+		Role:         req.Role,
+		Scopes:       scopeSet(req.Scopes),
+		CreatedBy:    author,
+	}
+	if err := s.repo.CreateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	recordAfter(ctx, TargetUser, u.ID, u)
+	s.logger.Info("user created", zap.String("user_id", u.ID), zap.String("username", u.Username),
+		zap.String("role", u.Role), zap.String("by", author))
+	return u, nil
+}
+
+// Update меняет email, роль, персональные scopes или отключает пользователя.
+// При сужении доступа выданные токены отзываются, чтобы изменение подействовало сразу.
+func (s *UserService) Update(ctx context.Context, id string, patch domain.UserPatch) (*domain.User, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	recordBefore(ctx, TargetUser, id, u)
+
+	revoke := false
+	if patch.Email != nil {
+		email := strings.TrimSpace(*patch.Email)
+		if _, err := mail.ParseAddress(email); err != nil || len(email) > 255 {
+			return nil, &ValidationError{Err: errors.New("email is invalid")}
+		}
+		u.Email = email
+	}
+	if patch.Role != nil {
+		role := strings.ToLower(strings.TrimSpace(*patch.Role))
+		if _, ok := s.roles[role]; !ok {
+			return nil, &ValidationError{Err: fmt.Errorf("unknown role %q", role)}
+		}
+		revoke = revoke || role != u.Role
+		u.Role = role
+	}
+	if patch.Scopes != nil {
+		u.Scopes = scopeSet(*patch.Scopes)
+		revoke = true
+	}
+	if patch.Disabled != nil {
+		switch {
+		case *patch.Disabled && u.DisabledAt == nil:
+			now := time.Now()
+			u.DisabledAt = &now
+			revoke = true
+		case !*patch.Disabled:
+			u.DisabledAt = nil
+		}
+	}
+
+	if err := s.repo.UpdateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	recordAfter(ctx, TargetUser, id, u)
+	s.logger.Info("user updated", zap.String("user_id", u.ID), zap.String("role", u.Role),
+		zap.Bool("disabled", u.DisabledAt != nil), zap.String("by", authorFromContext(ctx)))
+
+	if revoke {
+		if err := s.revocations.RevokeSubject(ctx, u.ID); err != nil {
+			return nil, fmt.Errorf("user updated, but token revocation failed: %w", err)
+		}
+	}
+	return u, nil
+}
+
+// ChangePassword меняет пароль текущего пользователя. Требует текущий пароль;
+// после смены все сессии пользователя (включая текущую) завершаются.
+func (s *UserService) ChangePassword(ctx context.Context, current, next string) error {
+	u, err := s.Get(ctx, authorFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if u.IsExternal() {
+		return &ValidationError{Err: domain.ErrExternalPassword}
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(current)); err != nil {
+		return domain.ErrInvalidCredentials
+	}
+	if current == next {
+		return &ValidationError{Err: errors.New("new password must differ from the current one")}
+	}
+	if err := s.setPassword(ctx, u.ID, next); err != nil {
+		return err
+	}
+	recordAfter(ctx, TargetUser, u.ID, map[string]bool{"password_changed": true}) // Сам пароль в журнал не попадает
+	return nil
+}
+
+// ResetPassword задает пароль пользователю от имени администратора и снимает блокировку входа.
+// Пустой password — сгенерировать временный; он возвращается один раз.
+func (s *UserService) ResetPassword(ctx context.Context, id, password string) (string, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if u.IsExternal() {
+		return "", &ValidationError{Err: domain.ErrExternalPassword}
+	}
+	generated := ""
+	if password == "" {
+		p, err := NewTemporaryPassword()
+		if err != nil {
+			return "", err
+		}
+		password, generated = p, p
+	}
+	if err := s.setPassword(ctx, id, password); err != nil {
+		return "", err
+	}
+	recordAfter(ctx, TargetUser, id, map[string]bool{"password_reset": true, "generated": generated != ""})
+	s.logger.Info("user password reset", zap.String("user_id", id), zap.String("by", authorFromContext(ctx)))
+	return generated, nil
+}
+
+func (s *UserService) setPassword(ctx context.Context, id, password string) error {
+	if err := domain.ValidatePassword(password); err != nil {
+		return &ValidationError{Err: err}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetUserPassword(ctx, id, string(hash)); err != nil {
+		return err
+	}
+	if err := s.revocations.RevokeSubject(ctx, id); err != nil {
+		return fmt.Errorf("password changed, but token revocation failed: %w", err)
+	}
+	return nil
+}
+
+// NewTemporaryPassword генерирует случайный пароль (144 бита) для сброса и bootstrap.
+func NewTemporaryPassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func scopeSet(list []string) map[string]bool {
+	scopes := make(map[string]bool, len(list))
+	for _, sc := range list {
+		if sc = strings.TrimSpace(sc); sc != "" {
+			scopes[sc] = true
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memUserRepo повторяет семантику postgres.AgentRepo для пользователей: счетчик неудачных
+// входов обнуляется при блокировке, а новый пароль снимает блокировку.
+type memUserRepo struct {
+	AuthProvider // Client Credentials в этих тестах не используются
+	users        map[string]*domain.User
+}
+
+func newMemUserRepo(users ...*domain.User) *memUserRepo {
+	r := &memUserRepo{users: make(map[string]*domain.User)}
+	for _, u := range users {
+		r.users[u.ID] = u
+	}
+	return r
+}
+
+func (r *memUserRepo) GetUserByUsername(_ context.Context, username string) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.Username == username {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memUserRepo) GetUserByID(_ context.Context, id string) (*domain.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	c := *u
+	return &c, nil
+}
+
+func (r *memUserRepo) ListUsers(context.Context) ([]*domain.User, error) { return nil, nil }
+func (r *memUserRepo) CreateUser(context.Context, *domain.User) error    { return nil }
+func (r *memUserRepo) UpdateUser(context.Context, *domain.User) error    { return nil }
+func (r *memUserRepo) CountActiveAdmins(context.Context) (int, error)    { return 1, nil }
+
+func (r *memUserRepo) SetUserPassword(_ context.Context, id, hash string) error {
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	now := time.Now()
+	u.PasswordHash, u.PasswordChangedAt = hash, &now
+	u.FailedLoginAttempts, u.LockedUntil = 0, nil
+	return nil
+}
+
+func (r *memUserRepo) RecordLoginFailure(_ context.Context, id string, maxAttempts int, lockFor time.Duration) (*time.Time, error) {
+	u := r.users[id]
+	u.FailedLoginAttempts++
+	if u.FailedLoginAttempts >= maxAttempts {
+		until := time.Now().Add(lockFor)
+		u.FailedLoginAttempts, u.LockedUntil = 0, &until
+	}
+	return u.LockedUntil, nil
+}
+
+func (r *memUserRepo) RecordLoginSuccess(_ context.Context, id string) error {
+	u := r.users[id]
+	now := time.Now()
+	u.LastLogin, u.FailedLoginAttempts, u.LockedUntil = &now, 0, nil
+	return nil
+}
+
+const testPassword = "correct horse battery"
+
+func testUser(t *testing.T, username string) *domain.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &domain.User{ID: uuid.NewString(), Username: username, PasswordHash: string(hash),
+		Role: domain.RoleOperator, AuthProvider: domain.AuthProviderLocal}
+}
+
+type userTestEnv struct {
+	repo  *memUserRepo
+	auth  *AuthService
+	users *UserService
+	mr    *miniredis.Miniredis
+}
+
+func newUserTestEnv(t *testing.T, users ...*domain.User) *userTestEnv {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	revocations := auth.NewRevocationList(rdb, time.Hour, false)
+
+	repo := newMemUserRepo(users...)
+	cfg := infra.AuthConfig{
+		BcryptCost: bcrypt.MinCost,
+		TokenTTL:   time.Hour,
+		Lockout:    infra.LockoutConfig{MaxAttempts: 3, Duration: 15 * time.Minute},
+	}
+	return &userTestEnv{
+		repo:  repo,
+		auth:  NewAuthService(repo, key, auth.NewKeySet(&key.PublicKey), revocations, cfg),
+		users: NewUserService(repo, revocations, domain.NewRolePermissions(nil), bcrypt.MinCost, zap.NewNop()),
+		mr:    mr,
+	}
+}
+
+func (e *userTestEnv) login(username, password string) error {
+	_, err := e.auth.GenerateToken(context.Background(), username, password)
+	return err
+}
+
+func TestLoginLockout(t *testing.T) {
+	u := testUser(t, "alice")
+	env := newUserTestEnv(t, u)
+	ok, wrong := testPassword, "wrong password!!"
+
+	steps := []struct {
+		password string
+		wantErr  error
+	}{
+		{wrong, domain.ErrInvalidCredentials},
+		{wrong, domain.ErrInvalidCredentials},
+		{ok, nil}, // Успешный вход сбрасывает счетчик: серия должна быть подряд
+		{wrong, domain.ErrInvalidCredentials},
+		{wrong, domain.ErrInvalidCredentials},
+		{wrong, domain.ErrInvalidCredentials}, // Третья ошибка подряд — блокировка
+		{ok, domain.ErrInvalidCredentials},    // Верный пароль во время блокировки не помогает
+	}
+	for i, s := range steps {
+		if err := env.login("alice", s.password); !errors.Is(err, s.wantErr) {
+			t.Fatalf("step %d: login error = %v, want %v", i, err, s.wantErr)
+		}
+	}
+	if !env.repo.users[u.ID].IsLocked(time.Now()) {
+		t.Fatal("user is not locked after 3 failures")
+	}
+
+	// Во время блокировки попытки не продлевают ее и не копят счетчик
+	until := *env.repo.users[u.ID].LockedUntil
+	if err := env.login("alice", wrong); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("login during lockout error = %v", err)
+	}
+	if got := env.repo.users[u.ID]; !got.LockedUntil.Equal(until) || got.FailedLoginAttempts != 0 {
+		t.Errorf("lockout changed by attempt during lockout: until %v (was %v), attempts %d", got.LockedUntil, until, got.FailedLoginAttempts)
+	}
+
+	// Срок вышел — вход снова возможен
+	past := time.Now().Add(-time.Second)
+	env.repo.users[u.ID].LockedUntil = &past
+	if err := env.login("alice", ok); err != nil {
+		t.Fatalf("login after lockout expired: %v", err)
+	}
+	if got := env.repo.users[u.ID]; got.LockedUntil != nil || got.LastLogin == nil {
+		t.Errorf("successful login did not reset lockout: %+v", got)
+	}
+}
+
+func TestLoginRejectedAccounts(t *testing.T) {
+	disabled := testUser(t, "disabled")
+	now := time.Now()
+	disabled.DisabledAt = &now
+	external := testUser(t, "external")
+	external.AuthProvider = domain.AuthProviderOIDC
+	env := newUserTestEnv(t, disabled, external)
+
+	for _, username := range []string{"disabled", "external", "unknown"} {
+		if err := env.login(username, testPassword); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("login %s error = %v, want %v", username, err, domain.ErrInvalidCredentials)
+		}
+	}
+	// Неудачи по отключенной учетной записи не считаются попытками подбора
+	if disabled := env.repo.users[disabled.ID]; disabled.FailedLoginAttempts != 0 {
+		t.Errorf("failed attempts of disabled user = %d, want 0", disabled.FailedLoginAttempts)
+	}
+}
+
+func TestPasswordLifecycle(t *testing.T) {
+	u := testUser(t, "bob")
+	external := testUser(t, "carol")
+	external.AuthProvider = domain.AuthProviderOIDC
+	env := newUserTestEnv(t, u, external)
+	asUser := func(id string) context.Context { return context.WithValue(context.Background(), "user_id", id) }
+	revoked := func(id string) bool { return env.mr.Exists(infra.RedisKeyRevokedSubjectPrefix + id) }
+
+	t.Run("change", func(t *testing.T) {
+		var verr *ValidationError
+		if err := env.users.ChangePassword(asUser(u.ID), "not the password", "new password 123"); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("wrong current password error = %v", err)
+		}
+		if err := env.users.ChangePassword(asUser(u.ID), testPassword, testPassword); !errors.As(err, &verr) {
+			t.Errorf("same password error = %v, want ValidationError", err)
+		}
+		if err := env.users.ChangePassword(asUser(u.ID), testPassword, "short"); !errors.As(err, &verr) {
+			t.Errorf("short password error = %v, want ValidationError", err)
+		}
+		if revoked(u.ID) {
+			t.Fatal("tokens revoked by a rejected change")
+		}
+
+		if err := env.users.ChangePassword(asUser(u.ID), testPassword, "new password 123"); err != nil {
+			t.Fatalf("ChangePassword() error = %v", err)
+		}
+		if !revoked(u.ID) || env.repo.users[u.ID].PasswordChangedAt == nil {
+			t.Error("password change did not revoke sessions or record the change time")
+		}
+		if err := env.login("bob", testPassword); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("old password still works: %v", err)
+		}
+		if err := env.login("bob", "new password 123"); err != nil {
+			t.Errorf("new password login error = %v", err)
+		}
+	})
+
+	t.Run("reset unlocks", func(t *testing.T) {
+		until := time.Now().Add(time.Hour)
+		env.repo.users[u.ID].LockedUntil = &until
+		env.mr.FlushAll()
+
+		temp, err := env.users.ResetPassword(context.Background(), u.ID, "")
+		if err != nil {
+			t.Fatalf("ResetPassword() error = %v", err)
+		}
+		if len(temp) < domain.MinPasswordLen {
+			t.Errorf("temporary password %q is too short", temp)
+		}
+		if !revoked(u.ID) {
+			t.Error("reset did not revoke sessions")
+		}
+		if err := env.login("bob", temp); err != nil {
+			t.Errorf("login with temporary password error = %v", err)
+		}
+	})
+
+	t.Run("explicit reset", func(t *testing.T) {
+		temp, err := env.users.ResetPassword(context.Background(), u.ID, "chosen by admin 42")
+		if err != nil || temp != "" {
+			t.Fatalf("ResetPassword() = %q, %v; want empty generated password", temp, err)
+		}
+		if err := env.login("bob", "chosen by admin 42"); err != nil {
+			t.Errorf("login error = %v", err)
+		}
+	})
+
+	t.Run("external user", func(t *testing.T) {
+		var verr *ValidationError
+		if _, err := env.users.ResetPassword(context.Background(), external.ID, ""); !errors.As(err, &verr) {
+			t.Errorf("reset of external user error = %v, want ValidationError", err)
+		}
+		if err := env.users.ChangePassword(asUser(external.ID), testPassword, "new password 123"); !errors.As(err, &verr) {
+			t.Errorf("change of external user error = %v, want ValidationError", err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OAuth2 Client Credentials (RFC 6749, раздел 4.4): агент обменивает client_id/client_secret
+// на короткоживущий RS256-токен для шлюза. client_id агента — его UUID.
+const GrantTypeClientCredentials = "client_credentials"
+
+// Аудитории токенов: консоль не принимает токены агентов, и наоборот
+const (
+	AudienceConsole = "spaceai-console"
+	AudienceGateway = "spaceai-gateway"
+)
+
+// Коды ошибок токен-эндпоинта (RFC 6749, раздел 5.2)
+const (
+	OAuthInvalidRequest       = "invalid_request"
+	OAuthInvalidClient        = "invalid_client"
+	OAuthInvalidScope         = "invalid_scope"
+	OAuthUnsupportedGrantType = "unsupported_grant_type"
+)
+
+// OAuthError — ошибка выдачи токена агенту в формате RFC 6749.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// ClientCredentialsRequest — параметры запроса токена агентом.
+type ClientCredentialsRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Scope        string // Необязательное сужение: подмножество Agent.Scopes через пробел
+}
+
+// RequestedScopes разбирает параметр scope.
+func (r ClientCredentialsRequest) RequestedScopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// AgentCredential — секрет агента. Хранится только bcrypt-хеш.
+type AgentCredential struct {
+	ID         string     `json:"id"`
+	AgentID    string     `json:"agent_id"`
+	SecretHash string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // Задается при ротации: старый секрет действует до этого момента
+}
+
+// AgentSecret — результат выпуска секрета. client_secret показывается один раз.
+type AgentSecret struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	CredentialID string `json:"credential_id"`
+	// Срок, до которого продолжают действовать прежние секреты (nil — прежних не было или отозваны сразу)
+	PreviousExpiresAt *time.Time `json:"previous_expires_at,omitempty"`
+}
+
+// ScopeAllows проверяет, покрывает ли набор scopes capability. Поддерживаются маски
+// вида "db.*" (любая capability с префиксом "db.") и "*", как в Agent.Scopes.
+func ScopeAllows(scopes map[string]bool, capID string) bool {
+	if scopes["admin"] || scopes["*"] || scopes[capID] {
+		return true
+	}
+	for s, ok := range scopes {
+		if ok && strings.HasSuffix(s, ".*") && strings.HasPrefix(capID, strings.TrimSuffix(s, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrAgentNotFound — агента нет или он выведен из эксплуатации.
+	ErrAgentNotFound = errors.New("agent not found")
+	// ErrAgentNameTaken — имя уже занято другим действующим агентом.
+	ErrAgentNameTaken = errors.New("agent name is already taken")
+)
+
+// Окружения агентов (CHECK-ограничение в таблице agents)
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// Ограничения схемы agents
+const (
+	maxAgentNameLen     = 255
+	maxAgentTeamLen     = 100
+	maxDescriptionLen   = 2000
+	maxAgentOwners      = 20
+	maxAgentLabels      = 64
+	maxLabelValueLen    = 63
+	maxAgentMetadataLen = 16 << 10
+	maxAgentTokenTTL    = 24 * 60 * 60 // Секунды; верхнюю границу дополнительно ограничивает auth.agent_tokens.max_ttl
+)
+
+var (
+	// Ключи меток в стиле Kubernetes: "team", "cost-center", "spaceai.io/tier"
+	labelKeyRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9.-]{0,251}[a-z0-9])?/)?[a-z0-9]([a-z0-9_.-]{0,61}[a-z0-9])?$`)
+	// Capability ID: "slack.message.send", "db.*"
+	scopeRe = regexp.MustCompile(`^[a-z0-9_*-]+(\.[a-z0-9_*-]+)*$`)
+)
+
+// AgentPatch — частичное изменение агента (PATCH). nil означает «не менять».
+// Статус и режим песочницы меняются отдельными операциями (block/unblock/sandbox).
+type AgentPatch struct {
+	Name        *string                 `json:"name"`
+	Description *string                 `json:"description"`
+	Owners      *[]string               `json:"owners"`
+	Team        *string                 `json:"team"`
+	Environment *string                 `json:"environment"`
+	Labels      *map[string]string      `json:"labels"`
+	Scopes      *[]string               `json:"scopes"`
+	Metadata    *map[string]interface{} `json:"metadata"`
+
+	TokenTTLSeconds *int `json:"token_ttl_seconds"` // 0 — сбросить на значение по умолчанию
+}
+
+// Apply переносит заданные поля патча в агента.
+func (p *AgentPatch) Apply(a *Agent) {
+	if p.Name != nil {
+		a.Name = *p.Name
+	}
+	if p.Description != nil {
+		a.Description = *p.Description
+	}
+	if p.Owners != nil {
+		a.Owners = *p.Owners
+	}
+	if p.Team != nil {
+		a.Team = *p.Team
+	}
+	if p.Environment != nil {
+		a.Environment = *p.Environment
+	}
+	if p.Labels != nil {
+		a.Labels = *p.Labels
+	}
+	if p.Scopes != nil {
+		a.Scopes = *p.Scopes
+	}
+	if p.Metadata != nil {
+		a.Metadata = *p.Metadata
+	}
+	if p.TokenTTLSeconds != nil {
+		a.TokenTTLSeconds = *p.TokenTTLSeconds
+	}
+}
+
+// AgentFilter — фильтры списка агентов в консоли.
+type AgentFilter struct {
+	Team           string
+	Environment    string
+	Owner          string
+	Labels         map[string]string // Все пары должны совпасть
+	IncludeDeleted bool
+}
+
+// Normalize приводит поля к каноничному виду и заполняет пустые коллекции,
+// чтобы в JSONB-колонки не попадал null.
+func (a *Agent) Normalize() {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Team = strings.TrimSpace(a.Team)
+	a.Environment = strings.ToLower(strings.TrimSpace(a.Environment))
+	if a.Environment == "" {
+		a.Environment = EnvDev
+	}
+	if a.Owners == nil {
+		a.Owners = []string{}
+	}
+	if a.Scopes == nil {
+		a.Scopes = []string{}
+	}
+	if a.Labels == nil {
+		a.Labels = map[string]string{}
+	}
+	if a.Metadata == nil {
+		a.Metadata = map[string]interface{}{}
+	}
+}
+
+// Validate проверяет агента на соответствие схеме agents и возвращает все ошибки разом.
+func (a *Agent) Validate() error {
+	var errs []error
+
+	switch {
+	case a.Name == "":
+		errs = append(errs, errors.New("name is required"))
+	case len(a.Name) > maxAgentNameLen:
+		errs = append(errs, fmt.Errorf("name must be at most %d characters", maxAgentNameLen))
+	}
+	if len(a.Description) > maxDescriptionLen {
+		errs = append(errs, fmt.Errorf("description must be at most %d characters", maxDescriptionLen))
+	}
+	if len(a.Team) > maxAgentTeamLen {
+		errs = append(errs, fmt.Errorf("team must be at most %d characters", maxAgentTeamLen))
+	}
+	switch a.Environment {
+	case EnvDev, EnvStaging, EnvProd:
+	default:
+		errs = append(errs, fmt.Errorf("environment must be one of %s, %s, %s", EnvDev, EnvStaging, EnvProd))
+	}
+
+	if len(a.Owners) > maxAgentOwners {
+		errs = append(errs, fmt.Errorf("at most %d owners allowed", maxAgentOwners))
+	}
+	for i, o := range a.Owners {
+		if strings.TrimSpace(o) == "" || len(o) > maxAgentNameLen {
+			errs = append(errs, fmt.Errorf("owners[%d] is invalid", i))
+		}
+	}
+
+	if len(a.Labels) > maxAgentLabels {
+		errs = append(errs, fmt.Errorf("at most %d labels allowed", maxAgentLabels))
+	}
+	for k, v := range a.Labels {
+		if !labelKeyRe.MatchString(k) {
+			errs = append(errs, fmt.Errorf("label key %q is invalid", k))
+		}
+		if len(v) > maxLabelValueLen {
+			errs = append(errs, fmt.Errorf("label %q value must be at most %d characters", k, maxLabelValueLen))
+		}
+	}
+
+	for i, s := range a.Scopes {
+		if !scopeRe.MatchString(s) {
+			errs = append(errs, fmt.Errorf("scopes[%d] %q is not a valid capability id", i, s))
+		}
+	}
+
+	if a.TokenTTLSeconds < 0 || a.TokenTTLSeconds > maxAgentTokenTTL {
+		errs = append(errs, fmt.Errorf("token_ttl_seconds must be in [0, %d]", maxAgentTokenTTL))
+	}
+
+	if raw, err := json.Marshal(a.Metadata); err != nil {
+		errs = append(errs, fmt.Errorf("metadata is not JSON-compatible: %w", err))
+	} else if len(raw) > maxAgentMetadataLen {
+		errs = append(errs, fmt.Errorf("metadata must be at most %d bytes", maxAgentMetadataLen))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAgentValidate(t *testing.T) {
+	valid := func() Agent {
+		a := Agent{Name: "jira-helper", Owners: []string{"alice@example.com"}, Environment: "Prod",
+			Labels: map[string]string{"cost-center": "42", "spaceai.io/tier": "gold"}, Scopes: []string{"jira.issue.read", "db.*"}}
+		a.Normalize()
+		return a
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(a *Agent)
+		wantErr string // Фрагмент ошибки; "" — агент корректен
+	}{
+		{name: "valid", mutate: func(*Agent) {}},
+		{name: "default environment", mutate: func(a *Agent) { a.Environment = ""; a.Normalize() }},
+		{name: "name required", mutate: func(a *Agent) { a.Name = "   "; a.Normalize() }, wantErr: "name is required"},
+		{name: "unknown environment", mutate: func(a *Agent) { a.Environment = "qa" }, wantErr: "environment"},
+		{name: "blank owner", mutate: func(a *Agent) { a.Owners = []string{"bob", " "} }, wantErr: "owners[1]"},
+		{name: "invalid label key", mutate: func(a *Agent) { a.Labels["Team Name"] = "x" }, wantErr: `label key "Team Name"`},
+		{name: "long label value", mutate: func(a *Agent) { a.Labels["team"] = strings.Repeat("x", maxLabelValueLen+1) }, wantErr: `label "team"`},
+		{name: "invalid scope", mutate: func(a *Agent) { a.Scopes = []string{"Jira Issue"} }, wantErr: "scopes[0]"},
+		{name: "token ttl too long", mutate: func(a *Agent) { a.TokenTTLSeconds = maxAgentTokenTTL + 1 }, wantErr: "token_ttl_seconds"},
+		{name: "oversized metadata", mutate: func(a *Agent) { a.Metadata = map[string]interface{}{"blob": strings.Repeat("x", maxAgentMetadataLen)} }, wantErr: "metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := valid()
+			tt.mutate(&a)
+			err := a.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgentValidateReportsAllErrors(t *testing.T) {
+	a := Agent{Environment: "qa", Scopes: []string{"bad scope"}, TokenTTLSeconds: -1}
+	err := a.Validate()
+	if err == nil {
+		t.Fatal("Validate() succeeded")
+	}
+	for _, want := range []string{"name is required", "environment", "scopes[0]", "token_ttl_seconds"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestAgentPatchApply(t *testing.T) {
+	a := Agent{Name: "bot", Team: "crm", Owners: []string{"alice"}, Status: StatusQuarantine, TokenTTLSeconds: 600}
+	name, ttl := "renamed-bot", 0
+	owners := []string{}
+	(&AgentPatch{Name: &name, Owners: &owners, TokenTTLSeconds: &ttl}).Apply(&a)
+
+	if a.Name != "renamed-bot" || len(a.Owners) != 0 || a.TokenTTLSeconds != 0 {
+		t.Errorf("patched fields = %q, %v, ttl %d", a.Name, a.Owners, a.TokenTTLSeconds)
+	}
+	// Незаданные поля и статус не меняются
+	if a.Team != "crm" || a.Status != StatusQuarantine {
+		t.Errorf("untouched fields changed: team %q, status %s", a.Team, a.Status)
+	}
+}
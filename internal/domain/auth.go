@@ -8,10 +8,16 @@ import (
 
 type CustomClaims struct {
 	UserID string          `json:"user_id"`
-	Scopes map[string]bool `json:"scopes"` // "admin": true или "jira.read": true
+	Scopes map[string]bool `json:"scopes"`         // "admin": true или "jira.read": true
+	Role   string          `json:"role,omitempty"` // Роль пользователя консоли (RBAC)
+	// AgentID задан только в токенах агентов (Client Credentials); user_id у них пустой
+	AgentID string `json:"agent_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsAgent отличает токен агента от токена пользователя консоли.
+func (c *CustomClaims) IsAgent() bool { return c.AgentID != "" }
+
 // Secure Token Issuing
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -22,6 +28,7 @@ type TokenResponse struct {
 	AccessToken string `json:"access_token"`
 	TokenType   string `json:"token_type"` // Всегда "Bearer"
 	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"` // Выданные scopes (только для токенов агентов)
 }
 
 type User struct {
@@ -33,4 +40,16 @@ type User struct {
 	Scopes       map[string]bool `json:"scopes"`
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
+
+	// Жизненный цикл учетной записи
+	CreatedBy           string     `json:"created_by"`
+	LastLogin           *time.Time `json:"last_login,omitempty"`
+	PasswordChangedAt   *time.Time `json:"password_changed_at,omitempty"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"` // Блокировка после серии неудачных входов
+	FailedLoginAttempts int        `json:"-"`
+
+	// Источник учетной записи: local (пароль) или oidc (корпоративный IdP)
+	AuthProvider string `json:"auth_provider"`
+	ExternalID   string `json:"external_id,omitempty"` // "{issuer}|{sub}" для внешних пользователей
 }
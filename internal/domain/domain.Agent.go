@@ -9,6 +9,8 @@ const (
 	StatusBlocked    AgentStatus = "blocked"    // Kill-switch (блокировка)
 	StatusQuarantine AgentStatus = "quarantine" // Требует HITL-подтверждения
 	StatusSandbox    AgentStatus = "sandbox"    // Безопасный режим (Live-данные не меняются)
+
+	StatusDecommissioned AgentStatus = "decommissioned" // Выведен из эксплуатации (мягкое удаление)
 )
 
 type Agent struct {
@@ -18,10 +20,23 @@ type Agent struct {
 	IsSandbox bool        `json:"is_sandbox"` // Флаг режима песочницы
 	Scopes    []string    `json:"scopes"`     // Список разрешенных Capability ID (для токена)
 
+	// Время жизни токена Client Credentials в секундах (0 — значение по умолчанию из конфига)
+	TokenTTLSeconds int `json:"token_ttl_seconds,omitempty"`
+
+	// Реестр: кто отвечает за агента и где он работает
+	Description string            `json:"description"`
+	Owners      []string          `json:"owners"`      // Ответственные (email или user_id)
+	Team        string            `json:"team"`        // Команда-владелец
+	Environment string            `json:"environment"` // dev, staging, prod
+	Labels      map[string]string `json:"labels"`      // Произвольные метки для фильтрации
+
 	// Метаданные для Observability
-	LastActivity time.Time `json:"last_activity"` // Последний успешный запрос
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	LastActivity *time.Time `json:"last_activity"` // Последний успешный запрос (nil — еще не было)
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	CreatedBy    string     `json:"created_by"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"` // Выведен из эксплуатации
+	DeletedBy    string     `json:"deleted_by,omitempty"`
 
 	// Дополнительные данные (версия, окружение и т.д.)
 	Metadata map[string]interface{} `json:"metadata"`
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 )
 
@@ -19,6 +20,21 @@ const (
 	EffectQuarantine PolicyEffect = "QUARANTINE" // Требовать ручного подтверждения (HITL)
 )
 
+// Valid сообщает, известен ли эффект шлюзу.
+func (e PolicyEffect) Valid() bool {
+	switch e {
+	case EffectAllow, EffectDeny, EffectSandbox, EffectQuarantine:
+		return true
+	}
+	return false
+}
+
+// ErrBreakGlassImmutable — break-glass доступ нельзя изменить: только отозвать (удалить) или выдать новый.
+var ErrBreakGlassImmutable = errors.New("break-glass grants cannot be updated; delete to revoke or grant a new one")
+
+// ErrShadowPolicyExists — для пары агент+способность уже есть теневая политика.
+var ErrShadowPolicyExists = errors.New("shadow policy for this agent and capability already exists")
+
 // Policy Архитектурный контур Security + Teacher + Connectors, представляет собой правило безопасности для Capability
 type Policy struct {
 	ID           string       `json:"id"`
@@ -30,6 +46,18 @@ type Policy struct {
 	Conditions json.RawMessage `json:"conditions,omitempty"` // Лимиты: {"max_amount": 1000, "currency": "USD"}
 	// позволяет ИБ-команде писать сложные правила (например, "только для транзакций до $100"), не меняя структуру БД.
 
+	// Номер текущей версии (растет при каждом изменении, см. PolicyVersion)
+	Version int `json:"version"`
+
+	// Временные рамки: окно валидности и повторяющееся расписание (см. policy_schedule.go).
+	// Проверяются в момент запроса, поэтому политика «включается» и истекает без Refresh.
+	ValidFrom  *time.Time      `json:"valid_from,omitempty"`
+	ValidUntil *time.Time      `json:"valid_until,omitempty"`
+	Schedule   *PolicySchedule `json:"schedule,omitempty"`
+
+	// BreakGlass — временный аварийный доступ. Всегда имеет valid_until и помечается в аудите.
+	BreakGlass bool `json:"break_glass,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -49,3 +77,38 @@ func (p *Policy) Decide() PolicyEffect {
 
 	return p.Effect
 }
+
+// Виды расхождений теневой политики с активной (Shadow Mode)
+const (
+	DivergenceWouldDeny     = "would_deny"     // Кандидат запретил бы запрос
+	DivergenceWouldEscalate = "would_escalate" // Кандидат ужесточил бы режим (Sandbox/HITL)
+	DivergenceWouldRelax    = "would_relax"    // Кандидат ослабил бы режим
+)
+
+// ShadowDivergence — расхождение решения теневой политики с фактическим решением шлюза.
+type ShadowDivergence struct {
+	ID             string        `json:"id"`
+	TraceID        string        `json:"trace_id"`
+	AgentID        string        `json:"agent_id"`
+	CapabilityID   string        `json:"capability_id"`
+	LivePolicyID   string        `json:"live_policy_id,omitempty"`
+	ShadowPolicyID string        `json:"shadow_policy_id"`
+	LiveEffect     PolicyEffect  `json:"live_effect"`
+	ShadowEffect   PolicyEffect  `json:"shadow_effect"`
+	Kind           string        `json:"kind"`
+	RiskScore      int           `json:"risk_score"`
+	RiskFindings   []RiskFinding `json:"risk_findings,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// ShadowSummary — агрегат расхождений по теневой политике для консоли.
+type ShadowSummary struct {
+	ShadowPolicyID string       `json:"shadow_policy_id"`
+	AgentID        string       `json:"agent_id"`
+	CapabilityID   string       `json:"capability_id"`
+	Kind           string       `json:"kind"`
+	LiveEffect     PolicyEffect `json:"live_effect"`
+	ShadowEffect   PolicyEffect `json:"shadow_effect"`
+	Count          int64        `json:"count"`
+	LastSeen       time.Time    `json:"last_seen"`
+}
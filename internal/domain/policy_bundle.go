@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PolicyOpImport — версия политики, созданная применением бандла (Policy-as-Code).
+const PolicyOpImport = "IMPORT"
+
+// PolicyChange — изменение существующей политики при применении бандла.
+type PolicyChange struct {
+	Before Policy                 `json:"before"`
+	After  Policy                 `json:"after"`
+	Diff   map[string]FieldChange `json:"diff"`
+}
+
+// BundlePlan — план приведения активного набора политик к содержимому бандла.
+type BundlePlan struct {
+	Added     []Policy       `json:"added"`
+	Changed   []PolicyChange `json:"changed"`
+	Removed   []Policy       `json:"removed"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// IsEmpty — бандл совпадает с активным набором.
+func (p *BundlePlan) IsEmpty() bool {
+	return len(p.Added) == 0 && len(p.Changed) == 0 && len(p.Removed) == 0
+}
+
+// Summary — краткая сводка в стиле "3 added, 1 changed, 2 removed".
+func (p *BundlePlan) Summary() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed", len(p.Added), len(p.Changed), len(p.Removed))
+}
+
+// PolicyKey — естественный ключ политики. Бандл хранится в git без UUID,
+// поэтому политики сопоставляются по паре агент+способность (как и в MemoEnforcer).
+// Для одной пары допускается несколько политик с разными временными рамками,
+// поэтому сигнатура окна и расписания входит в ключ: "agent:cap@mon,tue 09:00-18:00 UTC".
+func PolicyKey(p Policy) string {
+	key := p.AgentID + ":" + p.CapabilityID
+	if t := p.TimingKey(); t != "" {
+		key += "@" + t
+	}
+	return key
+}
+
+// PlanBundle сравнивает текущий набор с желаемым. Бандл — источник истины:
+// политики, которых в нем нет, попадают в Removed. Дубликаты ключей в текущем наборе
+// (исторические данные без уникального индекса) тоже удаляются, остается первая запись.
+// Break-glass доступы — оперативные и временные, бандлом не управляются и в план не попадают.
+func PlanBundle(current, desired []Policy) *BundlePlan {
+	plan := &BundlePlan{
+		Added:   make([]Policy, 0),
+		Changed: make([]PolicyChange, 0),
+		Removed: make([]Policy, 0),
+	}
+
+	byKey := make(map[string]Policy, len(current))
+	for _, p := range current {
+		if p.BreakGlass {
+			continue
+		}
+		if _, dup := byKey[PolicyKey(p)]; dup {
+			plan.Removed = append(plan.Removed, p)
+			continue
+		}
+		byKey[PolicyKey(p)] = p
+	}
+
+	for _, want := range desired {
+		key := PolicyKey(want)
+		have, ok := byKey[key]
+		if !ok {
+			plan.Added = append(plan.Added, want)
+			continue
+		}
+		delete(byKey, key)
+
+		next := have
+		next.Effect, next.Conditions = want.Effect, want.Conditions
+		if diff := DiffPolicies(&have, &next); len(diff) > 0 {
+			plan.Changed = append(plan.Changed, PolicyChange{Before: have, After: next, Diff: diff})
+		} else {
+			plan.Unchanged++
+		}
+	}
+
+	for _, p := range byKey {
+		plan.Removed = append(plan.Removed, p)
+	}
+
+	// Стабильный порядок для читаемого вывода plan
+	sort.Slice(plan.Added, func(i, j int) bool { return PolicyKey(plan.Added[i]) < PolicyKey(plan.Added[j]) })
+	sort.Slice(plan.Changed, func(i, j int) bool {
+		return PolicyKey(plan.Changed[i].Before) < PolicyKey(plan.Changed[j].Before)
+	})
+	sort.Slice(plan.Removed, func(i, j int) bool { return PolicyKey(plan.Removed[i]) < PolicyKey(plan.Removed[j]) })
+
+	return plan
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanBundle(t *testing.T) {
+	until := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	work := &PolicySchedule{Days: []string{"mon"}, Start: "09:00", End: "18:00"}
+	pol := func(id, agent, capID string, effect PolicyEffect) Policy {
+		return Policy{ID: id, AgentID: agent, CapabilityID: capID, Effect: effect, Version: 1}
+	}
+	withConditions := func(p Policy, raw string) Policy { p.Conditions = json.RawMessage(raw); return p }
+	withSchedule := func(p Policy) Policy { p.Schedule = work; return p }
+	breakGlass := pol("bg", "agent-1", "bank.transfer", EffectAllow)
+	breakGlass.BreakGlass, breakGlass.ValidUntil = true, &until
+
+	tests := []struct {
+		name    string
+		current []Policy
+		desired []Policy
+		// Ключи политик в каждой группе плана
+		added, changed, removed []string
+		unchanged               int
+	}{
+		{name: "empty"},
+		{
+			name:      "identical set",
+			current:   []Policy{withConditions(pol("p1", "agent-1", "crm.read", EffectAllow), `{"threshold":10}`)},
+			desired:   []Policy{withConditions(pol("", "agent-1", "crm.read", EffectAllow), `{ "threshold": 10 }`)},
+			unchanged: 1,
+		},
+		{
+			name:    "add change remove",
+			current: []Policy{pol("p1", "agent-1", "crm.read", EffectAllow), pol("p2", "agent-1", "crm.delete", EffectAllow)},
+			desired: []Policy{pol("", "agent-1", "crm.read", EffectDeny), pol("", "*", "crm.export", EffectSandbox)},
+			added:   []string{"*:crm.export"}, changed: []string{"agent-1:crm.read"}, removed: []string{"agent-1:crm.delete"},
+		},
+		{
+			name:    "conditions change",
+			current: []Policy{withConditions(pol("p1", "agent-1", "crm.read", EffectAllow), `{"threshold":10}`)},
+			desired: []Policy{withConditions(pol("", "agent-1", "crm.read", EffectAllow), `{"threshold":20}`)},
+			changed: []string{"agent-1:crm.read"},
+		},
+		{
+			// Временные рамки входят в ключ: плановая политика — отдельная запись рядом с бессрочной
+			name:    "schedule is part of the key",
+			current: []Policy{pol("p1", "agent-1", "db.query", EffectDeny)},
+			desired: []Policy{pol("", "agent-1", "db.query", EffectDeny), withSchedule(pol("", "agent-1", "db.query", EffectAllow))},
+			added:   []string{"agent-1:db.query@mon 09:00-18:00"}, unchanged: 1,
+		},
+		{
+			name:    "schedule removed",
+			current: []Policy{withSchedule(pol("p1", "agent-1", "db.query", EffectAllow))},
+			desired: []Policy{pol("", "agent-1", "db.query", EffectAllow)},
+			added:   []string{"agent-1:db.query"}, removed: []string{"agent-1:db.query@mon 09:00-18:00"},
+		},
+		{
+			name:    "break-glass is not managed by bundles",
+			current: []Policy{breakGlass},
+			desired: []Policy{pol("", "agent-2", "crm.read", EffectAllow)},
+			added:   []string{"agent-2:crm.read"},
+		},
+		{
+			name:      "duplicate in current set removed",
+			current:   []Policy{pol("p1", "agent-1", "crm.read", EffectAllow), pol("p2", "agent-1", "crm.read", EffectDeny)},
+			desired:   []Policy{pol("", "agent-1", "crm.read", EffectAllow)},
+			removed:   []string{"agent-1:crm.read"},
+			unchanged: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := PlanBundle(tt.current, tt.desired)
+
+			keys := func(list []Policy) []string {
+				out := make([]string, len(list))
+				for i, p := range list {
+					out[i] = PolicyKey(p)
+				}
+				return out
+			}
+			changed := make([]Policy, len(plan.Changed))
+			for i, c := range plan.Changed {
+				changed[i] = c.Before
+				if c.After.ID != c.Before.ID || len(c.Diff) == 0 {
+					t.Errorf("change %s keeps id %q -> %q, diff %v", PolicyKey(c.Before), c.Before.ID, c.After.ID, c.Diff)
+				}
+			}
+			for _, g := range []struct {
+				name      string
+				got, want []string
+			}{
+				{"added", keys(plan.Added), tt.added},
+				{"changed", keys(changed), tt.changed},
+				{"removed", keys(plan.Removed), tt.removed},
+			} {
+				if len(g.got) != len(g.want) || (len(g.got) > 0 && !reflect.DeepEqual(g.got, g.want)) {
+					t.Errorf("%s = %v, want %v", g.name, g.got, g.want)
+				}
+			}
+			if plan.Unchanged != tt.unchanged {
+				t.Errorf("unchanged = %d, want %d", plan.Unchanged, tt.unchanged)
+			}
+			if plan.IsEmpty() != (len(tt.added)+len(tt.changed)+len(tt.removed) == 0) {
+				t.Errorf("IsEmpty() = %v for %s", plan.IsEmpty(), plan.Summary())
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package domain
+
+import "encoding/json"
+
+// Операции в событиях изменения политик (канал policy-update)
+const (
+	PolicyEventUpsert  = "upsert"  // Политика создана или изменена — шлюз перечитывает одну строку
+	PolicyEventDelete  = "delete"  // Политика удалена
+	PolicyEventRefresh = "refresh" // Массовое изменение (бандл, откат набора) — полная перезагрузка
+)
+
+// PolicyChangeEvent — дельта для MemoEnforcer. Version позволяет отбросить устаревшие
+// и повторные события: Pub/Sub не гарантирует, что шлюз не увидит их не по порядку
+// относительно полной перезагрузки.
+type PolicyChangeEvent struct {
+	Op       string `json:"op"`
+	PolicyID string `json:"policy_id,omitempty"`
+	Version  int    `json:"version,omitempty"`
+}
+
+// Encode сериализует событие для Redis Pub/Sub.
+func (e PolicyChangeEvent) Encode() string {
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+// ParsePolicyChangeEvent разбирает payload канала. Прежний сигнал "refresh" и любые
+// нераспознанные сообщения трактуются как полная перезагрузка: лишний reload безопаснее
+// пропущенного изменения.
+func ParsePolicyChangeEvent(payload string) PolicyChangeEvent {
+	var e PolicyChangeEvent
+	if err := json.Unmarshal([]byte(payload), &e); err != nil || e.PolicyID == "" {
+		return PolicyChangeEvent{Op: PolicyEventRefresh}
+	}
+	if e.Op != PolicyEventUpsert && e.Op != PolicyEventDelete {
+		e.Op = PolicyEventRefresh
+	}
+	return e
+}
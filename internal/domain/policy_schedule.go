@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PolicySchedule — повторяющееся окно действия политики, например «пн–пт 09:00–18:00 по Москве».
+// Если End раньше Start, окно переходит через полночь (22:00–06:00).
+type PolicySchedule struct {
+	Days     []string `json:"days,omitempty" yaml:"days,omitempty"` // mon..sun; пусто — каждый день
+	Start    string   `json:"start" yaml:"start"`                   // HH:MM
+	End      string   `json:"end" yaml:"end"`                       // HH:MM
+	Timezone string   `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// String — каноничная запись расписания ("mon,tue 09:00-18:00 Europe/Moscow"), пусто для nil.
+func (s *PolicySchedule) String() string {
+	if s == nil {
+		return ""
+	}
+	days := make([]string, len(s.Days))
+	for i, d := range s.Days {
+		days[i] = strings.ToLower(d)
+	}
+	out := s.Start + "-" + s.End
+	if len(days) > 0 {
+		out = strings.Join(days, ",") + " " + out
+	}
+	if s.Timezone != "" {
+		out += " " + s.Timezone
+	}
+	return out
+}
+
+// ScheduleMatcher — скомпилированное расписание для проверки в Hot Path без парсинга.
+type ScheduleMatcher struct {
+	loc        *time.Location
+	days       [7]bool
+	start, end int // Минуты от полуночи
+}
+
+// Compile проверяет расписание и готовит его к быстрой проверке.
+func (s *PolicySchedule) Compile() (*ScheduleMatcher, error) {
+	m := &ScheduleMatcher{loc: time.UTC}
+
+	if s.Timezone != "" {
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: unknown timezone %q", s.Timezone)
+		}
+		m.loc = loc
+	}
+
+	if len(s.Days) == 0 {
+		for i := range m.days {
+			m.days[i] = true
+		}
+	}
+	for _, d := range s.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, fmt.Errorf("schedule: unknown weekday %q", d)
+		}
+		m.days[wd] = true
+	}
+
+	var err error
+	if m.start, err = parseClock(s.Start); err != nil {
+		return nil, err
+	}
+	if m.end, err = parseClock(s.End); err != nil {
+		return nil, err
+	}
+	if m.start == m.end {
+		return nil, errors.New("schedule: start and end must differ")
+	}
+	return m, nil
+}
+
+// Contains проверяет, попадает ли момент t в окно расписания.
+func (m *ScheduleMatcher) Contains(t time.Time) bool {
+	local := t.In(m.loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+
+	if m.start < m.end {
+		return m.days[day] && minute >= m.start && minute < m.end
+	}
+	// Окно через полночь: вечерняя часть относится к текущему дню, утренняя — к предыдущему
+	if minute >= m.start {
+		return m.days[day]
+	}
+	return minute < m.end && m.days[(day+6)%7]
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("schedule: invalid time %q (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsTimeBound — политика действует не всегда (окно валидности или расписание).
+func (p *Policy) IsTimeBound() bool {
+	return p.ValidFrom != nil || p.ValidUntil != nil || p.Schedule != nil
+}
+
+// ValidateTiming проверяет окно валидности, расписание и ограничения break-glass.
+func (p *Policy) ValidateTiming() error {
+	if p.ValidFrom != nil && p.ValidUntil != nil && !p.ValidUntil.After(*p.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
+	if p.Schedule != nil {
+		if _, err := p.Schedule.Compile(); err != nil {
+			return err
+		}
+	}
+	if p.BreakGlass && p.ValidUntil == nil {
+		return errors.New("break-glass grant must have valid_until")
+	}
+	return nil
+}
+
+// TimingKey — сигнатура временных рамок для естественного ключа политики (пусто для бессрочных).
+func (p *Policy) TimingKey() string {
+	if !p.IsTimeBound() {
+		return ""
+	}
+	parts := make([]string, 0, 3)
+	if p.ValidFrom != nil {
+		parts = append(parts, "from "+p.ValidFrom.UTC().Format(time.RFC3339))
+	}
+	if p.ValidUntil != nil {
+		parts = append(parts, "until "+p.ValidUntil.UTC().Format(time.RFC3339))
+	}
+	if p.Schedule != nil {
+		parts = append(parts, p.Schedule.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// InWindow проверяет только окно валидности [valid_from, valid_until).
+func (p *Policy) InWindow(t time.Time) bool {
+	if p.ValidFrom != nil && t.Before(*p.ValidFrom) {
+		return false
+	}
+	if p.ValidUntil != nil && !t.Before(*p.ValidUntil) {
+		return false
+	}
+	return true
+}
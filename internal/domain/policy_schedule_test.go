@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleContains(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*3600)
+	// 2026-03-06 — пятница, 2026-03-07 — суббота
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		schedule PolicySchedule
+		t        time.Time
+		want     bool
+	}{
+		{name: "inside work hours", schedule: PolicySchedule{Days: []string{"mon", "fri"}, Start: "09:00", End: "18:00"}, t: at(6, 9, 0), want: true},
+		{name: "end is exclusive", schedule: PolicySchedule{Days: []string{"fri"}, Start: "09:00", End: "18:00"}, t: at(6, 18, 0)},
+		{name: "weekend", schedule: PolicySchedule{Days: []string{"mon", "fri"}, Start: "09:00", End: "18:00"}, t: at(7, 10, 0)},
+		{name: "days are case insensitive", schedule: PolicySchedule{Days: []string{"SAT"}, Start: "09:00", End: "18:00"}, t: at(7, 10, 0), want: true},
+		// 07:30 UTC = 10:30 по Москве
+		{name: "timezone", schedule: PolicySchedule{Start: "10:00", End: "11:00", Timezone: "Europe/Moscow"}, t: at(6, 7, 30), want: true},
+		{name: "timezone outside", schedule: PolicySchedule{Start: "10:00", End: "11:00", Timezone: "Europe/Moscow"}, t: at(6, 10, 30)},
+		{name: "overnight evening part", schedule: PolicySchedule{Days: []string{"fri"}, Start: "22:00", End: "06:00"}, t: at(6, 23, 0), want: true},
+		// Утренняя часть окна пятницы приходится на субботу
+		{name: "overnight morning part belongs to previous day", schedule: PolicySchedule{Days: []string{"fri"}, Start: "22:00", End: "06:00"}, t: at(7, 5, 59), want: true},
+		{name: "overnight morning of unlisted day", schedule: PolicySchedule{Days: []string{"fri"}, Start: "22:00", End: "06:00"}, t: at(6, 5, 0)},
+		{name: "overnight daytime", schedule: PolicySchedule{Start: "22:00", End: "06:00"}, t: at(6, 12, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.schedule.Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%s, local %s) = %v, want %v", tt.t, tt.t.In(msk).Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidateTiming(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "permanent", policy: Policy{}},
+		{name: "window", policy: Policy{ValidFrom: &now, ValidUntil: &later}},
+		{name: "inverted window", policy: Policy{ValidFrom: &later, ValidUntil: &now}, wantErr: true},
+		{name: "empty window", policy: Policy{ValidFrom: &now, ValidUntil: &now}, wantErr: true},
+		{name: "break-glass with expiry", policy: Policy{BreakGlass: true, ValidUntil: &later}},
+		{name: "break-glass without expiry", policy: Policy{BreakGlass: true}, wantErr: true},
+		{name: "unknown weekday", policy: Policy{Schedule: &PolicySchedule{Days: []string{"funday"}, Start: "09:00", End: "18:00"}}, wantErr: true},
+		{name: "unknown timezone", policy: Policy{Schedule: &PolicySchedule{Start: "09:00", End: "18:00", Timezone: "Mars/Olympus"}}, wantErr: true},
+		{name: "zero-length schedule", policy: Policy{Schedule: &PolicySchedule{Start: "09:00", End: "09:00"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.ValidateTiming(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTiming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
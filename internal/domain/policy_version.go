@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrPolicyVersionNotFound — запрошенной версии политики не существует.
+var ErrPolicyVersionNotFound = errors.New("policy version not found")
+
+// Операции, порождающие новую версию политики
+const (
+	PolicyOpCreate   = "CREATE"
+	PolicyOpUpdate   = "UPDATE"
+	PolicyOpDelete   = "DELETE"
+	PolicyOpRollback = "ROLLBACK"
+)
+
+// PolicyVersion — неизменяемый снимок политики после очередного изменения.
+type PolicyVersion struct {
+	ID           string                 `json:"id"`
+	PolicyID     string                 `json:"policy_id"`
+	Version      int                    `json:"version"`
+	Operation    string                 `json:"operation"`
+	AgentID      string                 `json:"agent_id"`
+	CapabilityID string                 `json:"capability_id"`
+	Effect       PolicyEffect           `json:"effect"`
+	Conditions   json.RawMessage        `json:"conditions,omitempty"`
+	ValidFrom    *time.Time             `json:"valid_from,omitempty"`
+	ValidUntil   *time.Time             `json:"valid_until,omitempty"`
+	Schedule     *PolicySchedule        `json:"schedule,omitempty"`
+	BreakGlass   bool                   `json:"break_glass,omitempty"`
+	Deleted      bool                   `json:"deleted"` // После этой версии политики не существует
+	Author       string                 `json:"author"`
+	Diff         map[string]FieldChange `json:"diff,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// Policy восстанавливает политику из снимка.
+func (v *PolicyVersion) Policy() Policy {
+	return Policy{
+		ID:           v.PolicyID,
+		AgentID:      v.AgentID,
+		CapabilityID: v.CapabilityID,
+		Effect:       v.Effect,
+		Conditions:   v.Conditions,
+		Version:      v.Version,
+		ValidFrom:    v.ValidFrom,
+		ValidUntil:   v.ValidUntil,
+		Schedule:     v.Schedule,
+		BreakGlass:   v.BreakGlass,
+	}
+}
+
+// FieldChange — изменение одного поля между версиями.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DiffPolicies сравнивает две версии политики. Conditions сравниваются по ключам верхнего уровня
+// ("conditions.threshold"), чтобы в истории было видно, какой именно лимит поменяли.
+// nil означает отсутствие политики (создание или удаление).
+func DiffPolicies(before, after *Policy) map[string]FieldChange {
+	var b, a Policy
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+
+	diff := make(map[string]FieldChange)
+	if b.AgentID != a.AgentID {
+		diff["agent_id"] = FieldChange{From: b.AgentID, To: a.AgentID}
+	}
+	if b.CapabilityID != a.CapabilityID {
+		diff["capability_id"] = FieldChange{From: b.CapabilityID, To: a.CapabilityID}
+	}
+	if b.Effect != a.Effect {
+		diff["effect"] = FieldChange{From: b.Effect, To: a.Effect}
+	}
+	if !timeEqual(b.ValidFrom, a.ValidFrom) {
+		diff["valid_from"] = FieldChange{From: b.ValidFrom, To: a.ValidFrom}
+	}
+	if !timeEqual(b.ValidUntil, a.ValidUntil) {
+		diff["valid_until"] = FieldChange{From: b.ValidUntil, To: a.ValidUntil}
+	}
+	if b.Schedule.String() != a.Schedule.String() {
+		diff["schedule"] = FieldChange{From: b.Schedule, To: a.Schedule}
+	}
+	if b.BreakGlass != a.BreakGlass {
+		diff["break_glass"] = FieldChange{From: b.BreakGlass, To: a.BreakGlass}
+	}
+
+	bc, ac := conditionsMap(b.Conditions), conditionsMap(a.Conditions)
+	for k, bv := range bc {
+		av, ok := ac[k]
+		if !ok {
+			diff["conditions."+k] = FieldChange{From: decodeRaw(bv)}
+			continue
+		}
+		if !jsonEqual(bv, av) {
+			diff["conditions."+k] = FieldChange{From: decodeRaw(bv), To: decodeRaw(av)}
+		}
+	}
+	for k, av := range ac {
+		if _, ok := bc[k]; !ok {
+			diff["conditions."+k] = FieldChange{To: decodeRaw(av)}
+		}
+	}
+	return diff
+}
+
+func timeEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func conditionsMap(raw json.RawMessage) map[string]json.RawMessage {
+	m := make(map[string]json.RawMessage)
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &m)
+	}
+	return m
+}
+
+func decodeRaw(raw json.RawMessage) interface{} {
+	var v interface{}
+	_ = json.Unmarshal(raw, &v)
+	return v
+}
+
+// jsonEqual сравнивает значения без учета форматирования и порядка ключей.
+func jsonEqual(a, b json.RawMessage) bool {
+	ca, errA := json.Marshal(decodeRaw(a))
+	cb, errB := json.Marshal(decodeRaw(b))
+	return errA == nil && errB == nil && bytes.Equal(ca, cb)
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	sameInstant := from.In(time.FixedZone("MSK", 3*3600))
+	base := Policy{AgentID: "agent-1", CapabilityID: "bank.transfer", Effect: EffectAllow,
+		Conditions: json.RawMessage(`{"risk_field":"amount","threshold":1000}`), ValidFrom: &from}
+	with := func(f func(*Policy)) *Policy {
+		p := base
+		f(&p)
+		return &p
+	}
+
+	tests := []struct {
+		name   string
+		before *Policy
+		after  *Policy
+		want   []string // Измененные поля
+	}{
+		{name: "identical", before: &base, after: with(func(*Policy) {})},
+		{name: "conditions formatting and key order", before: &base,
+			after: with(func(p *Policy) { p.Conditions = json.RawMessage(`{ "threshold": 1000.0, "risk_field": "amount" }`) })},
+		{name: "same instant in another zone", before: &base, after: with(func(p *Policy) { p.ValidFrom = &sameInstant })},
+		{name: "effect", before: &base, after: with(func(p *Policy) { p.Effect = EffectDeny }), want: []string{"effect"}},
+		{name: "one condition key", before: &base,
+			after: with(func(p *Policy) { p.Conditions = json.RawMessage(`{"risk_field":"amount","threshold":5000}`) }),
+			want:  []string{"conditions.threshold"}},
+		{name: "condition added and removed", before: &base,
+			after: with(func(p *Policy) { p.Conditions = json.RawMessage(`{"risk_field":"amount","budgets":[]}`) }),
+			want:  []string{"conditions.budgets", "conditions.threshold"}},
+		{name: "window and schedule", before: &base, after: with(func(p *Policy) {
+			p.ValidFrom = nil
+			p.Schedule = &PolicySchedule{Start: "09:00", End: "18:00"}
+		}), want: []string{"schedule", "valid_from"}},
+		{name: "created", after: &base, want: []string{"agent_id", "capability_id", "conditions.risk_field", "conditions.threshold", "effect", "valid_from"}},
+		{name: "deleted", before: &base, want: []string{"agent_id", "capability_id", "conditions.risk_field", "conditions.threshold", "effect", "valid_from"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffPolicies(tt.before, tt.after)
+			got := make([]string, 0, len(diff))
+			for k := range diff {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("DiffPolicies() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Значение условия в diff — декодированный JSON, а не сырые байты
+	diff := DiffPolicies(&base, with(func(p *Policy) { p.Conditions = json.RawMessage(`{"risk_field":"amount","threshold":5000}`) }))
+	if c := diff["conditions.threshold"]; c.From != float64(1000) || c.To != float64(5000) {
+		t.Errorf("conditions.threshold change = %+v, want 1000 -> 5000", c)
+	}
+}
+
+// Откат берет политику из снимка версии: поля снимка должны полностью ее восстанавливать.
+func TestPolicyVersionRestoresPolicy(t *testing.T) {
+	until := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := Policy{
+		ID: "p1", AgentID: "agent-1", CapabilityID: "bank.transfer", Effect: EffectQuarantine,
+		Conditions: json.RawMessage(`{"threshold":1000}`), Version: 4, ValidUntil: &until,
+		Schedule: &PolicySchedule{Days: []string{"mon"}, Start: "09:00", End: "18:00"}, BreakGlass: true,
+	}
+	v := PolicyVersion{
+		ID: "v4", PolicyID: "p1", Version: 4, Operation: PolicyOpUpdate,
+		AgentID: want.AgentID, CapabilityID: want.CapabilityID, Effect: want.Effect, Conditions: want.Conditions,
+		ValidUntil: want.ValidUntil, Schedule: want.Schedule, BreakGlass: want.BreakGlass, Author: "u1",
+	}
+	got := v.Policy()
+	if diff := DiffPolicies(&want, &got); len(diff) != 0 || got.ID != want.ID || got.Version != want.Version {
+		t.Errorf("Policy() = %+v, diff %v", got, diff)
+	}
+}
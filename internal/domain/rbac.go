@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Права консоли в формате "ресурс:действие". Проверяются на уровне маршрутов ConsoleServer.
+const (
+	PermDashboardRead = "dashboard:read"
+
+	PermAgentsRead        = "agents:read"
+	PermAgentsWrite       = "agents:write"       // Регистрация, правка, вывод из эксплуатации
+	PermAgentsBlock       = "agents:block"       // Kill-switch, песочница
+	PermAgentsCredentials = "agents:credentials" // Выпуск и отзыв секретов Client Credentials
+
+	PermPoliciesRead       = "policies:read"
+	PermPoliciesWrite      = "policies:write"
+	PermPoliciesBreakGlass = "policies:break-glass"
+
+	PermApprovalsRead   = "approvals:read"
+	PermApprovalsDecide = "approvals:decide"
+
+	PermAuditRead      = "audit:read"
+	PermAdminAuditRead = "admin-audit:read" // Журнал действий пользователей консоли (только admin по умолчанию)
+	PermTokensRevoke   = "tokens:revoke"
+
+	PermUsersRead  = "users:read"
+	PermUsersWrite = "users:write" // Создание, роли, отключение, сброс пароля
+)
+
+// Роли пользователей консоли (колонка users.role)
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// DefaultRolePermissions — права ролей по умолчанию. Переопределяются в auth.roles.
+// "*" — все права, "policies:*" — все действия над ресурсом.
+func DefaultRolePermissions() map[string][]string {
+	viewer := []string{PermDashboardRead, PermAgentsRead, PermPoliciesRead, PermApprovalsRead, PermAuditRead}
+	return map[string][]string{
+		RoleViewer:   viewer,
+		RoleOperator: append(append([]string{}, viewer...), PermAgentsBlock, PermApprovalsDecide, PermPoliciesBreakGlass),
+		RoleAdmin:    {"*"},
+	}
+}
+
+// RolePermissions — отображение ролей в права.
+type RolePermissions map[string]map[string]bool
+
+// NewRolePermissions строит отображение: значения по умолчанию, поверх — overrides из конфига
+// (роль из конфига заменяет список прав роли целиком, новые роли добавляются).
+func NewRolePermissions(overrides map[string][]string) RolePermissions {
+	rp := make(RolePermissions)
+	set := func(role string, perms []string) {
+		m := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			m[strings.TrimSpace(p)] = true
+		}
+		rp[strings.ToLower(role)] = m
+	}
+	for role, perms := range DefaultRolePermissions() {
+		set(role, perms)
+	}
+	for role, perms := range overrides {
+		set(role, perms)
+	}
+	return rp
+}
+
+// Allowed проверяет право perm для роли и персональных scopes пользователя.
+// Scope "admin" (как в шлюзе) дает все права.
+func (rp RolePermissions) Allowed(role string, scopes map[string]bool, perm string) bool {
+	if scopes["admin"] || PermissionAllows(scopes, perm) {
+		return true
+	}
+	return PermissionAllows(rp[strings.ToLower(role)], perm)
+}
+
+// PermissionAllows проверяет право с учетом масок "*" и "ресурс:*".
+func PermissionAllows(granted map[string]bool, perm string) bool {
+	if granted["*"] || granted[perm] {
+		return true
+	}
+	resource, _, ok := strings.Cut(perm, ":")
+	return ok && granted[resource+":*"]
+}
+
+// Исходы административных действий в admin_audit
+const (
+	AdminOutcomeDenied  = "denied"  // Отказ RBAC, обработчик не вызывался
+	AdminOutcomeSuccess = "success" // Изменение выполнено (HTTP < 400)
+	AdminOutcomeFailed  = "failed"  // Обработчик вернул ошибку
+)
+
+// AdminAuditEntry — запись журнала административных действий консоли.
+type AdminAuditEntry struct {
+	ID         string          `json:"id"`
+	UserID     string          `json:"user_id"`
+	Role       string          `json:"role"`
+	Action     string          `json:"action"` // Требуемое право, например policies:write
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Outcome    string          `json:"outcome"`
+	Status     int             `json:"status,omitempty"` // HTTP-статус ответа
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"` // Состояние объекта до изменения
+	After      json.RawMessage `json:"after,omitempty"`  // Состояние после изменения
+	RemoteAddr string          `json:"remote_addr"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AdminAuditFilter — фильтры выборки журнала (пустые поля не ограничивают).
+type AdminAuditFilter struct {
+	UserID     string
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	From       *time.Time
+	To         *time.Time
+	Limit      int // 0 — без ограничения (экспорт)
+}
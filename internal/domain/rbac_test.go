@@ -0,0 +1,68 @@
+package domain
+
+import "testing"
+
+func TestPermissionAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted []string
+		perm    string
+		want    bool
+	}{
+		{name: "exact", granted: []string{PermPoliciesRead}, perm: PermPoliciesRead, want: true},
+		{name: "other action", granted: []string{PermPoliciesRead}, perm: PermPoliciesWrite},
+		{name: "all", granted: []string{"*"}, perm: PermUsersWrite, want: true},
+		{name: "resource wildcard", granted: []string{"policies:*"}, perm: PermPoliciesBreakGlass, want: true},
+		{name: "wildcard of other resource", granted: []string{"policies:*"}, perm: PermAgentsWrite},
+		// "admin-audit:read" — другой ресурс, "admin:*" его не покрывает
+		{name: "resource prefix", granted: []string{"admin:*"}, perm: PermAdminAuditRead},
+		{name: "permission without action", granted: []string{"audit:*"}, perm: "audit"},
+		{name: "nothing granted", perm: PermDashboardRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted := make(map[string]bool)
+			for _, p := range tt.granted {
+				granted[p] = true
+			}
+			if got := PermissionAllows(granted, tt.perm); got != tt.want {
+				t.Errorf("PermissionAllows(%v, %q) = %v, want %v", tt.granted, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolePermissionsAllowed(t *testing.T) {
+	rp := NewRolePermissions(map[string][]string{
+		"Auditor":    {" audit:* ", PermAdminAuditRead},
+		RoleOperator: {PermAgentsRead}, // Роль из конфига заменяет права по умолчанию целиком
+	})
+	tests := []struct {
+		name   string
+		role   string
+		scopes map[string]bool
+		perm   string
+		want   bool
+	}{
+		{name: "viewer reads policies", role: RoleViewer, perm: PermPoliciesRead, want: true},
+		{name: "viewer cannot write policies", role: RoleViewer, perm: PermPoliciesWrite},
+		{name: "viewer cannot read admin audit", role: RoleViewer, perm: PermAdminAuditRead},
+		{name: "admin has everything", role: RoleAdmin, perm: PermUsersWrite, want: true},
+		{name: "role is case insensitive", role: "ADMIN", perm: PermUsersWrite, want: true},
+		{name: "overridden operator keeps only config", role: RoleOperator, perm: PermAgentsRead, want: true},
+		{name: "overridden operator loses defaults", role: RoleOperator, perm: PermApprovalsDecide},
+		{name: "custom role with trimmed wildcard", role: "auditor", perm: PermAuditRead, want: true},
+		{name: "custom role outside its resources", role: "auditor", perm: PermPoliciesRead},
+		{name: "unknown role", role: "guest", perm: PermDashboardRead},
+		{name: "personal scope", role: RoleViewer, scopes: map[string]bool{PermApprovalsDecide: true}, perm: PermApprovalsDecide, want: true},
+		{name: "personal wildcard scope", role: "", scopes: map[string]bool{"users:*": true}, perm: PermUsersWrite, want: true},
+		{name: "gateway admin scope", role: "guest", scopes: map[string]bool{"admin": true}, perm: PermUsersWrite, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rp.Allowed(tt.role, tt.scopes, tt.perm); got != tt.want {
+				t.Errorf("Allowed(%q, %v, %q) = %v, want %v", tt.role, tt.scopes, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
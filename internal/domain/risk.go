@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// RiskFinding — одно срабатывание детектора риск-анализа.
+// Сохраняется в аудит как доказательная база решения (deny/sandbox/HITL).
+type RiskFinding struct {
+	Detector string `json:"detector"`           // secrets, exfiltration, urls, injection
+	Rule     string `json:"rule"`               // Конкретное правило детектора (например, "aws_access_key")
+	Score    int    `json:"score"`              // Вклад в риск: 0..100
+	Path     string `json:"path,omitempty"`     // Путь к полю в payload ("data.items[3].url")
+	Evidence string `json:"evidence,omitempty"` // Замаскированный фрагмент (секреты целиком не сохраняем)
+}
+
+// AgentIncident — автоматическая реакция риск-анализатора на аномальное поведение агента.
+// Хранит доказательства, на основании которых агент был переведен в карантин или заблокирован.
+type AgentIncident struct {
+	ID        string        `json:"id"`
+	AgentID   string        `json:"agent_id"`
+	Action    AgentStatus   `json:"action"` // quarantine или blocked
+	Source    string        `json:"source"` // Подсистема-инициатор: "behavior"
+	Score     int           `json:"score"`
+	Evidence  []RiskFinding `json:"evidence"`
+	CreatedAt time.Time     `json:"created_at"`
+}
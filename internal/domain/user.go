@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("username or email is already taken")
+	// ErrLastAdmin — операция оставила бы консоль без действующего администратора.
+	ErrLastAdmin = errors.New("cannot disable or demote the last active admin")
+	// ErrInvalidCredentials — общий ответ на любую неудачу входа (не раскрываем причину).
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Ограничения паролей. bcrypt учитывает только первые 72 байта — длиннее не принимаем,
+// чтобы «хвост» пароля не создавал ложного ощущения стойкости.
+const (
+	MinPasswordLen = 12
+	MaxPasswordLen = 72
+)
+
+var usernameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,49}$`)
+
+// Источники учетных записей (users.auth_provider)
+const (
+	AuthProviderLocal = "local"
+	AuthProviderOIDC  = "oidc"
+)
+
+// ErrExternalPassword — паролем внешнего пользователя управляет IdP.
+var ErrExternalPassword = errors.New("password of an external user is managed by the identity provider")
+
+// ValidUsername проверяет формат имени пользователя консоли.
+func ValidUsername(s string) bool { return usernameRe.MatchString(s) }
+
+// IsExternal — пользователь входит через внешний IdP и не имеет локального пароля.
+func (u *User) IsExternal() bool {
+	return u.AuthProvider != "" && u.AuthProvider != AuthProviderLocal
+}
+
+// IsActive — учетная запись не отключена.
+func (u *User) IsActive() bool { return u.DisabledAt == nil }
+
+// IsLocked — вход временно заблокирован после серии неудачных попыток.
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(now)
+}
+
+// CreateUserRequest — создание пользователя консоли.
+type CreateUserRequest struct {
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes"` // Персональные права сверх роли: ["policies:write"]
+}
+
+// Normalize приводит поля к каноничному виду.
+func (r *CreateUserRequest) Normalize() {
+	r.Username = strings.ToLower(strings.TrimSpace(r.Username))
+	r.Email = strings.TrimSpace(r.Email)
+	r.Role = strings.ToLower(strings.TrimSpace(r.Role))
+	if r.Role == "" {
+		r.Role = RoleViewer
+	}
+}
+
+// Validate проверяет запрос. Роль сверяется с известными ролями (с учетом auth.roles).
+func (r *CreateUserRequest) Validate(roles RolePermissions) error {
+	var errs []error
+	if !ValidUsername(r.Username) {
+		errs = append(errs, errors.New("username must be 2-50 chars: a-z, 0-9, '.', '_', '-'"))
+	}
+	if _, err := mail.ParseAddress(r.Email); err != nil || len(r.Email) > 255 {
+		errs = append(errs, errors.New("email is invalid"))
+	}
+	if err := ValidatePassword(r.Password); err != nil {
+		errs = append(errs, err)
+	}
+	if _, ok := roles[r.Role]; !ok {
+		errs = append(errs, fmt.Errorf("unknown role %q", r.Role))
+	}
+	return errors.Join(errs...)
+}
+
+// UserPatch — изменение пользователя администратором. nil означает «не менять».
+type UserPatch struct {
+	Email    *string   `json:"email"`
+	Role     *string   `json:"role"`
+	Scopes   *[]string `json:"scopes"`
+	Disabled *bool     `json:"disabled"`
+}
+
+// ValidatePassword проверяет требования к паролю.
+func ValidatePassword(p string) error {
+	switch {
+	case len(p) < MinPasswordLen:
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLen)
+	case len(p) > MaxPasswordLen:
+		return fmt.Errorf("password must be at most %d bytes", MaxPasswordLen)
+	}
+	return nil
+}
+
+// ScopeList превращает набор scopes в список для хранения в users.scopes.
+func ScopeList(scopes map[string]bool) []string {
+	list := make([]string, 0, len(scopes))
+	for s, ok := range scopes {
+		if ok {
+			list = append(list, s)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
@@ -32,7 +32,9 @@ import (
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/redact"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/risk"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/sandbox"
 	"go.uber.org/zap"
 )
 
@@ -59,9 +61,13 @@ type UAGCore struct {
 
 	// Компоненты логики (Runtime Managers)
 	riskAnalyzer *risk.Analyzer
+	budgets      *risk.BudgetTracker // Накопительные лимиты (Redis, sliding window)
+	sandboxResp  *sandbox.Responder  // Реалистичные ответы песочницы
+	shadow       *ShadowEvaluator    // Оценка кандидатных политик (Shadow Mode)
 	killSwitch   *KillSwitchManager
 	quarantine   *QuarantineManager
 	sandbox      *SandboxManager
+	redactor     *redact.Redactor // Фильтрация PII в ответах и аудите
 
 	// Инфраструктура
 	metrics *Metrics
@@ -78,6 +84,10 @@ type UAGDeps struct {
 	Executor     ActionExecutor
 	Approver     ApprovalCreator
 	RiskAnalyzer *risk.Analyzer
+	Budgets      *risk.BudgetTracker
+	SandboxResp  *sandbox.Responder
+	Shadow       *ShadowEvaluator
+	Redactor     *redact.Redactor
 
 	// Менеджеры состояний
 	KillSwitch *KillSwitchManager
@@ -91,6 +101,11 @@ type UAGDeps struct {
 }
 
 func NewUAGCore(deps UAGDeps) *UAGCore {
+	// Null Object: без явного редактора используем встроенные детекторы PII
+	if deps.Redactor == nil {
+		deps.Redactor = redact.NewRedactor(redact.DefaultDetectors()...)
+	}
+
 	return &UAGCore{
 		BaseValidator: deps.Validator,
 		policy:        deps.Policy,
@@ -98,21 +113,38 @@ func NewUAGCore(deps UAGDeps) *UAGCore {
 		executor:      deps.Executor,
 		approver:      deps.Approver,
 		riskAnalyzer:  deps.RiskAnalyzer,
+		budgets:       deps.Budgets,
+		sandboxResp:   deps.SandboxResp,
+		shadow:        deps.Shadow,
 		killSwitch:    deps.KillSwitch,
 		quarantine:    deps.Quarantine,
 		sandbox:       deps.Sandbox,
+		redactor:      deps.Redactor,
 		metrics:       deps.Metrics,
 		rdb:           deps.Redis,
 		logger:        deps.Logger.With(zap.String("mod", "uag-core")),
 	}
 }
 
+// VerifyToken перекрывает BaseValidator: шлюз принимает только токены агентов (Client Credentials).
+// В токене пользователя консоли нет agent_id, и агент бы брался из заголовка X-Agent-ID.
+func (u *UAGCore) VerifyToken(tokenStr string) (*domain.CustomClaims, error) {
+	claims, err := u.BaseValidator.VerifyToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsAgent() {
+		return nil, fmt.Errorf("token of %s is not an agent token", claims.Subject)
+	}
+	return claims, nil
+}
+
 func (u *UAGCore) ProcessAction(ctx context.Context, agentID string, capID string, data []byte) ([]byte, error) {
 	// Авторизация - проверка токена и прав (Security First)
 	scopes, ok := ctx.Value("user_scopes").(map[string]bool)
 
-	// Админ может всё, Агент — только то, что в его scopes
-	if !ok || (!scopes["admin"] && !scopes[capID]) {
+	// Админ может всё, Агент — только то, что в его scopes (с учетом масок вида "db.*")
+	if !ok || !domain.ScopeAllows(scopes, capID) {
 		return nil, fmt.Errorf("security: insufficient permissions for %s", capID)
 	}
 
@@ -139,32 +171,159 @@ func (u *UAGCore) ProcessAction(ctx context.Context, agentID string, capID strin
 
 	// Policy Lookup & Decision
 	policyData := u.policy.GetPolicy(agentID, capID)
+	if policyData.BreakGlass {
+		u.logger.Warn("request authorized by break-glass grant",
+			zap.String("agent", agentID),
+			zap.String("cap", capID),
+			zap.String("policy", policyData.ID),
+			zap.Timep("valid_until", policyData.ValidUntil))
+	}
+
+	// 0. Governance Check: состояние агента в Control Plane (в т.ч. выставленное риск-анализатором)
+	if u.killSwitch.IsBlocked(agentID) {
+		u.logger.Warn("intercepted blocked agent request", zap.String("agent", agentID))
+		event.Status = "BLOCKED"
+		u.logAudit(&event, policyData, nil)
+		return nil, fmt.Errorf("security: agent %s is blocked by kill-switch", agentID)
+	}
 
 	// 1. Применяем решение домена
 	effect := policyData.Decide()
+	quarantined := u.quarantine.IsQuarantined(agentID)
+	if quarantined {
+		effect = risk.Escalate(effect, domain.EffectQuarantine)
+	}
+
+	// 1.1. Контентный риск-анализ (секреты, эксфильтрация, URL, prompt-injection).
+	// Может только ужесточить решение политики: ALLOW -> SANDBOX -> HITL -> DENY.
+	assessment := u.riskAnalyzer.Assess(policyData, data)
+	event.RiskScore = assessment.Score
+	event.RiskFindings = assessment.Findings
+	effect = risk.Escalate(effect, assessment.Effect)
+
+	// 1.2. Накопительные бюджеты: сумма/количество по агенту и способности в скользящем окне.
+	// Проверка и расход атомарны; если запрос в итоге не исполнен, резерв снимается
+	budget, reservation := u.budgets.Reserve(ctx, event.ID, agentID, capID, policyData, data)
+	defer func() {
+		if event.Status != "SUCCESS" {
+			u.budgets.Release(reservation)
+		}
+	}()
+	event.RiskFindings = append(event.RiskFindings, budget.Findings...)
+	effect = risk.Escalate(effect, budget.Effect)
+
+	// 1.3. Динамический порог HITL из Conditions (risk_field/threshold)
+	if u.riskAnalyzer.IsRequired(policyData, data) {
+		effect = risk.Escalate(effect, domain.EffectQuarantine)
+	}
+
+	// 1.4. Shadow Mode: кандидатная политика оценивается на этом же запросе, не влияя на решение
+	u.shadow.Evaluate(ShadowRequest{
+		TraceID:      traceID,
+		AgentID:      agentID,
+		CapabilityID: capID,
+		LivePolicy:   policyData,
+		LiveEffect:   effect,
+		Quarantined:  quarantined,
+		Payload:      data,
+	})
 
 	if effect == domain.EffectDeny {
 		// Дальше код НЕ ИДЕТ. Мы в безопасности.
-		u.logger.Warn("access denied", zap.String("cap", capID))
+		u.logger.Warn("access denied", zap.String("cap", capID), zap.Int("risk_score", assessment.Score))
+		event.Status = "DENIED"
+		u.logAudit(&event, policyData, nil)
 		return nil, fmt.Errorf("access denied: %s", capID)
 	}
 
 	// 2. Проверяем необходимость Human-in-the-loop (HITL)
 	// Важно: Риск-анализ первичен! Если запрос опасен, админ должен его увидеть,
 	// даже если агент работает в режиме песочницы.
-	if effect == domain.EffectQuarantine || u.riskAnalyzer.IsRequired(policyData, data) {
+	if effect == domain.EffectQuarantine {
 		u.logger.Info("high risk action detected, quarantine triggered (HITL)", zap.String("agent", agentID))
-		return u.handleMandatoryApproval(ctx, agentID, capID, data)
+		return u.handleMandatoryApproval(ctx, &event, policyData, data)
 	}
 
 	// 3. Если риск пройден или апрув получен, проверяем режим исполнения
 	if effect == domain.EffectSandbox || u.sandbox.IsSandbox(agentID) {
 		u.logger.Debug("executing in sandbox mode", zap.String("agent", agentID))
-		return u.executeSandbox(ctx, agentID, capID, data)
+		return u.executeSandbox(ctx, &event, policyData, data)
 	}
 
 	// 4. Live вызов (только для чистых и проверенных запросов)
-	return u.executor.Call(ctx, capID, data)
+	return u.executeLive(ctx, &event, policyData, data)
+}
+
+// executeLive выполняет боевой вызов через ActionExecutor, применяет фильтры вывода
+// политики и фиксирует результат в AgentFS.
+func (u *UAGCore) executeLive(ctx context.Context, event *audit.AuditEvent, p domain.Policy, data []byte) ([]byte, error) {
+	resp, err := u.executor.Call(ctx, event.CapabilityID, data)
+	if err != nil {
+		event.Status = "FAILED"
+		event.Error = err.Error()
+		u.logAudit(event, p, nil)
+		return nil, err
+	}
+
+	// Агент получает только отфильтрованный ответ. Если фильтр применить нельзя —
+	// не отдаем данные вовсе (Fail Closed), чтобы не допустить утечки PII.
+	filters, err := redact.FromConditions(p.Conditions)
+	var out []byte
+	if err == nil {
+		out, err = u.redactor.ApplyJSON(resp, filters.Response)
+	}
+	if err != nil {
+		event.Status = "FAILED"
+		event.Error = err.Error()
+		u.logAudit(event, p, nil)
+		return nil, fmt.Errorf("security: response filtering failed: %w", err)
+	}
+
+	event.Status = "SUCCESS"
+	u.budgets.Commit(ctx, event.ID, event.AgentID, event.CapabilityID, p, data)
+	u.sandboxResp.Record(event.CapabilityID, p, resp)
+	u.logAudit(event, p, resp)
+	return out, nil
+}
+
+// logAudit применяет audit_filter политики к Payload/Response и отправляет событие в AgentFS.
+// Фильтр для аудита настраивается независимо от фильтра ответа агенту. Если фильтр не читается,
+// событие все равно пишется, но с маскированием всеми детекторами.
+func (u *UAGCore) logAudit(event *audit.AuditEvent, p domain.Policy, resp []byte) {
+	filters, err := redact.FromConditions(p.Conditions)
+	rules := filters.Audit
+	if err != nil {
+		u.logger.Warn("audit filter is invalid, masking all detectors",
+			zap.String("policy_id", p.ID), zap.Error(err))
+		rules = &redact.Rules{Mask: u.redactor.DetectorNames()}
+	}
+
+	event.PolicyID = p.ID
+	event.PolicyVersion = p.Version
+	event.BreakGlass = p.BreakGlass
+	event.DurationMs = time.Since(event.Timestamp).Milliseconds()
+	event.Payload = u.redactor.ApplyMap(event.Payload, rules)
+	if resp != nil {
+		var v interface{}
+		if err := json.Unmarshal(resp, &v); err == nil {
+			event.Response = u.redactor.Apply(v, rules)
+		}
+	} else if event.Response != nil {
+		event.Response = u.redactor.Apply(event.Response, rules)
+	}
+
+	u.auditor.Log(*event)
+
+	// Поведенческий профиль агента учится на каждом исходе (кроме уже отсеченного трафика)
+	if event.Status == "BLOCKED" {
+		return
+	}
+	u.riskAnalyzer.Observe(risk.Observation{
+		AgentID:      event.AgentID,
+		CapabilityID: event.CapabilityID,
+		Timestamp:    event.Timestamp,
+		Failed:       event.Status != "SUCCESS" && event.Status != "INTERCEPTED",
+	})
 }
 
 // Вспомогательный метод для конвертации
@@ -174,35 +333,29 @@ func (u *UAGCore) bytesToMap(data []byte) map[string]interface{} {
 	return m
 }
 
-func (u *UAGCore) executeSandbox(ctx context.Context, agentID, capID string, data []byte) ([]byte, error) {
-	start := time.Now()
-
-	// Десериализуем payload для читаемости в логах (Senior-подход)
-	var payloadMap map[string]interface{}
-	json.Unmarshal(data, &payloadMap)
+func (u *UAGCore) executeSandbox(ctx context.Context, event *audit.AuditEvent, p domain.Policy, data []byte) ([]byte, error) {
+	// Реалистичный ответ из источника, заданного политикой (fixture/schema/recorded/static)
+	respBytes, source := u.sandboxResp.Respond(ctx, event.CapabilityID, p, data)
+	event.Mode = "SANDBOX"
 
-	// Имитируем "успешный" ответ от системы
-	mockResponse := map[string]interface{}{
-		"status":  "simulated_success",
-		"details": "Action captured in sandbox mode, no real impact made.",
+	filters, err := redact.FromConditions(p.Conditions)
+	var out []byte
+	if err == nil {
+		out, err = u.redactor.ApplyJSON(respBytes, filters.Response)
+	}
+	if err != nil {
+		event.Status = "FAILED"
+		event.Error = err.Error()
+		u.logAudit(event, p, nil)
+		return nil, fmt.Errorf("security: response filtering failed: %w", err)
 	}
-	respBytes, _ := json.Marshal(mockResponse)
 
 	// Асинхронно пишем в AgentFS, чтобы не блокировать ответ агенту
-	u.auditor.Log(audit.AuditEvent{
-		ID:           uuid.New().String(),
-		TraceID:      extractTraceID(ctx),
-		AgentID:      agentID,
-		CapabilityID: capID,
-		Payload:      payloadMap,
-		Mode:         "SANDBOX",
-		Status:       "INTERCEPTED",
-		Response:     mockResponse,
-		Timestamp:    time.Now(),
-		DurationMs:   time.Since(start).Milliseconds(),
-	})
+	event.Status = "INTERCEPTED"
+	u.logger.Debug("sandbox response served", zap.String("capability", event.CapabilityID), zap.String("source", source))
+	u.logAudit(event, p, respBytes)
 
-	return respBytes, nil
+	return out, nil
 }
 
 func (u *UAGCore) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
@@ -215,6 +368,15 @@ func (u *UAGCore) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 	agentID := r.Header.Get("X-Agent-ID")
 	capID := r.URL.Query().Get("capability") // например, ?capability=crm.user.delete
 
+	// Токен агента однозначно определяет агента: заголовок необязателен, но не может ему противоречить
+	if tokenAgent, ok := r.Context().Value("agent_id").(string); ok && tokenAgent != "" {
+		if agentID != "" && agentID != tokenAgent {
+			http.Error(w, "X-Agent-ID does not match agent token", http.StatusForbidden)
+			return
+		}
+		agentID = tokenAgent
+	}
+
 	if agentID == "" || capID == "" {
 		http.Error(w, "X-Agent-ID and capability query param are required", http.StatusBadRequest)
 		return
@@ -242,7 +404,9 @@ func (u *UAGCore) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
-func (u *UAGCore) handleMandatoryApproval(ctx context.Context, agentID, capID string, data []byte) ([]byte, error) {
+func (u *UAGCore) handleMandatoryApproval(ctx context.Context, event *audit.AuditEvent, p domain.Policy, data []byte) ([]byte, error) {
+	agentID, capID := event.AgentID, event.CapabilityID
+
 	// 1. Генерируем ID для отслеживания жизненного цикла запроса
 	executionID := uuid.New().String()
 
@@ -283,11 +447,13 @@ func (u *UAGCore) handleMandatoryApproval(ctx context.Context, agentID, capID st
 		switch msg.Payload {
 		case string(domain.StatusApproved):
 			u.logger.Info("HITL: operation approved", zap.String("id", executionID))
-			// Исполняем через Reliability Wrapper
-			return u.executor.Call(ctx, capID, data)
+			// Исполняем через Reliability Wrapper (с фильтрацией ответа и аудитом)
+			return u.executeLive(ctx, event, p, data)
 
 		case string(domain.StatusRejected):
 			u.logger.Warn("HITL: operation rejected by operator", zap.String("id", executionID))
+			event.Status = "REJECTED"
+			u.logAudit(event, p, nil)
 			return nil, fmt.Errorf("security: operation explicitly rejected by human operator")
 
 		default:
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/risk"
+	"go.uber.org/zap"
+)
+
+// TestGatewayAcceptsOnlyAgentTokens проверяет, что токен пользователя консоли с поддельным
+// X-Agent-ID не проходит шлюз, а токен агента не может действовать от имени другого агента.
+func TestGatewayAcceptsOnlyAgentTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims *domain.CustomClaims) string {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = auth.KeyID(&key.PublicKey)
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	admin := map[string]bool{"admin": true}
+	tests := []struct {
+		name     string
+		token    string
+		agentHdr string
+		want     int
+	}{
+		{
+			name: "console token with console audience",
+			token: sign(&domain.CustomClaims{UserID: "u1", Role: domain.RoleAdmin, Scopes: admin,
+				RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", Audience: jwt.ClaimStrings{domain.AudienceConsole}}}),
+			agentHdr: "victim-agent",
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name: "user token with gateway audience",
+			token: sign(&domain.CustomClaims{UserID: "u1", Role: domain.RoleAdmin, Scopes: admin,
+				RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", Audience: jwt.ClaimStrings{domain.AudienceGateway}}}),
+			agentHdr: "victim-agent",
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name: "agent token with foreign X-Agent-ID",
+			token: sign(&domain.CustomClaims{AgentID: "agent-1", Scopes: admin,
+				RegisteredClaims: jwt.RegisteredClaims{Subject: "agent-1", Audience: jwt.ClaimStrings{domain.AudienceGateway}}}),
+			agentHdr: "victim-agent",
+			want:     http.StatusForbidden,
+		},
+	}
+
+	uag := NewUAGCore(UAGDeps{
+		Validator: auth.NewBaseValidator(auth.NewKeySet(&key.PublicKey), nil, domain.AudienceGateway),
+		Logger:    zap.NewNop(),
+	})
+	h := auth.NewMiddleware(uag, zap.NewNop())(http.HandlerFunc(uag.HandleHTTPRequest))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/execute?capability=crm.user.delete", strings.NewReader(`{}`))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			req.Header.Set("X-Agent-ID", tt.agentHdr)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+type recordingAuditor struct {
+	events []audit.AuditEvent
+}
+
+func (a *recordingAuditor) Log(event audit.AuditEvent) { a.events = append(a.events, event) }
+
+// TestExecuteSandboxAudit: ответ песочницы, который не удалось отфильтровать, не отдается агенту,
+// но попадает в аудит с ошибкой — как и в executeLive.
+func TestExecuteSandboxAudit(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		wantStatus string
+		wantErr    bool
+	}{
+		{name: "filtered response", conditions: `{"response_filter":{"mask":["email"]}}`, wantStatus: "INTERCEPTED"},
+		{name: "invalid response filter", conditions: `{"response_filter":"ssn"}`, wantStatus: "FAILED", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor := &recordingAuditor{}
+			uag := NewUAGCore(UAGDeps{
+				Auditor:      auditor,
+				RiskAnalyzer: risk.NewAnalyzer(nil, zap.NewNop()),
+				Logger:       zap.NewNop(),
+			})
+			p := domain.Policy{ID: "p1", Version: 3, Conditions: json.RawMessage(tt.conditions)}
+			event := &audit.AuditEvent{ID: "e1", AgentID: "agent-1", CapabilityID: "crm.read", Timestamp: time.Now()}
+
+			out, err := uag.executeSandbox(context.Background(), event, p, []byte(`{}`))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("executeSandbox() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && out != nil {
+				t.Errorf("unfiltered response returned to agent: %s", out)
+			}
+			if len(auditor.events) != 1 {
+				t.Fatalf("audit events = %d, want 1", len(auditor.events))
+			}
+			got := auditor.events[0]
+			if got.Mode != "SANDBOX" || got.Status != tt.wantStatus || got.PolicyID != "p1" || got.PolicyVersion != 3 {
+				t.Errorf("audit event = %s/%s policy %s v%d, want SANDBOX/%s policy p1 v3",
+					got.Mode, got.Status, got.PolicyID, got.PolicyVersion, tt.wantStatus)
+			}
+			if tt.wantErr && got.Error == "" {
+				t.Error("audit event has no error")
+			}
+		})
+	}
+}
@@ -2,15 +2,17 @@ package engine
 
 import (
 	"context"
-	"strings"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
-// UnaryAuthInterceptor проверяет токен в метаданных gRPC вызова
+// UnaryAuthInterceptor проверяет токен агента в метаданных gRPC вызова тем же VerifyToken,
+// что и HTTP-путь: подпись по kid/JWKS, aud и exp, отзыв и правило «только токены агентов».
+// Токен передается в authorization ("Bearer <jwt>") или, для старых клиентов, в x-devai-token.
 func UnaryAuthInterceptor(u *UAGCore) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
@@ -25,21 +27,24 @@ func UnaryAuthInterceptor(u *UAGCore) grpc.UnaryServerInterceptor {
 		}
 
 		// 2. Ищем токен (в gRPC заголовки обычно в нижнем регистре)
-		tokens := md.Get("x-devai-token")
+		tokens := md.Get("authorization")
+		if len(tokens) == 0 {
+			tokens = md.Get("x-devai-token")
+		}
 		if len(tokens) == 0 {
 			return nil, status.Errorf(codes.Unauthenticated, "missing access token")
 		}
 
-		token := tokens[0]
-
-		// 3. Парсим Scopes (та же логика, что и в HTTP)
-		scopes := make(map[string]bool)
-		for _, s := range strings.Split(token, ",") {
-			scopes[strings.TrimSpace(s)] = true
+		// 3. Проверяем токен; scopes и агент берутся только из проверенных claims
+		claims, err := u.VerifyToken(tokens[0])
+		if err != nil {
+			u.logger.Warn("grpc auth failure", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, status.Errorf(codes.Unauthenticated, "invalid access token")
 		}
 
-		// 4. Обогащаем контекст для ProcessAction
-		newCtx := context.WithValue(ctx, "user_scopes", scopes)
+		// 4. Обогащаем контекст для ProcessAction (те же ключи, что у auth.NewMiddleware)
+		newCtx := context.WithValue(ctx, "user_scopes", claims.Scopes)
+		newCtx = context.WithValue(newCtx, "agent_id", claims.AgentID)
 
 		// Идем дальше по цепочке
 		return handler(newCtx, req)
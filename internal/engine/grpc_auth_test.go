@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra/auth"
+	pb "github.com/xela07ax/spaceai-infra-prototype/pkg/api/connector/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestGRPCAuth: gRPC-слушатель проверяет токен так же, как HTTP, и берет агента из claims.
+func TestGRPCAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims *domain.CustomClaims, ttl time.Duration) string {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = auth.KeyID(&key.PublicKey)
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	agentToken := func(ttl time.Duration) string {
+		return sign(&domain.CustomClaims{AgentID: "agent-1", Scopes: map[string]bool{"crm.read": true},
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "agent-1", Audience: jwt.ClaimStrings{domain.AudienceGateway}}}, ttl)
+	}
+
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		reqAgent string
+		wantCode codes.Code
+		wantErr  string // Ошибка пайплайна в ExecuteResponse (вызов дошел до ProcessAction)
+	}{
+		{name: "no token", md: metadata.MD{}, wantCode: codes.Unauthenticated},
+		{name: "scopes instead of token", md: metadata.Pairs("x-devai-token", "admin"), wantCode: codes.Unauthenticated},
+		{
+			name: "console token",
+			md: metadata.Pairs("authorization", "Bearer "+sign(&domain.CustomClaims{UserID: "u1", Role: domain.RoleAdmin,
+				Scopes: map[string]bool{"admin": true}, RegisteredClaims: jwt.RegisteredClaims{Subject: "u1", Audience: jwt.ClaimStrings{domain.AudienceConsole}}}, time.Hour)),
+			reqAgent: "victim-agent",
+			wantCode: codes.Unauthenticated,
+		},
+		{name: "expired agent token", md: metadata.Pairs("authorization", "Bearer "+agentToken(-time.Minute)), wantCode: codes.Unauthenticated},
+		{name: "foreign agent_id", md: metadata.Pairs("authorization", "Bearer "+agentToken(time.Hour)), reqAgent: "victim-agent", wantCode: codes.PermissionDenied},
+		// Scopes берутся из токена: crm.read не дает права на crm.user.delete
+		{name: "agent token", md: metadata.Pairs("authorization", "Bearer "+agentToken(time.Hour)), reqAgent: "agent-1", wantErr: "insufficient permissions"},
+		{name: "legacy header with agent token", md: metadata.Pairs("x-devai-token", agentToken(time.Hour)), wantErr: "insufficient permissions"},
+	}
+
+	uag := NewUAGCore(UAGDeps{
+		Validator: auth.NewBaseValidator(auth.NewKeySet(&key.PublicKey), nil, domain.AudienceGateway),
+		Logger:    zap.NewNop(),
+	})
+	srv := NewGRPCGatewayServer(uag)
+	interceptor := UnaryAuthInterceptor(uag)
+	info := &grpc.UnaryServerInfo{FullMethod: "/connector.v1.ConnectorService/Execute"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.Execute(ctx, req.(*pb.ExecuteRequest))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			req := &pb.ExecuteRequest{CapabilityId: "crm.user.delete"}
+			if tt.reqAgent != "" {
+				req.Metadata = map[string]string{"agent_id": tt.reqAgent}
+			}
+
+			out, err := interceptor(ctx, req, info, handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v (err = %v)", code, tt.wantCode, err)
+			}
+			if tt.wantErr == "" {
+				return
+			}
+			resp := out.(*pb.ExecuteResponse)
+			if resp.StatusCode != 403 || !strings.Contains(resp.ErrorMessage, tt.wantErr) {
+				t.Errorf("response = %d %q, want 403 %q", resp.StatusCode, resp.ErrorMessage, tt.wantErr)
+			}
+		})
+	}
+}
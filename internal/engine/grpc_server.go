@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 
 	pb "github.com/xela07ax/spaceai-infra-prototype/pkg/api/connector/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -21,9 +23,15 @@ func (s *GRPCGatewayServer) Execute(ctx context.Context, req *pb.ExecuteRequest)
 	// 1. Подготавливаем данные (маршалим Struct в JSON байты для ProcessAction)
 	payloadBytes, _ := json.Marshal(req.Payload.AsMap())
 
-	// 2. Извлекаем AgentID из метаданных или самого запроса
-	// В gRPC метаданные передаются через context
-	agentID := req.Metadata["agent_id"]
+	// 2. Агента определяет проверенный токен (UnaryAuthInterceptor). agent_id в metadata
+	// запроса необязателен, но, как и X-Agent-ID в HTTP, не может ему противоречить
+	agentID, _ := ctx.Value("agent_id").(string)
+	if agentID == "" {
+		return nil, status.Error(codes.Unauthenticated, "agent token is required")
+	}
+	if claimed := req.Metadata["agent_id"]; claimed != "" && claimed != agentID {
+		return nil, status.Error(codes.PermissionDenied, "agent_id does not match agent token")
+	}
 
 	// 3. Вызываем единый пайплайн обработки (Тот же, что и для HTTP!)
 	respBytes, err := s.uag.ProcessAction(ctx, agentID, req.CapabilityId, payloadBytes)
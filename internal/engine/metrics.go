@@ -3,6 +3,7 @@ package engine
 import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
 )
 
 type Metrics struct {
@@ -18,8 +19,16 @@ type Metrics struct {
 	// Saturation: состояние Circuit Breaker (0 - ок, 1 - выбило)
 	CircuitBreakerState *prometheus.GaugeVec
 
-	// Audit: заполненность буфера (backpressure)
-	AuditBufferFill prometheus.Gauge
+	// Audit: заполненность буфера (backpressure), по хранилищам (audit.sinks)
+	AuditBufferFill *prometheus.GaugeVec
+
+	// Audit: надежность доставки (спул на диске, повторы, потери), по хранилищам
+	AuditSpoolBytes   *prometheus.GaugeVec
+	AuditSpooled      *prometheus.CounterVec
+	AuditDropped      *prometheus.CounterVec
+	AuditWriteRetries *prometheus.CounterVec
+	AuditReplayed     *prometheus.CounterVec
+	AuditDeadLettered *prometheus.CounterVec
 }
 
 func NewMetrics(reg prometheus.Registerer) *Metrics {
@@ -50,9 +59,52 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 			Help: "Current state of the circuit breaker (0=closed, 1=open).",
 		}, []string{"connector_id"}),
 
-		AuditBufferFill: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		AuditBufferFill: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "uag_audit_buffer_utilization",
 			Help: "Current number of events in audit buffer.",
-		}),
+		}, []string{"sink"}),
+
+		AuditSpoolBytes: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "uag_audit_spool_bytes",
+			Help: "Size of the on-disk audit spool awaiting replay.",
+		}, []string{"sink"}),
+
+		AuditSpooled: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "uag_audit_spooled_total",
+			Help: "Total number of audit events written to the on-disk spool.",
+		}, []string{"sink"}),
+
+		AuditDropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "uag_audit_dropped_total",
+			Help: "Total number of audit events lost (spool disabled, full or unreadable).",
+		}, []string{"sink"}),
+
+		AuditWriteRetries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "uag_audit_write_retries_total",
+			Help: "Total number of retried audit batch writes.",
+		}, []string{"sink"}),
+
+		AuditReplayed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "uag_audit_replayed_total",
+			Help: "Total number of audit events replayed from the spool.",
+		}, []string{"sink"}),
+
+		AuditDeadLettered: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "uag_audit_dead_lettered_total",
+			Help: "Total number of audit events rejected by the sink and moved to the dead-letter file.",
+		}, []string{"sink"}),
+	}
+}
+
+// AuditFS — метрики для AgentFS хранилища sink.
+func (m *Metrics) AuditFS(sink string) audit.AgentFSMetrics {
+	return audit.AgentFSMetrics{
+		BufferFill:   m.AuditBufferFill.WithLabelValues(sink),
+		SpoolBytes:   m.AuditSpoolBytes.WithLabelValues(sink),
+		Spooled:      m.AuditSpooled.WithLabelValues(sink),
+		Dropped:      m.AuditDropped.WithLabelValues(sink),
+		WriteRetries: m.AuditWriteRetries.WithLabelValues(sink),
+		Replayed:     m.AuditReplayed.WithLabelValues(sink),
+		DeadLettered: m.AuditDeadLettered.WithLabelValues(sink),
 	}
 }
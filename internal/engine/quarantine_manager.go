@@ -27,6 +27,7 @@ func NewQuarantineManager(rdb *redis.Client, repo QuarantineProvider, logger *za
 		quarantineCash: make(map[string]bool),
 		repo:           repo,
 		rdb:            rdb,
+		logger:         logger.With(zap.String("mod", "quarantine")),
 	}
 }
 
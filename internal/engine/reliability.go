@@ -56,6 +56,8 @@ func (w *ReliabilityWrapper) Call(ctx context.Context, capID string, payload []b
 		r := retry.New(
 			retry.Context(ctx),
 			retry.Attempts(3),
+			// Отсутствие маршрута — ошибка конфигурации, повтор не поможет
+			retry.RetryIf(func(err error) bool { return !errors.Is(err, connectors.ErrNoRoute) }),
 			// Умный расчет задержки
 			retry.DelayType(func(n uint, err error, config retry.DelayContext) time.Duration {
 				// Если коннектор вернул ThrottleError (например, считал Retry-After заголовок)
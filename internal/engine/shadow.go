@@ -0,0 +1,147 @@
+package engine
+
+/*
+Файл shadow.go реализует Shadow Mode — оценку кандидатного набора политик на реальном трафике.
+
+Запрос исполняется по активной политике, а теневая политика для той же пары агент+способность
+прогоняется через тот же конвейер решения (Decide, контентный риск, бюджеты, порог HITL).
+Если итоговые эффекты различаются, расхождение сохраняется в policy_shadow_divergences.
+Оценка асинхронная и ограничена по параллелизму: она не может ни задержать, ни изменить
+боевое решение.
+*/
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/risk"
+	"go.uber.org/zap"
+)
+
+// ShadowPolicyProvider — источник теневых политик (реализуется MemoEnforcer).
+type ShadowPolicyProvider interface {
+	GetShadowPolicy(agentID, capID string) (domain.Policy, bool)
+}
+
+// DivergenceRecorder — хранилище расхождений.
+type DivergenceRecorder interface {
+	RecordShadowDivergence(ctx context.Context, d *domain.ShadowDivergence) error
+}
+
+// ShadowRequest — снимок запроса и боевого решения, на котором оценивается кандидат.
+type ShadowRequest struct {
+	TraceID      string
+	AgentID      string
+	CapabilityID string
+	LivePolicy   domain.Policy
+	LiveEffect   domain.PolicyEffect // Итоговый эффект с учетом риск-анализа и состояния агента
+	Quarantined  bool                // Агент в карантине — эскалация применяется к обоим решениям
+	Payload      []byte
+}
+
+type ShadowEvaluator struct {
+	policies ShadowPolicyProvider
+	recorder DivergenceRecorder
+	analyzer *risk.Analyzer
+	budgets  *risk.BudgetTracker
+	logger   *zap.Logger
+
+	slots chan struct{} // Ограничение числа одновременных оценок
+}
+
+func NewShadowEvaluator(policies ShadowPolicyProvider, recorder DivergenceRecorder, analyzer *risk.Analyzer, budgets *risk.BudgetTracker, logger *zap.Logger) *ShadowEvaluator {
+	return &ShadowEvaluator{
+		policies: policies,
+		recorder: recorder,
+		analyzer: analyzer,
+		budgets:  budgets,
+		logger:   logger.With(zap.String("mod", "shadow")),
+		slots:    make(chan struct{}, 64),
+	}
+}
+
+// Evaluate запускает оценку теневой политики в фоне. Если кандидата нет, вызов бесплатен.
+// При перегрузке оценка пропускается: теневой режим — аналитика, а не контроль.
+func (s *ShadowEvaluator) Evaluate(req ShadowRequest) {
+	if s == nil {
+		return
+	}
+	shadow, ok := s.policies.GetShadowPolicy(req.AgentID, req.CapabilityID)
+	if !ok {
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.logger.Debug("shadow evaluation skipped: too many in flight", zap.String("agent", req.AgentID))
+		return
+	}
+
+	go func() {
+		defer func() { <-s.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		s.compare(ctx, req, shadow)
+	}()
+}
+
+func (s *ShadowEvaluator) compare(ctx context.Context, req ShadowRequest, shadow domain.Policy) {
+	effect := shadow.Decide()
+	if req.Quarantined {
+		effect = risk.Escalate(effect, domain.EffectQuarantine)
+	}
+
+	assessment := s.analyzer.Assess(shadow, req.Payload)
+	effect = risk.Escalate(effect, assessment.Effect)
+
+	budget := s.budgets.Check(ctx, req.AgentID, req.CapabilityID, shadow, req.Payload)
+	effect = risk.Escalate(effect, budget.Effect)
+
+	if s.analyzer.IsRequired(shadow, req.Payload) {
+		effect = risk.Escalate(effect, domain.EffectQuarantine)
+	}
+
+	if effect == req.LiveEffect {
+		return
+	}
+
+	kind := domain.DivergenceWouldRelax
+	switch {
+	case effect == domain.EffectDeny:
+		kind = domain.DivergenceWouldDeny
+	case risk.Severity(effect) > risk.Severity(req.LiveEffect):
+		kind = domain.DivergenceWouldEscalate
+	}
+
+	d := &domain.ShadowDivergence{
+		ID:             uuid.New().String(),
+		TraceID:        req.TraceID,
+		AgentID:        req.AgentID,
+		CapabilityID:   req.CapabilityID,
+		LivePolicyID:   req.LivePolicy.ID,
+		ShadowPolicyID: shadow.ID,
+		LiveEffect:     req.LiveEffect,
+		ShadowEffect:   effect,
+		Kind:           kind,
+		RiskScore:      assessment.Score,
+		RiskFindings:   append(assessment.Findings, budget.Findings...),
+		CreatedAt:      time.Now(),
+	}
+
+	if err := s.recorder.RecordShadowDivergence(ctx, d); err != nil {
+		s.logger.Error("failed to record shadow divergence", zap.String("agent", req.AgentID), zap.Error(err))
+		return
+	}
+	s.logger.Info("shadow policy divergence",
+		zap.String("agent", req.AgentID),
+		zap.String("cap", req.CapabilityID),
+		zap.String("kind", kind),
+		zap.String("live", string(req.LiveEffect)),
+		zap.String("shadow", string(effect)),
+	)
+}
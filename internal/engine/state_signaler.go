@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"go.uber.org/zap"
+)
+
+// IncidentRepository — требования StateSignaler к хранилищу.
+type IncidentRepository interface {
+	UpdateAgentStatus(ctx context.Context, agentID string, status string) error
+	RecordAgentIncident(ctx context.Context, incident *domain.AgentIncident) error
+}
+
+// StateSignaler реализует risk.AgentStateSignaler.
+// Повторяет контур консоли (AgentService.updateAgentState): Postgres -> Redis Pub/Sub,
+// поэтому автоматическая блокировка неотличима от ручной для всех инстансов шлюза.
+type StateSignaler struct {
+	repo   IncidentRepository
+	rdb    *redis.Client
+	logger *zap.Logger
+}
+
+func NewStateSignaler(rdb *redis.Client, repo IncidentRepository, logger *zap.Logger) *StateSignaler {
+	return &StateSignaler{
+		repo:   repo,
+		rdb:    rdb,
+		logger: logger.With(zap.String("mod", "state-signaler")),
+	}
+}
+
+func (s *StateSignaler) SignalAgentState(ctx context.Context, incident *domain.AgentIncident) error {
+	var channel, signal string
+	switch incident.Action {
+	case domain.StatusBlocked:
+		channel, signal = infra.RedisChanKillSwitch, "true"
+	case domain.StatusQuarantine:
+		channel, signal = infra.RedisChanQuarantine, "on"
+	default:
+		return fmt.Errorf("state-signaler: unsupported action %q", incident.Action)
+	}
+
+	if incident.ID == "" {
+		incident.ID = uuid.New().String()
+	}
+
+	// 1. Доказательства фиксируем первыми: даже если статус не обновится, инцидент останется для разбора
+	if err := s.repo.RecordAgentIncident(ctx, incident); err != nil {
+		return fmt.Errorf("state-signaler: failed to record incident: %w", err)
+	}
+
+	// 2. Persistence Layer (источник правды для прогрева кэшей)
+	if err := s.repo.UpdateAgentStatus(ctx, incident.AgentID, string(incident.Action)); err != nil {
+		return fmt.Errorf("state-signaler: database error: %w", err)
+	}
+
+	// 3. Real-time Signaling — тот же формат "agent_id:status", что и у консоли
+	payload := fmt.Sprintf("%s:%s", incident.AgentID, signal)
+	if err := s.rdb.Publish(ctx, channel, payload).Err(); err != nil {
+		s.logger.Warn("runtime signal delivery failed", zap.String("channel", channel), zap.Error(err))
+		return nil
+	}
+
+	s.logger.Info("agent state changed by risk analyzer",
+		zap.String("agent_id", incident.AgentID),
+		zap.String("incident_id", incident.ID),
+		zap.String("new_status", string(incident.Action)),
+		zap.Int("score", incident.Score))
+	return nil
+}
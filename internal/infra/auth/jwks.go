@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// jwksMinRefresh — не чаще одного внепланового запроса JWKS при неизвестном kid,
+// чтобы поток токенов с мусорным kid не превратился в DoS консоли.
+const jwksMinRefresh = 30 * time.Second
+
+// JWKSClient — набор ключей шлюза, синхронизируемый с JWKS консоли.
+// При неизвестном kid (консоль только что сменила ключ) набор обновляется вне очереди.
+type JWKSClient struct {
+	*KeySet
+	url    string
+	client *http.Client
+	logger *zap.Logger
+
+	fetchMu   sync.Mutex
+	lastFetch time.Time
+}
+
+// JWKSOptions — адрес JWKS консоли и параметры соединения.
+type JWKSOptions struct {
+	URL string
+	// CA консоли и клиентский сертификат (mTLS); nil — системные корневые сертификаты
+	TLS *tls.Config
+	// Разрешить http:// — только для разработки: по открытому каналу ключи проверки можно подменить
+	AllowHTTP bool
+	Timeout   time.Duration // По умолчанию 5s
+}
+
+// NewJWKSClient создает клиента. seed — ключи, которыми можно проверять токены,
+// пока первая загрузка JWKS не удалась (например, public_key_path из конфига).
+func NewJWKSClient(opts JWKSOptions, logger *zap.Logger, seed ...*rsa.PublicKey) (*JWKSClient, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("jwks: invalid url %q", opts.URL)
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && opts.AllowHTTP:
+		logger.Warn("jwks is fetched over plain http, use only for development", zap.String("url", opts.URL))
+	case u.Scheme == "http":
+		return nil, fmt.Errorf("jwks: %s is not https (auth.jwks_allow_http is for development only)", opts.URL)
+	default:
+		return nil, fmt.Errorf("jwks: unsupported url scheme %q", u.Scheme)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLS != nil {
+		transport.TLSClientConfig = opts.TLS
+	}
+	return &JWKSClient{
+		KeySet: NewKeySet(seed...),
+		url:    opts.URL,
+		client: &http.Client{Timeout: opts.Timeout, Transport: transport},
+		logger: logger.Named("jwks"),
+	}, nil
+}
+
+// PublicKey перекрывает KeySet: при промахе по kid пробует обновить набор.
+func (c *JWKSClient) PublicKey(kid string) (*rsa.PublicKey, error) {
+	key, err := c.KeySet.PublicKey(kid)
+	if err == nil || kid == "" {
+		return key, err
+	}
+
+	c.fetchMu.Lock()
+	stale := time.Since(c.lastFetch) >= jwksMinRefresh
+	c.fetchMu.Unlock()
+	if !stale {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if ferr := c.Fetch(ctx); ferr != nil {
+		c.logger.Warn("jwks refresh on unknown kid failed", zap.String("kid", kid), zap.Error(ferr))
+		return nil, err
+	}
+	return c.KeySet.PublicKey(kid)
+}
+
+// Fetch загружает JWKS и заменяет набор целиком: ключ, убранный из JWKS консоли, перестает приниматься.
+func (c *JWKSClient) Fetch(ctx context.Context) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	c.lastFetch = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("jwks: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return fmt.Errorf("jwks: invalid document: %w", err)
+	}
+	keys, err := set.PublicKeys()
+	if err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	c.Replace(keys)
+	c.logger.Debug("jwks refreshed", zap.Int("keys", len(keys)))
+	return nil
+}
+
+// Start периодически обновляет набор ключей до отмены ctx.
+func (c *JWKSClient) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Fetch(ctx); err != nil {
+				c.logger.Error("jwks refresh failed", zap.Error(err))
+			}
+		}
+	}
+}
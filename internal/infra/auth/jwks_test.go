@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// jwksServer отдает набор ключей, который тест может подменить (ротация на консоли).
+type jwksServer struct {
+	mu   sync.Mutex
+	keys []*rsa.PublicKey
+	hits int
+}
+
+func (s *jwksServer) set(keys ...*rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hits++
+	json.NewEncoder(w).Encode(NewKeySet(s.keys...).JWKS())
+}
+
+func TestNewJWKSClientURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		allowHTTP bool
+		wantErr   string
+	}{
+		{name: "https", url: "https://console:8000/.well-known/jwks.json"},
+		{name: "http refused", url: "http://console:8000/.well-known/jwks.json", wantErr: "not https"},
+		{name: "http in development", url: "http://localhost:8000/.well-known/jwks.json", allowHTTP: true},
+		{name: "other scheme", url: "ftp://console/jwks.json", allowHTTP: true, wantErr: "scheme"},
+		{name: "no host", url: "https:///jwks.json", wantErr: "invalid url"},
+		{name: "garbage", url: "://", wantErr: "invalid url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWKSClient(JWKSOptions{URL: tt.url, AllowHTTP: tt.allowHTTP}, zap.NewNop())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewJWKSClient() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewJWKSClient() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKSClientTLS(t *testing.T) {
+	key := testKey(t)
+	keys := &jwksServer{}
+	keys.set(&key.PublicKey)
+	srv := httptest.NewUnstartedServer(keys)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // Отказы рукопожатия ожидаемы
+	srv.StartTLS()
+	defer srv.Close()
+
+	consoleCA := x509.NewCertPool()
+	consoleCA.AddCert(srv.Certificate())
+
+	tests := []struct {
+		name    string
+		tls     *tls.Config
+		wantErr bool
+	}{
+		{name: "console CA", tls: &tls.Config{RootCAs: consoleCA}},
+		{name: "system roots reject private CA", wantErr: true},
+		{name: "foreign CA", tls: &tls.Config{RootCAs: x509.NewCertPool()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewJWKSClient(JWKSOptions{URL: srv.URL, TLS: tt.tls}, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.Fetch(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && c.Len() != 1 {
+				t.Errorf("keys = %d, want 1", c.Len())
+			}
+		})
+	}
+}
+
+func TestJWKSClientRotation(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	oldKid, newKid := KeyID(&oldKey.PublicKey), KeyID(&newKey.PublicKey)
+
+	keys := &jwksServer{}
+	keys.set(&oldKey.PublicKey)
+	srv := httptest.NewServer(keys)
+	defer srv.Close()
+
+	c, err := NewJWKSClient(JWKSOptions{URL: srv.URL, AllowHTTP: true}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		serve    []*rsa.PublicKey // Набор консоли перед шагом (nil — без изменений)
+		fetch    bool             // Плановое обновление перед проверкой
+		kid      string
+		wantErr  bool
+		wantHits int
+	}{
+		// Первая проверка с незнакомым kid загружает набор вне очереди
+		{name: "unknown kid triggers fetch", kid: oldKid, wantHits: 1},
+		// Консоль выпустила новый ключ, но внеочередной запрос уже был меньше jwksMinRefresh назад
+		{name: "refresh is rate limited", serve: []*rsa.PublicKey{&newKey.PublicKey, &oldKey.PublicKey}, kid: newKid, wantErr: true, wantHits: 1},
+		{name: "scheduled refresh picks up new key", fetch: true, kid: newKid, wantHits: 2},
+		{name: "previous key still published", kid: oldKid, wantHits: 2},
+		{name: "retired key is rejected", serve: []*rsa.PublicKey{&newKey.PublicKey}, fetch: true, kid: oldKid, wantErr: true, wantHits: 3},
+		// Токен без kid проверяется текущим ключом набора, без запроса к консоли
+		{name: "empty kid uses current key", kid: "", wantHits: 3},
+	}
+	for _, st := range steps {
+		if st.serve != nil {
+			keys.set(st.serve...)
+		}
+		if st.fetch {
+			if err := c.Fetch(context.Background()); err != nil {
+				t.Fatalf("%s: Fetch() error = %v", st.name, err)
+			}
+		}
+		_, err := c.PublicKey(st.kid)
+		if (err != nil) != st.wantErr {
+			t.Fatalf("%s: PublicKey(%q) error = %v, wantErr %v", st.name, st.kid, err, st.wantErr)
+		}
+		keys.mu.Lock()
+		hits := keys.hits
+		keys.mu.Unlock()
+		if hits != st.wantHits {
+			t.Fatalf("%s: jwks requests = %d, want %d", st.name, hits, st.wantHits)
+		}
+	}
+}
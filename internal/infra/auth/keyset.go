@@ -0,0 +1,173 @@
+package auth
+
+/*
+Файл keyset.go реализует набор открытых ключей для проверки RS256 с ротацией по kid.
+
+Консоль подписывает токены текущим ключом и ставит в заголовок kid — отпечаток ключа
+по RFC 7638. Прежние ключи остаются в наборе (auth.previous_public_key_paths), пока не истекут
+выпущенные ими токены, и публикуются вместе с текущим в JWKS (/.well-known/jwks.json).
+Шлюзы забирают JWKS и периодически его обновляют (JWKSClient), поэтому смена ключа
+не требует перезапуска шлюзов.
+*/
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// KeyProvider выдает открытый ключ по kid из заголовка токена.
+type KeyProvider interface {
+	PublicKey(kid string) (*rsa.PublicKey, error)
+}
+
+// ErrUnknownKey — токен подписан ключом, которого нет в наборе.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet — потокобезопасный набор ключей. Первый ключ — ключ по умолчанию: им проверяются
+// токены без kid, выпущенные до появления ротации.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+	ids  []string // Порядок публикации в JWKS, первый — ключ по умолчанию
+}
+
+func NewKeySet(keys ...*rsa.PublicKey) *KeySet {
+	s := &KeySet{}
+	s.Replace(keys)
+	return s
+}
+
+// PublicKey реализует KeyProvider.
+func (s *KeySet) PublicKey(kid string) (*rsa.PublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" {
+		if len(s.ids) == 0 {
+			return nil, ErrUnknownKey
+		}
+		kid = s.ids[0]
+	}
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// Replace атомарно заменяет набор (дубликаты отбрасываются).
+func (s *KeySet) Replace(keys []*rsa.PublicKey) {
+	m := make(map[string]*rsa.PublicKey, len(keys))
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k == nil {
+			continue
+		}
+		kid := KeyID(k)
+		if _, dup := m[kid]; dup {
+			continue
+		}
+		m[kid] = k
+		ids = append(ids, kid)
+	}
+
+	s.mu.Lock()
+	s.keys, s.ids = m, ids
+	s.mu.Unlock()
+}
+
+// Len возвращает число ключей в наборе.
+func (s *KeySet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ids)
+}
+
+// JWKS возвращает набор в формате RFC 7517 для публикации.
+func (s *KeySet) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(s.ids))}
+	for _, kid := range s.ids {
+		set.Keys = append(set.Keys, NewJWK(s.keys[kid]))
+	}
+	return set
+}
+
+// JWK — открытый RSA-ключ (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS — набор ключей, который консоль отдает на /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewJWK(k *rsa.PublicKey) JWK {
+	n, e := encodeRSA(k)
+	return JWK{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: KeyID(k), N: n, E: e}
+}
+
+// PublicKeys разбирает набор. Ключи не RSA или не для подписи пропускаются;
+// kid пересчитывается по самому ключу, чтобы подмена kid в JWKS ничего не давала.
+func (set JWKS) PublicKeys() ([]*rsa.PublicKey, error) {
+	keys := make([]*rsa.PublicKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no RSA signing keys")
+	}
+	return keys, nil
+}
+
+// PublicKey разбирает RSA-ключ из JWK.
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("jwk %q: invalid n: %w", k.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("jwk %q: invalid e: %w", k.Kid, err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("jwk %q: invalid exponent", k.Kid)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+// KeyID — отпечаток ключа по RFC 7638 (SHA-256 канонического JWK), используется как kid.
+func KeyID(k *rsa.PublicKey) string {
+	n, e := encodeRSA(k)
+	// Порядок полей канонический (лексикографический), поэтому json.Marshal от map подходит
+	canonical, _ := json.Marshal(map[string]string{"e": e, "kty": "RSA", "n": n})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeRSA(k *rsa.PublicKey) (n, e string) {
+	return base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+}
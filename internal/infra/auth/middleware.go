@@ -32,6 +32,11 @@ func NewMiddleware(v TokenValidator, logger *zap.Logger) func(http.Handler) http
 			// Прокидываем данные в контекст
 			ctx := context.WithValue(r.Context(), "user_scopes", claims.Scopes)
 			ctx = context.WithValue(ctx, "user_id", claims.UserID)
+			ctx = context.WithValue(ctx, "user_role", claims.Role)
+			if claims.IsAgent() {
+				// Токен агента (Client Credentials) удостоверяет, КТО делает запрос
+				ctx = context.WithValue(ctx, "agent_id", claims.AgentID)
+			}
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -0,0 +1,291 @@
+package auth
+
+/*
+Файл oidc.go реализует клиента OIDC-провайдера для входа операторов в консоль
+(Authorization Code Flow с PKCE, RFC 7636).
+
+Консоль не доверяет токенам IdP дальше входа: id_token проверяется (подпись по JWKS
+провайдера, iss, aud, exp, nonce), из него берутся subject, имя и группы, а затем
+консоль выдает собственный RS256-токен. Шлюзы и остальной API про IdP ничего не знают.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"go.uber.org/zap"
+)
+
+// oidcDiscoveryTTL — как долго кэшируется документ discovery провайдера.
+const oidcDiscoveryTTL = time.Hour
+
+// OIDCIdentity — проверенные данные пользователя из id_token.
+type OIDCIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider — клиент одного OIDC-провайдера: discovery, обмен кода и проверка id_token.
+type OIDCProvider struct {
+	cfg    infra.OIDCConfig
+	client *http.Client
+	logger *zap.Logger
+
+	mu          sync.Mutex
+	meta        *oidcMetadata
+	metaFetched time.Time
+	// Ключи IdP индексируются его собственными kid (не отпечатками, как в KeySet)
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+func NewOIDCProvider(cfg infra.OIDCConfig, logger *zap.Logger) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger.Named("oidc"),
+	}
+}
+
+// AuthCodeURL возвращает адрес страницы входа IdP для редиректа браузера.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {PKCEChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на токены и возвращает проверенную личность из id_token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic (RFC 6749, раздел 2.3.1): значения кодируются как form-urlencoded
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("oidc: invalid token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token endpoint returned %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+	return p.verifyIDToken(ctx, meta, body.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, meta *oidcMetadata, raw, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: invalid id_token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("oidc: id_token nonce mismatch")
+	}
+
+	id := &OIDCIdentity{Issuer: meta.Issuer}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	id.Username, _ = claims[p.cfg.UsernameClaim].(string)
+	if id.Subject == "" {
+		return nil, errors.New("oidc: id_token has no subject")
+	}
+
+	// Группы приходят массивом или одной строкой (зависит от IdP)
+	switch g := claims[p.cfg.GroupsClaim].(type) {
+	case []interface{}:
+		for _, v := range g {
+			if s, ok := v.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = []string{g}
+	}
+	return id, nil
+}
+
+// metadata возвращает документ discovery, загружая его при первом обращении и раз в час.
+func (p *OIDCProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.metaFetched) < oidcDiscoveryTTL {
+		return p.meta, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var meta oidcMetadata
+	if err := p.getJSON(ctx, discoveryURL, &meta); err != nil {
+		if p.meta != nil {
+			p.logger.Warn("oidc discovery refresh failed, using cached document", zap.Error(err))
+			return p.meta, nil
+		}
+		return nil, err
+	}
+	// Защита от подмены: провайдер обязан назвать себя тем же issuer (OIDC Discovery, раздел 4.3)
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.cfg.IssuerURL, "/") {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", meta.Issuer, p.cfg.IssuerURL)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is incomplete")
+	}
+	p.meta, p.metaFetched = &meta, time.Now()
+	return p.meta, nil
+}
+
+// publicKey ищет ключ IdP по kid; при промахе (IdP сменил ключ) перечитывает JWKS не чаще jwksMinRefresh.
+func (p *OIDCProvider) publicKey(ctx context.Context, meta *oidcMetadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksMinRefresh {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+	p.keysFetched = time.Now()
+
+	var set JWKS
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("oidc: %w", err)
+		}
+		keys[k.Kid] = key
+	}
+	p.keys = keys
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+}
+
+// lookupKey: без kid допускается только единственный ключ в наборе.
+func (p *OIDCProvider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, u string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oidc: request %s failed: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned %d", u, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst); err != nil {
+		return fmt.Errorf("oidc: invalid document %s: %w", u, err)
+	}
+	return nil
+}
+
+// RandomToken возвращает случайную строку для state, nonce и PKCE verifier (256 бит).
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// PKCEChallenge вычисляет code_challenge по методу S256.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
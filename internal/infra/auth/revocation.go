@@ -0,0 +1,94 @@
+package auth
+
+/*
+Файл revocation.go реализует список отзыва токенов в Redis.
+
+Отзыв бывает двух видов:
+- по jti — конкретный токен (утечка из логов, скомпрометированная сессия);
+- по subject — все токены пользователя или агента, выпущенные ДО момента отзыва
+  (блокировка агента, отзыв секретов). Новые токены после этого снова действуют.
+
+Записи живут не дольше самого долгого токена, поэтому список не растет бесконечно.
+Проверка выполняется в VerifyToken одним MGET; консоль и все шлюзы видят отзыв сразу.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+)
+
+// RevocationChecker проверяет, не отозван ли токен.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *domain.CustomClaims) (bool, error)
+}
+
+// ErrTokenRevoked — токен отозван до истечения срока.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+type RevocationList struct {
+	rdb *redis.Client
+	// maxTokenTTL — срок хранения отзыва по subject: к его окончанию все более ранние токены истекли
+	maxTokenTTL time.Duration
+	// failOpen — пропускать токены, если Redis недоступен (по умолчанию запрещаем: Zero Trust)
+	failOpen bool
+}
+
+func NewRevocationList(rdb *redis.Client, maxTokenTTL time.Duration, failOpen bool) *RevocationList {
+	return &RevocationList{rdb: rdb, maxTokenTTL: maxTokenTTL, failOpen: failOpen}
+}
+
+// RevokeToken отзывает токен по jti. expiresAt — срок токена (нулевое значение — maxTokenTTL).
+func (l *RevocationList) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("jti is required")
+	}
+	ttl := l.maxTokenTTL
+	if !expiresAt.IsZero() {
+		ttl = time.Until(expiresAt)
+	}
+	if ttl <= 0 {
+		return nil // Токен уже истек сам
+	}
+	return l.rdb.Set(ctx, infra.RedisKeyRevokedTokenPrefix+jti, 1, ttl).Err()
+}
+
+// RevokeSubject отзывает все токены пользователя или агента, выпущенные до текущего момента.
+func (l *RevocationList) RevokeSubject(ctx context.Context, subject string) error {
+	if subject == "" {
+		return errors.New("subject is required")
+	}
+	return l.rdb.Set(ctx, infra.RedisKeyRevokedSubjectPrefix+subject, time.Now().Unix(), l.maxTokenTTL).Err()
+}
+
+// IsRevoked реализует RevocationChecker.
+func (l *RevocationList) IsRevoked(ctx context.Context, claims *domain.CustomClaims) (bool, error) {
+	vals, err := l.rdb.MGet(ctx,
+		infra.RedisKeyRevokedTokenPrefix+claims.ID,
+		infra.RedisKeyRevokedSubjectPrefix+claims.Subject,
+	).Result()
+	if err != nil {
+		if l.failOpen {
+			return false, nil
+		}
+		return false, fmt.Errorf("revocation check failed: %w", err)
+	}
+
+	if claims.ID != "" && vals[0] != nil {
+		return true, nil
+	}
+	if s, ok := vals[1].(string); ok && claims.IssuedAt != nil {
+		revokedAt, err := strconv.ParseInt(s, 10, 64)
+		// iat хранится с точностью до секунды: токен, выпущенный в ту же секунду, тоже считается отозванным
+		if err == nil && claims.IssuedAt.Unix() <= revokedAt {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,21 +1,29 @@
 package auth
 
 import (
+	"context"
 	"crypto/rsa"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 )
 
-// BaseValidator содержит общую логику проверки RS256
+// revocationTimeout — бюджет проверки списка отзыва в Hot Path.
+const revocationTimeout = 200 * time.Millisecond
+
+// BaseValidator содержит общую логику проверки RS256: ключ выбирается по kid,
+// обязательны aud получателя и exp, после проверки подписи токен сверяется со списком отзыва.
 type BaseValidator struct {
-	publicKey *rsa.PublicKey
+	keys     KeyProvider
+	revoked  RevocationChecker // nil — отзыв не проверяется
+	audience string            // domain.AudienceConsole или domain.AudienceGateway
 }
 
-func NewBaseValidator(pubKey *rsa.PublicKey) *BaseValidator {
-	return &BaseValidator{publicKey: pubKey}
+func NewBaseValidator(keys KeyProvider, revoked RevocationChecker, audience string) *BaseValidator {
+	return &BaseValidator{keys: keys, revoked: revoked, audience: audience}
 }
 
 // VerifyToken реализует интерфейс auth.TokenValidator.
@@ -28,8 +36,19 @@ func (v *BaseValidator) VerifyToken(tokenStr string) (*domain.CustomClaims, erro
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return v.publicKey, nil
-	})
+		// Тем же ключом консоль подписывает не только токены (например, контрольные точки аудита
+		// с typ audit-checkpoint+jwt): принимаем только typ токена доступа
+		if typ, ok := token.Header["typ"]; ok && typ != "JWT" {
+			return nil, fmt.Errorf("unexpected token type: %v", typ)
+		}
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.PublicKey(kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		// Тем же ключом подписаны токены другой аудитории: без проверки aud токен консоли прошел бы шлюз
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil || !token.Valid {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -40,6 +59,18 @@ func (v *BaseValidator) VerifyToken(tokenStr string) (*domain.CustomClaims, erro
 		return nil, fmt.Errorf("invalid claims")
 	}
 
+	if v.revoked != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), revocationTimeout)
+		defer cancel()
+		revoked, err := v.revoked.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
 	return claims, nil
 }
 
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+type stubRevocations struct{ revoked bool }
+
+func (s stubRevocations) IsRevoked(context.Context, *domain.CustomClaims) (bool, error) {
+	return s.revoked, nil
+}
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, claims *domain.CustomClaims, header map[string]any) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = KeyID(&key.PublicKey)
+	for k, v := range header {
+		tok.Header[k] = v
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBaseValidatorVerifyToken(t *testing.T) {
+	key := testKey(t)
+	other := testKey(t)
+	exp := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+	agentClaims := func() *domain.CustomClaims {
+		return &domain.CustomClaims{
+			AgentID: "agent-1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "agent-1",
+				Audience:  jwt.ClaimStrings{domain.AudienceGateway},
+				ExpiresAt: exp,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     *rsa.PrivateKey
+		claims  func() *domain.CustomClaims
+		header  map[string]any
+		revoked bool
+		wantErr bool
+	}{
+		{name: "valid", key: key, claims: agentClaims},
+		{name: "bearer prefix", key: key, claims: agentClaims},
+		{name: "wrong audience", key: key, wantErr: true, claims: func() *domain.CustomClaims {
+			c := agentClaims()
+			c.Audience = jwt.ClaimStrings{domain.AudienceConsole}
+			return c
+		}},
+		{name: "missing audience", key: key, wantErr: true, claims: func() *domain.CustomClaims {
+			c := agentClaims()
+			c.Audience = nil
+			return c
+		}},
+		{name: "missing exp", key: key, wantErr: true, claims: func() *domain.CustomClaims {
+			c := agentClaims()
+			c.ExpiresAt = nil
+			return c
+		}},
+		{name: "expired", key: key, wantErr: true, claims: func() *domain.CustomClaims {
+			c := agentClaims()
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return c
+		}},
+		{name: "unknown key", key: other, claims: agentClaims, wantErr: true},
+		{name: "checkpoint typ", key: key, claims: agentClaims, header: map[string]any{"typ": "audit-checkpoint+jwt"}, wantErr: true},
+		{name: "revoked", key: key, claims: agentClaims, revoked: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewBaseValidator(NewKeySet(&key.PublicKey), stubRevocations{revoked: tt.revoked}, domain.AudienceGateway)
+			tok := signTestToken(t, tt.key, tt.claims(), tt.header)
+			if tt.name == "bearer prefix" {
+				tok = "Bearer " + tok
+			}
+			claims, err := v.VerifyToken(tok)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.revoked && !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("VerifyToken() error = %v, want ErrTokenRevoked", err)
+			}
+			if err == nil && claims.AgentID != "agent-1" {
+				t.Errorf("AgentID = %q, want agent-1", claims.AgentID)
+			}
+		})
+	}
+}
+
+func TestBaseValidatorRejectsOtherAlgorithms(t *testing.T) {
+	key := testKey(t)
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS512, &domain.CustomClaims{
+		AgentID: "agent-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{domain.AudienceGateway},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewBaseValidator(NewKeySet(&key.PublicKey), nil, domain.AudienceGateway)
+	if _, err := v.VerifyToken(s); err == nil {
+		t.Fatal("RS512 token accepted, want only RS256")
+	}
+}
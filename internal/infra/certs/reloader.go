@@ -0,0 +1,156 @@
+package certs
+
+/*
+Файл reloader.go реализует перечитывание сертификатов с диска без перезапуска процесса.
+
+Сертификаты в проде выпускаются на дни или часы (cert-manager, Vault PKI, SPIFFE)
+и подменяются на диске. Reloader периодически сверяет время изменения файлов и
+атомарно подменяет сертификат и пул CA; новые TLS-рукопожатия сразу используют
+новые файлы, установленные соединения не разрываются. Если новые файлы не читаются
+(например, ротатор успел записать только ключ), остается прежняя пара.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reloader хранит актуальную пару сертификат/ключ и пул доверенных CA.
+// Любой из файлов может быть пустым: без пары нет своего сертификата, без CA — пул nil.
+type Reloader struct {
+	certFile, keyFile, caFile string
+	logger                    *zap.Logger
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	mtimes map[string]time.Time
+}
+
+// NewReloader загружает файлы. Ошибка первой загрузки фатальна: без сертификата слушатель
+// не должен молча стартовать в открытом виде.
+func NewReloader(certFile, keyFile, caFile string, logger *zap.Logger) (*Reloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("certs: cert_file and key_file must be set together")
+	}
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		logger:   logger.Named("certs"),
+		mtimes:   make(map[string]time.Time),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Certificate возвращает текущую пару (nil, если сертификат не настроен).
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// CertPool возвращает текущий пул CA (nil — не настроен).
+func (r *Reloader) CertPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// Reload перечитывает файлы, если хотя бы один изменился. Возвращает true, если набор обновлен.
+func (r *Reloader) Reload() (bool, error) {
+	mtimes, changed, err := r.stat()
+	if err != nil || !changed {
+		return false, err
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return false, fmt.Errorf("certs: failed to load key pair: %w", err)
+		}
+		if c.Leaf == nil && len(c.Certificate) > 0 {
+			c.Leaf, _ = x509.ParseCertificate(c.Certificate[0])
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return false, fmt.Errorf("certs: failed to read CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("certs: no certificates in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.pool, r.mtimes = cert, pool, mtimes
+	r.mu.Unlock()
+
+	if cert != nil && cert.Leaf != nil {
+		r.logger.Info("certificates loaded",
+			zap.String("subject", cert.Leaf.Subject.String()),
+			zap.Time("not_after", cert.Leaf.NotAfter))
+	}
+	return true, nil
+}
+
+// Start проверяет файлы с заданным интервалом до отмены ctx.
+func (r *Reloader) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reload(); err != nil {
+				r.logger.Error("certificate reload failed, keeping previous", zap.Error(err))
+			}
+		}
+	}
+}
+
+// stat сравнивает время изменения файлов с последней успешной загрузкой.
+func (r *Reloader) stat() (map[string]time.Time, bool, error) {
+	r.mu.RLock()
+	prev := r.mtimes
+	r.mu.RUnlock()
+
+	mtimes := make(map[string]time.Time, 3)
+	changed := false
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, false, fmt.Errorf("certs: %w", err)
+		}
+		mtimes[f] = fi.ModTime()
+		if !fi.ModTime().Equal(prev[f]) {
+			changed = true
+		}
+	}
+	return mtimes, changed || len(prev) == 0, nil
+}
@@ -0,0 +1,180 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"go.uber.org/zap"
+)
+
+// ALPN слушателей: gRPC работает только поверх HTTP/2
+var (
+	ProtosHTTP = []string{"h2", "http/1.1"}
+	ProtosGRPC = []string{"h2"}
+)
+
+// ErrPeerNotPinned — сертификат коннектора валиден, но не совпал с пиннингом маршрута.
+var ErrPeerNotPinned = errors.New("peer certificate does not match pinned identity")
+
+// NewServerTLS строит tls.Config слушателя по секции server.tls. Сертификат и пул CA клиентов
+// берутся из Reloader при каждом рукопожатии, поэтому ротация файлов не требует рестарта.
+func NewServerTLS(c infra.ServerTLSConfig, r *Reloader, nextProtos []string) (*tls.Config, error) {
+	if r.Certificate() == nil {
+		return nil, errors.New("tls: server certificate is required")
+	}
+	minVersion, err := parseVersion(c.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := parseClientAuth(c.ClientAuth, c.ClientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:   minVersion,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*r.Certificate()},
+				ClientCAs:    r.CertPool(),
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}, nil
+}
+
+// PeerPolicy — ожидаемая личность сервера на исходящем соединении.
+type PeerPolicy struct {
+	ServerName string   // Имя (или IP) для проверки цепочки
+	SANs       []string // DNS или URI SAN, один из которых обязан быть в сертификате
+	SPKIPins   []string // base64(SHA-256(SubjectPublicKeyInfo)), один из которых обязан совпасть
+}
+
+// NewClientTLS строит tls.Config исходящего соединения. Цепочка проверяется вручную
+// в VerifyConnection по текущему пулу CA из Reloader (стандартная проверка не умеет
+// подменять RootCAs на лету), затем проверяется пиннинг маршрута. Пустой peer.ServerName —
+// имя берется из рукопожатия (клиент подставляет хост, к которому подключается).
+func NewClientTLS(r *Reloader, peer PeerPolicy, logger *zap.Logger) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: peer.ServerName,
+		// Не отключает проверку: она выполняется в VerifyConnection ниже
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if c := r.Certificate(); c != nil {
+				return c, nil
+			}
+			return &tls.Certificate{}, nil // Сервер решит сам, допускает ли он клиента без сертификата
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			policy := peer
+			if policy.ServerName == "" {
+				policy.ServerName = cs.ServerName
+			}
+			err := VerifyPeer(cs.PeerCertificates, r.CertPool(), policy)
+			if err != nil {
+				logger.Warn("connector tls verification failed", zap.String("server_name", policy.ServerName), zap.Error(err))
+			}
+			return err
+		},
+	}
+}
+
+// VerifyPeer проверяет цепочку сертификатов сервера (roots nil — системные CA) и пиннинг.
+func VerifyPeer(chain []*x509.Certificate, roots *x509.CertPool, peer PeerPolicy) error {
+	if len(chain) == 0 {
+		return errors.New("tls: peer presented no certificate")
+	}
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       peer.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	}); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+
+	if len(peer.SANs) > 0 {
+		names := slices.Clone(leaf.DNSNames)
+		for _, u := range leaf.URIs {
+			names = append(names, u.String())
+		}
+		for _, ip := range leaf.IPAddresses {
+			names = append(names, ip.String())
+		}
+		if !slices.ContainsFunc(peer.SANs, func(want string) bool { return slices.Contains(names, want) }) {
+			return fmt.Errorf("%w: SAN %v not in %v", ErrPeerNotPinned, names, peer.SANs)
+		}
+	}
+	if len(peer.SPKIPins) > 0 {
+		pin := SPKIPin(leaf)
+		if !slices.Contains(peer.SPKIPins, pin) {
+			return fmt.Errorf("%w: spki %s", ErrPeerNotPinned, pin)
+		}
+	}
+	return nil
+}
+
+// SPKIPin — отпечаток открытого ключа сертификата для pinned_spki:
+// base64(SHA-256(SubjectPublicKeyInfo)), как в HPKP.
+func SPKIPin(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// HostFromAddress возвращает хост из "host:port" (для ServerName по умолчанию).
+func HostFromAddress(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func parseVersion(v string) (uint16, error) {
+	switch strings.TrimSpace(v) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("tls: unsupported min_version %q (use 1.2 or 1.3)", v)
+}
+
+func parseClientAuth(mode string, hasCA bool) (tls.ClientAuthType, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "":
+		if hasCA {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	case "require":
+		if !hasCA {
+			return 0, errors.New("tls: client_auth=require needs client_ca_file")
+		}
+		return tls.RequireAndVerifyClientCert, nil
+	case "verify_if_given":
+		if !hasCA {
+			return 0, errors.New("tls: client_auth=verify_if_given needs client_ca_file")
+		}
+		return tls.VerifyClientCertIfGiven, nil
+	case "none":
+		return tls.NoClientCert, nil
+	}
+	return 0, fmt.Errorf("tls: unsupported client_auth %q", mode)
+}
@@ -17,6 +17,7 @@ type Config struct {
 	Redis    RedisConfig    `mapstructure:"redis"`
 	Auth     AuthConfig     `mapstructure:"auth"`
 	Engine   EngineConfig   `mapstructure:"engine"`
+	Audit    AuditConfig    `mapstructure:"audit"`
 	Logger   LoggerConfig   `mapstructure:"logger"`
 }
 
@@ -26,6 +27,21 @@ type ServerConfig struct {
 	Port         int           `mapstructure:"port"`
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+
+	// TLS/mTLS входящих соединений (HTTP и gRPC шлюза, HTTP консоли)
+	TLS ServerTLSConfig `mapstructure:"tls"`
+}
+
+// ServerTLSConfig — TLS слушателей. Сертификаты перечитываются с диска без перезапуска.
+type ServerTLSConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"` // Задан — включается mTLS
+	// Проверка клиентского сертификата: require (по умолчанию при client_ca_file) | verify_if_given | none
+	ClientAuth     string        `mapstructure:"client_auth"`
+	MinVersion     string        `mapstructure:"min_version"`     // "1.2" | "1.3"
+	ReloadInterval time.Duration `mapstructure:"reload_interval"` // Как часто проверять файлы сертификатов
 }
 
 // DatabaseConfig описывает подключение к PostgreSQL.
@@ -46,21 +62,315 @@ type RedisConfig struct {
 type AuthConfig struct {
 	PublicKeyPath  string        `mapstructure:"public_key_path"`
 	PrivateKeyPath string        `mapstructure:"private_key_path"` // Только для Console API
-	TokenTTL       time.Duration `mapstructure:"token_ttl"`
+	TokenTTL       time.Duration `mapstructure:"token_ttl"`        // Токены пользователей консоли
 	BcryptCost     int           `mapstructure:"bcrypt_cost"`
 	PublicKey      []byte
 	PrivateKey     []byte
+
+	// Ротация ключей: прежние открытые ключи публикуются в JWKS консоли, пока живут их токены
+	PreviousPublicKeyPaths []string `mapstructure:"previous_public_key_paths"`
+	PreviousPublicKeys     [][]byte
+	// Шлюз: JWKS консоли вместо (или в дополнение к) public_key_path
+	JWKSURL             string        `mapstructure:"jwks_url"`
+	JWKSRefreshInterval time.Duration `mapstructure:"jwks_refresh_interval"`
+	// TLS до консоли: свой CA и клиентский сертификат шлюза (mTLS); без enabled — системные CA
+	JWKSTLS ClientTLSConfig `mapstructure:"jwks_tls"`
+	// Разрешить jwks_url по http:// — только для разработки
+	JWKSAllowHTTP bool `mapstructure:"jwks_allow_http"`
+	// Пропускать токены, если список отзыва в Redis недоступен (по умолчанию — нет)
+	RevocationFailOpen bool `mapstructure:"revocation_fail_open"`
+
+	AgentTokens AgentTokenConfig `mapstructure:"agent_tokens"`
+
+	// Блокировка входа пользователей консоли после серии неудачных попыток
+	Lockout LockoutConfig `mapstructure:"lockout"`
+
+	// Вход операторов через корпоративный IdP (OIDC Authorization Code + PKCE)
+	OIDC OIDCConfig `mapstructure:"oidc"`
+
+	// RBAC консоли: переопределение прав ролей ("viewer": ["agents:read", ...]).
+	// Не заданные роли берут права по умолчанию (domain.DefaultRolePermissions).
+	Roles map[string][]string `mapstructure:"roles"`
+}
+
+// MaxTokenTTL — срок жизни самого долгого токена (консоль или агент); столько хранится отзыв по subject.
+func (c AuthConfig) MaxTokenTTL() time.Duration {
+	return max(c.TokenTTL, c.AgentTokens.MaxTTL, c.AgentTokens.DefaultTTL)
+}
+
+// AgentTokenConfig — токены агентов (OAuth2 Client Credentials).
+type AgentTokenConfig struct {
+	DefaultTTL    time.Duration `mapstructure:"default_ttl"`    // Если у агента не задан token_ttl_seconds
+	MaxTTL        time.Duration `mapstructure:"max_ttl"`        // Потолок для персональных TTL агентов
+	RotationGrace time.Duration `mapstructure:"rotation_grace"` // Сколько действует прежний секрет после ротации
+}
+
+// LockoutConfig — защита входа в консоль от перебора паролей.
+type LockoutConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"` // Неудачных попыток подряд до блокировки (0 — выключено)
+	Duration    time.Duration `mapstructure:"duration"`     // Срок блокировки
+}
+
+// OIDCConfig — единый вход в консоль через OIDC-провайдер (Keycloak, Okta, Azure AD).
+// После входа консоль выдает свой обычный RS256-токен с ролью из group_mappings.
+type OIDCConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	IssuerURL    string   `mapstructure:"issuer_url"` // Discovery: {issuer_url}/.well-known/openid-configuration
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"` // Лучше через ENV: AUTH_OIDC_CLIENT_SECRET
+	RedirectURL  string   `mapstructure:"redirect_url"`  // https://console.corp.io/auth/oidc/callback
+	Scopes       []string `mapstructure:"scopes"`
+
+	UsernameClaim string `mapstructure:"username_claim"` // По умолчанию preferred_username
+	GroupsClaim   string `mapstructure:"groups_claim"`   // По умолчанию groups
+
+	// Группы IdP -> роль и scopes консоли. Роль берется из первого совпадения по порядку,
+	// scopes объединяются по всем совпавшим группам.
+	GroupMappings []OIDCGroupMapping `mapstructure:"group_mappings"`
+	// Роль, если ни одна группа не совпала ("" — вход запрещен)
+	DefaultRole string `mapstructure:"default_role"`
+	// Создавать пользователя при первом входе (иначе его заводит администратор заранее)
+	JITProvisioning bool `mapstructure:"jit_provisioning"`
+	// Сколько живет state входа (PKCE verifier и nonce в Redis)
+	StateTTL time.Duration `mapstructure:"state_ttl"`
+}
+
+// OIDCGroupMapping — сопоставление группы IdP с ролью и персональными scopes консоли.
+type OIDCGroupMapping struct {
+	Group  string   `mapstructure:"group"`
+	Role   string   `mapstructure:"role"`
+	Scopes []string `mapstructure:"scopes"`
 }
 
 // EngineConfig содержит специфичные настройки для UAG Data Plane.
 type EngineConfig struct {
-	AuditBufferSize    int           `mapstructure:"audit_buffer_size"`
-	AuditFlushInterval time.Duration `mapstructure:"audit_flush_interval"`
+	// Пакетная запись аудита (AgentFS)
+	AuditBufferSize    int           `mapstructure:"audit_buffer_size"`     // Емкость канала событий
+	AuditFlushInterval time.Duration `mapstructure:"audit_flush_interval"`  // Запись неполного пакета
+	AuditBatchSize     int           `mapstructure:"audit_batch_size"`      // Событий в пакете
+	AuditBatchMaxBytes int           `mapstructure:"audit_batch_max_bytes"` // 0 — без ограничения
+	AuditWorkers       int           `mapstructure:"audit_workers"`         // Параллельных писателей
+	// Повторы записи пакетов аудита и дисковый спул на время недоступности БД
+	AuditRetry AuditRetryConfig `mapstructure:"audit_retry"`
+	AuditSpool AuditSpoolConfig `mapstructure:"audit_spool"`
 
 	// Настройки Circuit Breaker для внешних AI-коннекторов
 	CBMaxRequests int           `mapstructure:"cb_max_requests"`
 	CBInterval    time.Duration `mapstructure:"cb_interval"`
 	CBTimeout     time.Duration `mapstructure:"cb_timeout"`
+
+	// Контентный риск-анализ (детекторы risk.Analyzer)
+	Risk RiskConfig `mapstructure:"risk"`
+
+	// Поведенческий анализ с автоматическим карантином/блокировкой
+	Behavior BehaviorConfig `mapstructure:"behavior"`
+
+	// Источники реалистичных ответов песочницы
+	Sandbox SandboxConfig `mapstructure:"sandbox"`
+
+	// Синхронизация кэша политик с PostgreSQL
+	PolicySync PolicySyncConfig `mapstructure:"policy_sync"`
+
+	// Маршрутизация вызовов к коннекторам и TLS исходящих соединений
+	Connectors ConnectorsConfig `mapstructure:"connectors"`
+}
+
+// ConnectorsConfig — куда шлюз отправляет вызовы способностей и как проверяет коннекторы.
+type ConnectorsConfig struct {
+	// Маршруты по префиксу capability ("jira." -> коннектор Jira). Побеждает самый длинный префикс,
+	// пустой префикс — маршрут по умолчанию. Без маршрутов — один коннектор localhost:50051.
+	Routes []ConnectorRoute `mapstructure:"routes"`
+	// TLS по умолчанию для всех маршрутов (маршрут может переопределить)
+	TLS ClientTLSConfig `mapstructure:"tls"`
+}
+
+// ConnectorRoute — адрес коннектора и его ожидаемая личность.
+type ConnectorRoute struct {
+	Name    string `mapstructure:"name"`
+	Prefix  string `mapstructure:"prefix"`
+	Address string `mapstructure:"address"`
+
+	TLS *ClientTLSConfig `mapstructure:"tls"`
+	// Пиннинг личности коннектора поверх проверки цепочки: сертификат обязан содержать
+	// один из SAN (DNS или URI, например spiffe://corp/connector/jira) и/или открытый ключ
+	// с одним из SHA-256 отпечатков SPKI (base64).
+	PinnedSANs []string `mapstructure:"pinned_sans"`
+	PinnedSPKI []string `mapstructure:"pinned_spki"`
+}
+
+// ClientTLSConfig — TLS/mTLS исходящих соединений шлюза.
+type ClientTLSConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	CAFile     string `mapstructure:"ca_file"`     // Пусто — системные корневые сертификаты
+	CertFile   string `mapstructure:"cert_file"`   // Клиентский сертификат шлюза (mTLS)
+	KeyFile    string `mapstructure:"key_file"`    //
+	ServerName string `mapstructure:"server_name"` // Имя для проверки сертификата (по умолчанию — хост из address)
+	// Как часто проверять файлы сертификатов
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+// RiskConfig настраивает встроенные детекторы риск-анализатора.
+type RiskConfig struct {
+	BlockedDomains  []string `mapstructure:"blocked_domains"`   // Домены, обращение к которым почти наверняка утечка
+	MaxArrayLen     int      `mapstructure:"max_array_len"`     // Порог «массовой» выборки в payload
+	MaxPayloadBytes int      `mapstructure:"max_payload_bytes"` // Порог подозрительно большого запроса
+}
+
+// BehaviorConfig настраивает поведенческий профиль агентов (risk.BehaviorMonitor).
+type BehaviorConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	MinSamples      int           `mapstructure:"min_samples"`      // Событий до «прогрева» профиля
+	RateMultiplier  float64       `mapstructure:"rate_multiplier"`  // Всплеск RPM относительно базовой линии
+	MinRatePerMin   int           `mapstructure:"min_rate_per_min"` // Абсолютный минимум RPM для всплеска
+	ErrorRatio      float64       `mapstructure:"error_ratio"`      // Аномальная доля отказов в окне
+	ErrorWindow     int           `mapstructure:"error_window"`     // Размер окна исходов
+	WorkDays        []string      `mapstructure:"work_days"`        // ["mon", "tue", ...]
+	WorkHourStart   int           `mapstructure:"work_hour_start"`
+	WorkHourEnd     int           `mapstructure:"work_hour_end"`
+	Timezone        string        `mapstructure:"timezone"` // IANA, например "Europe/Moscow"
+	QuarantineScore int           `mapstructure:"quarantine_score"`
+	BlockScore      int           `mapstructure:"block_score"`
+	Cooldown        time.Duration `mapstructure:"cooldown"`
+}
+
+// AuditRetryConfig — повторы записи пакета аудита до переноса в спул.
+type AuditRetryConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Backoff     time.Duration `mapstructure:"backoff"`     // Первая задержка, далее удваивается
+	MaxBackoff  time.Duration `mapstructure:"max_backoff"` // Предел задержки и интервал повтора воспроизведения спула
+}
+
+// AuditSpoolConfig — дисковый спул событий, не записанных в БД (audit.Spool).
+type AuditSpoolConfig struct {
+	Dir      string `mapstructure:"dir"`       // Пусто — спул выключен: при сбоях события теряются
+	MaxBytes int64  `mapstructure:"max_bytes"` // 0 — без ограничения
+}
+
+// SandboxConfig настраивает источники ответов песочницы (sandbox.Responder).
+type SandboxConfig struct {
+	FixturesDir string `mapstructure:"fixtures_dir"` // Каталог фикстур {capability}.json
+	RecordLive  bool   `mapstructure:"record_live"`  // Записывать обезличенные Live-ответы
+	MaxRecorded int    `mapstructure:"max_recorded"` // Сколько последних ответов хранить на способность
+}
+
+// PolicySyncConfig настраивает сверку кэша MemoEnforcer с БД.
+type PolicySyncConfig struct {
+	DriftCheckInterval time.Duration `mapstructure:"drift_check_interval"` // 0 — сверка отключена
+}
+
+// AuditConfig — целостность и хранение журнала аудита агентов (audit_logs).
+type AuditConfig struct {
+	// Цепочка хешей: пишет шлюз (AgentFS)
+	Chain AuditChainConfig `mapstructure:"chain"`
+	// Подписанные контрольные точки: ставит консоль (нужен auth.private_key)
+	Checkpoints AuditCheckpointConfig `mapstructure:"checkpoints"`
+	// Непрерывная доставка новых событий в SIEM: запускает консоль
+	Forwarder AuditForwarderConfig `mapstructure:"forwarder"`
+	// Партиции хранения, срок хранения и архивация: выполняет консоль
+	Retention AuditRetentionConfig `mapstructure:"retention"`
+	// Хранилища событий шлюза (AgentFS); пусто — только PostgreSQL
+	Sinks []AuditSinkConfig `mapstructure:"sinks"`
+}
+
+// AuditSinkConfig — одно хранилище событий аудита. У каждого свои очередь, повторы
+// и спул (engine.audit_spool.dir/<name>); пакеты и воркеры — общие из engine.
+type AuditSinkConfig struct {
+	Name       string                `mapstructure:"name"` // Уникально: метка метрик и каталог спула
+	Type       string                `mapstructure:"type"` // postgres | clickhouse | kafka | file
+	ClickHouse AuditClickHouseConfig `mapstructure:"clickhouse"`
+	Kafka      AuditKafkaConfig      `mapstructure:"kafka"`
+	File       AuditFileSinkConfig   `mapstructure:"file"`
+}
+
+type AuditClickHouseConfig struct {
+	URL      string          `mapstructure:"url"` // HTTP-интерфейс: http(s)://clickhouse:8123
+	Database string          `mapstructure:"database"`
+	Table    string          `mapstructure:"table"`
+	Username string          `mapstructure:"username"`
+	Password string          `mapstructure:"password"`
+	Timeout  time.Duration   `mapstructure:"timeout"`
+	TLS      ClientTLSConfig `mapstructure:"tls"`
+}
+
+type AuditKafkaConfig struct {
+	Brokers  []string        `mapstructure:"brokers"`
+	Topic    string          `mapstructure:"topic"`
+	ClientID string          `mapstructure:"client_id"`
+	Format   string          `mapstructure:"format"`  // ndjson | ecs | cef
+	Timeout  time.Duration   `mapstructure:"timeout"` // Предел доставки пакета
+	TLS      ClientTLSConfig `mapstructure:"tls"`
+	SASL     AuditSASLConfig `mapstructure:"sasl"`
+}
+
+type AuditSASLConfig struct {
+	Mechanism string `mapstructure:"mechanism"` // plain | scram-sha-256 | scram-sha-512; пусто — без SASL
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+type AuditFileSinkConfig struct {
+	Dir      string        `mapstructure:"dir"`
+	Format   string        `mapstructure:"format"`    // ndjson | ecs | cef
+	MaxBytes int64         `mapstructure:"max_bytes"` // Ротация по размеру
+	MaxAge   time.Duration `mapstructure:"max_age"`   // Ротация по возрасту
+	MaxFiles int           `mapstructure:"max_files"` // Сколько файлов хранить
+}
+
+type AuditChainConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Партиция цепочки этого шлюза (по умолчанию — имя хоста). Шлюзы с одной партицией
+	// пишут по очереди, с разными — параллельно.
+	Partition string `mapstructure:"partition"`
+}
+
+type AuditCheckpointConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// AuditForwarderConfig — доставка событий цепочки аудита в syslog или HTTP-коллектор.
+// Курсор (audit_forward_cursors) хранится в БД по имени форвардера и партиции цепочки.
+type AuditForwarderConfig struct {
+	Enabled   bool              `mapstructure:"enabled"`
+	Name      string            `mapstructure:"name"`       // Имя курсора: у разных получателей — разные имена
+	Target    string            `mapstructure:"target"`     // syslog, http
+	Format    string            `mapstructure:"format"`     // cef, ecs, ndjson
+	BatchSize int               `mapstructure:"batch_size"` // Событий в одной отправке
+	Interval  time.Duration     `mapstructure:"interval"`   // Опрос новых событий и повтор после ошибки
+	StartFrom string            `mapstructure:"start_from"` // latest — без истории, earliest — с первого события
+	Syslog    AuditSyslogConfig `mapstructure:"syslog"`
+	HTTP      AuditHTTPConfig   `mapstructure:"http"`
+}
+
+type AuditSyslogConfig struct {
+	Network  string        `mapstructure:"network"` // tcp, udp
+	Address  string        `mapstructure:"address"`
+	AppName  string        `mapstructure:"app_name"`
+	Facility int           `mapstructure:"facility"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+type AuditHTTPConfig struct {
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"` // Например, Authorization коллектора
+	Timeout time.Duration     `mapstructure:"timeout"`
+}
+
+// AuditRetentionConfig — партиционирование audit_logs по времени и удаление партиций по сроку.
+type AuditRetentionConfig struct {
+	Enabled     bool               `mapstructure:"enabled"`
+	Days        int                `mapstructure:"days"`         // Срок хранения; 0 — партиции не удаляются
+	Partition   string             `mapstructure:"partition"`    // daily, monthly
+	CreateAhead int                `mapstructure:"create_ahead"` // Сколько партиций создавать наперед
+	Interval    time.Duration      `mapstructure:"interval"`
+	Archive     AuditArchiveConfig `mapstructure:"archive"`
+}
+
+// AuditArchiveConfig — архивация партиции в gzip NDJSON перед удалением. Каталог должен быть
+// общим для реплик консоли (обслуживание выполняет любая из них).
+type AuditArchiveConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Dir     string `mapstructure:"dir"`
 }
 
 // LoggerConfig настраивает поведение zap логгера.
@@ -102,11 +412,29 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("unable to decode into struct: %w", err)
 	}
 
+	// Прежний ключ defaults.audit_retention_days, если новый не задан явно
+	_, daysInEnv := os.LookupEnv("AUDIT_RETENTION_DAYS")
+	if !v.InConfig("audit.retention.days") && !daysInEnv && v.IsSet("defaults.audit_retention_days") {
+		cfg.Audit.Retention.Days = v.GetInt("defaults.audit_retention_days")
+	}
+
+	// Без явного списка хранилищ шлюз пишет аудит только в PostgreSQL
+	if len(cfg.Audit.Sinks) == 0 {
+		cfg.Audit.Sinks = []AuditSinkConfig{{Name: "postgres", Type: "postgres"}}
+	}
+
 	// 6. Загрузка ключей из Файла ИЛИ из ENV
 	// Сначала проверяем, не лежит ли сам PEM-ключ в ENV (для Docker/K8s)
 	// Если нет — читаем файл по указанному пути
 	cfg.Auth.PublicKey = loadKeyResource(cfg.Auth.PublicKeyPath, "AUTH_PUBLIC_KEY_DATA")
 	cfg.Auth.PrivateKey = loadKeyResource(cfg.Auth.PrivateKeyPath, "AUTH_PRIVATE_KEY_DATA")
+	for _, path := range cfg.Auth.PreviousPublicKeyPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous public key: %w", err)
+		}
+		cfg.Auth.PreviousPublicKeys = append(cfg.Auth.PreviousPublicKeys, data)
+	}
 
 	return &cfg, nil
 }
@@ -117,8 +445,61 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("database.max_conns", 15)
 	v.SetDefault("database.min_conns", 5)
 	v.SetDefault("logger.level", "info")
-	v.SetDefault("engine.audit_buffer_size", 1000)
-	v.SetDefault("engine.audit_flush_interval", 1*time.Second)
+	v.SetDefault("auth.token_ttl", 24*time.Hour)
+	v.SetDefault("auth.agent_tokens.default_ttl", 15*time.Minute)
+	v.SetDefault("auth.agent_tokens.max_ttl", time.Hour)
+	v.SetDefault("auth.agent_tokens.rotation_grace", time.Hour)
+	v.SetDefault("auth.lockout.max_attempts", 5)
+	v.SetDefault("auth.lockout.duration", 15*time.Minute)
+	v.SetDefault("auth.oidc.client_secret", "")
+	v.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	v.SetDefault("auth.oidc.username_claim", "preferred_username")
+	v.SetDefault("auth.oidc.groups_claim", "groups")
+	v.SetDefault("auth.oidc.jit_provisioning", true)
+	v.SetDefault("auth.oidc.state_ttl", 10*time.Minute)
+	v.SetDefault("auth.jwks_refresh_interval", 5*time.Minute)
+	v.SetDefault("server.tls.min_version", "1.2")
+	v.SetDefault("server.tls.reload_interval", time.Minute)
+	v.SetDefault("engine.connectors.tls.reload_interval", time.Minute)
+	v.SetDefault("audit.chain.enabled", true)
+	v.SetDefault("audit.chain.partition", defaultChainPartition())
+	v.SetDefault("audit.checkpoints.enabled", true)
+	v.SetDefault("audit.checkpoints.interval", time.Hour)
+	v.SetDefault("audit.forwarder.enabled", false)
+	v.SetDefault("audit.forwarder.name", "siem")
+	v.SetDefault("audit.forwarder.target", "syslog")
+	v.SetDefault("audit.forwarder.format", "cef")
+	v.SetDefault("audit.forwarder.batch_size", 500)
+	v.SetDefault("audit.forwarder.interval", 5*time.Second)
+	v.SetDefault("audit.forwarder.start_from", "latest")
+	v.SetDefault("audit.forwarder.syslog.network", "tcp")
+	v.SetDefault("audit.forwarder.syslog.facility", 13)
+	v.SetDefault("audit.forwarder.syslog.timeout", 10*time.Second)
+	v.SetDefault("audit.forwarder.http.timeout", 10*time.Second)
+	v.SetDefault("audit.retention.enabled", true)
+	v.SetDefault("audit.retention.days", 90)
+	v.SetDefault("audit.retention.partition", "daily")
+	v.SetDefault("audit.retention.create_ahead", 7)
+	v.SetDefault("audit.retention.interval", time.Hour)
+	v.SetDefault("audit.retention.archive.enabled", false)
+	v.SetDefault("audit.retention.archive.dir", "./audit-archive")
+	v.SetDefault("engine.audit_buffer_size", 10000)
+	v.SetDefault("engine.audit_flush_interval", 500*time.Millisecond)
+	v.SetDefault("engine.audit_batch_size", 100)
+	v.SetDefault("engine.audit_batch_max_bytes", 4<<20)
+	v.SetDefault("engine.audit_workers", 1)
+	v.SetDefault("engine.audit_retry.max_attempts", 3)
+	v.SetDefault("engine.audit_retry.backoff", 200*time.Millisecond)
+	v.SetDefault("engine.audit_retry.max_backoff", 5*time.Second)
+	v.SetDefault("engine.audit_spool.dir", "./audit-spool")
+	v.SetDefault("engine.audit_spool.max_bytes", 1<<30)
+	v.SetDefault("engine.risk.max_array_len", 500)
+	v.SetDefault("engine.risk.max_payload_bytes", 256<<10)
+	v.SetDefault("engine.behavior.quarantine_score", 60)
+	v.SetDefault("engine.behavior.block_score", 85)
+	v.SetDefault("engine.sandbox.fixtures_dir", "./fixtures/sandbox")
+	v.SetDefault("engine.sandbox.max_recorded", 50)
+	v.SetDefault("engine.policy_sync.drift_check_interval", time.Minute)
 }
 
 // loadKeyResource — универсальный хелпер архитектора
@@ -136,3 +517,11 @@ func loadKeyResource(path string, envDataKey string) []byte {
 	}
 	return nil
 }
+
+// defaultChainPartition — имя хоста: в Kubernetes это имя пода, у каждого шлюза своя партиция.
+func defaultChainPartition() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "default"
+}
@@ -18,6 +18,22 @@ const (
 	RedisKeyLockApprovalsExec     = RedisNamespace + ":approvals:execution:"
 )
 
+// Префиксы динамических ключей (риск-анализ, песочница; часть добавляется в месте использования)
+const (
+	// RedisKeyBudgetPrefix — Sorted Set скользящего окна бюджета: {prefix}{agent}:{capability}:{budget}
+	RedisKeyBudgetPrefix = RedisNamespace + ":risk:budget:"
+
+	// RedisKeySandboxRecordedPrefix — List обезличенных Live-ответов для песочницы: {prefix}{capability}
+	RedisKeySandboxRecordedPrefix = RedisNamespace + ":sandbox:recorded:"
+
+	// RedisKeyRevokedTokenPrefix — отозванный токен: {prefix}{jti}, TTL до истечения токена
+	RedisKeyRevokedTokenPrefix = RedisNamespace + ":auth:revoked:jti:"
+	// RedisKeyRevokedSubjectPrefix — отзыв всех токенов пользователя или агента: {prefix}{sub} = unix-время отзыва
+	RedisKeyRevokedSubjectPrefix = RedisNamespace + ":auth:revoked:sub:"
+	// RedisKeyOIDCStatePrefix — незавершенный вход через OIDC: {prefix}{state} = PKCE verifier и nonce, одноразовый
+	RedisKeyOIDCStatePrefix = RedisNamespace + ":auth:oidc:state:"
+)
+
 // Каналы Pub/Sub (события)
 const (
 	// RedisChanApprovalDecisions — канал для трансляции решений оператора (HITL).
@@ -0,0 +1,188 @@
+package policy
+
+/*
+Файл bundle.go реализует формат Policy-as-Code: весь набор политик в одном YAML/JSON-файле,
+который ИБ-команда хранит в git и применяет через консоль (policyctl plan/apply).
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	BundleAPIVersion = "spaceai/v1"
+	BundleKind       = "PolicyBundle"
+)
+
+// Bundle — сериализуемый набор политик:
+//
+//	apiVersion: spaceai/v1
+//	kind: PolicyBundle
+//	policies:
+//	  - agent_id: "*"
+//	    capability_id: slack.message.send
+//	    effect: DENY
+//	    conditions: {reason: global security limit}
+//	  - agent_id: analytics-agent
+//	    capability_id: db.query.execute
+//	    effect: ALLOW
+//	    schedule: {days: [mon, tue, wed, thu, fri], start: "09:00", end: "18:00", timezone: Europe/Moscow}
+type Bundle struct {
+	APIVersion string         `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string         `yaml:"kind" json:"kind"`
+	Policies   []BundlePolicy `yaml:"policies" json:"policies"`
+}
+
+type BundlePolicy struct {
+	AgentID      string                 `yaml:"agent_id" json:"agent_id"`
+	CapabilityID string                 `yaml:"capability_id" json:"capability_id"`
+	Effect       domain.PolicyEffect    `yaml:"effect" json:"effect"`
+	Conditions   map[string]interface{} `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+
+	ValidFrom  *time.Time             `yaml:"valid_from,omitempty" json:"valid_from,omitempty"`
+	ValidUntil *time.Time             `yaml:"valid_until,omitempty" json:"valid_until,omitempty"`
+	Schedule   *domain.PolicySchedule `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+}
+
+// NewBundle собирает бандл из активных политик (экспорт). ID и версии в бандл не попадают,
+// break-glass доступы тоже: это временные оперативные решения, а не часть правил в git.
+func NewBundle(policies []domain.Policy) (*Bundle, error) {
+	b := &Bundle{APIVersion: BundleAPIVersion, Kind: BundleKind, Policies: make([]BundlePolicy, 0, len(policies))}
+
+	for _, p := range policies {
+		if p.BreakGlass {
+			continue
+		}
+		bp := BundlePolicy{
+			AgentID:      p.AgentID,
+			CapabilityID: p.CapabilityID,
+			Effect:       p.Effect,
+			ValidFrom:    p.ValidFrom,
+			ValidUntil:   p.ValidUntil,
+			Schedule:     p.Schedule,
+		}
+		if len(p.Conditions) > 0 && string(p.Conditions) != "null" {
+			if err := json.Unmarshal(p.Conditions, &bp.Conditions); err != nil {
+				return nil, fmt.Errorf("bundle: policy %s has invalid conditions: %w", p.ID, err)
+			}
+			if len(bp.Conditions) == 0 {
+				bp.Conditions = nil
+			}
+		}
+		b.Policies = append(b.Policies, bp)
+	}
+
+	// Детерминированный порядок — чтобы diff в git показывал только реальные изменения
+	sort.Slice(b.Policies, func(i, j int) bool {
+		pi, pj := b.Policies[i], b.Policies[j]
+		if pi.CapabilityID != pj.CapabilityID {
+			return pi.CapabilityID < pj.CapabilityID
+		}
+		if pi.AgentID != pj.AgentID {
+			return pi.AgentID < pj.AgentID
+		}
+		return pi.timingKey() < pj.timingKey()
+	})
+	return b, nil
+}
+
+// ParseBundle читает бандл в YAML или JSON (JSON — подмножество YAML).
+func ParseBundle(data []byte) (*Bundle, error) {
+	var b Bundle
+	if err := yaml.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("bundle: parse error: %w", err)
+	}
+	return &b, nil
+}
+
+// Marshal сериализует бандл в yaml (по умолчанию) или json.
+func (b *Bundle) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "", "yaml", "yml":
+		return yaml.Marshal(b)
+	case "json":
+		return json.MarshalIndent(b, "", "  ")
+	}
+	return nil, fmt.Errorf("bundle: unsupported format %q", format)
+}
+
+// Validate проверяет структуру бандла и возвращает все найденные ошибки разом,
+// чтобы автор правил исправил файл за один проход.
+func (b *Bundle) Validate() error {
+	var errs []error
+	if b.APIVersion != BundleAPIVersion {
+		errs = append(errs, fmt.Errorf("apiVersion must be %q, got %q", BundleAPIVersion, b.APIVersion))
+	}
+	if b.Kind != BundleKind {
+		errs = append(errs, fmt.Errorf("kind must be %q, got %q", BundleKind, b.Kind))
+	}
+
+	seen := make(map[string]int, len(b.Policies))
+	for i, p := range b.Policies {
+		if p.AgentID == "" {
+			errs = append(errs, fmt.Errorf("policies[%d]: agent_id is required", i))
+		}
+		if p.CapabilityID == "" {
+			errs = append(errs, fmt.Errorf("policies[%d]: capability_id is required", i))
+		}
+		switch p.Effect {
+		case domain.EffectAllow, domain.EffectDeny, domain.EffectSandbox, domain.EffectQuarantine:
+		default:
+			errs = append(errs, fmt.Errorf("policies[%d]: unsupported effect %q", i, p.Effect))
+		}
+
+		dp := p.policy()
+		if err := dp.ValidateTiming(); err != nil {
+			errs = append(errs, fmt.Errorf("policies[%d]: %w", i, err))
+		}
+
+		// Одна пара агент+способность может встречаться несколько раз с разными временными рамками
+		key := domain.PolicyKey(dp)
+		if prev, dup := seen[key]; dup {
+			errs = append(errs, fmt.Errorf("policies[%d]: duplicates policies[%d] (%s)", i, prev, key))
+		}
+		seen[key] = i
+	}
+	return errors.Join(errs...)
+}
+
+// ToPolicies конвертирует бандл в доменные политики (без ID).
+func (b *Bundle) ToPolicies() ([]domain.Policy, error) {
+	result := make([]domain.Policy, 0, len(b.Policies))
+	for i, bp := range b.Policies {
+		p := bp.policy()
+		if len(bp.Conditions) > 0 {
+			raw, err := json.Marshal(bp.Conditions)
+			if err != nil {
+				return nil, fmt.Errorf("bundle: policies[%d]: conditions are not JSON-compatible: %w", i, err)
+			}
+			p.Conditions = raw
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// policy — доменная политика без Conditions (для ключа и проверки временных рамок).
+func (bp *BundlePolicy) policy() domain.Policy {
+	return domain.Policy{
+		AgentID:      bp.AgentID,
+		CapabilityID: bp.CapabilityID,
+		Effect:       bp.Effect,
+		ValidFrom:    bp.ValidFrom,
+		ValidUntil:   bp.ValidUntil,
+		Schedule:     bp.Schedule,
+	}
+}
+
+func (bp *BundlePolicy) timingKey() string {
+	p := bp.policy()
+	return p.TimingKey()
+}
@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+func TestBundleValidate(t *testing.T) {
+	header := "apiVersion: spaceai/v1\nkind: PolicyBundle\n"
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr []string // Фрагменты, которые должны быть в ошибке (все ошибки — разом)
+	}{
+		{
+			name: "valid yaml",
+			doc: header + `policies:
+  - {agent_id: "*", capability_id: slack.message.send, effect: DENY, conditions: {reason: limit}}
+  - agent_id: analytics-agent
+    capability_id: db.query.execute
+    effect: ALLOW
+    schedule: {days: [mon, fri], start: "09:00", end: "18:00", timezone: Europe/Moscow}
+  - {agent_id: analytics-agent, capability_id: db.query.execute, effect: DENY}`,
+		},
+		{name: "valid json", doc: `{"apiVersion":"spaceai/v1","kind":"PolicyBundle","policies":[{"agent_id":"a","capability_id":"c","effect":"SANDBOX"}]}`},
+		{name: "wrong header", doc: "apiVersion: v2\nkind: Bundle\npolicies: []", wantErr: []string{"apiVersion", "kind"}},
+		{
+			name: "all policy errors at once",
+			doc: header + `policies:
+  - {capability_id: c1, effect: ALLOW}
+  - {agent_id: a, effect: allow}
+  - {agent_id: a, capability_id: c3, effect: ALLOW, schedule: {start: "09:00", end: "09:00"}}`,
+			wantErr: []string{"policies[0]: agent_id", "policies[1]: capability_id", `policies[1]: unsupported effect "allow"`, "policies[2]: schedule"},
+		},
+		{
+			name: "duplicate key",
+			doc: header + `policies:
+  - {agent_id: a, capability_id: c, effect: ALLOW}
+  - {agent_id: a, capability_id: c, effect: DENY}`,
+			wantErr: []string{"policies[1]: duplicates policies[0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ParseBundle([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = b.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate() error = nil")
+			}
+			for _, frag := range tt.wantErr {
+				if !strings.Contains(err.Error(), frag) {
+					t.Errorf("Validate() error = %q, want it to mention %q", err, frag)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBundleMalformed(t *testing.T) {
+	if _, err := ParseBundle([]byte("policies: [")); err == nil {
+		t.Error("ParseBundle() error = nil for malformed document")
+	}
+}
+
+// Экспорт -> git -> применение без правок: план должен быть пустым в обоих форматах.
+func TestBundleRoundTrip(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+	current := []domain.Policy{
+		{ID: "p1", AgentID: "*", CapabilityID: "slack.message.send", Effect: domain.EffectDeny,
+			Conditions: json.RawMessage(`{"reason":"global limit","budgets":[{"name":"daily","agg":"count","window":"24h","limit":10}]}`)},
+		{ID: "p2", AgentID: "analytics-agent", CapabilityID: "db.query.execute", Effect: domain.EffectAllow,
+			Schedule: &domain.PolicySchedule{Days: []string{"mon", "fri"}, Start: "09:00", End: "18:00", Timezone: "Europe/Moscow"}},
+		{ID: "p3", AgentID: "analytics-agent", CapabilityID: "db.query.execute", Effect: domain.EffectDeny},
+		{ID: "p4", AgentID: "billing-agent", CapabilityID: "bank.transfer", Effect: domain.EffectQuarantine,
+			ValidFrom: &from, ValidUntil: &until, Conditions: json.RawMessage(`{}`)},
+		{ID: "bg", AgentID: "billing-agent", CapabilityID: "bank.transfer", Effect: domain.EffectAllow,
+			BreakGlass: true, ValidUntil: &until},
+	}
+
+	exported, err := NewBundle(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported.Policies) != 4 {
+		t.Fatalf("exported %d policies, want 4 (break-glass excluded)", len(exported.Policies))
+	}
+
+	for _, format := range []string{"yaml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			data, err := exported.Marshal(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParseBundle(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Validate(); err != nil {
+				t.Fatalf("exported bundle is invalid: %v\n%s", err, data)
+			}
+			desired, err := b.ToPolicies()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan := domain.PlanBundle(current, desired); !plan.IsEmpty() || plan.Unchanged != 4 {
+				t.Errorf("plan after round trip = %s (%d unchanged)\n%s", plan.Summary(), plan.Unchanged, data)
+			}
+
+			again, _ := b.Marshal(format)
+			if string(again) != string(data) {
+				t.Errorf("re-export differs:\n%s\nvs\n%s", again, data)
+			}
+		})
+	}
+}
+
+func TestMarshalUnsupportedFormat(t *testing.T) {
+	b, _ := NewBundle(nil)
+	if _, err := b.Marshal("toml"); err == nil {
+		t.Error("Marshal(toml) error = nil")
+	}
+}
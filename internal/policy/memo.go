@@ -2,7 +2,9 @@ package policy
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
@@ -11,6 +13,24 @@ import (
 
 type PolicyRepository interface {
 	GetAllPolicies(ctx context.Context) ([]domain.Policy, error)
+	GetAllShadowPolicies(ctx context.Context) ([]domain.Policy, error)
+	GetPolicyByID(ctx context.Context, id string) (*domain.Policy, error)
+	PolicyChecksum(ctx context.Context) (int, string, error)
+}
+
+// entry — политика с заранее скомпилированным расписанием.
+type entry struct {
+	policy   domain.Policy
+	schedule *domain.ScheduleMatcher
+	invalid  bool // Расписание не разобрано: политика никогда не активна, но пару «занимает»
+}
+
+// activeAt проверяет окно валидности и расписание в момент t.
+func (e *entry) activeAt(t time.Time) bool {
+	if e.invalid || !e.policy.InWindow(t) {
+		return false
+	}
+	return e.schedule == nil || e.schedule.Contains(t)
 }
 
 // MemoEnforcer реализует интерфейс Enforcer, используя потокобезопасную мапу.
@@ -18,63 +38,186 @@ type PolicyRepository interface {
 // но в рантайме шлюз обращается только к памяти.
 type MemoEnforcer struct {
 	mu sync.RWMutex
-	// Кэш: "agent_id:capability_id" -> Policy
-	policies map[string]domain.Policy
+	// Кэш: "agent_id:capability_id" -> политики пары в порядке приоритета
+	// (break-glass, затем ограниченные по времени, затем бессрочные)
+	policies map[string][]entry
+	// Зеркало таблицы policies по ID (для дельт и контрольной суммы)
+	byID map[string]domain.Policy
+	// Теневой (кандидатный) набор в том же формате ключей. Не участвует в решении,
+	// а только оценивается параллельно для поиска расхождений (Shadow Mode).
+	shadow map[string]domain.Policy
+
+	// syncMu упорядочивает Refresh и применение дельт, чтобы дельта не «откатила»
+	// результат параллельной полной перезагрузки
+	syncMu sync.Mutex
 
-	repo   PolicyRepository // Используется только для Refresh()
+	repo   PolicyRepository // Используется только для синхронизации (Refresh, дельты, checksum)
 	rdb    *redis.Client
 	logger *zap.Logger
+	now    func() time.Time
 }
 
 func NewMemoEnforcer(repo PolicyRepository, rdb *redis.Client, logger *zap.Logger) *MemoEnforcer {
 	return &MemoEnforcer{
-		policies: make(map[string]domain.Policy),
+		policies: make(map[string][]entry),
+		byID:     make(map[string]domain.Policy),
+		shadow:   make(map[string]domain.Policy),
 		repo:     repo,
 		rdb:      rdb,
 		logger:   logger.Named("enforcer"),
+		now:      time.Now,
 	}
 }
 
 // GetPolicy политики для авторизации. Он работает только с RAM. Он не знает про Postgres. Это и есть наш "Hot Path"
 // Нам мало знать «можно или нельзя». Нам нужно знать «как именно» (Live, Sandbox, Quarantine)
 // Логика принятия решения (Decision Logic) находится в UAGCore, где есть доступ к KillSwitch, SandboxManager и Policy
+//
+// Временные рамки проверяются в момент запроса: политика с расписанием «включается» и
+// break-glass доступ истекает сами по себе, без Refresh.
 func (e *MemoEnforcer) GetPolicy(agentID, capID string) domain.Policy {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	// 1. Сначала ищем персональную политику агента
-	specificKey := agentID + ":" + capID
-	if p, ok := e.policies[specificKey]; ok {
-		return p
-	}
+	now := e.now()
 
-	// 2. Если нет — ищем глобальную политику (wildcard) для всех агентов
-	globalKey := "*:" + capID
-	if p, ok := e.policies[globalKey]; ok {
-		return p
+	// 1. Сначала ищем персональную политику агента, 2. затем глобальную (wildcard) для всех агентов
+	for _, key := range []string{agentID + ":" + capID, "*:" + capID} {
+		if p, found := e.match(key, now); found {
+			return p
+		}
 	}
 
 	// 3. Если ничего не нашли — возвращаем дефолтный запрет Default Deny (Zero Trust)
 	return domain.Policy{Effect: domain.EffectDeny}
 }
 
+// match возвращает первую активную политику пары. Если у пары есть постоянные или плановые
+// политики, но ни одна сейчас не действует, — это Default Deny, а не переход к wildcard:
+// «разрешено только в рабочие часы» не должно превращаться в глобальное правило вне их.
+// Истекший break-glass доступ пару не «занимает», и проверка продолжается по иерархии.
+func (e *MemoEnforcer) match(key string, now time.Time) (domain.Policy, bool) {
+	entries, ok := e.policies[key]
+	if !ok {
+		return domain.Policy{}, false
+	}
+
+	claimed := false
+	for i := range entries {
+		if entries[i].activeAt(now) {
+			return entries[i].policy, true
+		}
+		if !entries[i].policy.BreakGlass {
+			claimed = true
+		}
+	}
+	if claimed {
+		return domain.Policy{Effect: domain.EffectDeny}, true
+	}
+	return domain.Policy{}, false
+}
+
+// GetShadowPolicy ищет теневую политику по тем же правилам (агент, затем '*').
+// Теневой набор работает как оверлей над активным: если кандидата для пары нет,
+// решение не меняется и расхождения быть не может (ok == false).
+func (e *MemoEnforcer) GetShadowPolicy(agentID, capID string) (domain.Policy, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if len(e.shadow) == 0 {
+		return domain.Policy{}, false
+	}
+	if p, ok := e.shadow[agentID+":"+capID]; ok {
+		return p, true
+	}
+	p, ok := e.shadow["*:"+capID]
+	return p, ok
+}
+
 // Refresh он выполняет «холодную загрузку» для втономномности всех политик из PostgreSQL в память шлюза (при старте).
 func (e *MemoEnforcer) Refresh(ctx context.Context) error {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+
 	policiesDb, err := e.repo.GetAllPolicies(ctx)
 	if err != nil {
 		return err
 	}
+	shadowDb, err := e.repo.GetAllShadowPolicies(ctx)
+	if err != nil {
+		return err
+	}
 
-	newPolicies := make(map[string]domain.Policy)
+	newPolicies := e.indexEntries(policiesDb)
+	newShadow := indexPolicies(shadowDb)
+	newByID := make(map[string]domain.Policy, len(policiesDb))
 	for _, p := range policiesDb {
-		key := p.AgentID + ":" + p.CapabilityID
-		newPolicies[key] = p
+		newByID[p.ID] = p
 	}
 
 	e.mu.Lock()
 	e.policies = newPolicies
+	e.byID = newByID
+	e.shadow = newShadow
 	e.mu.Unlock()
 
-	e.logger.Info("policy cache refreshed", zap.Int("count", len(newPolicies)))
+	e.logger.Info("policy cache refreshed", zap.Int("count", len(policiesDb)), zap.Int("shadow", len(newShadow)))
 	return nil
 }
+
+func indexPolicies(list []domain.Policy) map[string]domain.Policy {
+	idx := make(map[string]domain.Policy, len(list))
+	for _, p := range list {
+		idx[policyKey(p)] = p
+	}
+	return idx
+}
+
+// indexEntries группирует политики по паре и упорядочивает их по приоритету.
+func (e *MemoEnforcer) indexEntries(list []domain.Policy) map[string][]entry {
+	idx := make(map[string][]entry, len(list))
+	for _, p := range list {
+		key := policyKey(p)
+		idx[key] = append(idx[key], e.compile(p))
+	}
+	for _, entries := range idx {
+		sortEntries(entries)
+	}
+	return idx
+}
+
+// compile готовит политику к проверке в Hot Path. Политика с некорректным расписанием
+// не отбрасывается, а становится неактивной (Fail-Safe: не расширяем доступ до wildcard).
+func (e *MemoEnforcer) compile(p domain.Policy) entry {
+	en := entry{policy: p}
+	if p.Schedule != nil {
+		m, err := p.Schedule.Compile()
+		if err != nil {
+			e.logger.Error("policy has invalid schedule, treating as inactive", zap.String("policy", p.ID), zap.Error(err))
+			en.invalid = true
+			return en
+		}
+		en.schedule = m
+	}
+	return en
+}
+
+func policyKey(p domain.Policy) string {
+	return p.AgentID + ":" + p.CapabilityID
+}
+
+func sortEntries(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool { return rank(entries[i].policy) < rank(entries[j].policy) })
+}
+
+// rank — приоритет политики внутри пары: break-glass перекрывает плановые, плановые — бессрочные.
+func rank(p domain.Policy) int {
+	switch {
+	case p.BreakGlass:
+		return 0
+	case p.IsTimeBound():
+		return 1
+	default:
+		return 2
+	}
+}
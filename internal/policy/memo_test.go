@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+func TestGetPolicyTiming(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC) // Среда
+	at := func(d time.Duration) *time.Time { v := now.Add(d); return &v }
+	workHours := &domain.PolicySchedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00"}
+	nightShift := &domain.PolicySchedule{Start: "22:00", End: "06:00"}
+
+	permanent := domain.Policy{ID: "perm", AgentID: "agent-1", CapabilityID: "bank.transfer", Effect: domain.EffectQuarantine}
+	wildcard := domain.Policy{ID: "any", AgentID: "*", CapabilityID: "bank.transfer", Effect: domain.EffectSandbox}
+	breakGlass := func(until time.Duration) domain.Policy {
+		return domain.Policy{ID: "bg", AgentID: "agent-1", CapabilityID: "bank.transfer", Effect: domain.EffectAllow,
+			BreakGlass: true, ValidFrom: at(-time.Hour), ValidUntil: at(until)}
+	}
+	scheduled := func(s *domain.PolicySchedule) domain.Policy {
+		return domain.Policy{ID: "sched", AgentID: "agent-1", CapabilityID: "bank.transfer", Effect: domain.EffectAllow, Schedule: s}
+	}
+
+	tests := []struct {
+		name     string
+		policies []domain.Policy
+		wantID   string // "" — Default Deny
+	}{
+		{name: "break-glass overrides permanent", policies: []domain.Policy{permanent, breakGlass(time.Hour)}, wantID: "bg"},
+		{name: "break-glass overrides schedule", policies: []domain.Policy{scheduled(workHours), breakGlass(time.Hour)}, wantID: "bg"},
+		{name: "expired break-glass falls back to permanent", policies: []domain.Policy{permanent, breakGlass(-time.Minute)}, wantID: "perm"},
+		// Истекший break-glass пару не занимает: решение переходит к wildcard
+		{name: "expired break-glass falls back to wildcard", policies: []domain.Policy{wildcard, breakGlass(-time.Minute)}, wantID: "any"},
+		{name: "break-glass expires exactly now", policies: []domain.Policy{permanent, breakGlass(0)}, wantID: "perm"},
+		{name: "schedule active overrides permanent", policies: []domain.Policy{permanent, scheduled(workHours)}, wantID: "sched"},
+		{name: "schedule inactive falls back to permanent", policies: []domain.Policy{permanent, scheduled(nightShift)}, wantID: "perm"},
+		// «Разрешено только ночью» вне окна — запрет, а не переход к wildcard
+		{name: "schedule inactive claims the pair", policies: []domain.Policy{wildcard, scheduled(nightShift)}},
+		{name: "invalid schedule is inactive", policies: []domain.Policy{wildcard, scheduled(&domain.PolicySchedule{Start: "25:00", End: "06:00"})}},
+		{
+			name: "validity window not started",
+			policies: []domain.Policy{permanent, {ID: "future", AgentID: "agent-1", CapabilityID: "bank.transfer",
+				Effect: domain.EffectAllow, ValidFrom: at(time.Hour)}},
+			wantID: "perm",
+		},
+		{name: "wildcard only", policies: []domain.Policy{wildcard}, wantID: "any"},
+		{name: "no policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEnforcer(t, newMemPolicyRepo(tt.policies...))
+			e.now = func() time.Time { return now }
+
+			got := e.GetPolicy("agent-1", "bank.transfer")
+			if got.ID != tt.wantID {
+				t.Fatalf("GetPolicy() = %q (%s), want %q", got.ID, got.Effect, tt.wantID)
+			}
+			if tt.wantID == "" && got.Decide() != domain.EffectDeny {
+				t.Errorf("Decide() = %s, want DENY", got.Decide())
+			}
+		})
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	var missing *domain.Policy
+	tests := []struct {
+		name   string
+		policy *domain.Policy
+		want   domain.PolicyEffect
+	}{
+		{name: "nil policy", policy: missing, want: domain.EffectDeny},
+		{name: "empty effect", policy: &domain.Policy{ID: "p1"}, want: domain.EffectDeny},
+		{name: "sandbox", policy: &domain.Policy{Effect: domain.EffectSandbox}, want: domain.EffectSandbox},
+		{name: "break-glass allow", policy: &domain.Policy{Effect: domain.EffectAllow, BreakGlass: true}, want: domain.EffectAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Decide(); got != tt.want {
+				t.Errorf("Decide() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package policy
+
+/*
+Файл sync.go реализует инкрементальную синхронизацию кэша MemoEnforcer.
+
+Консоль публикует в канал policy-update событие {op, policy_id, version}, и шлюз перечитывает
+из PostgreSQL только одну строку вместо всей таблицы. Устаревшие и повторные события
+отбрасываются по номеру версии. Pub/Sub не гарантирует доставку, поэтому шлюз периодически
+сравнивает контрольную сумму кэша с БД и при расхождении (дрейфе) делает полную перезагрузку.
+Полная перезагрузка выполняется также при каждом переподключении к Redis.
+*/
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"go.uber.org/zap"
+)
+
+// ApplyChange применяет событие изменения политики к кэшу.
+func (e *MemoEnforcer) ApplyChange(ctx context.Context, ev domain.PolicyChangeEvent) error {
+	switch ev.Op {
+	case domain.PolicyEventUpsert:
+		return e.applyUpsert(ctx, ev)
+	case domain.PolicyEventDelete:
+		e.applyDelete(ev)
+		return nil
+	default:
+		return e.Refresh(ctx)
+	}
+}
+
+func (e *MemoEnforcer) applyUpsert(ctx context.Context, ev domain.PolicyChangeEvent) error {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+
+	e.mu.RLock()
+	cached, ok := e.byID[ev.PolicyID]
+	e.mu.RUnlock()
+	if ok && cached.Version >= ev.Version {
+		return nil // Повтор или событие старее кэша
+	}
+
+	p, err := e.repo.GetPolicyByID(ctx, ev.PolicyID)
+	if err != nil {
+		return fmt.Errorf("policy: failed to load policy %s: %w", ev.PolicyID, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeLocked(ev.PolicyID)
+	if p == nil {
+		return nil // Политику успели удалить — событие delete придет следом
+	}
+	e.insertLocked(*p)
+
+	e.logger.Debug("policy delta applied", zap.String("policy", p.ID), zap.Int("version", p.Version))
+	return nil
+}
+
+func (e *MemoEnforcer) applyDelete(ev domain.PolicyChangeEvent) {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cached, ok := e.byID[ev.PolicyID]
+	if !ok || (ev.Version > 0 && cached.Version > ev.Version) {
+		return // Уже удалена или воссоздана более новой версией (откат)
+	}
+	e.removeLocked(ev.PolicyID)
+	e.logger.Debug("policy removed from cache", zap.String("policy", ev.PolicyID))
+}
+
+// insertLocked добавляет политику в индекс. Новая политика встает первой в своем ранге,
+// как и при полной загрузке (ORDER BY created_at DESC). Вызывается под e.mu.
+func (e *MemoEnforcer) insertLocked(p domain.Policy) {
+	key := policyKey(p)
+	entries := make([]entry, 0, len(e.policies[key])+1)
+	entries = append(entries, e.compile(p))
+	entries = append(entries, e.policies[key]...)
+	sortEntries(entries)
+
+	e.policies[key] = entries
+	e.byID[p.ID] = p
+}
+
+// removeLocked убирает политику из индекса. Слайс пары пересоздается, а не правится на месте.
+func (e *MemoEnforcer) removeLocked(id string) {
+	old, ok := e.byID[id]
+	if !ok {
+		return
+	}
+	delete(e.byID, id)
+
+	key := policyKey(old)
+	entries := make([]entry, 0, len(e.policies[key]))
+	for _, en := range e.policies[key] {
+		if en.policy.ID != id {
+			entries = append(entries, en)
+		}
+	}
+	if len(entries) == 0 {
+		delete(e.policies, key)
+		return
+	}
+	e.policies[key] = entries
+}
+
+// Checksum считает контрольную сумму кэша в том же формате, что и PolicyChecksum в репозитории:
+// md5 от "id:version", упорядоченных по id и разделенных запятой.
+func (e *MemoEnforcer) Checksum() (int, string) {
+	e.mu.RLock()
+	pairs := make([]string, 0, len(e.byID))
+	for id, p := range e.byID {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", id, p.Version))
+	}
+	e.mu.RUnlock()
+
+	if len(pairs) == 0 {
+		return 0, ""
+	}
+	sort.Strings(pairs)
+	sum := md5.Sum([]byte(strings.Join(pairs, ",")))
+	return len(pairs), hex.EncodeToString(sum[:])
+}
+
+// driftGrace — пауза перед повторной сверкой: событие об изменении, только что
+// записанном в БД, может быть еще в пути, и это не дрейф.
+const driftGrace = 2 * time.Second
+
+// CheckDrift сравнивает кэш с БД и при устойчивом расхождении выполняет полную перезагрузку.
+// Возвращает true, если дрейф был обнаружен.
+func (e *MemoEnforcer) CheckDrift(ctx context.Context) (bool, error) {
+	inSync, dbCount, err := e.compareChecksum(ctx)
+	if err != nil || inSync {
+		return false, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(driftGrace):
+	}
+	if inSync, dbCount, err = e.compareChecksum(ctx); err != nil || inSync {
+		return false, err
+	}
+
+	count, _ := e.Checksum()
+
+	e.logger.Warn("policy cache drift detected, reloading",
+		zap.Int("cache_count", count),
+		zap.Int("db_count", dbCount))
+	return true, e.Refresh(ctx)
+}
+
+func (e *MemoEnforcer) compareChecksum(ctx context.Context) (bool, int, error) {
+	dbCount, dbSum, err := e.repo.PolicyChecksum(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	count, sum := e.Checksum()
+	return count == dbCount && sum == dbSum, dbCount, nil
+}
+
+// StartListener подписывается на канал policy-update и применяет дельты.
+// При каждой (пере)подписке выполняется Refresh: события, отправленные во время разрыва, потеряны.
+func (e *MemoEnforcer) StartListener(ctx context.Context) {
+	for {
+		pubsub := e.rdb.Subscribe(ctx, infra.RedisChanPolicyUpdate)
+
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			e.logger.Error("failed to subscribe", zap.String("chan", infra.RedisChanPolicyUpdate), zap.Error(err))
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		if err := e.Refresh(ctx); err != nil {
+			e.logger.Error("sync failed on reconnect", zap.Error(err))
+		}
+
+		ch := pubsub.Channel()
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				pubsub.Close()
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					break loop // Канал закрыт, идем на переподключение
+				}
+				ev := domain.ParsePolicyChangeEvent(msg.Payload)
+				if err := e.ApplyChange(ctx, ev); err != nil {
+					e.logger.Error("failed to apply policy change",
+						zap.String("op", ev.Op),
+						zap.String("policy", ev.PolicyID),
+						zap.Error(err))
+				}
+			}
+		}
+
+		pubsub.Close()
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// StartDriftCheck периодически сверяет контрольную сумму кэша с БД.
+func (e *MemoEnforcer) StartDriftCheck(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.CheckDrift(ctx); err != nil {
+				e.logger.Error("policy drift check failed", zap.Error(err))
+			}
+		}
+	}
+}
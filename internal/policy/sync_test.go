@@ -0,0 +1,213 @@
+package policy
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"go.uber.org/zap"
+)
+
+// memPolicyRepo — таблица policies в памяти; PolicyChecksum повторяет запрос postgres.
+type memPolicyRepo struct {
+	policies map[string]domain.Policy
+	loads    int // Число полных загрузок (GetAllPolicies)
+}
+
+func newMemPolicyRepo(list ...domain.Policy) *memPolicyRepo {
+	r := &memPolicyRepo{policies: make(map[string]domain.Policy)}
+	for _, p := range list {
+		r.policies[p.ID] = p
+	}
+	return r
+}
+
+func (r *memPolicyRepo) GetAllPolicies(context.Context) ([]domain.Policy, error) {
+	r.loads++
+	list := make([]domain.Policy, 0, len(r.policies))
+	for _, p := range r.policies {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *memPolicyRepo) GetAllShadowPolicies(context.Context) ([]domain.Policy, error) {
+	return nil, nil
+}
+
+func (r *memPolicyRepo) GetPolicyByID(_ context.Context, id string) (*domain.Policy, error) {
+	p, ok := r.policies[id]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (r *memPolicyRepo) PolicyChecksum(context.Context) (int, string, error) {
+	if len(r.policies) == 0 {
+		return 0, "", nil
+	}
+	ids := make([]string, 0, len(r.policies))
+	for id := range r.policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	pairs := make([]string, len(ids))
+	for i, id := range ids {
+		pairs[i] = fmt.Sprintf("%s:%d", id, r.policies[id].Version)
+	}
+	sum := md5.Sum([]byte(strings.Join(pairs, ",")))
+	return len(pairs), hex.EncodeToString(sum[:]), nil
+}
+
+func (r *memPolicyRepo) put(id, agentID, capID string, effect domain.PolicyEffect, version int) {
+	r.policies[id] = domain.Policy{ID: id, AgentID: agentID, CapabilityID: capID, Effect: effect, Version: version}
+}
+
+func testEnforcer(t *testing.T, repo *memPolicyRepo) *MemoEnforcer {
+	t.Helper()
+	e := NewMemoEnforcer(repo, nil, zap.NewNop())
+	if err := e.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestApplyChange(t *testing.T) {
+	upsert := func(id string, v int) domain.PolicyChangeEvent {
+		return domain.PolicyChangeEvent{Op: domain.PolicyEventUpsert, PolicyID: id, Version: v}
+	}
+	del := func(id string, v int) domain.PolicyChangeEvent {
+		return domain.PolicyChangeEvent{Op: domain.PolicyEventDelete, PolicyID: id, Version: v}
+	}
+
+	tests := []struct {
+		name   string
+		db     func(r *memPolicyRepo) // Изменение в БД, о котором сообщает событие
+		events []domain.PolicyChangeEvent
+		agent  string
+		want   domain.PolicyEffect
+		reload bool // Ожидается полная перезагрузка
+	}{
+		{
+			name:   "new version applied",
+			db:     func(r *memPolicyRepo) { r.put("p1", "agent-1", "crm.read", domain.EffectSandbox, 2) },
+			events: []domain.PolicyChangeEvent{upsert("p1", 2)}, agent: "agent-1", want: domain.EffectSandbox,
+		},
+		{
+			name:   "new policy applied",
+			db:     func(r *memPolicyRepo) { r.put("p2", "agent-2", "crm.read", domain.EffectAllow, 1) },
+			events: []domain.PolicyChangeEvent{upsert("p2", 1)}, agent: "agent-2", want: domain.EffectAllow,
+		},
+		{
+			// Событие старее кэша (пришло после полной перезагрузки): строку не перечитываем
+			name:   "stale event ignored",
+			db:     func(r *memPolicyRepo) { r.put("p1", "agent-1", "crm.read", domain.EffectDeny, 1) },
+			events: []domain.PolicyChangeEvent{upsert("p1", 1)}, agent: "agent-1", want: domain.EffectAllow,
+		},
+		{
+			name: "policy moved to another agent",
+			db: func(r *memPolicyRepo) {
+				r.put("p1", "agent-2", "crm.read", domain.EffectAllow, 2)
+			},
+			events: []domain.PolicyChangeEvent{upsert("p1", 2)}, agent: "agent-1", want: domain.EffectDeny,
+		},
+		{
+			name:   "deleted",
+			db:     func(r *memPolicyRepo) { delete(r.policies, "p1") },
+			events: []domain.PolicyChangeEvent{del("p1", 1)}, agent: "agent-1", want: domain.EffectDeny,
+		},
+		{
+			// Удаление старой версии после отката (политика воссоздана с версией 3)
+			name:   "delete of older version ignored",
+			db:     func(r *memPolicyRepo) { r.put("p1", "agent-1", "crm.read", domain.EffectSandbox, 3) },
+			events: []domain.PolicyChangeEvent{upsert("p1", 3), del("p1", 1)}, agent: "agent-1", want: domain.EffectSandbox,
+		},
+		{
+			name:   "upsert of policy already deleted",
+			db:     func(r *memPolicyRepo) { delete(r.policies, "p1") },
+			events: []domain.PolicyChangeEvent{upsert("p1", 2)}, agent: "agent-1", want: domain.EffectDeny,
+		},
+		{
+			name:   "refresh",
+			db:     func(r *memPolicyRepo) { r.put("p1", "agent-1", "crm.read", domain.EffectQuarantine, 1) },
+			events: []domain.PolicyChangeEvent{domain.ParsePolicyChangeEvent("refresh")}, agent: "agent-1", want: domain.EffectQuarantine, reload: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemPolicyRepo()
+			repo.put("p1", "agent-1", "crm.read", domain.EffectAllow, 1)
+			e := testEnforcer(t, repo)
+
+			tt.db(repo)
+			for _, ev := range tt.events {
+				if err := e.ApplyChange(context.Background(), ev); err != nil {
+					t.Fatalf("ApplyChange(%+v) error = %v", ev, err)
+				}
+			}
+
+			if got := e.GetPolicy(tt.agent, "crm.read").Effect; got != tt.want {
+				t.Errorf("GetPolicy(%s).Effect = %s, want %s", tt.agent, got, tt.want)
+			}
+			if reloaded := repo.loads > 1; reloaded != tt.reload {
+				t.Errorf("full reloads = %d, want reload %v", repo.loads-1, tt.reload)
+			}
+		})
+	}
+}
+
+func TestChecksumMatchesRepository(t *testing.T) {
+	repo := newMemPolicyRepo()
+	e := testEnforcer(t, repo)
+	assertInSync := func(step string) {
+		t.Helper()
+		count, sum := e.Checksum()
+		dbCount, dbSum, _ := repo.PolicyChecksum(context.Background())
+		if count != dbCount || sum != dbSum {
+			t.Errorf("%s: cache checksum %d/%s, db %d/%s", step, count, sum, dbCount, dbSum)
+		}
+	}
+	assertInSync("empty")
+
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprintf("p%d", i)
+		repo.put(id, "agent-1", fmt.Sprintf("cap.%d", i), domain.EffectAllow, 1)
+		if err := e.ApplyChange(context.Background(), domain.PolicyChangeEvent{Op: domain.PolicyEventUpsert, PolicyID: id, Version: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertInSync("after upserts")
+
+	delete(repo.policies, "p2")
+	if err := e.ApplyChange(context.Background(), domain.PolicyChangeEvent{Op: domain.PolicyEventDelete, PolicyID: "p2", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	assertInSync("after delete")
+}
+
+func TestCheckDrift(t *testing.T) {
+	repo := newMemPolicyRepo()
+	repo.put("p1", "agent-1", "crm.read", domain.EffectAllow, 1)
+	e := testEnforcer(t, repo)
+
+	if drift, err := e.CheckDrift(context.Background()); err != nil || drift {
+		t.Fatalf("CheckDrift() in sync = %v, %v", drift, err)
+	}
+
+	// Событие потеряно: БД изменилась, кэш — нет
+	repo.put("p1", "agent-1", "crm.read", domain.EffectDeny, 2)
+	drift, err := e.CheckDrift(context.Background())
+	if err != nil || !drift {
+		t.Fatalf("CheckDrift() after lost event = %v, %v; want drift", drift, err)
+	}
+	if got := e.GetPolicy("agent-1", "crm.read"); got.Version != 2 || got.Effect != domain.EffectDeny {
+		t.Errorf("policy after drift reload = v%d %s, want v2 DENY", got.Version, got.Effect)
+	}
+}
@@ -0,0 +1,131 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Detector находит чувствительные фрагменты в строке и заменяет их маской.
+type Detector interface {
+	Name() string
+	Mask(s string) string
+}
+
+// DefaultDetectors возвращает встроенный набор детекторов PII (от специфичных к общим).
+func DefaultDetectors() []Detector {
+	return []Detector{
+		IBANDetector{},
+		CardDetector{},
+		EmailDetector{},
+		PhoneDetector{},
+	}
+}
+
+var (
+	emailRe = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	phoneRe = regexp.MustCompile(`\+?\d[\d\s().\-]{8,}\d`)
+	cardRe  = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+	ibanRe  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?:[ ]?[A-Z0-9]){11,30}\b`)
+)
+
+// EmailDetector оставляет только домен: "john@corp.io" -> "***@corp.io".
+type EmailDetector struct{}
+
+func (EmailDetector) Name() string { return "email" }
+
+func (EmailDetector) Mask(s string) string {
+	return emailRe.ReplaceAllString(s, "***@$1")
+}
+
+// PhoneDetector оставляет две последние цифры номера.
+type PhoneDetector struct{}
+
+func (PhoneDetector) Name() string { return "phone" }
+
+func (PhoneDetector) Mask(s string) string {
+	return phoneRe.ReplaceAllStringFunc(s, func(m string) string {
+		digits := onlyDigits(m)
+		// Короткие последовательности — скорее ID или сумма, чем телефон
+		if len(digits) < 10 || len(digits) > 15 {
+			return m
+		}
+		return "***" + digits[len(digits)-2:]
+	})
+}
+
+// CardDetector маскирует номера карт, прошедшие проверку Луна, оставляя 4 последние цифры.
+type CardDetector struct{}
+
+func (CardDetector) Name() string { return "card" }
+
+func (CardDetector) Mask(s string) string {
+	return cardRe.ReplaceAllStringFunc(s, func(m string) string {
+		digits := onlyDigits(m)
+		if len(digits) < 13 || len(digits) > 19 || !luhnValid(digits) {
+			return m
+		}
+		return strings.Repeat("*", len(digits)-4) + digits[len(digits)-4:]
+	})
+}
+
+// IBANDetector маскирует IBAN с корректной контрольной суммой (mod 97), оставляя код страны и 4 последних символа.
+type IBANDetector struct{}
+
+func (IBANDetector) Name() string { return "iban" }
+
+func (IBANDetector) Mask(s string) string {
+	return ibanRe.ReplaceAllStringFunc(s, func(m string) string {
+		iban := strings.ReplaceAll(m, " ", "")
+		if !ibanValid(iban) {
+			return m
+		}
+		return iban[:2] + strings.Repeat("*", len(iban)-6) + iban[len(iban)-4:]
+	})
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func ibanValid(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	// Переносим первые 4 символа в конец и считаем остаток по модулю 97 «на лету»
+	rearranged := iban[4:] + iban[:4]
+	rem := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
@@ -0,0 +1,178 @@
+package redact
+
+/*
+Файл redactor.go реализует фильтрацию данных, которые шлюз отдает агенту и сохраняет в аудит.
+
+Правила (Rules) привязываются к политике через поле Conditions и применяются независимо:
+- response_filter — к ответу коннектора перед возвратом агенту;
+- audit_filter    — к Payload/Response события перед записью в AgentFS.
+
+Поддерживаемые операции:
+- Drop Fields: удаление ключей на любом уровне вложенности (например, "ssn", "password");
+- Masking: маскирование строковых значений детекторами (email, phone, card, iban);
+- Truncation: усечение больших массивов до MaxArrayLen элементов.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Rules описывает набор правил фильтрации для одного направления (ответ или аудит).
+type Rules struct {
+	DropFields  []string `json:"drop_fields"`   // Ключи, удаляемые на любом уровне вложенности
+	Mask        []string `json:"mask"`          // Имена детекторов: email, phone, card, iban
+	MaxArrayLen int      `json:"max_array_len"` // Максимальная длина массива (0 — без ограничений)
+}
+
+// IsEmpty сообщает, что правила не меняют данные (можно пропустить обход).
+func (r *Rules) IsEmpty() bool {
+	return r == nil || (len(r.DropFields) == 0 && len(r.Mask) == 0 && r.MaxArrayLen <= 0)
+}
+
+// PolicyFilters — правила вывода, прикрепленные к политике.
+type PolicyFilters struct {
+	Response *Rules `json:"response_filter"` // Что увидит агент
+	Audit    *Rules `json:"audit_filter"`    // Что попадет в AgentFS
+}
+
+// FromConditions извлекает правила вывода из Conditions политики.
+// Отсутствующие условия — «без фильтрации»; битые возвращают ошибку: молча пропустить
+// фильтр значило бы отдать агенту или записать в аудит нефильтрованные данные.
+func FromConditions(raw json.RawMessage) (PolicyFilters, error) {
+	var f PolicyFilters
+	if len(raw) == 0 {
+		return f, nil
+	}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return PolicyFilters{}, fmt.Errorf("redact: invalid filters in conditions: %w", err)
+	}
+	return f, nil
+}
+
+// Redactor применяет правила к произвольным JSON-структурам.
+// Набор детекторов расширяемый: достаточно реализовать интерфейс Detector.
+// Детекторы применяются в порядке регистрации: более специфичные (IBAN, карты)
+// должны идти раньше общих (телефон), чтобы не «откусывать» части чужих номеров.
+type Redactor struct {
+	order     []Detector
+	detectors map[string]Detector
+}
+
+func NewRedactor(detectors ...Detector) *Redactor {
+	r := &Redactor{detectors: make(map[string]Detector, len(detectors))}
+	for _, d := range detectors {
+		if _, ok := r.detectors[d.Name()]; !ok {
+			r.order = append(r.order, d)
+		}
+		r.detectors[d.Name()] = d
+	}
+	return r
+}
+
+// DetectorNames возвращает имена зарегистрированных детекторов в порядке применения.
+func (r *Redactor) DetectorNames() []string {
+	names := make([]string, 0, len(r.order))
+	for _, d := range r.order {
+		names = append(names, d.Name())
+	}
+	return names
+}
+
+// Validate проверяет, что все детекторы, упомянутые в правилах, зарегистрированы.
+func (r *Redactor) Validate(rules *Rules) error {
+	if rules == nil {
+		return nil
+	}
+	for _, name := range rules.Mask {
+		if _, ok := r.detectors[name]; !ok {
+			return fmt.Errorf("redact: unknown detector %q", name)
+		}
+	}
+	return nil
+}
+
+// ApplyJSON фильтрует JSON-документ. При пустых правилах данные возвращаются без копирования.
+func (r *Redactor) ApplyJSON(data []byte, rules *Rules) ([]byte, error) {
+	if rules.IsEmpty() || len(data) == 0 {
+		return data, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("redact: response is not valid JSON: %w", err)
+	}
+
+	return json.Marshal(r.Apply(v, rules))
+}
+
+// ApplyMap — вариант Apply для Payload аудита.
+func (r *Redactor) ApplyMap(m map[string]interface{}, rules *Rules) map[string]interface{} {
+	if rules.IsEmpty() || m == nil {
+		return m
+	}
+	out, _ := r.Apply(m, rules).(map[string]interface{})
+	return out
+}
+
+// Apply возвращает отфильтрованную копию значения. Исходная структура не изменяется,
+// поэтому одну и ту же копию ответа можно независимо фильтровать для агента и для аудита.
+func (r *Redactor) Apply(v interface{}, rules *Rules) interface{} {
+	if rules.IsEmpty() {
+		return v
+	}
+
+	drop := make(map[string]struct{}, len(rules.DropFields))
+	for _, f := range rules.DropFields {
+		drop[strings.ToLower(f)] = struct{}{}
+	}
+
+	requested := make(map[string]bool, len(rules.Mask))
+	for _, name := range rules.Mask {
+		requested[name] = true
+	}
+	masks := make([]Detector, 0, len(rules.Mask))
+	for _, d := range r.order {
+		if requested[d.Name()] {
+			masks = append(masks, r.detectors[d.Name()])
+		}
+	}
+
+	return r.walk(v, drop, masks, rules.MaxArrayLen)
+}
+
+func (r *Redactor) walk(v interface{}, drop map[string]struct{}, masks []Detector, maxLen int) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if _, ok := drop[strings.ToLower(k)]; ok {
+				continue
+			}
+			out[k] = r.walk(item, drop, masks, maxLen)
+		}
+		return out
+
+	case []interface{}:
+		n := len(val)
+		if maxLen > 0 && n > maxLen {
+			n = maxLen
+		}
+		out := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			out[i] = r.walk(val[i], drop, masks, maxLen)
+		}
+		return out
+
+	case string:
+		for _, d := range masks {
+			val = d.Mask(val)
+		}
+		return val
+
+	default:
+		// Числа, bool и null не маскируем: номера карт и телефонов в JSON приходят строками
+		return val
+	}
+}
@@ -0,0 +1,106 @@
+package redact
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFromConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		want       PolicyFilters
+		wantErr    bool
+	}{
+		{name: "empty"},
+		{name: "no filters", conditions: `{"max_amount": 1000}`},
+		{
+			name:       "both filters",
+			conditions: `{"response_filter":{"drop_fields":["ssn"]},"audit_filter":{"mask":["email"],"max_array_len":5}}`,
+			want: PolicyFilters{
+				Response: &Rules{DropFields: []string{"ssn"}},
+				Audit:    &Rules{Mask: []string{"email"}, MaxArrayLen: 5},
+			},
+		},
+		{name: "not json", conditions: `{"response_filter":`, wantErr: true},
+		{name: "filter is a string", conditions: `{"response_filter":"ssn"}`, wantErr: true},
+		{name: "drop_fields is a string", conditions: `{"audit_filter":{"drop_fields":"password"}}`, wantErr: true},
+		{name: "mask is an object", conditions: `{"audit_filter":{"mask":{"email":true}}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromConditions(json.RawMessage(tt.conditions))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromConditions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromConditions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorValidate(t *testing.T) {
+	r := NewRedactor(DefaultDetectors()...)
+	tests := []struct {
+		name    string
+		rules   *Rules
+		wantErr bool
+	}{
+		{name: "nil"},
+		{name: "known detectors", rules: &Rules{Mask: []string{"email", "phone", "card", "iban"}}},
+		{name: "unknown detector", rules: &Rules{Mask: []string{"email", "passport"}}, wantErr: true},
+		{name: "detector names are case sensitive", rules: &Rules{Mask: []string{"Email"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.Validate(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedactorApplyJSON(t *testing.T) {
+	r := NewRedactor(DefaultDetectors()...)
+	tests := []struct {
+		name    string
+		rules   *Rules
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "no rules", data: `{"email":"john@corp.io"}`, want: `{"email":"john@corp.io"}`},
+		{
+			name:  "drop fields at any depth, case insensitive",
+			rules: &Rules{DropFields: []string{"ssn"}},
+			data:  `{"ssn":"1","user":{"SSN":"2","name":"x"}}`,
+			want:  `{"user":{"name":"x"}}`,
+		},
+		{
+			name:  "mask email and card",
+			rules: &Rules{Mask: []string{"email", "card"}},
+			data:  `{"contact":"john@corp.io","card":"4111 1111 1111 1111","amount":4111111111111111}`,
+			want:  `{"amount":4111111111111111,"card":"************1111","contact":"***@corp.io"}`,
+		},
+		{
+			name:  "truncate arrays",
+			rules: &Rules{MaxArrayLen: 2},
+			data:  `{"items":[1,2,3],"nested":[[1,2,3]]}`,
+			want:  `{"items":[1,2],"nested":[[1,2]]}`,
+		},
+		{name: "not json fails closed", rules: &Rules{DropFields: []string{"ssn"}}, data: `ssn=1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ApplyJSON([]byte(tt.data), tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("ApplyJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// WriteAdminAudit сохраняет запись журнала административных действий консоли.
+func (r *AgentRepo) WriteAdminAudit(ctx context.Context, e *domain.AdminAuditEntry) error {
+	query := `
+		INSERT INTO admin_audit (user_id, role, action, method, path, outcome, status,
+			target_type, target_id, before_state, after_state, remote_addr, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		e.UserID, e.Role, e.Action, e.Method, e.Path, e.Outcome, e.Status,
+		e.TargetType, e.TargetID, nullJSON(e.Before), nullJSON(e.After), e.RemoteAddr, e.RequestID,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to write admin audit: %w", err)
+	}
+	return nil
+}
+
+// QueryAdminAudit возвращает записи журнала (новые первыми).
+func (r *AgentRepo) QueryAdminAudit(ctx context.Context, f domain.AdminAuditFilter) ([]domain.AdminAuditEntry, error) {
+	entries := make([]domain.AdminAuditEntry, 0)
+	err := r.StreamAdminAudit(ctx, f, func(e *domain.AdminAuditEntry) error {
+		entries = append(entries, *e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// StreamAdminAudit построчно передает записи журнала в fn, не накапливая выборку в памяти (экспорт).
+func (r *AgentRepo) StreamAdminAudit(ctx context.Context, f domain.AdminAuditFilter, fn func(*domain.AdminAuditEntry) error) error {
+	// $N = '' OR ... — опциональные фильтры
+	query := `
+		SELECT id, user_id, role, action, method, path, outcome, status, target_type, target_id,
+			before_state, after_state, remote_addr, request_id, created_at
+		FROM admin_audit
+		WHERE ($1 = '' OR user_id = $1)
+		  AND ($2 = '' OR action = $2)
+		  AND ($3 = '' OR target_type = $3)
+		  AND ($4 = '' OR target_id = $4)
+		  AND ($5 = '' OR outcome = $5)
+		  AND ($6::timestamptz IS NULL OR created_at >= $6)
+		  AND ($7::timestamptz IS NULL OR created_at < $7)
+		ORDER BY created_at DESC
+		LIMIT NULLIF($8, 0)`
+
+	rows, err := r.pool.Query(ctx, query,
+		f.UserID, f.Action, f.TargetType, f.TargetID, f.Outcome, f.From, f.To, f.Limit)
+	if err != nil {
+		return fmt.Errorf("postgres: admin audit query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAdminAudit(rows)
+		if err != nil {
+			return fmt.Errorf("postgres: admin audit scan error: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func scanAdminAudit(row pgx.Row) (*domain.AdminAuditEntry, error) {
+	e := &domain.AdminAuditEntry{}
+	var before, after []byte
+	err := row.Scan(&e.ID, &e.UserID, &e.Role, &e.Action, &e.Method, &e.Path, &e.Outcome, &e.Status,
+		&e.TargetType, &e.TargetID, &before, &after, &e.RemoteAddr, &e.RequestID, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.Before, e.After = before, after
+	return e, nil
+}
+
+// nullJSON — пустое состояние хранится как NULL, а не как невалидный пустой JSONB.
+func nullJSON(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
@@ -6,6 +6,7 @@ package postgres
 и методы управления состоянием агентов:
 - IsBlocked/MarkAsBlocked: проверка и изменение статуса блокировки (Kill-Switch).
 - GetAgent/UpdateStatus: базовые операции управления жизненным циклом агентов.
+- Create/Update/DecommissionAgent: реестр агентов (владельцы, команда, окружение, метки).
 
 Этот файл служит базой для расширения репозитория методами аудита, политик и подтверждений,
 расположенными в соседних файлах пакета.
@@ -13,15 +14,15 @@ package postgres
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
 )
@@ -29,6 +30,9 @@ import (
 // AgentRepo Основная структура, инициализация пула, методы для Agents
 type AgentRepo struct {
 	pool *pgxpool.Pool
+
+	// Партиция цепочки хешей для WriteBatch (пусто — события пишутся без цепочки)
+	chainPartition string
 }
 
 // NewAgentRepo — инициализация пула с настройкой MaxConns и жизненного цикла соединений.
@@ -51,7 +55,11 @@ func NewAgentRepo(ctx context.Context, cfg *infra.Config) *AgentRepo {
 		log.Fatalf("Unable to create connection pool: %v", err)
 	}
 
-	return &AgentRepo{pool: pool}
+	repo := &AgentRepo{pool: pool}
+	if cfg.Audit.Chain.Enabled {
+		repo.chainPartition = cfg.Audit.Chain.Partition
+	}
+	return repo
 }
 
 func (r *AgentRepo) Close() { r.pool.Close() }
@@ -61,7 +69,7 @@ func (r *AgentRepo) Ping(ctx context.Context) error { return r.pool.Ping(ctx) }
 
 // UpdateAgentStatus меняет основной статус (например, для Kill-switch)
 func (r *AgentRepo) UpdateAgentStatus(ctx context.Context, agentID string, status string) error {
-	query := `UPDATE agents SET status = $1, updated_at = NOW() WHERE id = $2`
+	query := `UPDATE agents SET status = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL`
 
 	result, err := r.pool.Exec(ctx, query, status, agentID)
 	if err != nil {
@@ -77,33 +85,34 @@ func (r *AgentRepo) UpdateAgentStatus(ctx context.Context, agentID string, statu
 
 // SetAgentSandbox включает/выключает песочницу
 func (r *AgentRepo) SetAgentSandbox(ctx context.Context, agentID string, enabled bool) error {
-	query := `UPDATE agents SET is_sandbox = $1, updated_at = NOW() WHERE id = $2`
+	query := `UPDATE agents SET is_sandbox = $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL`
 
-	_, err := r.pool.Exec(ctx, query, enabled, agentID)
-	return err
+	ct, err := r.pool.Exec(ctx, query, enabled, agentID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return domain.ErrAgentNotFound
+	}
+	return nil
 }
 
 func (r *AgentRepo) GetSandboxAgents(ctx context.Context) ([]string, error) {
 	// Выбираем агентов, у которых в поле status или в отдельной таблице указан sandbox
-	query := `SELECT id FROM agents WHERE is_sandbox = true`
-
-	var p []string
-	err := r.pool.QueryRow(ctx, query).Scan(&p)
+	query := `SELECT id FROM agents WHERE is_sandbox = true AND deleted_at IS NULL`
 
+	rows, err := r.pool.Query(ctx, query)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
+		return nil, fmt.Errorf("postgres: failed to fetch sandbox agents: %w", err)
 	}
-	return p, nil
+	return pgx.CollectRows(rows, pgx.RowTo[string])
 }
 
-// GetBlockedIDs возвращает список ID всех агентов со статусом 'blocked'.
+// GetBlockedIDs возвращает список ID всех агентов со статусом 'blocked' и выведенных из эксплуатации.
 // Используется для "прогрева" кэша Kill-Switch при старте системы.
 func (r *AgentRepo) GetBlockedIDs(ctx context.Context) ([]string, error) {
 	// Мы выбираем только ID, так как для L1/L2 кэша нам не нужны полные данные агента
-	query := `SELECT id FROM agents WHERE status = 'blocked'`
+	query := `SELECT id FROM agents WHERE status = 'blocked' OR deleted_at IS NOT NULL`
 
 	rows, err := r.pool.Query(ctx, query)
 	if err != nil {
@@ -173,101 +182,151 @@ func (r *AgentRepo) GetGlobalStats(ctx context.Context) (*domain.GlobalStats, er
 
 	return stats, nil
 }
-func (r *AgentRepo) FetchLogs(ctx context.Context, agentID, capID string) ([]audit.AuditEvent, error) {
-	// $1 = '' OR agent_id = $1 — это эффективный способ сделать фильтры опциональными
-	query := `
-		SELECT id, agent_id, capability_id, status, duration_ms, timestamp 
-		FROM audit_logs 
-		WHERE ($1 = '' OR agent_id = $1) 
-		  AND ($2 = '' OR capability_id = $2)
-		ORDER BY timestamp DESC 
-		LIMIT 100`
-
-	rows, err := r.pool.Query(ctx, query, agentID, capID)
-	if err != nil {
-		return nil, fmt.Errorf("postgres: query failed: %w", err)
-	}
-	defer rows.Close()
 
-	// Инициализируем пустой слайс (не nil), чтобы фронтенд получил [] вместо null
-	logs := make([]audit.AuditEvent, 0)
+// agentColumns — общий список колонок agents для scanAgent.
+const agentColumns = `id, name, status, is_sandbox, scopes, description, owners, team, environment, labels,
+	metadata, last_activity, created_at, updated_at, created_by, deleted_at, COALESCE(deleted_by, ''),
+	COALESCE(token_ttl_seconds, 0)`
 
-	for rows.Next() {
-		var log audit.AuditEvent
-		err := rows.Scan(
-			&log.ID,
-			&log.AgentID,
-			&log.CapabilityID,
-			&log.Status,
-			&log.DurationMs,
-			&log.Timestamp,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("postgres: scan error: %w", err)
-		}
-		logs = append(logs, log)
-	}
-
-	// Проверяем на ошибки, возникшие во время итерации (например, обрыв связи)
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("postgres: rows iteration error: %w", err)
+func scanAgent(row pgx.Row) (*domain.Agent, error) {
+	a := &domain.Agent{}
+	err := row.Scan(
+		&a.ID, &a.Name, &a.Status, &a.IsSandbox, &a.Scopes,
+		&a.Description, &a.Owners, &a.Team, &a.Environment, &a.Labels,
+		&a.Metadata, &a.LastActivity, &a.CreatedAt, &a.UpdatedAt, &a.CreatedBy, &a.DeletedAt, &a.DeletedBy,
+		&a.TokenTTLSeconds,
+	)
+	if err != nil {
+		return nil, err
 	}
-
-	return logs, nil
+	return a, nil
 }
 
+// GetAgent возвращает агента, в том числе выведенного из эксплуатации (для истории в консоли).
 func (r *AgentRepo) GetAgent(ctx context.Context, id string) (*domain.Agent, error) {
-	query := `
-		SELECT id, name, status, is_sandbox, scopes, last_activity, created_at, updated_at, metadata 
-		FROM agents 
-		WHERE id = $1`
-
-	var a domain.Agent
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&a.ID, &a.Name, &a.Status, &a.IsSandbox, &a.Scopes,
-		&a.LastActivity, &a.CreatedAt, &a.UpdatedAt, &a.Metadata,
-	)
+	query := `SELECT ` + agentColumns + ` FROM agents WHERE id = $1`
 
+	a, err := scanAgent(r.pool.QueryRow(ctx, query, id))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil // Возвращаем nil без ошибки, чтобы хендлер выдал 404
 		}
 		return nil, err
 	}
-	return &a, nil
+	return a, nil
 }
 
-func (r *AgentRepo) ListAgents(ctx context.Context) ([]*domain.Agent, error) {
-	// Выбираем основные поля для списка.
-	// Metadata и Scopes берем, чтобы фронт мог сразу их показать без доп. запросов.
-	query := `
-		SELECT id, name, status, is_sandbox, last_activity, created_at, metadata 
-		FROM agents 
-		ORDER BY last_activity DESC NULLS LAST`
+// ListAgents возвращает агентов с фильтрами реестра. Пустые значения фильтра не применяются.
+func (r *AgentRepo) ListAgents(ctx context.Context, f domain.AgentFilter) ([]*domain.Agent, error) {
+	if f.Labels == nil {
+		f.Labels = map[string]string{}
+	}
+	labels, err := json.Marshal(f.Labels)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := json.Marshal([]string{f.Owner})
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := r.pool.Query(ctx, query)
+	query := `SELECT ` + agentColumns + `
+		FROM agents
+		WHERE ($1 OR deleted_at IS NULL)
+		  AND ($2 = '' OR team = $2)
+		  AND ($3 = '' OR environment = $3)
+		  AND ($4 = '' OR owners @> $5::jsonb)
+		  AND labels @> $6::jsonb
+		ORDER BY last_activity DESC NULLS LAST, name`
+
+	rows, err := r.pool.Query(ctx, query, f.IncludeDeleted, f.Team, f.Environment, f.Owner, owner, labels)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var agents []*domain.Agent
+	agents := make([]*domain.Agent, 0)
 	for rows.Next() {
-		a := &domain.Agent{}
-		err := rows.Scan(
-			&a.ID,
-			&a.Name,
-			&a.Status,
-			&a.IsSandbox,
-			&a.LastActivity,
-			&a.CreatedAt,
-			&a.Metadata,
-		)
+		a, err := scanAgent(rows)
 		if err != nil {
 			return nil, err
 		}
 		agents = append(agents, a)
 	}
+	return agents, rows.Err()
+}
+
+// CreateAgent регистрирует агента. ID генерируется базой.
+func (r *AgentRepo) CreateAgent(ctx context.Context, a *domain.Agent) error {
+	query := `
+		INSERT INTO agents (id, name, status, is_sandbox, scopes, description, owners, team, environment,
+		                    labels, metadata, created_by, token_ttl_seconds)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, 0))
+		RETURNING id, created_at, updated_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		a.Name, a.Status, a.IsSandbox, a.Scopes, a.Description, a.Owners, a.Team, a.Environment,
+		a.Labels, a.Metadata, a.CreatedBy, a.TokenTTLSeconds,
+	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	if isUniqueViolation(err) {
+		return domain.ErrAgentNameTaken
+	}
+	if err != nil {
+		return fmt.Errorf("postgres: failed to create agent: %w", err)
+	}
+	return nil
+}
+
+// UpdateAgent сохраняет редактируемые поля реестра. Статус и песочница здесь не меняются.
+func (r *AgentRepo) UpdateAgent(ctx context.Context, a *domain.Agent) error {
+	query := `
+		UPDATE agents
+		SET name = $1, scopes = $2, description = $3, owners = $4, team = $5, environment = $6,
+		    labels = $7, metadata = $8, token_ttl_seconds = NULLIF($9, 0), updated_at = NOW()
+		WHERE id = $10 AND deleted_at IS NULL
+		RETURNING updated_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		a.Name, a.Scopes, a.Description, a.Owners, a.Team, a.Environment, a.Labels, a.Metadata, a.TokenTTLSeconds, a.ID,
+	).Scan(&a.UpdatedAt)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return domain.ErrAgentNotFound
+	case isUniqueViolation(err):
+		return domain.ErrAgentNameTaken
+	case err != nil:
+		return fmt.Errorf("postgres: failed to update agent: %w", err)
+	}
+	return nil
+}
+
+// DecommissionAgent выводит агента из эксплуатации (мягкое удаление). Строка остается для
+// аудита и истории, а сам агент навсегда попадает в список блокировки (см. GetBlockedIDs).
+func (r *AgentRepo) DecommissionAgent(ctx context.Context, id, author string) error {
+	// Вместе с агентом отзываются все его секреты Client Credentials
+	query := `
+		WITH agent AS (
+			UPDATE agents
+			SET status = $1, is_sandbox = false, deleted_at = NOW(), deleted_by = $2, updated_at = NOW()
+			WHERE id = $3 AND deleted_at IS NULL
+			RETURNING id
+		), revoked AS (
+			UPDATE agent_credentials SET revoked_at = NOW(), revoked_by = $2
+			WHERE agent_id IN (SELECT id FROM agent) AND revoked_at IS NULL
+		)
+		SELECT count(*) FROM agent`
+
+	var n int
+	if err := r.pool.QueryRow(ctx, query, domain.StatusDecommissioned, author, id).Scan(&n); err != nil {
+		return fmt.Errorf("postgres: failed to decommission agent: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrAgentNotFound
+	}
+	return nil
+}
 
-	return agents, nil
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
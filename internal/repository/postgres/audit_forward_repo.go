@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+// UnchainedAuditEvents возвращает число событий вне цепочки хешей (chain_seq IS NULL) и время
+// последнего из них. Такие события пишут шлюзы с выключенным audit.chain, и пересылка их не видит.
+func (r *AgentRepo) UnchainedAuditEvents(ctx context.Context) (int64, time.Time, error) {
+	var (
+		count  int64
+		latest *time.Time
+	)
+	err := r.pool.QueryRow(ctx, `SELECT count(*), max(timestamp) FROM audit_logs WHERE chain_seq IS NULL`).Scan(&count, &latest)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("postgres: failed to count unchained audit events: %w", err)
+	}
+	if latest == nil {
+		return count, time.Time{}, nil
+	}
+	return count, *latest, nil
+}
+
+// ForwardChainBatch передает в ship следующий пакет событий партиции после курсора consumer
+// и сдвигает курсор, только если ship вернул nil. Курсор блокируется на время отправки;
+// если его держит другая реплика, возвращается 0 без ожидания. fromHead — новый курсор
+// начинается с текущей головы партиции (без истории), иначе — с первого события.
+func (r *AgentRepo) ForwardChainBatch(ctx context.Context, consumer, partition string, fromHead bool, limit int,
+	ship func([]audit.AuditEvent) error) (int, error) {
+	n := 0
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO audit_forward_cursors (consumer, partition, seq)
+			SELECT $1, $2, CASE WHEN $3 THEN COALESCE((SELECT seq FROM audit_chain_heads WHERE partition = $2), 0) ELSE 0 END
+			ON CONFLICT (consumer, partition) DO NOTHING`, consumer, partition, fromHead); err != nil {
+			return fmt.Errorf("postgres: failed to init forward cursor: %w", err)
+		}
+
+		var cursor int64
+		err := tx.QueryRow(ctx, `
+			SELECT seq FROM audit_forward_cursors
+			WHERE consumer = $1 AND partition = $2
+			FOR UPDATE SKIP LOCKED`, consumer, partition).Scan(&cursor)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil // Партицию сейчас отправляет другая реплика
+		}
+		if err != nil {
+			return fmt.Errorf("postgres: failed to lock forward cursor: %w", err)
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT `+auditSelectColumns+`, chain_seq
+			FROM audit_logs
+			WHERE chain_partition = $1 AND chain_seq > $2
+			ORDER BY chain_seq
+			LIMIT $3`, partition, cursor, limit)
+		if err != nil {
+			return fmt.Errorf("postgres: query failed: %w", err)
+		}
+		var last int64
+		events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.AuditEvent, error) {
+			e, err := scanAuditEvent(row, &last)
+			if err != nil {
+				return audit.AuditEvent{}, err
+			}
+			return *e, nil
+		})
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		if err := ship(events); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE audit_forward_cursors SET seq = $3, updated_at = NOW()
+			WHERE consumer = $1 AND partition = $2`, consumer, partition, last); err != nil {
+			return fmt.Errorf("postgres: failed to move forward cursor: %w", err)
+		}
+		n = len(events)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,405 @@
+package postgres
+
+/*
+Файл audit_partition_repo.go управляет партициями хранения audit_logs (см. audit/partition.go):
+создание наперед, архивация и удаление по сроку, восстановление архива.
+
+DDL не принимает параметры, поэтому границы партиций подставляются литералами — они
+всегда получены из audit.PartitionFor/ParsePartition, а имена экранируются pgx.Identifier.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+// chainRecordColumns — все колонки audit_logs в порядке scanChainRecord.
+const chainRecordColumns = `COALESCE(chain_partition, ''), COALESCE(chain_seq, 0), COALESCE(prev_hash, ''), COALESCE(hash, ''),
+	id, trace_id, agent_id, capability_id, payload, mode, status, response,
+	duration_ms, timestamp, risk_score, risk_findings, COALESCE(policy_id, ''), policy_version, break_glass`
+
+func scanChainRecord(row pgx.Row) (*audit.ChainRecord, error) {
+	rec := &audit.ChainRecord{}
+	var payload, resp, findings []byte
+	if err := row.Scan(&rec.Partition, &rec.Seq, &rec.PrevHash, &rec.Hash,
+		&rec.ID, &rec.TraceID, &rec.AgentID, &rec.CapabilityID, &payload, &rec.Mode, &rec.Status, &resp,
+		&rec.DurationMs, &rec.Timestamp, &rec.RiskScore, &findings, &rec.PolicyID, &rec.PolicyVersion, &rec.BreakGlass,
+	); err != nil {
+		return nil, fmt.Errorf("postgres: chain scan error: %w", err)
+	}
+	rec.Payload, rec.Response, rec.RiskFindings = payload, resp, findings
+	return rec, nil
+}
+
+// auditMaintenanceLockKey — ключ pg_advisory_lock обслуживания партиций (один исполнитель на кластер).
+const auditMaintenanceLockKey = 0x61756469 // "audi"
+
+// WithAuditMaintenanceLock выполняет fn, удерживая сессионную advisory-блокировку обслуживания.
+// Если блокировку держит другая реплика, fn не вызывается и возвращается false.
+func (r *AgentRepo) WithAuditMaintenanceLock(ctx context.Context, fn func() error) (bool, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, auditMaintenanceLockKey).Scan(&locked); err != nil {
+		return false, fmt.Errorf("postgres: failed to take maintenance lock: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	// Разблокировка — на том же соединении; контекст вызова мог быть уже отменен
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, auditMaintenanceLockKey)
+	return true, fn()
+}
+
+// AuditPartitions возвращает партиции хранения audit_logs по возрастанию времени (без DEFAULT).
+func (r *AgentRepo) AuditPartitions(ctx context.Context) ([]audit.Partition, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT c.relname, a.restored_at IS NOT NULL
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		LEFT JOIN audit_archives a ON a.partition = c.relname
+		WHERE i.inhparent = 'audit_logs'::regclass
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to list audit partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var parts []audit.Partition
+	for rows.Next() {
+		var name string
+		var held bool
+		if err := rows.Scan(&name, &held); err != nil {
+			return nil, err
+		}
+		p, ok := audit.ParsePartition(name)
+		if !ok {
+			continue // DEFAULT и таблицы, созданные вручную
+		}
+		p.Held = held
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+// CreateAuditPartition создает партицию и подключает ее к audit_logs. Строки ее диапазона,
+// успевшие попасть в DEFAULT, переносятся в нее: иначе ATTACH отказал бы.
+func (r *AgentRepo) CreateAuditPartition(ctx context.Context, p audit.Partition) error {
+	name := pgx.Identifier{p.Name}.Sanitize()
+	from, to := partitionBound(p.From), partitionBound(p.To)
+
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		stmts := []string{
+			`CREATE TABLE ` + name + ` (LIKE audit_logs INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`,
+			`INSERT INTO ` + name + ` SELECT * FROM audit_logs_default WHERE timestamp >= ` + from + ` AND timestamp < ` + to,
+			`DELETE FROM audit_logs_default WHERE timestamp >= ` + from + ` AND timestamp < ` + to,
+			`ALTER TABLE audit_logs ATTACH PARTITION ` + name + ` FOR VALUES FROM (` + from + `) TO (` + to + `)`,
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("postgres: failed to create partition %s: %w", p.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func partitionBound(t time.Time) string {
+	return "'" + t.UTC().Format("2006-01-02 15:04:05") + "+00'"
+}
+
+// ExpireAuditPartition удаляет партицию хранения в одной транзакции:
+//  1. блокирует партицию от записи (SHARE): архив и якоря видят окончательное содержимое;
+//  2. если archive != nil — пишет все строки в архив и регистрирует его в audit_archives;
+//  3. сдвигает якорь каждой партиции цепочки и сохраняет удаляемые события выше него
+//     (см. advanceAnchors; подписывает sign, если задан);
+//  4. удаляет партицию.
+//
+// При ошибке транзакция откатывается и партиция остается на месте.
+func (r *AgentRepo) ExpireAuditPartition(ctx context.Context, p audit.Partition, archive *audit.ArchiveWriter,
+	sign func(*audit.Checkpoint) error) error {
+	name := pgx.Identifier{p.Name}.Sanitize()
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `LOCK TABLE `+name+` IN SHARE MODE`); err != nil {
+			return fmt.Errorf("postgres: failed to lock partition %s: %w", p.Name, err)
+		}
+
+		if archive != nil {
+			if err := r.archivePartition(ctx, tx, name, archive); err != nil {
+				return err
+			}
+			meta, err := archive.Close()
+			archive = nil
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO audit_archives (partition, range_from, range_to, path, row_count, sha256, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (partition) DO UPDATE SET
+					path = EXCLUDED.path, row_count = EXCLUDED.row_count, sha256 = EXCLUDED.sha256,
+					created_at = EXCLUDED.created_at, restored_at = NULL`,
+				meta.Partition, meta.From, meta.To, meta.Path, meta.Rows, meta.SHA256, meta.CreatedAt); err != nil {
+				return fmt.Errorf("postgres: failed to register archive: %w", err)
+			}
+		}
+
+		if err := r.advanceAnchors(ctx, tx, p, sign); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DROP TABLE `+name); err != nil {
+			return fmt.Errorf("postgres: failed to drop partition %s: %w", p.Name, err)
+		}
+		return nil
+	})
+	if archive != nil {
+		archive.Abort()
+	}
+	return err
+}
+
+func (r *AgentRepo) archivePartition(ctx context.Context, tx pgx.Tx, name string, archive *audit.ArchiveWriter) error {
+	rows, err := tx.Query(ctx, `SELECT `+chainRecordColumns+` FROM `+name+` ORDER BY timestamp, id`)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read partition: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec, err := scanChainRecord(rows)
+		if err != nil {
+			return err
+		}
+		if err := archive.Write(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// advanceAnchors сдвигает якорь каждой партиции цепочки, затронутой удаляемой партицией хранения
+// (см. audit.PlanAnchor): не выше первого оставшегося события, а удаляемые события выше якоря
+// сохраняет в audit_chain_pruned, чтобы проверка связала цепочку через пропуск.
+func (r *AgentRepo) advanceAnchors(ctx context.Context, tx pgx.Tx, p audit.Partition, sign func(*audit.Checkpoint) error) error {
+	name := pgx.Identifier{p.Name}.Sanitize()
+	rows, err := tx.Query(ctx, `SELECT DISTINCT chain_partition FROM `+name+` WHERE chain_partition IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read chain partitions: %w", err)
+	}
+	chains, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read chain partitions: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, chain := range chains {
+		plan, err := r.planAnchor(ctx, tx, p, chain)
+		if err != nil {
+			return err
+		}
+		if plan.Anchor != nil {
+			cp := plan.Anchor
+			cp.CreatedAt = now
+			if sign != nil {
+				if err := sign(cp); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO audit_chain_anchors (partition, seq, hash, key_id, signature, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (partition) DO UPDATE SET
+					seq = EXCLUDED.seq, hash = EXCLUDED.hash, key_id = EXCLUDED.key_id,
+					signature = EXCLUDED.signature, created_at = EXCLUDED.created_at`,
+				cp.Partition, cp.Seq, cp.Hash, cp.KeyID, cp.Signature, cp.CreatedAt); err != nil {
+				return fmt.Errorf("postgres: failed to save chain anchor: %w", err)
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM audit_chain_pruned WHERE partition = $1 AND seq <= $2`, cp.Partition, cp.Seq); err != nil {
+				return fmt.Errorf("postgres: failed to trim pruned links: %w", err)
+			}
+		}
+		for i := range plan.Pruned {
+			cp := &plan.Pruned[i]
+			cp.CreatedAt = now
+			if sign != nil {
+				if err := sign(cp); err != nil {
+					return err
+				}
+			}
+			// Повторное удаление восстановленной партиции не меняет уже подписанную запись
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO audit_chain_pruned (partition, seq, hash, key_id, signature, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (partition, seq) DO NOTHING`,
+				cp.Partition, cp.Seq, cp.Hash, cp.KeyID, cp.Signature, cp.CreatedAt); err != nil {
+				return fmt.Errorf("postgres: failed to save pruned link: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// planAnchor собирает для audit.PlanAnchor прежний якорь, первое оставшееся событие партиции
+// цепочки и только те удаляемые строки, что могут стать якорем или попасть в pruned.
+func (r *AgentRepo) planAnchor(ctx context.Context, tx pgx.Tx, p audit.Partition, chain string) (audit.AnchorPlan, error) {
+	name := pgx.Identifier{p.Name}.Sanitize()
+
+	var anchorSeq int64
+	err := tx.QueryRow(ctx, `SELECT seq FROM audit_chain_anchors WHERE partition = $1`, chain).Scan(&anchorSeq)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return audit.AnchorPlan{}, fmt.Errorf("postgres: failed to read chain anchor: %w", err)
+	}
+
+	// Первое событие цепочки выше якоря, которое остается в других партициях хранения
+	var retainedSeq *int64
+	if err := tx.QueryRow(ctx, `
+		SELECT MIN(chain_seq) FROM audit_logs
+		WHERE chain_partition = $1 AND chain_seq > $2 AND tableoid <> $3::text::regclass`,
+		chain, anchorSeq, p.Name).Scan(&retainedSeq); err != nil {
+		return audit.AnchorPlan{}, fmt.Errorf("postgres: failed to read retained chain events: %w", err)
+	}
+	limit := int64(math.MaxInt64)
+	if retainedSeq != nil {
+		limit = *retainedSeq
+	}
+
+	// Удаляемые строки от последней ниже первого оставшегося события и выше
+	rows, err := tx.Query(ctx, `
+		SELECT chain_seq, hash FROM `+name+`
+		WHERE chain_partition = $1 AND chain_seq > $2
+		  AND chain_seq >= COALESCE((
+			SELECT MAX(chain_seq) FROM `+name+` WHERE chain_partition = $1 AND chain_seq < $3), $3)
+		ORDER BY chain_seq`, chain, anchorSeq, limit)
+	if err != nil {
+		return audit.AnchorPlan{}, fmt.Errorf("postgres: failed to read chain tails: %w", err)
+	}
+	dropped, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.ChainLink, error) {
+		var l audit.ChainLink
+		err := row.Scan(&l.Seq, &l.Hash)
+		return l, err
+	})
+	if err != nil {
+		return audit.AnchorPlan{}, fmt.Errorf("postgres: failed to read chain tails: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `SELECT seq, hash FROM audit_chain_pruned WHERE partition = $1 AND seq > $2`, chain, anchorSeq)
+	if err != nil {
+		return audit.AnchorPlan{}, fmt.Errorf("postgres: failed to read pruned links: %w", err)
+	}
+	pruned := make(map[int64]string)
+	var seq int64
+	var hash string
+	if _, err := pgx.ForEachRow(rows, []any{&seq, &hash}, func() error {
+		pruned[seq] = hash
+		return nil
+	}); err != nil {
+		return audit.AnchorPlan{}, fmt.Errorf("postgres: failed to read pruned links: %w", err)
+	}
+
+	var retained int64
+	if retainedSeq != nil {
+		retained = *retainedSeq
+	}
+	return audit.PlanAnchor(chain, anchorSeq, dropped, pruned, retained), nil
+}
+
+// PrunedLinks возвращает подписанные hash событий выше якоря, удаленных по сроку.
+func (r *AgentRepo) PrunedLinks(ctx context.Context, partition string) ([]audit.Checkpoint, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT partition, seq, hash, key_id, signature, created_at
+		FROM audit_chain_pruned WHERE partition = $1 ORDER BY seq`, partition)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to read pruned links: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.Checkpoint, error) {
+		var cp audit.Checkpoint
+		err := row.Scan(&cp.Partition, &cp.Seq, &cp.Hash, &cp.KeyID, &cp.Signature, &cp.CreatedAt)
+		return cp, err
+	})
+}
+
+// ChainAnchor возвращает якорь партиции цепочки (nil — начало цепочки не удалялось).
+func (r *AgentRepo) ChainAnchor(ctx context.Context, partition string) (*audit.Checkpoint, error) {
+	cp := &audit.Checkpoint{}
+	err := r.pool.QueryRow(ctx, `
+		SELECT partition, seq, hash, key_id, signature, created_at
+		FROM audit_chain_anchors WHERE partition = $1`, partition,
+	).Scan(&cp.Partition, &cp.Seq, &cp.Hash, &cp.KeyID, &cp.Signature, &cp.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to read chain anchor: %w", err)
+	}
+	return cp, nil
+}
+
+const archiveColumns = `partition, range_from, range_to, path, row_count, sha256, created_at, restored_at`
+
+func scanArchive(row pgx.Row) (audit.Archive, error) {
+	var a audit.Archive
+	err := row.Scan(&a.Partition, &a.From, &a.To, &a.Path, &a.Rows, &a.SHA256, &a.CreatedAt, &a.RestoredAt)
+	return a, err
+}
+
+// AuditArchives возвращает архивы удаленных партиций (новые первыми).
+func (r *AgentRepo) AuditArchives(ctx context.Context) ([]audit.Archive, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+archiveColumns+` FROM audit_archives ORDER BY range_from DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to list archives: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.Archive, error) {
+		return scanArchive(row)
+	})
+}
+
+// AuditArchive возвращает архив партиции (nil — партиция не архивировалась).
+func (r *AgentRepo) AuditArchive(ctx context.Context, partition string) (*audit.Archive, error) {
+	a, err := scanArchive(r.pool.QueryRow(ctx, `SELECT `+archiveColumns+` FROM audit_archives WHERE partition = $1`, partition))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to read archive: %w", err)
+	}
+	return &a, nil
+}
+
+// SetArchiveHold ставит (held) или снимает удержание восстановленной партиции от удаления по сроку.
+func (r *AgentRepo) SetArchiveHold(ctx context.Context, partition string, held bool) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE audit_archives SET restored_at = CASE WHEN $2 THEN NOW() END
+		WHERE partition = $1`, partition, held)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to update archive: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("postgres: archive %s not found", partition)
+	}
+	return nil
+}
+
+// RestoreAuditRecords вставляет строки архива как есть; уже существующие (id, timestamp) пропускаются,
+// поэтому повторное восстановление безопасно. Возвращает число вставленных строк.
+func (r *AgentRepo) RestoreAuditRecords(ctx context.Context, records []*audit.ChainRecord) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	tag, err := r.pool.Exec(ctx,
+		auditInsertQuery(len(records))+` ON CONFLICT (id, timestamp) DO NOTHING`, auditInsertArgs(records)...)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: failed to restore audit records: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
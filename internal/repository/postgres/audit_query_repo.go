@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+// auditSelectColumns — полная запись события для Console API.
+const auditSelectColumns = `id, trace_id, agent_id, capability_id, payload, mode, status, response,
+	duration_ms, timestamp, risk_score, risk_findings, COALESCE(policy_id, ''), policy_version, break_glass`
+
+// QueryAuditEvents возвращает страницу событий аудита по фильтрам и курсору.
+func (r *AgentRepo) QueryAuditEvents(ctx context.Context, q audit.Query) ([]audit.AuditEvent, error) {
+	events := make([]audit.AuditEvent, 0)
+	err := r.StreamAuditEvents(ctx, q, func(e *audit.AuditEvent) error {
+		events = append(events, *e)
+		return nil
+	})
+	return events, err
+}
+
+// StreamAuditEvents построчно передает события в fn, не накапливая выборку в памяти.
+// Limit == 0 — без ограничения (экспорт).
+func (r *AgentRepo) StreamAuditEvents(ctx context.Context, q audit.Query, fn func(*audit.AuditEvent) error) error {
+	query, args, err := buildAuditQuery(q)
+	if err != nil {
+		return err
+	}
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("postgres: query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("postgres: rows iteration error: %w", err)
+	}
+	return nil
+}
+
+// buildAuditQuery собирает WHERE только из заданных фильтров: планировщик видит конкретные
+// условия и выбирает подходящий индекс (GIN по payload, trace_id, agent_id + timestamp).
+func buildAuditQuery(q audit.Query) (string, []any, error) {
+	field, desc, err := q.SortSpec()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.AgentID != "" {
+		where = append(where, "agent_id = "+arg(q.AgentID))
+	}
+	if q.CapabilityID != "" {
+		where = append(where, "capability_id = "+arg(q.CapabilityID))
+	}
+	if q.TraceID != "" {
+		where = append(where, "trace_id = "+arg(q.TraceID))
+	}
+	if q.PolicyID != "" {
+		where = append(where, "policy_id = "+arg(q.PolicyID))
+	}
+	if len(q.Statuses) > 0 {
+		where = append(where, "status = ANY("+arg(q.Statuses)+")")
+	}
+	if len(q.Modes) > 0 {
+		where = append(where, "mode = ANY("+arg(q.Modes)+")")
+	}
+	if q.From != nil {
+		where = append(where, "timestamp >= "+arg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "timestamp < "+arg(*q.To))
+	}
+	if len(q.Payload) > 0 {
+		doc, err := json.Marshal(q.Payload)
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, "payload @> "+arg(string(doc))+"::jsonb")
+	}
+	if q.Cursor != nil {
+		v, err := q.Cursor.SortValue()
+		if err != nil {
+			return "", nil, err
+		}
+		// Keyset-пагинация: (поле, id) строго после последней строки страницы
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", field, op, arg(v), arg(q.Cursor.ID)))
+	}
+
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	var sb strings.Builder
+	sb.WriteString("SELECT " + auditSelectColumns + " FROM audit_logs")
+	if len(where) > 0 {
+		sb.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	fmt.Fprintf(&sb, " ORDER BY %s %s, id %s", field, dir, dir)
+	if q.Limit > 0 {
+		sb.WriteString(" LIMIT " + arg(q.Limit))
+	}
+	return sb.String(), args, nil
+}
+
+// TraceEvents возвращает события запроса в порядке времени (не более limit).
+func (r *AgentRepo) TraceEvents(ctx context.Context, traceID string, limit int) ([]audit.AuditEvent, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+auditSelectColumns+`
+		FROM audit_logs
+		WHERE trace_id = $1
+		ORDER BY timestamp, id
+		LIMIT $2`, traceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: query failed: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.AuditEvent, error) {
+		e, err := scanAuditEvent(row)
+		if err != nil {
+			return audit.AuditEvent{}, err
+		}
+		return *e, nil
+	})
+}
+
+// scanAuditEvent читает auditSelectColumns; extra — колонки, выбранные после них.
+func scanAuditEvent(row pgx.Row, extra ...any) (*audit.AuditEvent, error) {
+	e := &audit.AuditEvent{}
+	dest := []any{
+		&e.ID, &e.TraceID, &e.AgentID, &e.CapabilityID, &e.Payload, &e.Mode, &e.Status, &e.Response,
+		&e.DurationMs, &e.Timestamp, &e.RiskScore, &e.RiskFindings, &e.PolicyID, &e.PolicyVersion, &e.BreakGlass,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: scan error: %w", err)
+	}
+	return e, nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
+)
+
+func TestBuildAuditQuery(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	at := from.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		query     audit.Query
+		wantWhere string // Условие после WHERE; "" — без WHERE
+		wantTail  string // ORDER BY и LIMIT
+		wantArgs  []any
+	}{
+		{
+			name:     "no filters",
+			query:    audit.Query{},
+			wantTail: " ORDER BY timestamp DESC, id DESC",
+		},
+		{
+			name: "filters numbered in order",
+			query: audit.Query{AgentID: "agent-1", CapabilityID: "crm.read", TraceID: "tr-1", PolicyID: "p-1",
+				Statuses: []string{"SUCCESS", "FAILED"}, Modes: []string{"SANDBOX"}, From: &from, To: &to},
+			wantWhere: "agent_id = $1 AND capability_id = $2 AND trace_id = $3 AND policy_id = $4 AND " +
+				"status = ANY($5) AND mode = ANY($6) AND timestamp >= $7 AND timestamp < $8",
+			wantTail: " ORDER BY timestamp DESC, id DESC",
+			wantArgs: []any{"agent-1", "crm.read", "tr-1", "p-1", []string{"SUCCESS", "FAILED"}, []string{"SANDBOX"}, from, to},
+		},
+		{
+			name:      "payload containment",
+			query:     audit.Query{AgentID: "agent-1", Payload: map[string]any{"issue": map[string]any{"project": "X"}}},
+			wantWhere: "agent_id = $1 AND payload @> $2::jsonb",
+			wantTail:  " ORDER BY timestamp DESC, id DESC",
+			wantArgs:  []any{"agent-1", `{"issue":{"project":"X"}}`},
+		},
+		{
+			name:     "ascending sort with limit",
+			query:    audit.Query{Sort: "duration_ms", Limit: 50},
+			wantTail: " ORDER BY duration_ms ASC, id ASC LIMIT $1",
+			wantArgs: []any{50},
+		},
+		{
+			name: "descending cursor",
+			query: audit.Query{Sort: "-timestamp", Limit: 10,
+				Cursor: &audit.Cursor{Sort: "-timestamp", Value: at.Format(time.RFC3339Nano), ID: "ev-9"}},
+			wantWhere: "(timestamp, id) < ($1, $2)",
+			wantTail:  " ORDER BY timestamp DESC, id DESC LIMIT $3",
+			wantArgs:  []any{at, "ev-9", 10},
+		},
+		{
+			name: "ascending cursor after filters",
+			query: audit.Query{AgentID: "agent-1", Sort: "risk_score",
+				Cursor: &audit.Cursor{Sort: "risk_score", Value: "70", ID: "ev-3"}},
+			wantWhere: "agent_id = $1 AND (risk_score, id) > ($2, $3)",
+			wantTail:  " ORDER BY risk_score ASC, id ASC",
+			wantArgs:  []any{"agent-1", int64(70), "ev-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := buildAuditQuery(tt.query)
+			if err != nil {
+				t.Fatalf("buildAuditQuery() error = %v", err)
+			}
+			want := "SELECT " + auditSelectColumns + " FROM audit_logs"
+			if tt.wantWhere != "" {
+				want += " WHERE " + tt.wantWhere
+			}
+			want += tt.wantTail
+			if sql != want {
+				t.Errorf("sql =\n%s\nwant\n%s", strings.TrimPrefix(sql, "SELECT "+auditSelectColumns), strings.TrimPrefix(want, "SELECT "+auditSelectColumns))
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBuildAuditQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query audit.Query
+	}{
+		{name: "unknown sort", query: audit.Query{Sort: "-agent_id"}},
+		{name: "cursor value of wrong type", query: audit.Query{Sort: "risk_score",
+			Cursor: &audit.Cursor{Sort: "risk_score", Value: "high", ID: "ev-1"}}},
+		{name: "cursor of unknown sort", query: audit.Query{
+			Cursor: &audit.Cursor{Sort: "agent_id", Value: "a", ID: "ev-1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sql, _, err := buildAuditQuery(tt.query); err == nil {
+				t.Errorf("buildAuditQuery() = %q, want error", sql)
+			}
+		})
+	}
+}
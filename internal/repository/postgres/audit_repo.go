@@ -3,52 +3,284 @@ package postgres
 /*
 Файл audit_repo.go реализует компонент AgentFS (Audit Trail) для аналитического слоя.
 Спроектирован для работы в условиях высокой интенсивности записи событий.
+
+Если у репозитория задана партиция цепочки, пакет пишется в одной транзакции с головой
+партиции (audit_chain_heads): голова блокируется, события получают chain_seq и hash
+(см. audit/chain.go), затем голова сдвигается на последнее событие пакета.
+
+Запись идемпотентна: AgentFS повторяет пакеты после неоднозначных сбоев (коммит прошел,
+ответ потерян) и воспроизводит дисковый спул, поэтому уже сохраненные события пропускаются.
+В цепочке их нужно отсеять до выдачи chain_seq, иначе в нумерации появился бы пропуск.
+
+Ошибки данных (SQLSTATE классов 22 и 23, кроме гонки уникального ключа) возвращаются как
+audit.PermanentError: AgentFS не повторяет такой пакет, а откладывает отклоненные события
+в dead-letter.
 */
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/audit"
 )
 
+// auditInsertColumns — колонки audit_logs, которые заполняют WriteBatch и RestoreAuditRecords.
+var auditInsertColumns = []string{
+	"id", "trace_id", "agent_id", "capability_id", "payload", "mode", "status", "response",
+	"duration_ms", "timestamp", "risk_score", "risk_findings", "policy_id", "policy_version", "break_glass",
+	"chain_partition", "chain_seq", "prev_hash", "hash",
+}
+
 // WriteBatch выполняет атомарную пакетную вставку (Bulk Insert) накопленных логов.
 // - Использование JSONB: обеспечивает гибкую схему хранения payload и ответов агентов.
-// - Оптимизация: реализация минимизирует количество транзакций к БД за счет группировки
-// событий, что критично для Hot Path обработки запросов в шлюзе UAG.
+// - Оптимизация: строки передаются через COPY (бинарный протокол, без лимита в 65535
+// параметров у многострочного INSERT), одна транзакция на пакет.
 func (r *AgentRepo) WriteBatch(ctx context.Context, events []audit.AuditEvent) error {
 	if len(events) == 0 {
 		return nil
 	}
 
-	// Количество колонок в таблице audit_logs
-	numFields := 10
-	placeholderStr := ""
-	vals := make([]interface{}, 0, len(events)*numFields)
+	records := make([]*audit.ChainRecord, 0, len(events))
+	for _, e := range events {
+		rec, err := audit.NewChainRecord(e)
+		if err != nil {
+			return audit.Permanent(err)
+		}
+		records = append(records, rec)
+	}
 
-	// Динамически строим запрос для пакетной вставки
-	for i, e := range events {
-		p := i * numFields
-		placeholderStr += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d),",
-			p+1, p+2, p+3, p+4, p+5, p+6, p+7, p+8, p+9, p+10)
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var seq int64
+		var hash string
+		if r.chainPartition != "" {
+			// Голова создается при первой записи партиции; FOR UPDATE сериализует писателей партиции
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO audit_chain_heads (partition, seq, hash) VALUES ($1, 0, $2)
+				ON CONFLICT (partition) DO NOTHING`, r.chainPartition, audit.GenesisHash); err != nil {
+				return fmt.Errorf("postgres: failed to init chain head: %w", err)
+			}
+			if err := tx.QueryRow(ctx,
+				`SELECT seq, hash FROM audit_chain_heads WHERE partition = $1 FOR UPDATE`, r.chainPartition,
+			).Scan(&seq, &hash); err != nil {
+				return fmt.Errorf("postgres: failed to lock chain head: %w", err)
+			}
+		}
 
-		payload, _ := json.Marshal(e.Payload)
-		resp, _ := json.Marshal(e.Response)
+		// В цепочке — под блокировкой головы: параллельный писатель партиции не вставит те же события.
+		// Без цепочки гонка двух писателей одного события завершится ошибкой ключа, а повтор ее снимет.
+		records, err := newAuditRecords(ctx, tx, records)
+		if err != nil || len(records) == 0 {
+			return err
+		}
 
-		vals = append(vals,
-			e.ID, e.TraceID, e.AgentID, e.CapabilityID,
-			payload, e.Mode, e.Status, resp, e.DurationMs, e.Timestamp,
-		)
-	}
+		if r.chainPartition != "" {
+			for _, rec := range records {
+				if err := rec.Link(r.chainPartition, seq, hash); err != nil {
+					return err
+				}
+				seq, hash = rec.Seq, rec.Hash
+			}
+		}
 
-	// Убираем лишнюю запятую в конце
-	query := fmt.Sprintf(
-		"INSERT INTO audit_logs (id, trace_id, agent_id, capability_id, payload, mode, status, response, duration_ms, timestamp) VALUES %s",
-		strings.TrimSuffix(placeholderStr, ","),
-	)
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"audit_logs"}, auditInsertColumns,
+			pgx.CopyFromSlice(len(records), func(i int) ([]any, error) {
+				return auditRecordValues(records[i]), nil
+			})); err != nil {
+			return fmt.Errorf("postgres: failed to copy audit events: %w", err)
+		}
 
-	_, err := r.pool.Exec(ctx, query, vals...)
+		if r.chainPartition == "" {
+			return nil
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE audit_chain_heads SET seq = $2, hash = $3, updated_at = NOW() WHERE partition = $1`,
+			r.chainPartition, seq, hash)
+		return err
+	})
+	if isAuditDataError(err) {
+		return audit.Permanent(err)
+	}
 	return err
 }
+
+// isAuditDataError — БД отклонила содержимое событий (неверный UUID, \u0000 в JSONB, нарушение
+// ограничения), и повтор того же пакета не поможет. Гонка уникального ключа снимается повтором.
+func isAuditDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "22") || (strings.HasPrefix(pgErr.Code, "23") && pgErr.Code != "23505")
+}
+
+// newAuditRecords отбрасывает события, уже сохраненные в audit_logs.
+func newAuditRecords(ctx context.Context, tx pgx.Tx, records []*audit.ChainRecord) ([]*audit.ChainRecord, error) {
+	ids := make([]string, len(records))
+	timestamps := make([]time.Time, len(records))
+	for i, rec := range records {
+		ids[i], timestamps[i] = rec.ID, rec.Timestamp
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT l.id::text
+		FROM audit_logs l
+		JOIN unnest($1::uuid[], $2::timestamptz[]) AS b(id, ts) ON l.id = b.id AND l.timestamp = b.ts`,
+		ids, timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to check stored audit events: %w", err)
+	}
+	stored, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to check stored audit events: %w", err)
+	}
+	if len(stored) == 0 {
+		return records, nil
+	}
+
+	seen := make(map[string]bool, len(stored))
+	for _, id := range stored {
+		seen[id] = true
+	}
+	fresh := records[:0]
+	for _, rec := range records {
+		if !seen[rec.ID] {
+			fresh = append(fresh, rec)
+		}
+	}
+	return fresh, nil
+}
+
+func auditInsertQuery(rows int) string {
+	n := len(auditInsertColumns)
+	values := make([]string, 0, rows)
+	for i := 0; i < rows; i++ {
+		ph := make([]string, n)
+		for j := range ph {
+			ph[j] = fmt.Sprintf("$%d", i*n+j+1)
+		}
+		values = append(values, "("+strings.Join(ph, ", ")+")")
+	}
+	return "INSERT INTO audit_logs (" + strings.Join(auditInsertColumns, ", ") + ") VALUES " + strings.Join(values, ", ")
+}
+
+func auditInsertArgs(records []*audit.ChainRecord) []any {
+	vals := make([]any, 0, len(records)*len(auditInsertColumns))
+	for _, rec := range records {
+		vals = append(vals, auditRecordValues(rec)...)
+	}
+	return vals
+}
+
+// auditRecordValues — значения строки в порядке auditInsertColumns.
+func auditRecordValues(rec *audit.ChainRecord) []any {
+	// Вне цепочки колонки цепочки остаются NULL
+	var partition, seq, prevHash, hash any
+	if rec.Partition != "" {
+		partition, seq, prevHash, hash = rec.Partition, rec.Seq, rec.PrevHash, rec.Hash
+	}
+	return []any{
+		rec.ID, rec.TraceID, rec.AgentID, rec.CapabilityID, []byte(rec.Payload), rec.Mode, rec.Status,
+		[]byte(rec.Response), rec.DurationMs, rec.Timestamp, rec.RiskScore, []byte(rec.RiskFindings),
+		rec.PolicyID, rec.PolicyVersion, rec.BreakGlass,
+		partition, seq, prevHash, hash,
+	}
+}
+
+// ChainHeads возвращает головы всех партиций цепочки.
+func (r *AgentRepo) ChainHeads(ctx context.Context) ([]audit.ChainHead, error) {
+	rows, err := r.pool.Query(ctx, `SELECT partition, seq, hash, updated_at FROM audit_chain_heads ORDER BY partition`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to read chain heads: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.ChainHead, error) {
+		var h audit.ChainHead
+		err := row.Scan(&h.Partition, &h.Seq, &h.Hash, &h.UpdatedAt)
+		return h, err
+	})
+}
+
+// StreamChain передает события партиции в fn по возрастанию chain_seq, не загружая партицию в память.
+func (r *AgentRepo) StreamChain(ctx context.Context, partition string, fn func(*audit.ChainRecord) error) error {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+chainRecordColumns+`
+		FROM audit_logs
+		WHERE chain_partition = $1
+		ORDER BY chain_seq`, partition)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read chain: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec, err := scanChainRecord(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountUnchainedEvents — события, записанные до включения цепочки (или с выключенной цепочкой).
+func (r *AgentRepo) CountUnchainedEvents(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_logs WHERE chain_partition IS NULL`).Scan(&n)
+	return n, err
+}
+
+// SaveCheckpoint сохраняет подписанную контрольную точку.
+func (r *AgentRepo) SaveCheckpoint(ctx context.Context, cp *audit.Checkpoint) error {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO audit_checkpoints (partition, seq, hash, key_id, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		cp.Partition, cp.Seq, cp.Hash, cp.KeyID, cp.Signature, cp.CreatedAt,
+	).Scan(&cp.ID)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ListCheckpoints возвращает контрольные точки партиции по возрастанию seq.
+func (r *AgentRepo) ListCheckpoints(ctx context.Context, partition string) ([]audit.Checkpoint, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, partition, seq, hash, key_id, signature, created_at
+		FROM audit_checkpoints
+		WHERE partition = $1
+		ORDER BY seq, id`, partition)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to read checkpoints: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (audit.Checkpoint, error) {
+		var cp audit.Checkpoint
+		err := row.Scan(&cp.ID, &cp.Partition, &cp.Seq, &cp.Hash, &cp.KeyID, &cp.Signature, &cp.CreatedAt)
+		return cp, err
+	})
+}
+
+// LastCheckpoints возвращает seq последней контрольной точки каждой партиции.
+func (r *AgentRepo) LastCheckpoints(ctx context.Context) (map[string]int64, error) {
+	rows, err := r.pool.Query(ctx, `SELECT partition, MAX(seq) FROM audit_checkpoints GROUP BY partition`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to read checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	last := make(map[string]int64)
+	for rows.Next() {
+		var partition string
+		var seq int64
+		if err := rows.Scan(&partition, &seq); err != nil {
+			return nil, err
+		}
+		last[partition] = seq
+	}
+	return last, rows.Err()
+}
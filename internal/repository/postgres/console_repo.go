@@ -26,11 +26,13 @@ func (r *AgentRepo) GetUnifiedDashboard(ctx context.Context) (*domain.UnifiedDas
 		SELECT 
 			COUNT(*),
 			COUNT(*) FILTER (WHERE status = 'SYSTEM_ERROR'),
+			COUNT(*) FILTER (WHERE risk_score > 0),
 			COALESCE(PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY duration_ms), 0)
 		FROM audit_logs 
 		WHERE timestamp > NOW() - INTERVAL '60 minutes'`).Scan(
 		&d.Activity.TotalRequests,
 		&d.Incidents.SystemErrors,
+		&d.Risks.HighRiskDetections,
 		&d.Quality.P95Latency,
 	)
 
@@ -0,0 +1,112 @@
+package postgres
+
+/*
+Файл credential_repo.go хранит секреты агентов для OAuth2 Client Credentials.
+
+Ротация не ломает работающих агентов: новый секрет добавляется, а прежние получают
+expires_at = NOW() + grace и продолжают действовать, пока агент не переключится.
+Отзыв (revoked_at) действует немедленно и применяется при компрометации и выводе агента из эксплуатации.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// activeCredential — условие действующего секрета.
+const activeCredential = `revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`
+
+// RotateAgentCredential добавляет агенту новый секрет, а действующим задает срок grace.
+// При grace == 0 прежние секреты отзываются сразу. Возвращает новый секрет и срок действия прежних.
+func (r *AgentRepo) RotateAgentCredential(ctx context.Context, agentID, secretHash, author string, grace time.Duration) (*domain.AgentCredential, *time.Time, error) {
+	cred := &domain.AgentCredential{AgentID: agentID, SecretHash: secretHash, CreatedBy: author}
+	var previous *time.Time
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		// Блокируем агента: параллельные ротации выполняются по очереди
+		var id string
+		err := tx.QueryRow(ctx, `SELECT id FROM agents WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, agentID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrAgentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if grace > 0 {
+			until := time.Now().Add(grace)
+			ct, err := tx.Exec(ctx, `
+				UPDATE agent_credentials SET expires_at = LEAST(COALESCE(expires_at, $2), $2)
+				WHERE agent_id = $1 AND `+activeCredential, agentID, until)
+			if err != nil {
+				return err
+			}
+			if ct.RowsAffected() > 0 {
+				previous = &until
+			}
+		} else {
+			_, err := tx.Exec(ctx, `
+				UPDATE agent_credentials SET revoked_at = NOW(), revoked_by = $2
+				WHERE agent_id = $1 AND revoked_at IS NULL`, agentID, author)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRow(ctx, `
+			INSERT INTO agent_credentials (agent_id, secret_hash, created_by)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at`, agentID, secretHash, author,
+		).Scan(&cred.ID, &cred.CreatedAt)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrAgentNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("postgres: failed to rotate agent credential: %w", err)
+	}
+	return cred, previous, nil
+}
+
+// ListAgentCredentials возвращает действующие секреты агента (новые первыми).
+func (r *AgentRepo) ListAgentCredentials(ctx context.Context, agentID string) ([]domain.AgentCredential, error) {
+	query := `
+		SELECT id, agent_id, secret_hash, created_at, created_by, expires_at
+		FROM agent_credentials
+		WHERE agent_id = $1 AND ` + activeCredential + `
+		ORDER BY created_at DESC`
+
+	rows, err := r.pool.Query(ctx, query, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to list agent credentials: %w", err)
+	}
+	defer rows.Close()
+
+	creds := make([]domain.AgentCredential, 0)
+	for rows.Next() {
+		var c domain.AgentCredential
+		if err := rows.Scan(&c.ID, &c.AgentID, &c.SecretHash, &c.CreatedAt, &c.CreatedBy, &c.ExpiresAt); err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// RevokeAgentCredentials немедленно отзывает все секреты агента. Возвращает число отозванных.
+func (r *AgentRepo) RevokeAgentCredentials(ctx context.Context, agentID, author string) (int64, error) {
+	query := `
+		UPDATE agent_credentials SET revoked_at = NOW(), revoked_by = $2
+		WHERE agent_id = $1 AND revoked_at IS NULL`
+
+	ct, err := r.pool.Exec(ctx, query, agentID, author)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: failed to revoke agent credentials: %w", err)
+	}
+	return ct.RowsAffected(), nil
+}
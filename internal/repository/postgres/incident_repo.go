@@ -0,0 +1,35 @@
+package postgres
+
+/*
+Файл incident_repo.go хранит инциденты, созданные риск-анализатором шлюза
+(автоматический карантин или блокировка агента вместе с доказательствами).
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// RecordAgentIncident сохраняет инцидент и сработавшие сигналы (evidence) в JSONB.
+func (r *AgentRepo) RecordAgentIncident(ctx context.Context, incident *domain.AgentIncident) error {
+	evidence, err := json.Marshal(incident.Evidence)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to marshal incident evidence: %w", err)
+	}
+
+	query := `
+		INSERT INTO agent_incidents (id, agent_id, action, source, score, evidence, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = r.pool.Exec(ctx, query,
+		incident.ID, incident.AgentID, incident.Action, incident.Source,
+		incident.Score, evidence, incident.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to record agent incident: %w", err)
+	}
+	return nil
+}
@@ -16,21 +16,36 @@ import (
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 )
 
-func (r *AgentRepo) GetPolicyByID(ctx context.Context, id string) (*domain.Policy, error) {
-	query := `
-		SELECT id, agent_id, capability_id, effect, conditions 
-		FROM policies 
-		WHERE id = $1`
+// policyColumns — общий список колонок policies для scanPolicy.
+const policyColumns = `id, agent_id, capability_id, effect, conditions, version,
+	valid_from, valid_until, schedule, break_glass, created_at, updated_at`
 
+func scanPolicy(row pgx.Row) (*domain.Policy, error) {
 	p := &domain.Policy{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := row.Scan(
 		&p.ID,
 		&p.AgentID,
 		&p.CapabilityID,
 		&p.Effect,
 		&p.Conditions,
+		&p.Version,
+		&p.ValidFrom,
+		&p.ValidUntil,
+		&p.Schedule,
+		&p.BreakGlass,
+		&p.CreatedAt,
+		&p.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *AgentRepo) GetPolicyByID(ctx context.Context, id string) (*domain.Policy, error) {
+	query := `SELECT ` + policyColumns + ` FROM policies WHERE id = $1`
 
+	p, err := scanPolicy(r.pool.QueryRow(ctx, query, id))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil // Возвращаем nil для 404 в хендлере
@@ -41,8 +56,10 @@ func (r *AgentRepo) GetPolicyByID(ctx context.Context, id string) (*domain.Polic
 }
 
 // GetAllPolicies выполняет "холодную загрузку" всего набора активных политик при старте.
+// Истекшие break-glass доступы тоже загружаются: их отсекает MemoEnforcer по времени,
+// а набор строк должен совпадать с PolicyChecksum.
 func (r *AgentRepo) GetAllPolicies(ctx context.Context) ([]domain.Policy, error) {
-	query := `SELECT id, agent_id, capability_id, effect, conditions FROM policies`
+	query := `SELECT ` + policyColumns + ` FROM policies ORDER BY created_at DESC`
 
 	rows, err := r.pool.Query(ctx, query)
 	if err != nil {
@@ -52,13 +69,29 @@ func (r *AgentRepo) GetAllPolicies(ctx context.Context) ([]domain.Policy, error)
 
 	var results []domain.Policy
 	for rows.Next() {
-		var p domain.Policy
-		if err := rows.Scan(&p.ID, &p.AgentID, &p.CapabilityID, &p.Effect, &p.Conditions); err != nil {
+		p, err := scanPolicy(rows)
+		if err != nil {
 			return nil, err
 		}
-		results = append(results, p)
+		results = append(results, *p)
 	}
-	return results, nil
+	return results, rows.Err()
+}
+
+// PolicyChecksum возвращает число политик и md5 от "id:version", упорядоченных по id.
+// Шлюз сравнивает его со своим кэшем (MemoEnforcer.Checksum), чтобы обнаружить
+// пропущенные события Pub/Sub без полной выгрузки таблицы.
+func (r *AgentRepo) PolicyChecksum(ctx context.Context) (int, string, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(md5(string_agg(id::text || ':' || version, ',' ORDER BY id)), '')
+		FROM policies`
+
+	var count int
+	var sum string
+	if err := r.pool.QueryRow(ctx, query).Scan(&count, &sum); err != nil {
+		return 0, "", fmt.Errorf("postgres: failed to compute policy checksum: %w", err)
+	}
+	return count, sum, nil
 }
 
 // todo убрали вызов из за инфорсера
@@ -89,49 +122,59 @@ func (r *AgentRepo) GetDecision(ctx context.Context, agentID, capID string) (*do
 	return &p, nil
 }
 
-// CreatePolicy создает новую запись.
+// CreatePolicy создает новую запись и ее первую версию в одной транзакции.
 // Позволяет задавать agent_id = '*' для глобальных правил.
-func (r *AgentRepo) CreatePolicy(ctx context.Context, p *domain.Policy) error {
-	query := `
-		INSERT INTO policies (id, agent_id, capability_id, effect, conditions)
-		VALUES (gen_random_uuid(), $1, $2, $3, $4)`
-
-	_, err := r.pool.Exec(ctx, query, p.AgentID, p.CapabilityID, p.Effect, p.Conditions)
-	if err != nil {
-		return fmt.Errorf("postgres: failed to create policy: %w", err)
-	}
-	return nil
+func (r *AgentRepo) CreatePolicy(ctx context.Context, p *domain.Policy, author string) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		query := `
+			INSERT INTO policies (id, agent_id, capability_id, effect, conditions, version,
+			                      valid_from, valid_until, schedule, break_glass)
+			VALUES (gen_random_uuid(), $1, $2, $3, $4, 1, $5, $6, $7, $8)
+			RETURNING id, version`
+
+		if err := tx.QueryRow(ctx, query, p.AgentID, p.CapabilityID, p.Effect, p.Conditions,
+			p.ValidFrom, p.ValidUntil, p.Schedule, p.BreakGlass).Scan(&p.ID, &p.Version); err != nil {
+			return fmt.Errorf("postgres: failed to create policy: %w", err)
+		}
+		return insertPolicyVersion(ctx, tx, domain.PolicyOpCreate, p, false, domain.DiffPolicies(nil, p), author)
+	})
 }
 
-// UpdatePolicy обновляет условия или эффект существующей политики.
-func (r *AgentRepo) UpdatePolicy(ctx context.Context, p *domain.Policy) error {
-	query := `
-		UPDATE policies 
-		SET effect = $1, conditions = $2 
-		WHERE id = $3`
-
-	ct, err := r.pool.Exec(ctx, query, p.Effect, p.Conditions, p.ID)
-	if err != nil {
-		return fmt.Errorf("postgres: failed to update policy: %w", err)
-	}
+// UpdatePolicy обновляет эффект, условия и временные рамки существующей политики, фиксируя новую версию и diff.
+func (r *AgentRepo) UpdatePolicy(ctx context.Context, p *domain.Policy, author string) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		current, err := lockPolicy(ctx, tx, p.ID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("postgres: policy not found")
+		}
+		if current.BreakGlass {
+			return domain.ErrBreakGlassImmutable
+		}
 
-	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("postgres: policy not found")
-	}
-	return nil
+		next := *current
+		next.Effect, next.Conditions = p.Effect, p.Conditions
+		next.ValidFrom, next.ValidUntil, next.Schedule = p.ValidFrom, p.ValidUntil, p.Schedule
+		if err := writePolicyState(ctx, tx, domain.PolicyOpUpdate, current, &next, author); err != nil {
+			return err
+		}
+		*p = next
+		return nil
+	})
 }
 
-// DeletePolicy удаляет политику по ID.
-func (r *AgentRepo) DeletePolicy(ctx context.Context, id string) error {
-	query := `DELETE FROM policies WHERE id = $1`
-
-	ct, err := r.pool.Exec(ctx, query, id)
-	if err != nil {
-		return fmt.Errorf("postgres: failed to delete policy: %w", err)
-	}
-
-	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("postgres: policy not found")
-	}
-	return nil
+// DeletePolicy удаляет политику по ID. История версий сохраняется (последняя версия помечается deleted).
+func (r *AgentRepo) DeletePolicy(ctx context.Context, id string, author string) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		current, err := lockPolicy(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("postgres: policy not found")
+		}
+		return writePolicyState(ctx, tx, domain.PolicyOpDelete, current, nil, author)
+	})
 }
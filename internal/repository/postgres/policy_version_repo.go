@@ -0,0 +1,335 @@
+package postgres
+
+/*
+Файл policy_version_repo.go реализует историю изменений политик (Policy Versioning).
+
+Каждое изменение политики (создание, правка, удаление, откат) в той же транзакции пишет
+неизменяемый снимок в policy_versions: автор, diff и время. Откат не переписывает историю,
+а создает новую версию с состоянием из прошлого (операция ROLLBACK), поэтому цепочка
+«кто, когда и что поменял» не теряется даже после нескольких откатов.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// ListPolicyVersions возвращает историю политики, начиная с последней версии.
+func (r *AgentRepo) ListPolicyVersions(ctx context.Context, policyID string) ([]domain.PolicyVersion, error) {
+	query := `
+		SELECT id, policy_id, version, operation, agent_id, capability_id, effect, conditions,
+		       valid_from, valid_until, schedule, break_glass, deleted, author, diff, created_at
+		FROM policy_versions
+		WHERE policy_id = $1
+		ORDER BY version DESC`
+
+	rows, err := r.pool.Query(ctx, query, policyID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to list policy versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make([]domain.PolicyVersion, 0)
+	for rows.Next() {
+		v, err := scanPolicyVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// RollbackPolicy возвращает политику в состояние указанной версии.
+// Если в этой версии политика была удалена — удаляет ее, если политика удалена сейчас — воссоздает.
+func (r *AgentRepo) RollbackPolicy(ctx context.Context, policyID string, version int, author string) (*domain.Policy, error) {
+	var result *domain.Policy
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx, `
+			SELECT id, policy_id, version, operation, agent_id, capability_id, effect, conditions,
+			       valid_from, valid_until, schedule, break_glass, deleted, author, diff, created_at
+			FROM policy_versions
+			WHERE policy_id = $1 AND version = $2`, policyID, version)
+
+		target, err := scanPolicyVersion(row)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrPolicyVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		current, err := lockPolicy(ctx, tx, policyID)
+		if err != nil {
+			return err
+		}
+
+		var desired *domain.Policy
+		if !target.Deleted {
+			p := target.Policy()
+			desired = &p
+		}
+		if err := writePolicyState(ctx, tx, domain.PolicyOpRollback, current, desired, author); err != nil {
+			return err
+		}
+		result = desired
+		return nil
+	})
+
+	return result, err
+}
+
+// RollbackPoliciesTo приводит весь набор политик к состоянию на момент at.
+// Политики, созданные позже, удаляются; удаленные после at — воссоздаются.
+// Выполняется одной транзакцией под блокировкой таблицы, возвращает число измененных политик.
+func (r *AgentRepo) RollbackPoliciesTo(ctx context.Context, at time.Time, author string) (int, error) {
+	changed := 0
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		// Параллельные правки из консоли ждут окончания отката
+		if _, err := tx.Exec(ctx, `LOCK TABLE policies IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("postgres: failed to lock policies: %w", err)
+		}
+
+		// Снимок на момент at: последняя версия каждой политики, созданная не позже at
+		rows, err := tx.Query(ctx, `
+			SELECT DISTINCT ON (policy_id)
+			       id, policy_id, version, operation, agent_id, capability_id, effect, conditions,
+			       valid_from, valid_until, schedule, break_glass, deleted, author, diff, created_at
+			FROM policy_versions
+			WHERE created_at <= $1
+			ORDER BY policy_id, version DESC`, at)
+		if err != nil {
+			return fmt.Errorf("postgres: failed to load policy snapshot: %w", err)
+		}
+		desired := make(map[string]*domain.Policy)
+		for rows.Next() {
+			v, err := scanPolicyVersion(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if !v.Deleted {
+				p := v.Policy()
+				desired[v.PolicyID] = &p
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		current, err := loadPolicies(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		// Обходим объединение текущих и целевых политик
+		ids := make(map[string]struct{}, len(current)+len(desired))
+		for id := range current {
+			ids[id] = struct{}{}
+		}
+		for id := range desired {
+			ids[id] = struct{}{}
+		}
+
+		for id := range ids {
+			cur, want := current[id], desired[id]
+			if cur == nil && want == nil {
+				continue
+			}
+			if cur != nil && want != nil && len(domain.DiffPolicies(cur, want)) == 0 {
+				continue
+			}
+			if err := writePolicyState(ctx, tx, domain.PolicyOpRollback, cur, want, author); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+
+	return changed, err
+}
+
+// ApplyPolicyBundle атомарно приводит активный набор к содержимому бандла (Policy-as-Code).
+// План строится внутри транзакции под блокировкой таблицы, поэтому применяется ровно то,
+// что возвращается вызывающему коду. Каждое изменение получает версию IMPORT.
+func (r *AgentRepo) ApplyPolicyBundle(ctx context.Context, desired []domain.Policy, author string) (*domain.BundlePlan, error) {
+	var plan *domain.BundlePlan
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `LOCK TABLE policies IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("postgres: failed to lock policies: %w", err)
+		}
+
+		current, err := loadPolicies(ctx, tx)
+		if err != nil {
+			return err
+		}
+		list := make([]domain.Policy, 0, len(current))
+		for _, p := range current {
+			list = append(list, *p)
+		}
+
+		plan = domain.PlanBundle(list, desired)
+
+		for i := range plan.Added {
+			plan.Added[i].ID = uuid.New().String()
+			if err := writePolicyState(ctx, tx, domain.PolicyOpImport, nil, &plan.Added[i], author); err != nil {
+				return err
+			}
+		}
+		for i := range plan.Changed {
+			c := &plan.Changed[i]
+			if err := writePolicyState(ctx, tx, domain.PolicyOpImport, &c.Before, &c.After, author); err != nil {
+				return err
+			}
+		}
+		for i := range plan.Removed {
+			if err := writePolicyState(ctx, tx, domain.PolicyOpImport, &plan.Removed[i], nil, author); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// writePolicyState приводит строку policies к состоянию desired (nil — политики нет)
+// и записывает соответствующую версию. Изменений нет — новой версии тоже нет.
+func writePolicyState(ctx context.Context, tx pgx.Tx, op string, current, desired *domain.Policy, author string) error {
+	if current == nil && desired == nil {
+		return nil
+	}
+	diff := domain.DiffPolicies(current, desired)
+	if current != nil && desired != nil && len(diff) == 0 {
+		return nil
+	}
+
+	policyID := ""
+	if desired != nil {
+		policyID = desired.ID
+	} else {
+		policyID = current.ID
+	}
+
+	var version int
+	if err := tx.QueryRow(ctx,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM policy_versions WHERE policy_id = $1`, policyID,
+	).Scan(&version); err != nil {
+		return fmt.Errorf("postgres: failed to allocate policy version: %w", err)
+	}
+
+	switch {
+	case desired == nil:
+		if _, err := tx.Exec(ctx, `DELETE FROM policies WHERE id = $1`, policyID); err != nil {
+			return fmt.Errorf("postgres: failed to delete policy: %w", err)
+		}
+		gone := *current
+		gone.Version = version
+		return insertPolicyVersion(ctx, tx, op, &gone, true, diff, author)
+
+	case current == nil:
+		desired.Version = version
+		_, err := tx.Exec(ctx, `
+			INSERT INTO policies (id, agent_id, capability_id, effect, conditions, version,
+			                      valid_from, valid_until, schedule, break_glass)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			policyID, desired.AgentID, desired.CapabilityID, desired.Effect, desired.Conditions, version,
+			desired.ValidFrom, desired.ValidUntil, desired.Schedule, desired.BreakGlass)
+		if err != nil {
+			return fmt.Errorf("postgres: failed to restore policy: %w", err)
+		}
+
+	default:
+		desired.Version = version
+		_, err := tx.Exec(ctx, `
+			UPDATE policies
+			SET agent_id = $1, capability_id = $2, effect = $3, conditions = $4, version = $5,
+			    valid_from = $6, valid_until = $7, schedule = $8, break_glass = $9, updated_at = NOW()
+			WHERE id = $10`,
+			desired.AgentID, desired.CapabilityID, desired.Effect, desired.Conditions, version,
+			desired.ValidFrom, desired.ValidUntil, desired.Schedule, desired.BreakGlass, policyID)
+		if err != nil {
+			return fmt.Errorf("postgres: failed to update policy: %w", err)
+		}
+	}
+
+	return insertPolicyVersion(ctx, tx, op, desired, false, diff, author)
+}
+
+func insertPolicyVersion(ctx context.Context, tx pgx.Tx, op string, p *domain.Policy, deleted bool, diff map[string]domain.FieldChange, author string) error {
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to marshal policy diff: %w", err)
+	}
+	if author == "" {
+		author = "unknown"
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO policy_versions (policy_id, version, operation, agent_id, capability_id, effect, conditions,
+		                             valid_from, valid_until, schedule, break_glass, deleted, author, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		p.ID, p.Version, op, p.AgentID, p.CapabilityID, p.Effect, p.Conditions,
+		p.ValidFrom, p.ValidUntil, p.Schedule, p.BreakGlass, deleted, author, diffJSON)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to record policy version: %w", err)
+	}
+	return nil
+}
+
+// lockPolicy читает политику с блокировкой строки до конца транзакции (nil — политики нет).
+func lockPolicy(ctx context.Context, tx pgx.Tx, id string) (*domain.Policy, error) {
+	p, err := scanPolicy(tx.QueryRow(ctx, `SELECT `+policyColumns+` FROM policies WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to lock policy: %w", err)
+	}
+	return p, nil
+}
+
+func loadPolicies(ctx context.Context, tx pgx.Tx) (map[string]*domain.Policy, error) {
+	rows, err := tx.Query(ctx, `SELECT `+policyColumns+` FROM policies`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]*domain.Policy)
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[p.ID] = p
+	}
+	return result, rows.Err()
+}
+
+func scanPolicyVersion(row pgx.Row) (*domain.PolicyVersion, error) {
+	var v domain.PolicyVersion
+	var diff []byte
+	if err := row.Scan(&v.ID, &v.PolicyID, &v.Version, &v.Operation, &v.AgentID, &v.CapabilityID,
+		&v.Effect, &v.Conditions, &v.ValidFrom, &v.ValidUntil, &v.Schedule, &v.BreakGlass, &v.Deleted, &v.Author, &diff, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	if len(diff) > 0 {
+		_ = json.Unmarshal(diff, &v.Diff)
+	}
+	return &v, nil
+}
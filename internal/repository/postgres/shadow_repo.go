@@ -0,0 +1,191 @@
+package postgres
+
+/*
+Файл shadow_repo.go хранит теневой (кандидатный) набор политик и расхождения,
+которые шлюз фиксирует при его оценке на реальном трафике (Shadow Mode).
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// GetAllShadowPolicies загружает весь теневой набор для MemoEnforcer.
+func (r *AgentRepo) GetAllShadowPolicies(ctx context.Context) ([]domain.Policy, error) {
+	query := `SELECT id, agent_id, capability_id, effect, conditions, created_at, updated_at FROM shadow_policies`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []domain.Policy
+	for rows.Next() {
+		var p domain.Policy
+		if err := rows.Scan(&p.ID, &p.AgentID, &p.CapabilityID, &p.Effect, &p.Conditions, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, p)
+	}
+	return results, rows.Err()
+}
+
+func (r *AgentRepo) GetShadowPolicyByID(ctx context.Context, id string) (*domain.Policy, error) {
+	query := `
+		SELECT id, agent_id, capability_id, effect, conditions, created_at, updated_at
+		FROM shadow_policies
+		WHERE id = $1`
+
+	p := &domain.Policy{}
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&p.ID, &p.AgentID, &p.CapabilityID, &p.Effect, &p.Conditions, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreateShadowPolicy добавляет кандидатную политику. Для одной пары агент+способность
+// допускается одна теневая политика (уникальный индекс, миграция 000021).
+func (r *AgentRepo) CreateShadowPolicy(ctx context.Context, p *domain.Policy) error {
+	query := `
+		INSERT INTO shadow_policies (id, agent_id, capability_id, effect, conditions)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4)
+		RETURNING id`
+
+	err := r.pool.QueryRow(ctx, query, p.AgentID, p.CapabilityID, p.Effect, p.Conditions).Scan(&p.ID)
+	if isUniqueViolation(err) {
+		return domain.ErrShadowPolicyExists // idx_shadow_policies_agent_capability
+	}
+	if err != nil {
+		return fmt.Errorf("postgres: failed to create shadow policy: %w", err)
+	}
+	return nil
+}
+
+func (r *AgentRepo) UpdateShadowPolicy(ctx context.Context, p *domain.Policy) error {
+	query := `
+		UPDATE shadow_policies
+		SET effect = $1, conditions = $2, updated_at = NOW()
+		WHERE id = $3`
+
+	ct, err := r.pool.Exec(ctx, query, p.Effect, p.Conditions, p.ID)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to update shadow policy: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("postgres: shadow policy not found")
+	}
+	return nil
+}
+
+func (r *AgentRepo) DeleteShadowPolicy(ctx context.Context, id string) error {
+	ct, err := r.pool.Exec(ctx, `DELETE FROM shadow_policies WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to delete shadow policy: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("postgres: shadow policy not found")
+	}
+	return nil
+}
+
+// RecordShadowDivergence сохраняет расхождение решений вместе с доказательствами риск-анализа.
+func (r *AgentRepo) RecordShadowDivergence(ctx context.Context, d *domain.ShadowDivergence) error {
+	findings, err := json.Marshal(d.RiskFindings)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to marshal divergence findings: %w", err)
+	}
+
+	// Default Deny не имеет ID политики
+	var livePolicyID *string
+	if d.LivePolicyID != "" {
+		livePolicyID = &d.LivePolicyID
+	}
+
+	query := `
+		INSERT INTO policy_shadow_divergences (
+			id, trace_id, agent_id, capability_id, live_policy_id, shadow_policy_id,
+			live_effect, shadow_effect, kind, risk_score, risk_findings, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err = r.pool.Exec(ctx, query,
+		d.ID, d.TraceID, d.AgentID, d.CapabilityID, livePolicyID, d.ShadowPolicyID,
+		d.LiveEffect, d.ShadowEffect, d.Kind, d.RiskScore, findings, d.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to record shadow divergence: %w", err)
+	}
+	return nil
+}
+
+// GetShadowSummary агрегирует расхождения за период по теневой политике и виду расхождения.
+func (r *AgentRepo) GetShadowSummary(ctx context.Context, since time.Time) ([]domain.ShadowSummary, error) {
+	query := `
+		SELECT shadow_policy_id, agent_id, capability_id, kind, live_effect, shadow_effect,
+		       COUNT(*), MAX(created_at)
+		FROM policy_shadow_divergences
+		WHERE created_at >= $1
+		GROUP BY shadow_policy_id, agent_id, capability_id, kind, live_effect, shadow_effect
+		ORDER BY COUNT(*) DESC`
+
+	rows, err := r.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]domain.ShadowSummary, 0)
+	for rows.Next() {
+		var s domain.ShadowSummary
+		if err := rows.Scan(&s.ShadowPolicyID, &s.AgentID, &s.CapabilityID, &s.Kind,
+			&s.LiveEffect, &s.ShadowEffect, &s.Count, &s.LastSeen); err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+// ListShadowDivergences возвращает последние расхождения (опционально по одной теневой политике).
+func (r *AgentRepo) ListShadowDivergences(ctx context.Context, shadowPolicyID string, limit int) ([]domain.ShadowDivergence, error) {
+	query := `
+		SELECT id, COALESCE(trace_id, ''), agent_id, capability_id, COALESCE(live_policy_id::text, ''),
+		       shadow_policy_id, live_effect, shadow_effect, kind, risk_score, risk_findings, created_at
+		FROM policy_shadow_divergences
+		WHERE ($1 = '' OR shadow_policy_id::text = $1)
+		ORDER BY created_at DESC
+		LIMIT $2`
+
+	rows, err := r.pool.Query(ctx, query, shadowPolicyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]domain.ShadowDivergence, 0)
+	for rows.Next() {
+		var d domain.ShadowDivergence
+		var findings []byte
+		if err := rows.Scan(&d.ID, &d.TraceID, &d.AgentID, &d.CapabilityID, &d.LivePolicyID,
+			&d.ShadowPolicyID, &d.LiveEffect, &d.ShadowEffect, &d.Kind, &d.RiskScore, &findings, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(findings) > 0 {
+			_ = json.Unmarshal(findings, &d.RiskFindings)
+		}
+		results = append(results, d)
+	}
+	return results, rows.Err()
+}
@@ -1,21 +1,47 @@
 package postgres
 
+/*
+Файл user_repo.go реализует хранилище пользователей консоли: учетные записи, роли,
+пароли (только bcrypt-хеши) и счетчик неудачных входов для блокировки перебора.
+*/
+
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 )
 
-func (r *AgentRepo) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
-	query := `
-		SELECT id, email, username, password_hash, role, scopes, created_at, updated_at 
-		FROM users WHERE username = $1`
+// userColumns — общий список колонок users для scanUser.
+const userColumns = `id, email, username, password_hash, role, scopes, created_at, updated_at,
+	created_by, last_login, password_changed_at, disabled_at, locked_until, failed_login_attempts,
+	auth_provider, COALESCE(external_id, '')`
 
+func scanUser(row pgx.Row) (*domain.User, error) {
 	u := &domain.User{}
-	err := r.pool.QueryRow(ctx, query, username).Scan(
-		&u.ID, &u.Email, &u.Username, &u.PasswordHash, &u.Role, &u.Scopes, &u.CreatedAt, &u.UpdatedAt,
+	var scopes []byte
+	err := row.Scan(
+		&u.ID, &u.Email, &u.Username, &u.PasswordHash, &u.Role, &scopes, &u.CreatedAt, &u.UpdatedAt,
+		&u.CreatedBy, &u.LastLogin, &u.PasswordChangedAt, &u.DisabledAt, &u.LockedUntil, &u.FailedLoginAttempts,
+		&u.AuthProvider, &u.ExternalID,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scopes, err = decodeUserScopes(scopes); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (r *AgentRepo) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+
+	u, err := scanUser(r.pool.QueryRow(ctx, query, username))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -24,3 +50,227 @@ func (r *AgentRepo) GetUserByUsername(ctx context.Context, username string) (*do
 	}
 	return u, nil
 }
+
+// GetUserByID возвращает пользователя или domain.ErrUserNotFound.
+func (r *AgentRepo) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+	u, err := scanUser(r.pool.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	return u, err
+}
+
+// ListUsers возвращает всех пользователей (отключенных тоже) по алфавиту.
+func (r *AgentRepo) ListUsers(ctx context.Context) ([]*domain.User, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+userColumns+` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUserByExternalID ищет пользователя внешнего IdP по стабильному идентификатору.
+func (r *AgentRepo) GetUserByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE auth_provider = $1 AND external_id = $2`
+
+	u, err := scanUser(r.pool.QueryRow(ctx, query, provider, externalID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	return u, err
+}
+
+// CreateUser создает пользователя. Пароль передается уже хешированным.
+func (r *AgentRepo) CreateUser(ctx context.Context, u *domain.User) error {
+	if u.AuthProvider == "" {
+		u.AuthProvider = domain.AuthProviderLocal
+	}
+	query := `
+		INSERT INTO users (email, username, password_hash, role, scopes, created_by, password_changed_at,
+		                   auth_provider, external_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), $7, NULLIF($8, ''))
+		RETURNING id, created_at, updated_at, password_changed_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		u.Email, u.Username, u.PasswordHash, u.Role, domain.ScopeList(u.Scopes), u.CreatedBy,
+		u.AuthProvider, u.ExternalID,
+	).Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt, &u.PasswordChangedAt)
+	if isUniqueViolation(err) {
+		return domain.ErrUserExists
+	}
+	if err != nil {
+		return fmt.Errorf("postgres: failed to create user: %w", err)
+	}
+	return nil
+}
+
+// UpdateUser сохраняет email, роль, scopes и признак отключения.
+// Последнего действующего администратора отключить или понизить нельзя (domain.ErrLastAdmin).
+func (r *AgentRepo) UpdateUser(ctx context.Context, u *domain.User) error {
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		// Сериализуем изменения администраторов, чтобы два параллельных запроса
+		// не понизили двух последних админов одновременно
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('users:admins'))`); err != nil {
+			return err
+		}
+
+		var wasActiveAdmin bool
+		err := tx.QueryRow(ctx, `SELECT role = $1 AND disabled_at IS NULL FROM users WHERE id = $2 FOR UPDATE`,
+			domain.RoleAdmin, u.ID).Scan(&wasActiveAdmin)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE users
+			SET email = $1, role = $2, scopes = $3, disabled_at = $4, updated_at = NOW()
+			WHERE id = $5
+			RETURNING updated_at`
+		err = tx.QueryRow(ctx, query,
+			u.Email, u.Role, domain.ScopeList(u.Scopes), u.DisabledAt, u.ID,
+		).Scan(&u.UpdatedAt)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return domain.ErrUserNotFound
+		case isUniqueViolation(err):
+			return domain.ErrUserExists
+		case err != nil:
+			return fmt.Errorf("postgres: failed to update user: %w", err)
+		}
+
+		if !wasActiveAdmin {
+			return nil
+		}
+		admins, err := countActiveAdmins(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if admins == 0 {
+			return domain.ErrLastAdmin // Откатываем транзакцию
+		}
+		return nil
+	})
+}
+
+// SyncExternalUser обновляет email, роль и scopes внешнего пользователя по данным IdP при входе.
+// Источник правды для таких пользователей — IdP, поэтому защита последнего админа здесь не действует.
+func (r *AgentRepo) SyncExternalUser(ctx context.Context, u *domain.User) error {
+	query := `
+		UPDATE users SET email = $1, role = $2, scopes = $3, updated_at = NOW()
+		WHERE id = $4 AND auth_provider <> 'local'
+		RETURNING updated_at`
+
+	err := r.pool.QueryRow(ctx, query, u.Email, u.Role, domain.ScopeList(u.Scopes), u.ID).Scan(&u.UpdatedAt)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return domain.ErrUserNotFound
+	case isUniqueViolation(err):
+		return domain.ErrUserExists
+	case err != nil:
+		return fmt.Errorf("postgres: failed to sync external user: %w", err)
+	}
+	return nil
+}
+
+// SetUserPassword меняет хеш пароля и снимает блокировку входа.
+func (r *AgentRepo) SetUserPassword(ctx context.Context, id, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, password_changed_at = NOW(), failed_login_attempts = 0,
+		    locked_until = NULL, updated_at = NOW()
+		WHERE id = $2`
+
+	ct, err := r.pool.Exec(ctx, query, passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to set password: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// RecordLoginFailure увеличивает счетчик неудачных входов. При достижении maxAttempts
+// вход блокируется на lockFor, а счетчик обнуляется. Возвращает срок блокировки (nil — не заблокирован).
+func (r *AgentRepo) RecordLoginFailure(ctx context.Context, id string, maxAttempts int, lockFor time.Duration) (*time.Time, error) {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END,
+		    locked_until = CASE WHEN failed_login_attempts + 1 >= $2
+		                        THEN NOW() + make_interval(secs => $3) ELSE locked_until END
+		WHERE id = $1
+		RETURNING locked_until`
+
+	var lockedUntil *time.Time
+	err := r.pool.QueryRow(ctx, query, id, maxAttempts, lockFor.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: failed to record login failure: %w", err)
+	}
+	if lockedUntil != nil && lockedUntil.Before(time.Now()) {
+		return nil, nil // Прежняя блокировка уже истекла
+	}
+	return lockedUntil, nil
+}
+
+// RecordLoginSuccess фиксирует last_login и сбрасывает счетчик неудачных входов.
+func (r *AgentRepo) RecordLoginSuccess(ctx context.Context, id string) error {
+	query := `
+		UPDATE users SET last_login = NOW(), failed_login_attempts = 0, locked_until = NULL
+		WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("postgres: failed to record login: %w", err)
+	}
+	return nil
+}
+
+// CountActiveAdmins возвращает число действующих администраторов (для bootstrap).
+func (r *AgentRepo) CountActiveAdmins(ctx context.Context) (int, error) {
+	return countActiveAdmins(ctx, r.pool)
+}
+
+func countActiveAdmins(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}) (int, error) {
+	var n int
+	err := q.QueryRow(ctx, `SELECT count(*) FROM users WHERE role = $1 AND disabled_at IS NULL`, domain.RoleAdmin).Scan(&n)
+	return n, err
+}
+
+// decodeUserScopes читает users.scopes в обоих встречающихся форматах:
+// массив прав ["agents:read"] (как в схеме) и объект {"admin": true}.
+func decodeUserScopes(raw []byte) (map[string]bool, error) {
+	scopes := make(map[string]bool)
+	if len(raw) == 0 || string(raw) == "null" {
+		return scopes, nil
+	}
+	if raw[0] == '[' {
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("postgres: invalid user scopes: %w", err)
+		}
+		for _, s := range list {
+			scopes[s] = true
+		}
+		return scopes, nil
+	}
+	if err := json.Unmarshal(raw, &scopes); err != nil {
+		return nil, fmt.Errorf("postgres: invalid user scopes: %w", err)
+	}
+	return scopes, nil
+}
@@ -1,7 +1,10 @@
 package risk
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
 	"go.uber.org/zap"
@@ -13,13 +16,213 @@ type KillSwitchProvider interface {
 	MarkAsBlocked(agentID string)
 }
 
+// AgentStateSignaler переводит агента в новое состояние через тот же контур, что и консоль:
+// запись статуса в Postgres, сигнал в Redis Pub/Sub всем инстансам шлюза и фиксация доказательств.
+type AgentStateSignaler interface {
+	SignalAgentState(ctx context.Context, incident *domain.AgentIncident) error
+}
+
 type Analyzer struct {
-	ksm    KillSwitchProvider
-	logger *zap.Logger
+	ksm       KillSwitchProvider
+	detectors []ContentDetector
+	logger    *zap.Logger
+
+	// Поведенческий анализ (опционально, см. AttachBehavior)
+	behavior *BehaviorMonitor
+	signaler AgentStateSignaler
+}
+
+// NewAnalyzer создает анализатор. Если детекторы не переданы, используется встроенный набор.
+func NewAnalyzer(ksm KillSwitchProvider, logger *zap.Logger, detectors ...ContentDetector) *Analyzer {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors(DetectorConfig{})
+	}
+	return &Analyzer{ksm: ksm, detectors: detectors, logger: logger.Named("analyzer")}
+}
+
+// AttachBehavior включает поведенческий анализ с автоматической реакцией на аномалии.
+func (a *Analyzer) AttachBehavior(monitor *BehaviorMonitor, signaler AgentStateSignaler) {
+	a.behavior = monitor
+	a.signaler = signaler
+}
+
+// Observe передает событие шлюза в поведенческий профиль агента.
+// Если поведение аномально, агент асинхронно переводится в карантин или блокируется.
+func (a *Analyzer) Observe(obs Observation) {
+	if a.behavior == nil {
+		return
+	}
+
+	incident := a.behavior.Observe(obs)
+	if incident == nil {
+		return
+	}
+
+	a.logger.Warn("BEHAVIORAL ANOMALY DETECTED",
+		zap.String("agent_id", incident.AgentID),
+		zap.String("action", string(incident.Action)),
+		zap.Int("score", incident.Score),
+		zap.Any("evidence", incident.Evidence),
+	)
+
+	// Блокировка применяется к локальному кэшу немедленно, не дожидаясь возврата сигнала из Redis
+	if incident.Action == domain.StatusBlocked && a.ksm != nil {
+		a.ksm.MarkAsBlocked(incident.AgentID)
+	}
+
+	if a.signaler == nil {
+		return
+	}
+	// Не блокируем Hot Path: запись в БД и публикация сигнала — в фоне
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := a.signaler.SignalAgentState(ctx, incident); err != nil {
+			a.logger.Error("failed to signal agent state change",
+				zap.String("agent_id", incident.AgentID),
+				zap.String("action", string(incident.Action)),
+				zap.Error(err))
+		}
+	}()
+}
+
+// ContentRiskConditions — пороги контентного риска в Conditions политики:
+// {"content_risk": {"detectors": ["secrets", "injection"], "sandbox_score": 30, "hitl_score": 50, "deny_score": 80}}
+// Нулевой порог означает, что соответствующая эскалация отключена.
+type ContentRiskConditions struct {
+	Detectors    []string `json:"detectors"` // Пусто — все зарегистрированные детекторы
+	SandboxScore int      `json:"sandbox_score"`
+	HITLScore    int      `json:"hitl_score"`
+	DenyScore    int      `json:"deny_score"`
+}
+
+// Assessment — результат контентного риск-анализа запроса.
+type Assessment struct {
+	Score    int                  // Итоговый риск 0..100
+	Findings []domain.RiskFinding // Доказательства для аудита
+	Effect   domain.PolicyEffect  // Эскалация по порогам политики ("" — без эскалации)
+}
+
+// ParseContentRisk разбирает и проверяет content_risk из Conditions политики: детекторы должны
+// быть из набора detectors, пороги — в диапазоне 0..100. Без content_risk возвращает nil.
+func ParseContentRisk(conditions json.RawMessage, detectors []ContentDetector) (*ContentRiskConditions, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	var cond struct {
+		ContentRisk *ContentRiskConditions `json:"content_risk"`
+	}
+	if err := json.Unmarshal(conditions, &cond); err != nil {
+		return nil, err
+	}
+	c := cond.ContentRisk
+	if c == nil {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(detectors))
+	for _, d := range detectors {
+		known[d.Name()] = true
+	}
+	for _, name := range c.Detectors {
+		if !known[name] {
+			return nil, fmt.Errorf("content_risk: unknown detector %q", name)
+		}
+	}
+	for _, t := range []struct {
+		name  string
+		score int
+	}{{"sandbox_score", c.SandboxScore}, {"hitl_score", c.HITLScore}, {"deny_score", c.DenyScore}} {
+		if t.score < 0 || t.score > 100 {
+			return nil, fmt.Errorf("content_risk: %s must be between 0 and 100, got %d", t.name, t.score)
+		}
+	}
+	return c, nil
+}
+
+// Assess прогоняет payload через контентные детекторы и сопоставляет итоговый риск с порогами политики.
+// Оценка рассчитывается всегда (для аудита), даже если политика не задает порогов.
+// Некорректный content_risk не отключает проверку: работают все детекторы, а запрос отклоняется.
+func (a *Analyzer) Assess(p domain.Policy, payload []byte) Assessment {
+	cond, err := ParseContentRisk(p.Conditions, a.detectors)
+
+	enabled := make(map[string]bool)
+	if cond != nil {
+		for _, name := range cond.Detectors {
+			enabled[name] = true
+		}
+	}
+
+	doc := NewDocument(payload)
+	var findings []domain.RiskFinding
+	for _, d := range a.detectors {
+		if len(enabled) > 0 && !enabled[d.Name()] {
+			continue
+		}
+		findings = append(findings, d.Scan(doc)...)
+	}
+
+	res := Assessment{Score: aggregateScore(findings), Findings: findings}
+	if err != nil {
+		a.logger.Error("invalid content_risk conditions, request denied",
+			zap.String("policy_id", p.ID), zap.Error(err))
+		res.Findings = append(res.Findings, domain.RiskFinding{
+			Detector: "content_risk",
+			Rule:     "invalid_conditions",
+			Evidence: err.Error(),
+		})
+		res.Effect = domain.EffectDeny
+		return res
+	}
+	if cond != nil {
+		res.Effect = cond.effectFor(res.Score)
+	}
+
+	if res.Effect != "" {
+		a.logger.Warn("CONTENT RISK ESCALATION",
+			zap.String("policy_id", p.ID),
+			zap.Int("score", res.Score),
+			zap.Int("findings", len(findings)),
+			zap.String("effect", string(res.Effect)),
+		)
+	}
+	return res
+}
+
+func (c *ContentRiskConditions) effectFor(score int) domain.PolicyEffect {
+	switch {
+	case c.DenyScore > 0 && score >= c.DenyScore:
+		return domain.EffectDeny
+	case c.HITLScore > 0 && score >= c.HITLScore:
+		return domain.EffectQuarantine
+	case c.SandboxScore > 0 && score >= c.SandboxScore:
+		return domain.EffectSandbox
+	}
+	return ""
+}
+
+// effectSeverity задает порядок строгости эффектов для эскалации.
+var effectSeverity = map[domain.PolicyEffect]int{
+	domain.EffectAllow:      0,
+	domain.EffectSandbox:    1,
+	domain.EffectQuarantine: 2,
+	domain.EffectDeny:       3,
+}
+
+// Escalate возвращает более строгий из двух эффектов. Риск-анализ может только ужесточить решение политики.
+func Escalate(current, proposed domain.PolicyEffect) domain.PolicyEffect {
+	if proposed == "" {
+		return current
+	}
+	if effectSeverity[proposed] > effectSeverity[current] {
+		return proposed
+	}
+	return current
 }
 
-func NewAnalyzer(ksm KillSwitchProvider, logger *zap.Logger) *Analyzer {
-	return &Analyzer{ksm: ksm, logger: logger.Named("analyzer")}
+// Severity возвращает строгость эффекта (ALLOW < SANDBOX < QUARANTINE < DENY).
+func Severity(effect domain.PolicyEffect) int {
+	return effectSeverity[effect]
 }
 
 // IsRequired проверяет, нужно ли отправлять запрос на апрув (HITL)
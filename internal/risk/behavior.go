@@ -0,0 +1,267 @@
+package risk
+
+/*
+Файл behavior.go реализует потоковый поведенческий профиль (Behavioral Baseline) агента.
+
+Профиль строится «на лету» из событий шлюза, без обращения к БД:
+- Request Rate: EWMA числа запросов в минуту и сравнение текущей минуты с базовой линией;
+- Capability Mix: частоты вызова способностей; новая или редкая способность — сигнал;
+- Error Ratio: доля отказов (FAILED/DENIED/REJECTED) в скользящем окне последних запросов;
+- Off-Hours: активность вне рабочего окна, если для агента она нетипична.
+
+Сигналы агрегируются в итоговый балл 0..100. При превышении порогов анализатор переводит агента
+в карантин или блокирует его через тот же контур Redis-сигналов, что и консоль.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// Observation — одно событие шлюза, на котором обучается профиль.
+type Observation struct {
+	AgentID      string
+	CapabilityID string
+	Timestamp    time.Time
+	Failed       bool // Отказ коннектора, запрет политики или отклонение оператором
+}
+
+// BehaviorConfig — пороги поведенческого анализа.
+type BehaviorConfig struct {
+	MinSamples      int     // Сколько событий нужно для «прогретого» профиля
+	RateMultiplier  float64 // Во сколько раз текущий RPM должен превысить базовый
+	MinRatePerMin   int     // Абсолютный минимум RPM, ниже которого всплеск не считается
+	ErrorRatio      float64 // Доля отказов в окне, считающаяся аномальной
+	ErrorWindow     int     // Размер скользящего окна исходов
+	RareCapShare    float64 // Доля способности в профиле, ниже которой она «редкая»
+	WorkDays        []time.Weekday
+	WorkHourStart   int // Начало рабочего окна (час, включительно)
+	WorkHourEnd     int // Конец рабочего окна (час, не включительно)
+	Location        *time.Location
+	OffHoursShare   float64       // Если доля ночной активности в профиле ниже — ночной запрос аномален
+	QuarantineScore int           // Порог перевода в карантин (0 — отключено)
+	BlockScore      int           // Порог блокировки (0 — отключено)
+	Cooldown        time.Duration // Пауза между повторными срабатываниями по одному агенту
+}
+
+// withDefaults заполняет незаданные параметры безопасными значениями.
+func (c BehaviorConfig) withDefaults() BehaviorConfig {
+	if c.MinSamples <= 0 {
+		c.MinSamples = 200
+	}
+	if c.RateMultiplier <= 0 {
+		c.RateMultiplier = 5
+	}
+	if c.MinRatePerMin <= 0 {
+		c.MinRatePerMin = 30
+	}
+	if c.ErrorRatio <= 0 {
+		c.ErrorRatio = 0.5
+	}
+	if c.ErrorWindow <= 0 {
+		c.ErrorWindow = 50
+	}
+	if c.RareCapShare <= 0 {
+		c.RareCapShare = 0.01
+	}
+	if len(c.WorkDays) == 0 {
+		c.WorkDays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	}
+	if c.WorkHourEnd <= c.WorkHourStart {
+		c.WorkHourStart, c.WorkHourEnd = 8, 20
+	}
+	if c.Location == nil {
+		c.Location = time.UTC
+	}
+	if c.OffHoursShare <= 0 {
+		c.OffHoursShare = 0.05
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 10 * time.Minute
+	}
+	return c
+}
+
+// agentBaseline — поведенческий профиль одного агента.
+type agentBaseline struct {
+	total    int64
+	offHours int64
+	caps     map[string]int64
+
+	minute      time.Time // Текущая минута (усеченная)
+	minuteCount int
+	rateEWMA    float64 // Базовый RPM
+
+	outcomes []bool // Кольцевой буфер исходов (true — отказ)
+	next     int
+	failed   int
+
+	lastIncident time.Time
+}
+
+// BehaviorMonitor хранит профили всех агентов, обслуживаемых инстансом шлюза.
+type BehaviorMonitor struct {
+	cfg    BehaviorConfig
+	mu     sync.Mutex
+	agents map[string]*agentBaseline
+}
+
+func NewBehaviorMonitor(cfg BehaviorConfig) *BehaviorMonitor {
+	return &BehaviorMonitor{
+		cfg:    cfg.withDefaults(),
+		agents: make(map[string]*agentBaseline),
+	}
+}
+
+// Observe обновляет профиль агента и возвращает инцидент, если поведение вышло за пороги.
+// Метод вызывается в Hot Path, поэтому работает только с памятью и за O(1).
+func (m *BehaviorMonitor) Observe(obs Observation) *domain.AgentIncident {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.agents[obs.AgentID]
+	if !ok {
+		b = &agentBaseline{caps: make(map[string]int64), outcomes: make([]bool, m.cfg.ErrorWindow)}
+		m.agents[obs.AgentID] = b
+	}
+
+	ts := obs.Timestamp.In(m.cfg.Location)
+	findings := m.evaluate(b, obs, ts)
+	m.learn(b, obs, ts)
+
+	score := combineScores(findings)
+	action := m.actionFor(score)
+	if action == "" || ts.Sub(b.lastIncident) < m.cfg.Cooldown {
+		return nil
+	}
+	b.lastIncident = ts
+
+	return &domain.AgentIncident{
+		AgentID:   obs.AgentID,
+		Action:    action,
+		Source:    "behavior",
+		Score:     score,
+		Evidence:  findings,
+		CreatedAt: obs.Timestamp,
+	}
+}
+
+// evaluate сравнивает событие с профилем ДО обучения на нем (иначе аномалия «растворится» в базовой линии).
+func (m *BehaviorMonitor) evaluate(b *agentBaseline, obs Observation, ts time.Time) []domain.RiskFinding {
+	var findings []domain.RiskFinding
+	warmed := b.total >= int64(m.cfg.MinSamples)
+
+	// 1. Всплеск частоты запросов (считаем с учетом текущего события)
+	count := b.minuteCount + 1
+	if !ts.Truncate(time.Minute).Equal(b.minute) {
+		count = 1
+	}
+	if warmed && count >= m.cfg.MinRatePerMin && float64(count) > b.rateEWMA*m.cfg.RateMultiplier {
+		findings = append(findings, domain.RiskFinding{
+			Detector: "behavior", Rule: "rate_spike", Score: 60,
+			Evidence: fmt.Sprintf("%d req/min vs baseline %.1f", count, b.rateEWMA),
+		})
+	}
+
+	// 2. Новая или редкая способность
+	if warmed {
+		seen := b.caps[obs.CapabilityID]
+		switch {
+		case seen == 0:
+			findings = append(findings, domain.RiskFinding{
+				Detector: "behavior", Rule: "new_capability", Score: 40,
+				Path: obs.CapabilityID, Evidence: "capability never used before",
+			})
+		case float64(seen)/float64(b.total) < m.cfg.RareCapShare:
+			findings = append(findings, domain.RiskFinding{
+				Detector: "behavior", Rule: "rare_capability", Score: 20,
+				Path: obs.CapabilityID, Evidence: fmt.Sprintf("%d of %d requests", seen, b.total),
+			})
+		}
+	}
+
+	// 3. Доля отказов в скользящем окне
+	failed := b.failed
+	if obs.Failed {
+		failed++
+	}
+	if b.outcomes[b.next] {
+		failed-- // Этот исход будет вытеснен текущим
+	}
+	window := int(min(b.total+1, int64(len(b.outcomes))))
+	if window >= len(b.outcomes) && float64(failed)/float64(window) >= m.cfg.ErrorRatio {
+		findings = append(findings, domain.RiskFinding{
+			Detector: "behavior", Rule: "error_ratio", Score: 50,
+			Evidence: fmt.Sprintf("%d of last %d requests failed", failed, window),
+		})
+	}
+
+	// 4. Нетипичная активность вне рабочего окна
+	if warmed && m.isOffHours(ts) && float64(b.offHours)/float64(b.total) < m.cfg.OffHoursShare {
+		findings = append(findings, domain.RiskFinding{
+			Detector: "behavior", Rule: "off_hours", Score: 30,
+			Evidence: ts.Format(time.RFC3339),
+		})
+	}
+
+	return findings
+}
+
+// learn обновляет профиль агента текущим событием.
+func (m *BehaviorMonitor) learn(b *agentBaseline, obs Observation, ts time.Time) {
+	const alpha = 0.1 // Вес новой минуты в EWMA
+
+	minute := ts.Truncate(time.Minute)
+	switch {
+	case b.minute.IsZero():
+		b.minute, b.minuteCount = minute, 0
+	case !minute.Equal(b.minute):
+		// Закрываем прошедшую минуту и учитываем «тихие» минуты без запросов
+		b.rateEWMA = alpha*float64(b.minuteCount) + (1-alpha)*b.rateEWMA
+		idle := int(minute.Sub(b.minute)/time.Minute) - 1
+		for i := 0; i < idle && i < 60; i++ {
+			b.rateEWMA *= 1 - alpha
+		}
+		b.minute, b.minuteCount = minute, 0
+	}
+	b.minuteCount++
+
+	b.total++
+	b.caps[obs.CapabilityID]++
+	if m.isOffHours(ts) {
+		b.offHours++
+	}
+
+	if b.outcomes[b.next] {
+		b.failed--
+	}
+	b.outcomes[b.next] = obs.Failed
+	if obs.Failed {
+		b.failed++
+	}
+	b.next = (b.next + 1) % len(b.outcomes)
+}
+
+func (m *BehaviorMonitor) isOffHours(ts time.Time) bool {
+	workday := false
+	for _, d := range m.cfg.WorkDays {
+		if ts.Weekday() == d {
+			workday = true
+			break
+		}
+	}
+	return !workday || ts.Hour() < m.cfg.WorkHourStart || ts.Hour() >= m.cfg.WorkHourEnd
+}
+
+func (m *BehaviorMonitor) actionFor(score int) domain.AgentStatus {
+	switch {
+	case m.cfg.BlockScore > 0 && score >= m.cfg.BlockScore:
+		return domain.StatusBlocked
+	case m.cfg.QuarantineScore > 0 && score >= m.cfg.QuarantineScore:
+		return domain.StatusQuarantine
+	}
+	return ""
+}
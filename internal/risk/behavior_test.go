@@ -0,0 +1,139 @@
+package risk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// behaviorStart — среда, 09:00 UTC: прогрев идет в рабочее окно по умолчанию (пн-пт, 8-20).
+var behaviorStart = time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+
+// warmMonitor прогревает профиль agent-1: по одному успешному crm.read в минуту.
+func warmMonitor(t *testing.T, cfg BehaviorConfig) *BehaviorMonitor {
+	t.Helper()
+	m := NewBehaviorMonitor(cfg)
+	for i := 0; i < cfg.MinSamples; i++ {
+		obs := Observation{AgentID: "agent-1", CapabilityID: "crm.read", Timestamp: behaviorStart.Add(time.Duration(i) * time.Minute)}
+		if inc := m.Observe(obs); inc != nil {
+			t.Fatalf("incident during warm-up at sample %d: %+v", i, inc)
+		}
+	}
+	return m
+}
+
+func TestBehaviorMonitorThresholds(t *testing.T) {
+	base := BehaviorConfig{MinSamples: 20, MinRatePerMin: 5, ErrorWindow: 10, RareCapShare: 0.1,
+		OffHoursShare: 0.5, QuarantineScore: 40, BlockScore: 80}
+	probeAt := behaviorStart.Add(30 * time.Minute)
+	saturday := time.Date(2026, 3, 7, 10, 0, 0, 0, time.UTC)
+	obs := func(capID string, ts time.Time, failed bool) Observation {
+		return Observation{AgentID: "agent-1", CapabilityID: capID, Timestamp: ts, Failed: failed}
+	}
+	// burst — n запросов в одну минуту; последний — к способности last
+	burst := func(n int, ts time.Time, last string) []Observation {
+		list := make([]Observation, n)
+		for i := range list {
+			list[i] = obs("crm.read", ts.Add(time.Duration(i)*time.Second), false)
+		}
+		list[n-1].CapabilityID = last
+		return list
+	}
+
+	tests := []struct {
+		name      string
+		cfg       func(c *BehaviorConfig)
+		probes    []Observation // Инцидент ожидается не раньше последнего события
+		want      domain.AgentStatus
+		wantRules []string
+	}{
+		{name: "usual request", probes: []Observation{obs("crm.read", probeAt, false)}},
+		// Новая способность (40), затем редкая (20) — ниже порога 50
+		{name: "below threshold", cfg: func(c *BehaviorConfig) { c.QuarantineScore = 50 }, probes: []Observation{
+			obs("crm.write", probeAt, false), obs("crm.write", probeAt.Add(time.Minute), false)}},
+		{name: "new capability quarantines", probes: []Observation{obs("bank.transfer", probeAt, false)},
+			want: domain.StatusQuarantine, wantRules: []string{"new_capability"}},
+		{name: "rate spike quarantines", probes: burst(5, probeAt, "crm.read"),
+			want: domain.StatusQuarantine, wantRules: []string{"rate_spike"}},
+		{name: "error ratio quarantines", probes: []Observation{
+			obs("crm.read", probeAt, true), obs("crm.read", probeAt.Add(time.Minute), true),
+			obs("crm.read", probeAt.Add(2*time.Minute), true), obs("crm.read", probeAt.Add(3*time.Minute), true),
+			obs("crm.read", probeAt.Add(4*time.Minute), true)},
+			want: domain.StatusQuarantine, wantRules: []string{"error_ratio"}},
+		// 60, 40 и 30 вместе дают 83 — порог блокировки
+		{name: "combined signals block", probes: burst(5, saturday, "bank.transfer"),
+			want: domain.StatusBlocked, wantRules: []string{"rate_spike", "new_capability", "off_hours"}},
+		{name: "thresholds disabled", cfg: func(c *BehaviorConfig) { c.QuarantineScore, c.BlockScore = 0, 0 },
+			probes: burst(5, saturday, "bank.transfer")},
+		{name: "block threshold only", cfg: func(c *BehaviorConfig) { c.QuarantineScore = 0 },
+			probes: []Observation{obs("bank.transfer", probeAt, false)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			m := warmMonitor(t, cfg)
+
+			var inc *domain.AgentIncident
+			for i, o := range tt.probes {
+				inc = m.Observe(o)
+				if inc != nil && i < len(tt.probes)-1 {
+					t.Fatalf("incident at probe %d of %d: %+v", i, len(tt.probes), inc)
+				}
+			}
+			if tt.want == "" {
+				if inc != nil {
+					t.Fatalf("Observe() = %+v, want no incident", inc)
+				}
+				return
+			}
+			if inc == nil {
+				t.Fatalf("Observe() = nil, want %s", tt.want)
+			}
+			var rules []string
+			for _, f := range inc.Evidence {
+				rules = append(rules, f.Rule)
+			}
+			if inc.Action != tt.want || inc.Source != "behavior" || inc.AgentID != "agent-1" || !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("incident = %s from %s for %s, rules %v; want %s, rules %v", inc.Action, inc.Source, inc.AgentID, rules, tt.want, tt.wantRules)
+			}
+			if inc.Score < cfg.QuarantineScore {
+				t.Errorf("incident score %d is below quarantine threshold %d", inc.Score, cfg.QuarantineScore)
+			}
+		})
+	}
+}
+
+func TestBehaviorMonitorColdStart(t *testing.T) {
+	m := NewBehaviorMonitor(BehaviorConfig{MinSamples: 20, QuarantineScore: 40, BlockScore: 80})
+	// Непрогретый профиль не считает способности новыми и не сравнивает частоту
+	for i := 0; i < 10; i++ {
+		obs := Observation{AgentID: "agent-1", CapabilityID: "cap." + string(rune('a'+i)), Timestamp: behaviorStart}
+		if inc := m.Observe(obs); inc != nil {
+			t.Fatalf("incident on cold profile: %+v", inc)
+		}
+	}
+}
+
+func TestBehaviorMonitorCooldown(t *testing.T) {
+	cfg := BehaviorConfig{MinSamples: 20, QuarantineScore: 40, BlockScore: 80, Cooldown: 10 * time.Minute}
+	m := warmMonitor(t, cfg)
+	at := behaviorStart.Add(30 * time.Minute)
+	newCap := func(capID string, ts time.Time) *domain.AgentIncident {
+		return m.Observe(Observation{AgentID: "agent-1", CapabilityID: capID, Timestamp: ts})
+	}
+
+	if newCap("bank.transfer", at) == nil {
+		t.Fatal("first anomaly did not raise an incident")
+	}
+	if inc := newCap("bank.refund", at.Add(5*time.Minute)); inc != nil {
+		t.Errorf("incident within cooldown: %+v", inc)
+	}
+	if newCap("bank.close", at.Add(10*time.Minute)) == nil {
+		t.Error("no incident after cooldown expired")
+	}
+}
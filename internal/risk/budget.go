@@ -0,0 +1,446 @@
+package risk
+
+/*
+Файл budget.go реализует накопительные риск-бюджеты (Cumulative Risk Budgets).
+
+Порог IsRequired проверяет один запрос: 100 переводов по 4 999 никогда не превысят threshold 5 000.
+Бюджет считает агрегат (sum/count) поля payload по агенту и способности в скользящем окне
+и эскалирует запрос, если с его учетом лимит будет превышен.
+
+Хранение: Redis Sorted Set на каждую пару агент+способность+бюджет.
+Score — время события (мс), member — "event_id|value". Окно обрезается ZREMRANGEBYSCORE,
+поэтому состояние общее для всех инстансов шлюза и не растет бесконечно.
+
+Проверка и расход — один Lua-скрипт (Reserve): параллельные запросы не могут все пройти
+проверку до того, как кто-то из них запишется в окно. Запрос, который в итоге не исполнен
+(отказ, песочница, ошибка коннектора, отклонение оператором), снимается из окон Release.
+Учитываются только конечные неотрицательные значения: отрицательная сумма вернула бы бюджет.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"go.uber.org/zap"
+)
+
+// Budget — одно правило накопительного лимита из Conditions политики:
+// {"budgets": [{"name": "daily_volume", "field": "amount", "agg": "sum", "window": "24h", "limit": 20000, "effect": "QUARANTINE"}]}
+type Budget struct {
+	Name   string              `json:"name"`
+	Field  string              `json:"field"`  // Путь к числовому полю payload ("amount", "transfer.amount"); для count не нужен
+	Agg    string              `json:"agg"`    // sum | count
+	Window string              `json:"window"` // Длительность окна: "15m", "24h"
+	Limit  float64             `json:"limit"`
+	Effect domain.PolicyEffect `json:"effect"` // Эффект при превышении (по умолчанию QUARANTINE)
+}
+
+// BudgetVerdict — результат проверки бюджетов для одного запроса.
+type BudgetVerdict struct {
+	Effect   domain.PolicyEffect
+	Findings []domain.RiskFinding
+}
+
+// budgetWindowScript атомарно обрезает окно и возвращает {count, sum}.
+var budgetWindowScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+local sum = 0
+for _, m in ipairs(members) do
+	local sep = string.find(m, '|', 1, true)
+	if sep then
+		sum = sum + (tonumber(string.sub(m, sep + 1)) or 0)
+	end
+end
+return {#members, tostring(sum)}
+`)
+
+// budgetReserveScript атомарно проверяет все окна запроса и, если ни один лимит не превышен,
+// записывает в них запрос. KEYS — окна; ARGV[1] — время (мс), далее по 6 значений на окно:
+// начало окна, длина окна (мс), лимит, агрегат, вклад запроса, member.
+// Возвращает {} при успехе или пары {номер окна, прогноз} превышенных окон (ничего не записывая).
+var budgetReserveScript = redis.NewScript(`
+local now = ARGV[1]
+local exceeded = {}
+for i = 1, #KEYS do
+	local a = 1 + (i - 1) * 6
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', '(' .. ARGV[a + 1])
+	local members = redis.call('ZRANGE', KEYS[i], 0, -1)
+	local projected
+	if ARGV[a + 4] == 'count' then
+		projected = #members + 1
+	else
+		projected = tonumber(ARGV[a + 5])
+		for _, m in ipairs(members) do
+			local sep = string.find(m, '|', 1, true)
+			if sep then
+				projected = projected + (tonumber(string.sub(m, sep + 1)) or 0)
+			end
+		end
+	end
+	if projected > tonumber(ARGV[a + 3]) then
+		table.insert(exceeded, i)
+		table.insert(exceeded, tostring(projected))
+	end
+end
+if #exceeded > 0 then
+	return exceeded
+end
+for i = 1, #KEYS do
+	local a = 1 + (i - 1) * 6
+	redis.call('ZADD', KEYS[i], now, ARGV[a + 6])
+	redis.call('PEXPIRE', KEYS[i], ARGV[a + 2])
+end
+return {}
+`)
+
+// BudgetReservation — запрос, уже записанный в окна бюджетов (Reserve).
+type BudgetReservation struct {
+	keys    []string
+	members []string
+}
+
+type BudgetTracker struct {
+	rdb    *redis.Client
+	logger *zap.Logger
+}
+
+func NewBudgetTracker(rdb *redis.Client, logger *zap.Logger) *BudgetTracker {
+	return &BudgetTracker{rdb: rdb, logger: logger.Named("budgets")}
+}
+
+// ParseBudgets извлекает бюджеты из Conditions политики.
+func ParseBudgets(conditions json.RawMessage) ([]Budget, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	var cond struct {
+		Budgets []Budget `json:"budgets"`
+	}
+	if err := json.Unmarshal(conditions, &cond); err != nil {
+		return nil, err
+	}
+	for i := range cond.Budgets {
+		if err := cond.Budgets[i].normalize(i); err != nil {
+			return nil, err
+		}
+	}
+	return cond.Budgets, nil
+}
+
+func (b *Budget) normalize(idx int) error {
+	if b.Name == "" {
+		b.Name = strconv.Itoa(idx)
+	}
+	switch b.Agg {
+	case "":
+		b.Agg = "sum"
+	case "sum", "count":
+	default:
+		return fmt.Errorf("budget %s: unsupported agg %q", b.Name, b.Agg)
+	}
+	if b.Agg == "sum" && b.Field == "" {
+		return fmt.Errorf("budget %s: field is required for sum", b.Name)
+	}
+	if _, err := b.windowDuration(); err != nil {
+		return fmt.Errorf("budget %s: %w", b.Name, err)
+	}
+	switch b.Effect {
+	case "":
+		b.Effect = domain.EffectQuarantine
+	case domain.EffectDeny, domain.EffectQuarantine, domain.EffectSandbox:
+	default:
+		return fmt.Errorf("budget %s: unsupported effect %q", b.Name, b.Effect)
+	}
+	return nil
+}
+
+func (b *Budget) windowDuration() (time.Duration, error) {
+	d, err := time.ParseDuration(b.Window)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", b.Window)
+	}
+	return d, nil
+}
+
+// budgetCharge — вклад запроса в одно окно бюджета.
+type budgetCharge struct {
+	budget Budget
+	key    string
+	value  float64
+	window time.Duration
+}
+
+// charges разбирает бюджеты политики и вклад запроса в каждый из них.
+// Ошибка — бюджеты описаны неверно или значение поля не годится для учета.
+func (t *BudgetTracker) charges(agentID, capID string, p domain.Policy, payload []byte) ([]budgetCharge, *BudgetVerdict) {
+	budgets, err := ParseBudgets(p.Conditions)
+	if err != nil {
+		t.logger.Error("invalid budget conditions", zap.String("policy_id", p.ID), zap.Error(err))
+		v := failSafeVerdict("invalid_budget", err)
+		return nil, &v
+	}
+
+	data, payloadErr := parsePayload(payload)
+	var out []budgetCharge
+	for _, b := range budgets {
+		if payloadErr != nil && b.Agg == "sum" {
+			// Иначе число вне диапазона float64 где угодно в payload отключало бы учет суммы
+			t.logger.Warn("budget payload is not a JSON object", zap.String("agent_id", agentID), zap.Error(payloadErr))
+			v := failSafeVerdict("invalid_payload", payloadErr)
+			return nil, &v
+		}
+		value, ok, err := b.valueOf(data)
+		if err != nil {
+			t.logger.Warn("invalid budget value", zap.String("agent_id", agentID), zap.String("budget", b.Name), zap.Error(err))
+			v := failSafeVerdict("invalid_value", err)
+			v.Findings[0].Path = b.Field
+			return nil, &v
+		}
+		if !ok {
+			continue // В запросе нет учитываемого поля — бюджет не расходуется
+		}
+		window, _ := b.windowDuration()
+		out = append(out, budgetCharge{budget: b, key: budgetKey(agentID, capID, b.Name), value: value, window: window})
+	}
+	return out, nil
+}
+
+// exceeded добавляет в вердикт превышенный бюджет.
+func (t *BudgetTracker) exceeded(verdict *BudgetVerdict, agentID, capID string, b Budget, projected float64) {
+	t.logger.Warn("CUMULATIVE BUDGET EXCEEDED",
+		zap.String("agent_id", agentID),
+		zap.String("capability", capID),
+		zap.String("budget", b.Name),
+		zap.Float64("projected", projected),
+		zap.Float64("limit", b.Limit),
+	)
+	verdict.Effect = Escalate(verdict.Effect, b.Effect)
+	verdict.Findings = append(verdict.Findings, domain.RiskFinding{
+		Detector: "budget",
+		Rule:     b.Name,
+		Score:    100,
+		Path:     b.Field,
+		Evidence: fmt.Sprintf("%s %.2f > %.2f in %s", b.Agg, projected, b.Limit, b.Window),
+	})
+}
+
+// Check проверяет, не выйдет ли запрос за пределы бюджетов политики, ничего не записывая
+// (оценка кандидатных политик в Shadow Mode). Шлюз использует Reserve.
+// Если Redis недоступен или бюджеты описаны с ошибкой, запрос уходит на HITL (Fail Safe).
+func (t *BudgetTracker) Check(ctx context.Context, agentID, capID string, p domain.Policy, payload []byte) BudgetVerdict {
+	var verdict BudgetVerdict
+	if t == nil {
+		return verdict
+	}
+	charges, failed := t.charges(agentID, capID, p, payload)
+	if failed != nil {
+		return *failed
+	}
+
+	now := time.Now()
+	for _, c := range charges {
+		count, sum, err := t.window(ctx, c.key, now, c.window)
+		if err != nil {
+			t.logger.Error("budget window read failed", zap.String("budget", c.budget.Name), zap.Error(err))
+			return failSafeVerdict("budget_unavailable", err)
+		}
+		projected := sum + c.value
+		if c.budget.Agg == "count" {
+			projected = float64(count + 1)
+		}
+		if projected > c.budget.Limit {
+			t.exceeded(&verdict, agentID, capID, c.budget, projected)
+		}
+	}
+	return verdict
+}
+
+// Reserve атомарно проверяет бюджеты и, если ни один не превышен, сразу записывает запрос
+// во все окна. Возвращает вердикт и резервирование (nil — ничего не записано). Запрос, который
+// не будет исполнен, нужно снять Release: песочница и отказы бюджет не расходуют.
+// Если Redis недоступен или бюджеты описаны с ошибкой, запрос уходит на HITL (Fail Safe).
+func (t *BudgetTracker) Reserve(ctx context.Context, eventID, agentID, capID string, p domain.Policy, payload []byte) (BudgetVerdict, *BudgetReservation) {
+	var verdict BudgetVerdict
+	if t == nil {
+		return verdict, nil
+	}
+	charges, failed := t.charges(agentID, capID, p, payload)
+	if failed != nil {
+		return *failed, nil
+	}
+	if len(charges) == 0 {
+		return verdict, nil
+	}
+
+	now := time.Now()
+	res := &BudgetReservation{}
+	args := []any{now.UnixMilli()}
+	for _, c := range charges {
+		member := budgetMember(eventID, c.value)
+		res.keys = append(res.keys, c.key)
+		res.members = append(res.members, member)
+		args = append(args,
+			now.Add(-c.window).UnixMilli(),
+			c.window.Milliseconds(), // Ключ живет не дольше окна после последнего события
+			strconv.FormatFloat(c.budget.Limit, 'f', -1, 64),
+			c.budget.Agg,
+			strconv.FormatFloat(c.value, 'f', -1, 64),
+			member,
+		)
+	}
+
+	out, err := budgetReserveScript.Run(ctx, t.rdb, res.keys, args...).Slice()
+	if err != nil {
+		t.logger.Error("budget reserve failed", zap.String("agent_id", agentID), zap.Error(err))
+		return failSafeVerdict("budget_unavailable", err), nil
+	}
+	if len(out) == 0 {
+		return verdict, res
+	}
+	for i := 0; i+1 < len(out); i += 2 {
+		idx, _ := out[i].(int64)
+		projStr, _ := out[i+1].(string)
+		projected, _ := strconv.ParseFloat(projStr, 64)
+		if idx < 1 || int(idx) > len(charges) {
+			return failSafeVerdict("budget_unavailable", fmt.Errorf("unexpected budget script result: %v", out)), nil
+		}
+		t.exceeded(&verdict, agentID, capID, charges[idx-1].budget, projected)
+	}
+	return verdict, nil
+}
+
+// Release снимает неисполненный запрос из окон бюджетов. Контекст запроса к этому моменту
+// может быть отменен, поэтому используется собственный таймаут.
+func (t *BudgetTracker) Release(r *BudgetReservation) {
+	if t == nil || r == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	pipe := t.rdb.Pipeline()
+	for i, key := range r.keys {
+		pipe.ZRem(ctx, key, r.members[i])
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.logger.Error("budget release failed", zap.Strings("keys", r.keys), zap.Error(err))
+	}
+}
+
+// Commit записывает исполненный запрос во все окна бюджетов политики без проверки лимитов:
+// запрос, превысивший бюджет, но одобренный оператором, тоже расходует бюджет.
+// Для запроса, уже записанного Reserve, member совпадает и только обновляется время.
+func (t *BudgetTracker) Commit(ctx context.Context, eventID, agentID, capID string, p domain.Policy, payload []byte) {
+	if t == nil {
+		return
+	}
+	charges, failed := t.charges(agentID, capID, p, payload)
+	if failed != nil || len(charges) == 0 {
+		return
+	}
+
+	now := time.Now()
+	pipe := t.rdb.Pipeline()
+	for _, c := range charges {
+		pipe.ZAdd(ctx, c.key, redis.Z{Score: float64(now.UnixMilli()), Member: budgetMember(eventID, c.value)})
+		pipe.PExpire(ctx, c.key, c.window) // Ключ живет не дольше окна после последнего события
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.logger.Error("budget commit failed",
+			zap.String("agent_id", agentID),
+			zap.String("capability", capID),
+			zap.Error(err))
+	}
+}
+
+func (t *BudgetTracker) window(ctx context.Context, key string, now time.Time, window time.Duration) (int64, float64, error) {
+	from := now.Add(-window).UnixMilli()
+	res, err := budgetWindowScript.Run(ctx, t.rdb, []string{key}, from).Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("unexpected budget script result: %v", res)
+	}
+
+	count, _ := res[0].(int64)
+	sumStr, _ := res[1].(string)
+	sum, _ := strconv.ParseFloat(sumStr, 64)
+	return count, sum, nil
+}
+
+// valueOf возвращает вклад запроса в бюджет: значение поля для sum и 1 для count.
+// false — поля нет или оно не число (бюджет не расходуется); ошибка — число, которое нельзя
+// учитывать: отрицательное (вернуло бы бюджет), NaN или бесконечность.
+func (b *Budget) valueOf(data map[string]interface{}) (float64, bool, error) {
+	if b.Agg == "count" {
+		return 1, true, nil
+	}
+
+	var cur interface{} = data
+	for _, part := range strings.Split(b.Field, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return 0, false, nil
+		}
+		if cur, ok = m[part]; !ok {
+			return 0, false, nil
+		}
+	}
+
+	var f float64
+	switch v := cur.(type) {
+	case float64:
+		f = v
+	case string:
+		var err error
+		// Переполнение («1e400») дает ±Inf и отклоняется ниже, а не пропускается
+		if f, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil && !errors.Is(err, strconv.ErrRange) {
+			return 0, false, nil
+		}
+	default:
+		return 0, false, nil
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return 0, false, fmt.Errorf("budget %s: %s = %v is not a finite non-negative number", b.Name, b.Field, f)
+	}
+	return f, true, nil
+}
+
+func budgetMember(eventID string, value float64) string {
+	return eventID + "|" + strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func budgetKey(agentID, capID, name string) string {
+	return fmt.Sprintf("%s%s:%s:%s", infra.RedisKeyBudgetPrefix, agentID, capID, name)
+}
+
+// parsePayload разбирает payload запроса; пустой payload — запрос без полей.
+func parsePayload(payload []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return m, nil
+	}
+	return m, json.Unmarshal(payload, &m)
+}
+
+func failSafeVerdict(rule string, err error) BudgetVerdict {
+	return BudgetVerdict{
+		Effect: domain.EffectQuarantine,
+		Findings: []domain.RiskFinding{{
+			Detector: "budget", Rule: rule, Score: 100, Evidence: err.Error(),
+		}},
+	}
+}
@@ -0,0 +1,189 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"go.uber.org/zap"
+)
+
+func testBudgetTracker(t *testing.T) (*BudgetTracker, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewBudgetTracker(rdb, zap.NewNop()), mr
+}
+
+func budgetPolicy(t *testing.T, budgets ...Budget) domain.Policy {
+	t.Helper()
+	cond, err := json.Marshal(map[string]any{"budgets": budgets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return domain.Policy{ID: "p1", Conditions: cond}
+}
+
+func TestBudgetValueOf(t *testing.T) {
+	sum := Budget{Name: "volume", Field: "transfer.amount", Agg: "sum"}
+	tests := []struct {
+		name    string
+		budget  Budget
+		payload string
+		want    float64
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "number", budget: sum, payload: `{"transfer":{"amount":150.5}}`, want: 150.5, wantOK: true},
+		{name: "numeric string", budget: sum, payload: `{"transfer":{"amount":" 42 "}}`, want: 42, wantOK: true},
+		{name: "zero", budget: sum, payload: `{"transfer":{"amount":0}}`, want: 0, wantOK: true},
+		{name: "missing field", budget: sum, payload: `{"transfer":{}}`},
+		{name: "not a number", budget: sum, payload: `{"transfer":{"amount":"ten"}}`},
+		{name: "negative refunds budget", budget: sum, payload: `{"transfer":{"amount":-5000}}`, wantErr: true},
+		{name: "negative string", budget: sum, payload: `{"transfer":{"amount":"-1"}}`, wantErr: true},
+		{name: "NaN", budget: sum, payload: `{"transfer":{"amount":"NaN"}}`, wantErr: true},
+		{name: "infinity", budget: sum, payload: `{"transfer":{"amount":"+Inf"}}`, wantErr: true},
+		{name: "overflow", budget: sum, payload: `{"transfer":{"amount":"1e400"}}`, wantErr: true},
+		{name: "count ignores payload", budget: Budget{Name: "calls", Agg: "count"}, payload: `{}`, want: 1, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := parsePayload([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok, err := tt.budget.valueOf(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("valueOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("valueOf() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// Параллельные запросы не должны перерасходовать бюджет: проверка и запись атомарны.
+func TestBudgetReserveConcurrent(t *testing.T) {
+	bt, _ := testBudgetTracker(t)
+	p := budgetPolicy(t, Budget{Name: "volume", Field: "amount", Agg: "sum", Window: "1h", Limit: 1000})
+
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, res := bt.Reserve(context.Background(), fmt.Sprintf("ev-%d", i), "agent-1", "bank.transfer", p, []byte(`{"amount":100}`))
+			if v.Effect == "" {
+				if res == nil {
+					t.Error("passed without reservation")
+				}
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := passed.Load(); got != 10 {
+		t.Fatalf("passed = %d, want 10 (limit 1000 / 100)", got)
+	}
+}
+
+func TestBudgetReserve(t *testing.T) {
+	volume := Budget{Name: "volume", Field: "amount", Agg: "sum", Window: "1h", Limit: 500, Effect: domain.EffectDeny}
+	calls := Budget{Name: "calls", Agg: "count", Window: "1h", Limit: 2}
+
+	tests := []struct {
+		name       string
+		budgets    []Budget
+		payloads   []string
+		release    bool // Снимать резерв после каждого запроса (запрос не исполнен)
+		wantEffect []domain.PolicyEffect
+	}{
+		{
+			name:       "sum limit",
+			budgets:    []Budget{volume},
+			payloads:   []string{`{"amount":300}`, `{"amount":200}`, `{"amount":1}`},
+			wantEffect: []domain.PolicyEffect{"", "", domain.EffectDeny},
+		},
+		{
+			name:       "negative amount does not refund",
+			budgets:    []Budget{volume},
+			payloads:   []string{`{"amount":500}`, `{"amount":-500}`, `{"amount":100}`},
+			wantEffect: []domain.PolicyEffect{"", domain.EffectQuarantine, domain.EffectDeny},
+		},
+		{
+			name:       "exceeded budget records nothing in others",
+			budgets:    []Budget{calls, volume},
+			payloads:   []string{`{"amount":400}`, `{"amount":400}`, `{"amount":50}`, `{"amount":1}`},
+			wantEffect: []domain.PolicyEffect{"", domain.EffectDeny, "", domain.EffectQuarantine},
+		},
+		{
+			name:       "released requests do not spend budget",
+			budgets:    []Budget{calls},
+			payloads:   []string{`{}`, `{}`, `{}`, `{}`},
+			release:    true,
+			wantEffect: []domain.PolicyEffect{"", "", "", ""},
+		},
+		{
+			name:       "unparsable payload with sum budget",
+			budgets:    []Budget{volume},
+			payloads:   []string{`{"amount":1, "x": 1e400}`},
+			wantEffect: []domain.PolicyEffect{domain.EffectQuarantine},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt, _ := testBudgetTracker(t)
+			p := budgetPolicy(t, tt.budgets...)
+			for i, payload := range tt.payloads {
+				v, res := bt.Reserve(context.Background(), fmt.Sprintf("ev-%d", i), "agent-1", "bank.transfer", p, []byte(payload))
+				if v.Effect != tt.wantEffect[i] {
+					t.Fatalf("request %d (%s): effect = %q, want %q (%+v)", i, payload, v.Effect, tt.wantEffect[i], v.Findings)
+				}
+				if (res != nil) != (v.Effect == "") {
+					t.Fatalf("request %d: reservation = %v with effect %q", i, res, v.Effect)
+				}
+				if tt.release {
+					bt.Release(res)
+				}
+			}
+		})
+	}
+}
+
+// Check (Shadow Mode) не расходует бюджет, Commit учитывает одобренный сверх лимита запрос.
+func TestBudgetCheckAndCommit(t *testing.T) {
+	bt, mr := testBudgetTracker(t)
+	p := budgetPolicy(t, Budget{Name: "calls", Agg: "count", Window: "1h", Limit: 1})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if v := bt.Check(ctx, "agent-1", "crm.read", p, nil); v.Effect != "" {
+			t.Fatalf("Check() #%d = %q, want no effect", i, v.Effect)
+		}
+	}
+	if _, res := bt.Reserve(ctx, "ev-1", "agent-1", "crm.read", p, nil); res == nil {
+		t.Fatal("first request is not reserved")
+	}
+	bt.Commit(ctx, "ev-1", "agent-1", "crm.read", p, nil) // Тот же member: не считается дважды
+	bt.Commit(ctx, "ev-2", "agent-1", "crm.read", p, nil) // Одобрен оператором сверх лимита
+
+	members, err := mr.ZMembers(budgetKey("agent-1", "crm.read", "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("window = %v, want ev-1 and ev-2", members)
+	}
+	if v := bt.Check(ctx, "agent-1", "crm.read", p, nil); v.Effect != domain.EffectQuarantine {
+		t.Errorf("Check() after limit = %q, want QUARANTINE", v.Effect)
+	}
+}
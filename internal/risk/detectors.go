@@ -0,0 +1,413 @@
+package risk
+
+/*
+Файл detectors.go содержит контентные детекторы риск-анализатора.
+Каждый детектор независимо сканирует payload агента и возвращает набор срабатываний (Findings)
+с оценкой 0..100. Итоговый риск запроса агрегируется в Analyzer.Assess.
+
+Встроенные детекторы:
+- secrets:      API-ключи, токены, приватные ключи в теле запроса;
+- exfiltration: признаки массовой выгрузки данных (большие массивы, SELECT * без LIMIT, base64-блобы);
+- urls:         подозрительные домены (paste/tunnel-сервисы, IP-адреса, blocklist);
+- injection:    известные маркеры prompt-injection.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+)
+
+// ContentDetector — точка расширения риск-анализатора.
+type ContentDetector interface {
+	Name() string
+	Scan(doc *Document) []domain.RiskFinding
+}
+
+// StringField — строковое значение payload с путем до него.
+type StringField struct {
+	Path  string
+	Key   string // Имя ближайшего ключа (для правил по имени поля)
+	Value string
+}
+
+// Document — payload, разобранный один раз и переиспользуемый всеми детекторами.
+type Document struct {
+	Raw     []byte
+	Strings []StringField
+	Arrays  map[string]int // Путь -> длина массива
+}
+
+// NewDocument разбирает JSON payload. Невалидный JSON сканируется как одна строка.
+func NewDocument(raw []byte) *Document {
+	doc := &Document{Raw: raw, Arrays: make(map[string]int)}
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		doc.Strings = append(doc.Strings, StringField{Path: "$", Value: string(raw)})
+		return doc
+	}
+	doc.collect(v, "$", "")
+	return doc
+}
+
+func (d *Document) collect(v interface{}, path, key string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			d.collect(item, path+"."+k, k)
+		}
+	case []interface{}:
+		d.Arrays[path] = len(val)
+		for i, item := range val {
+			d.collect(item, fmt.Sprintf("%s[%d]", path, i), key)
+		}
+	case string:
+		d.Strings = append(d.Strings, StringField{Path: path, Key: key, Value: val})
+	}
+}
+
+// DetectorConfig — параметры встроенных детекторов (секция engine.risk в конфиге).
+type DetectorConfig struct {
+	BlockedDomains  []string // Явный blocklist доменов
+	MaxArrayLen     int      // Порог «массовой» выборки
+	MaxPayloadBytes int      // Порог подозрительно большого запроса
+}
+
+// DefaultDetectors возвращает встроенный набор детекторов.
+func DefaultDetectors(cfg DetectorConfig) []ContentDetector {
+	return []ContentDetector{
+		NewSecretsDetector(),
+		NewExfiltrationDetector(cfg.MaxArrayLen, cfg.MaxPayloadBytes),
+		NewURLDetector(cfg.BlockedDomains),
+		NewInjectionDetector(),
+	}
+}
+
+// maskEvidence оставляет от найденного фрагмента только префикс и длину.
+func maskEvidence(s string) string {
+	const keep = 4
+	if len(s) <= keep {
+		return strings.Repeat("*", len(s))
+	}
+	return fmt.Sprintf("%s…(%d chars)", s[:keep], len(s))
+}
+
+type regexRule struct {
+	name  string
+	re    *regexp.Regexp
+	score int
+}
+
+// --- secrets ---
+
+// SecretsDetector ищет учетные данные, которые агент пытается передать во внешнюю систему.
+type SecretsDetector struct {
+	rules       []regexRule
+	secretKeyRe *regexp.Regexp
+}
+
+func NewSecretsDetector() *SecretsDetector {
+	return &SecretsDetector{
+		rules: []regexRule{
+			{"private_key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED )?PRIVATE KEY-----`), 100},
+			{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), 90},
+			{"github_token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`), 90},
+			{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`), 90},
+			{"api_secret_key", regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}\b`), 80},
+			{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`), 60},
+			{"inline_credential", regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|passw(?:or)?d|access[_-]?token)\s*[:=]\s*["']?[^\s"']{8,}`), 60},
+		},
+		secretKeyRe: regexp.MustCompile(`(?i)^(?:password|passwd|secret|client_secret|api[_-]?key|private[_-]?key|access[_-]?token)$`),
+	}
+}
+
+func (d *SecretsDetector) Name() string { return "secrets" }
+
+func (d *SecretsDetector) Scan(doc *Document) []domain.RiskFinding {
+	var findings []domain.RiskFinding
+	for _, f := range doc.Strings {
+		for _, rule := range d.rules {
+			if m := rule.re.FindString(f.Value); m != "" {
+				findings = append(findings, domain.RiskFinding{
+					Detector: d.Name(), Rule: rule.name, Score: rule.score,
+					Path: f.Path, Evidence: maskEvidence(m),
+				})
+			}
+		}
+		// Поле с «говорящим» именем и непустым значением — вероятная передача секрета
+		if d.secretKeyRe.MatchString(f.Key) && len(f.Value) >= 8 {
+			findings = append(findings, domain.RiskFinding{
+				Detector: d.Name(), Rule: "secret_field", Score: 50,
+				Path: f.Path, Evidence: maskEvidence(f.Value),
+			})
+		}
+	}
+	return findings
+}
+
+// --- exfiltration ---
+
+// ExfiltrationDetector ищет признаки массовой выгрузки данных.
+type ExfiltrationDetector struct {
+	maxArrayLen     int
+	maxPayloadBytes int
+	selectAllRe     *regexp.Regexp
+	limitRe         *regexp.Regexp
+	dumpRe          *regexp.Regexp
+	emailRe         *regexp.Regexp
+}
+
+func NewExfiltrationDetector(maxArrayLen, maxPayloadBytes int) *ExfiltrationDetector {
+	if maxArrayLen <= 0 {
+		maxArrayLen = 500
+	}
+	if maxPayloadBytes <= 0 {
+		maxPayloadBytes = 256 << 10 // 256 KiB
+	}
+	return &ExfiltrationDetector{
+		maxArrayLen:     maxArrayLen,
+		maxPayloadBytes: maxPayloadBytes,
+		selectAllRe:     regexp.MustCompile(`(?i)\bselect\s+\*\s+from\b`),
+		limitRe:         regexp.MustCompile(`(?i)\blimit\s+\d+`),
+		dumpRe:          regexp.MustCompile(`(?i)\b(?:pg_dump|mysqldump|copy\s+\w+\s+to|export\s+all|dump\s+all|select\s+.+\s+into\s+outfile)\b`),
+		emailRe:         regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+}
+
+func (d *ExfiltrationDetector) Name() string { return "exfiltration" }
+
+func (d *ExfiltrationDetector) Scan(doc *Document) []domain.RiskFinding {
+	var findings []domain.RiskFinding
+
+	if len(doc.Raw) > d.maxPayloadBytes {
+		findings = append(findings, domain.RiskFinding{
+			Detector: d.Name(), Rule: "oversized_payload", Score: 40,
+			Evidence: fmt.Sprintf("%d bytes", len(doc.Raw)),
+		})
+	}
+
+	for path, n := range doc.Arrays {
+		if n > d.maxArrayLen {
+			findings = append(findings, domain.RiskFinding{
+				Detector: d.Name(), Rule: "bulk_array", Score: 50,
+				Path: path, Evidence: fmt.Sprintf("%d items", n),
+			})
+		}
+	}
+
+	emails := make(map[string]struct{})
+	for _, f := range doc.Strings {
+		if d.selectAllRe.MatchString(f.Value) && !d.limitRe.MatchString(f.Value) {
+			findings = append(findings, domain.RiskFinding{
+				Detector: d.Name(), Rule: "unbounded_select", Score: 50,
+				Path: f.Path, Evidence: maskEvidence(f.Value),
+			})
+		}
+		if m := d.dumpRe.FindString(f.Value); m != "" {
+			findings = append(findings, domain.RiskFinding{
+				Detector: d.Name(), Rule: "bulk_dump", Score: 60,
+				Path: f.Path, Evidence: m,
+			})
+		}
+		if longestBase64Run(f.Value) >= 4096 {
+			findings = append(findings, domain.RiskFinding{
+				Detector: d.Name(), Rule: "encoded_blob", Score: 40,
+				Path: f.Path, Evidence: fmt.Sprintf("%d chars", len(f.Value)),
+			})
+		}
+		for _, e := range d.emailRe.FindAllString(f.Value, -1) {
+			emails[strings.ToLower(e)] = struct{}{}
+		}
+	}
+
+	// Десятки разных адресов в одном запросе — типичная выгрузка контактной базы
+	if len(emails) > 20 {
+		findings = append(findings, domain.RiskFinding{
+			Detector: d.Name(), Rule: "bulk_pii", Score: 60,
+			Evidence: fmt.Sprintf("%d distinct emails", len(emails)),
+		})
+	}
+	return findings
+}
+
+// longestBase64Run считает самую длинную непрерывную последовательность base64-символов.
+// RE2 не поддерживает повторы длиннее 1000, поэтому считаем вручную.
+func longestBase64Run(s string) int {
+	longest, cur := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '+' || c == '/' {
+			cur++
+			if cur > longest {
+				longest = cur
+			}
+			continue
+		}
+		cur = 0
+	}
+	return longest
+}
+
+// --- urls ---
+
+// defaultSuspiciousDomains — сервисы, часто используемые для выноса данных и C2.
+var defaultSuspiciousDomains = []string{
+	"pastebin.com", "paste.ee", "hastebin.com", "ghostbin.com",
+	"transfer.sh", "file.io", "anonfiles.com",
+	"ngrok.io", "ngrok-free.app", "trycloudflare.com", "loca.lt",
+	"webhook.site", "requestbin.com", "pipedream.net", "interact.sh", "burpcollaborator.net",
+}
+
+// URLDetector проверяет ссылки в payload на подозрительные домены.
+type URLDetector struct {
+	blocked    []string
+	suspicious []string
+	urlRe      *regexp.Regexp
+}
+
+func NewURLDetector(blocked []string) *URLDetector {
+	normalized := make([]string, 0, len(blocked))
+	for _, b := range blocked {
+		if b = strings.ToLower(strings.TrimSpace(b)); b != "" {
+			normalized = append(normalized, b)
+		}
+	}
+	return &URLDetector{
+		blocked:    normalized,
+		suspicious: defaultSuspiciousDomains,
+		urlRe:      regexp.MustCompile(`(?i)\b(?:https?|ftp|wss?)://[^\s"'<>]+`),
+	}
+}
+
+func (d *URLDetector) Name() string { return "urls" }
+
+func (d *URLDetector) Scan(doc *Document) []domain.RiskFinding {
+	var findings []domain.RiskFinding
+	for _, f := range doc.Strings {
+		for _, raw := range d.urlRe.FindAllString(f.Value, -1) {
+			u, err := url.Parse(raw)
+			if err != nil {
+				continue
+			}
+			host := strings.ToLower(u.Hostname())
+
+			rule, score := d.classify(host)
+			if score == 0 {
+				continue
+			}
+			findings = append(findings, domain.RiskFinding{
+				Detector: d.Name(), Rule: rule, Score: score,
+				Path: f.Path, Evidence: host,
+			})
+		}
+	}
+	return findings
+}
+
+func (d *URLDetector) classify(host string) (string, int) {
+	switch {
+	case matchDomain(host, d.blocked):
+		return "blocked_domain", 90
+	case matchDomain(host, d.suspicious):
+		return "exfil_service", 70
+	case net.ParseIP(host) != nil:
+		return "raw_ip", 50
+	case strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--"):
+		return "punycode_domain", 40
+	}
+	return "", 0
+}
+
+func matchDomain(host string, list []string) bool {
+	for _, d := range list {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- injection ---
+
+// InjectionDetector ищет известные маркеры prompt-injection в тексте, который агент передает дальше.
+type InjectionDetector struct {
+	markers []regexRule
+}
+
+func NewInjectionDetector() *InjectionDetector {
+	return &InjectionDetector{
+		markers: []regexRule{
+			{"ignore_instructions", regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget)\s+(?:all\s+)?(?:the\s+)?(?:previous|prior|above|earlier)\s+(?:instructions|prompts|rules|messages)`), 80},
+			{"reveal_prompt", regexp.MustCompile(`(?i)\b(?:reveal|print|show|repeat)\s+(?:your|the)\s+(?:system\s+prompt|instructions|hidden\s+prompt)`), 70},
+			{"role_override", regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(?:in\s+)?(?:developer|dan|jailbreak|unrestricted)`), 70},
+			{"chat_template_token", regexp.MustCompile(`<\|(?:im_start|im_end|system|endoftext)\|>|\[/?INST\]|<<SYS>>`), 60},
+			{"fake_system_block", regexp.MustCompile(`(?i)(?:^|\n)\s*(?:###\s*)?(?:system|assistant)\s*:\s*`), 40},
+			{"tool_hijack", regexp.MustCompile(`(?i)\b(?:call|invoke|execute)\s+the\s+(?:tool|function)\s+\w+\s+with\b`), 40},
+		},
+	}
+}
+
+func (d *InjectionDetector) Name() string { return "injection" }
+
+func (d *InjectionDetector) Scan(doc *Document) []domain.RiskFinding {
+	var findings []domain.RiskFinding
+	for _, f := range doc.Strings {
+		for _, m := range d.markers {
+			if hit := m.re.FindString(f.Value); hit != "" {
+				findings = append(findings, domain.RiskFinding{
+					Detector: d.Name(), Rule: m.name, Score: m.score,
+					Path: f.Path, Evidence: strings.TrimSpace(hit),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// aggregateScore объединяет оценки детекторов как вероятностное «ИЛИ»: 1 - Π(1 - s_i).
+// Берется максимум по каждому детектору, чтобы десяток одинаковых срабатываний
+// не «перевешивал» один сильный сигнал другого детектора.
+func aggregateScore(findings []domain.RiskFinding) int {
+	perDetector := make(map[string]int)
+	for _, f := range findings {
+		if f.Score > perDetector[f.Detector] {
+			perDetector[f.Detector] = f.Score
+		}
+	}
+
+	names := make([]string, 0, len(perDetector))
+	for n := range perDetector {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	scores := make([]int, 0, len(names))
+	for _, n := range names {
+		scores = append(scores, perDetector[n])
+	}
+	return probabilisticOr(scores)
+}
+
+// combineScores объединяет все срабатывания без группировки (сигналы независимы по природе).
+func combineScores(findings []domain.RiskFinding) int {
+	scores := make([]int, 0, len(findings))
+	for _, f := range findings {
+		scores = append(scores, f.Score)
+	}
+	return probabilisticOr(scores)
+}
+
+func probabilisticOr(scores []int) int {
+	safe := 1.0
+	for _, s := range scores {
+		safe *= 1 - float64(s)/100
+	}
+	return int(100*(1-safe) + 0.5)
+}
@@ -0,0 +1,276 @@
+package sandbox
+
+/*
+Файл responder.go формирует ответы песочницы (Sandbox / Teacher Mode).
+
+Одинаковый "simulated_success" на любой вызов бесполезен для оценки агента: он не видит
+реальной структуры данных и ведет себя иначе, чем в бою. Поэтому ответ берется из источника,
+заданного в Conditions политики:
+- fixture  — подготовленные файлы {fixtures_dir}/{capability}.json;
+- schema   — генерация по JSON Schema из политики;
+- recorded — обезличенные ответы, записанные с Live-вызовов этой способности;
+- static   — фиксированный ответ из политики (или прежний canned-ответ).
+
+Выбор варианта детерминирован по хешу payload: один и тот же запрос получает один и тот же ответ,
+что делает прогоны агента в песочнице воспроизводимыми.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/domain"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/infra"
+	"github.com/xela07ax/spaceai-infra-prototype/internal/redact"
+	"go.uber.org/zap"
+)
+
+const (
+	SourceFixture  = "fixture"
+	SourceSchema   = "schema"
+	SourceRecorded = "recorded"
+	SourceStatic   = "static"
+)
+
+var errNoResponse = errors.New("sandbox: no response available")
+
+// Spec — настройки песочницы из Conditions политики:
+// {"sandbox": {"source": "fixture", "fixture": "jira.search", "fallback": "schema", "schema": {...}}}
+type Spec struct {
+	Source   string          `json:"source"`
+	Fixture  string          `json:"fixture,omitempty"`  // Имя файла фикстуры без .json (по умолчанию — ID способности)
+	Schema   json.RawMessage `json:"schema,omitempty"`   // JSON Schema для генератора
+	Response json.RawMessage `json:"response,omitempty"` // Фиксированный ответ для static
+	Fallback string          `json:"fallback,omitempty"` // Источник, если основной ничего не вернул
+}
+
+// SpecFromConditions извлекает настройки песочницы. Ошибки разбора не фатальны: используется static.
+func SpecFromConditions(raw json.RawMessage) Spec {
+	var cond struct {
+		Sandbox Spec `json:"sandbox"`
+	}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &cond)
+	}
+	if cond.Sandbox.Source == "" {
+		cond.Sandbox.Source = SourceStatic
+	}
+	return cond.Sandbox
+}
+
+// Config — глобальные настройки источников ответов.
+type Config struct {
+	FixturesDir string
+	RecordLive  bool // Сохранять ли обезличенные Live-ответы для источника recorded
+	MaxRecorded int  // Сколько последних ответов хранить на способность
+}
+
+type fixture struct {
+	modTime   time.Time
+	responses []json.RawMessage
+}
+
+type Responder struct {
+	cfg      Config
+	rdb      *redis.Client
+	redactor *redact.Redactor
+	logger   *zap.Logger
+
+	mu       sync.RWMutex
+	fixtures map[string]fixture
+}
+
+func NewResponder(cfg Config, rdb *redis.Client, redactor *redact.Redactor, logger *zap.Logger) *Responder {
+	if cfg.MaxRecorded <= 0 {
+		cfg.MaxRecorded = 50
+	}
+	return &Responder{
+		cfg:      cfg,
+		rdb:      rdb,
+		redactor: redactor,
+		logger:   logger.Named("sandbox_responder"),
+		fixtures: make(map[string]fixture),
+	}
+}
+
+// Respond возвращает ответ песочницы и имя фактически использованного источника.
+// Если ни основной, ни запасной источник ничего не дали, возвращается static-ответ.
+func (r *Responder) Respond(ctx context.Context, capID string, p domain.Policy, payload []byte) ([]byte, string) {
+	if r == nil {
+		return cannedResponse(), SourceStatic
+	}
+	spec := SpecFromConditions(p.Conditions)
+	seed := payloadSeed(payload)
+
+	sources := []string{spec.Source}
+	if spec.Fallback != "" && spec.Fallback != spec.Source {
+		sources = append(sources, spec.Fallback)
+	}
+
+	for _, src := range sources {
+		resp, err := r.fromSource(ctx, src, capID, spec, seed)
+		if err == nil {
+			return resp, src
+		}
+		r.logger.Debug("sandbox source unavailable",
+			zap.String("source", src),
+			zap.String("capability", capID),
+			zap.Error(err))
+	}
+	return cannedResponse(), SourceStatic
+}
+
+func (r *Responder) fromSource(ctx context.Context, src, capID string, spec Spec, seed uint64) ([]byte, error) {
+	switch src {
+	case SourceFixture:
+		name := spec.Fixture
+		if name == "" {
+			name = capID
+		}
+		return r.fixture(name, seed)
+	case SourceSchema:
+		if len(spec.Schema) == 0 {
+			return nil, errNoResponse
+		}
+		return Generate(spec.Schema, seed)
+	case SourceRecorded:
+		return r.recorded(ctx, capID, seed)
+	case SourceStatic:
+		if len(spec.Response) > 0 {
+			return spec.Response, nil
+		}
+		return cannedResponse(), nil
+	}
+	return nil, fmt.Errorf("sandbox: unknown source %q", src)
+}
+
+// fixture читает {fixtures_dir}/{name}.json. Файл — либо один ответ, либо {"responses": [...]}.
+// Кэш инвалидируется по mtime, поэтому фикстуры можно править без рестарта шлюза.
+func (r *Responder) fixture(name string, seed uint64) ([]byte, error) {
+	if r.cfg.FixturesDir == "" {
+		return nil, errors.New("sandbox: fixtures_dir is not configured")
+	}
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("sandbox: invalid fixture name %q", name)
+	}
+
+	path := filepath.Join(r.cfg.FixturesDir, name+".json")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	f, ok := r.fixtures[name]
+	r.mu.RUnlock()
+
+	if !ok || !f.modTime.Equal(info.ModTime()) {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		responses, err := parseFixture(raw)
+		if err != nil {
+			return nil, fmt.Errorf("sandbox: fixture %s: %w", name, err)
+		}
+		f = fixture{modTime: info.ModTime(), responses: responses}
+
+		r.mu.Lock()
+		r.fixtures[name] = f
+		r.mu.Unlock()
+	}
+
+	if len(f.responses) == 0 {
+		return nil, errNoResponse
+	}
+	return f.responses[seed%uint64(len(f.responses))], nil
+}
+
+func parseFixture(raw []byte) ([]json.RawMessage, error) {
+	if !json.Valid(raw) {
+		return nil, errors.New("invalid JSON")
+	}
+	var variants struct {
+		Responses []json.RawMessage `json:"responses"`
+	}
+	if err := json.Unmarshal(raw, &variants); err == nil && variants.Responses != nil {
+		return variants.Responses, nil
+	}
+	return []json.RawMessage{raw}, nil
+}
+
+func (r *Responder) recorded(ctx context.Context, capID string, seed uint64) ([]byte, error) {
+	items, err := r.rdb.LRange(ctx, recordedKey(capID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errNoResponse
+	}
+	return []byte(items[seed%uint64(len(items))]), nil
+}
+
+// Record сохраняет Live-ответ для источника recorded. Перед записью ответ обезличивается:
+// применяются audit_filter политики и ВСЕ зарегистрированные PII-детекторы, чтобы в песочницу
+// не попали реальные данные клиентов. Запись асинхронная и не задерживает ответ агенту.
+func (r *Responder) Record(capID string, p domain.Policy, resp []byte) {
+	if r == nil || !r.cfg.RecordLive || len(resp) == 0 {
+		return
+	}
+
+	go func() {
+		filters, err := redact.FromConditions(p.Conditions)
+		if err != nil {
+			return // Без audit_filter нельзя узнать, какие поля удалить
+		}
+		rules := redact.Rules{Mask: r.redactor.DetectorNames()}
+		if audit := filters.Audit; audit != nil {
+			rules.DropFields = audit.DropFields
+			rules.MaxArrayLen = audit.MaxArrayLen
+		}
+
+		clean, err := r.redactor.ApplyJSON(resp, &rules)
+		if err != nil {
+			return // Не-JSON ответы не записываем: их нельзя надежно обезличить
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		key := recordedKey(capID)
+		pipe := r.rdb.Pipeline()
+		pipe.LPush(ctx, key, clean)
+		pipe.LTrim(ctx, key, 0, int64(r.cfg.MaxRecorded-1))
+		if _, err := pipe.Exec(ctx); err != nil {
+			r.logger.Warn("failed to record live response", zap.String("capability", capID), zap.Error(err))
+		}
+	}()
+}
+
+func recordedKey(capID string) string {
+	return infra.RedisKeySandboxRecordedPrefix + capID
+}
+
+func payloadSeed(payload []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(payload)
+	return h.Sum64()
+}
+
+// cannedResponse — прежний универсальный ответ песочницы, используется как последний fallback.
+func cannedResponse() []byte {
+	resp, _ := json.Marshal(map[string]interface{}{
+		"status":  "simulated_success",
+		"details": "Action captured in sandbox mode, no real impact made.",
+	})
+	return resp
+}
@@ -0,0 +1,231 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// maxSchemaDepth ограничивает рекурсию генератора (защита от самоссылающихся схем).
+	maxSchemaDepth = 16
+	// maxSchemaItems и maxSchemaLength — предел minItems/maxItems и minLength/maxLength:
+	// схема приходит из политики, и ответ песочницы не должен занимать память шлюза.
+	maxSchemaItems  = 1000
+	maxSchemaLength = 64 << 10
+	// maxGeneratedValues — предел числа значений в одном ответе (вложенные массивы перемножаются).
+	maxGeneratedValues = 100_000
+)
+
+// schemaNode — поддерживаемое подмножество JSON Schema.
+type schemaNode struct {
+	Type       interface{}            `json:"type"` // "object" или ["string", "null"]
+	Properties map[string]*schemaNode `json:"properties"`
+	Items      *schemaNode            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+	Const      interface{}            `json:"const"`
+	Default    interface{}            `json:"default"`
+	Examples   []interface{}          `json:"examples"`
+	Format     string                 `json:"format"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+	MinItems   *int                   `json:"minItems"`
+	MaxItems   *int                   `json:"maxItems"`
+	MinLength  *int                   `json:"minLength"`
+	MaxLength  *int                   `json:"maxLength"`
+}
+
+// Generate строит правдоподобный JSON-ответ по схеме. Генерация детерминирована по seed.
+// Приоритет значений: const → enum → examples → default → случайное значение по type/format.
+func Generate(schema json.RawMessage, seed uint64) ([]byte, error) {
+	var root schemaNode
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("sandbox: invalid schema: %w", err)
+	}
+	if err := root.validate("$", 0); err != nil {
+		return nil, fmt.Errorf("sandbox: invalid schema: %w", err)
+	}
+
+	g := &generator{rnd: rand.New(rand.NewSource(int64(seed))), left: maxGeneratedValues}
+	v := g.value(&root, 0)
+	if g.left < 0 {
+		return nil, fmt.Errorf("sandbox: schema generates more than %d values", maxGeneratedValues)
+	}
+	return json.Marshal(v)
+}
+
+// validate проверяет границы размеров до генерации: отрицательные значения, min > max
+// или огромные пределы иначе приводят к панике или исчерпанию памяти.
+func (s *schemaNode) validate(path string, depth int) error {
+	if s == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	if err := checkBounds(path, "Items", s.MinItems, s.MaxItems, maxSchemaItems); err != nil {
+		return err
+	}
+	if err := checkBounds(path, "Length", s.MinLength, s.MaxLength, maxSchemaLength); err != nil {
+		return err
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Maximum < *s.Minimum {
+		return fmt.Errorf("%s: maximum is less than minimum", path)
+	}
+	for k, p := range s.Properties {
+		if err := p.validate(path+"."+k, depth+1); err != nil {
+			return err
+		}
+	}
+	return s.Items.validate(path+"[]", depth+1)
+}
+
+func checkBounds(path, name string, lo, hi *int, limit int) error {
+	for _, b := range []struct {
+		key string
+		v   *int
+	}{{"min" + name, lo}, {"max" + name, hi}} {
+		if b.v != nil && (*b.v < 0 || *b.v > limit) {
+			return fmt.Errorf("%s: %s must be in [0, %d]", path, b.key, limit)
+		}
+	}
+	if lo != nil && hi != nil && *lo > *hi {
+		return fmt.Errorf("%s: min%s is greater than max%s", path, name, name)
+	}
+	return nil
+}
+
+type generator struct {
+	rnd  *rand.Rand
+	left int // Сколько значений еще можно сгенерировать (см. maxGeneratedValues)
+}
+
+func (g *generator) value(s *schemaNode, depth int) interface{} {
+	if s == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	if g.left--; g.left < 0 {
+		return nil
+	}
+	switch {
+	case s.Const != nil:
+		return s.Const
+	case len(s.Enum) > 0:
+		return s.Enum[g.rnd.Intn(len(s.Enum))]
+	case len(s.Examples) > 0:
+		return s.Examples[g.rnd.Intn(len(s.Examples))]
+	case s.Default != nil:
+		return s.Default
+	}
+
+	switch s.typeName() {
+	case "object":
+		// Ключи обходим в отсортированном порядке, иначе порядок map сломает детерминизм
+		keys := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		obj := make(map[string]interface{}, len(keys))
+		for _, k := range keys {
+			obj[k] = g.value(s.Properties[k], depth+1)
+		}
+		return obj
+	case "array":
+		maxItems := intOr(s.MaxItems, 3)
+		n := g.between(intOr(s.MinItems, min(1, maxItems)), maxItems)
+		arr := make([]interface{}, 0, n)
+		for i := 0; i < n && g.left >= 0; i++ {
+			arr = append(arr, g.value(s.Items, depth+1))
+		}
+		return arr
+	case "integer":
+		return int64(g.number(s))
+	case "number":
+		return float64(int64(g.number(s)*100)) / 100
+	case "boolean":
+		return g.rnd.Intn(2) == 1
+	case "string":
+		return g.str(s)
+	}
+	return nil
+}
+
+func (s *schemaNode) typeName() string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []interface{}:
+		// ["string", "null"] — берем первый не-null тип
+		for _, v := range t {
+			if name, ok := v.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	switch {
+	case s.Properties != nil:
+		return "object"
+	case s.Items != nil:
+		return "array"
+	}
+	return ""
+}
+
+func (g *generator) number(s *schemaNode) float64 {
+	lo, hi := 0.0, 1000.0
+	if s.Minimum != nil {
+		lo = *s.Minimum
+	}
+	if s.Maximum != nil {
+		hi = *s.Maximum
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo + g.rnd.Float64()*(hi-lo)
+}
+
+func (g *generator) str(s *schemaNode) string {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	switch s.Format {
+	case "email":
+		return fmt.Sprintf("user%d@example.com", g.rnd.Intn(10000))
+	case "date-time":
+		return base.Add(time.Duration(g.rnd.Intn(365*24)) * time.Hour).Format(time.RFC3339)
+	case "date":
+		return base.AddDate(0, 0, g.rnd.Intn(365)).Format("2006-01-02")
+	case "uuid":
+		b := make([]byte, 16)
+		g.rnd.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "uri":
+		return fmt.Sprintf("https://example.com/resource/%d", g.rnd.Intn(10000))
+	}
+
+	const alphabet = "abcdefghijklmnopqrstuvwxyz"
+	maxLen := intOr(s.MaxLength, 12)
+	n := g.between(intOr(s.MinLength, min(6, maxLen)), maxLen)
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = alphabet[g.rnd.Intn(len(alphabet))]
+	}
+	return string(out)
+}
+
+func (g *generator) between(lo, hi int) int {
+	if hi < lo {
+		hi = lo
+	}
+	return lo + g.rnd.Intn(hi-lo+1)
+}
+
+func intOr(v *int, def int) int {
+	if v == nil {
+		return def
+	}
+	return *v
+}
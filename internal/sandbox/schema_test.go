@@ -0,0 +1,105 @@
+package sandbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+		check   func(t *testing.T, v any)
+	}{
+		{name: "negative maxItems", schema: `{"type":"array","items":{"type":"string"},"maxItems":-1}`, wantErr: "maxItems"},
+		{name: "negative minItems", schema: `{"type":"array","minItems":-5}`, wantErr: "minItems"},
+		{name: "minItems above maxItems", schema: `{"type":"array","minItems":5,"maxItems":2}`, wantErr: "greater"},
+		{name: "huge maxItems", schema: `{"type":"array","maxItems":2000000000}`, wantErr: "maxItems"},
+		{name: "negative maxLength", schema: `{"type":"string","maxLength":-3}`, wantErr: "maxLength"},
+		{name: "huge minLength", schema: `{"type":"string","minLength":1000000000}`, wantErr: "minLength"},
+		{name: "nested bad bounds", schema: `{"type":"object","properties":{"a":{"type":"array","items":{"type":"string","minLength":9,"maxLength":1}}}}`, wantErr: "$.a[]"},
+		{name: "maximum below minimum", schema: `{"type":"integer","minimum":10,"maximum":1}`, wantErr: "maximum"},
+		{
+			name: "nested arrays exceed value budget",
+			schema: `{"type":"array","minItems":1000,"maxItems":1000,"items":
+				{"type":"array","minItems":1000,"maxItems":1000,"items":{"type":"integer"}}}`,
+			wantErr: "values",
+		},
+		{
+			name:   "exact items",
+			schema: `{"type":"array","minItems":4,"maxItems":4,"items":{"type":"boolean"}}`,
+			check: func(t *testing.T, v any) {
+				if arr, _ := v.([]any); len(arr) != 4 {
+					t.Errorf("len = %d, want 4", len(arr))
+				}
+			},
+		},
+		{
+			name:   "minItems above default max",
+			schema: `{"type":"array","minItems":5,"items":{"type":"integer"}}`,
+			check: func(t *testing.T, v any) {
+				if arr, _ := v.([]any); len(arr) != 5 {
+					t.Errorf("len = %d, want 5", len(arr))
+				}
+			},
+		},
+		{
+			name:   "zero maxItems",
+			schema: `{"type":"array","maxItems":0,"items":{"type":"integer"}}`,
+			check: func(t *testing.T, v any) {
+				if arr, ok := v.([]any); !ok || len(arr) != 0 {
+					t.Errorf("got %v, want []", v)
+				}
+			},
+		},
+		{
+			name:   "string length",
+			schema: `{"type":"string","minLength":3,"maxLength":3}`,
+			check: func(t *testing.T, v any) {
+				if s, _ := v.(string); len(s) != 3 {
+					t.Errorf("got %q, want 3 chars", s)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Generate(json.RawMessage(tt.schema), 42)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			var v any
+			if err := json.Unmarshal(out, &v); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, v)
+		})
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object","properties":{
+		"id":{"type":"string","format":"uuid"},
+		"tags":{"type":"array","items":{"type":"string"}},
+		"amount":{"type":"number","minimum":1,"maximum":5}}}`)
+	a, err := Generate(schema, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Generate(schema, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("same seed produced different responses:\n%s\n%s", a, b)
+	}
+}
@@ -0,0 +1,6 @@
+-- Результаты контентного риск-анализа (детекторы секретов, эксфильтрации, URL и prompt-injection)
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS risk_score INT NOT NULL DEFAULT 0;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS risk_findings JSONB;
+
+-- Частичный индекс: в расследованиях ищут только «рисковые» события
+CREATE INDEX IF NOT EXISTS idx_audit_risk_score ON audit_logs(risk_score DESC, timestamp DESC) WHERE risk_score > 0;
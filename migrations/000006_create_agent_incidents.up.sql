@@ -0,0 +1,12 @@
+-- Инциденты, созданные риск-анализатором шлюза (автоматический карантин / блокировка)
+CREATE TABLE IF NOT EXISTS agent_incidents (
+    id UUID PRIMARY KEY,
+    agent_id VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,   -- quarantine, blocked
+    source VARCHAR(50) NOT NULL,   -- behavior
+    score INT NOT NULL,
+    evidence JSONB NOT NULL,       -- Сработавшие сигналы (rate_spike, new_capability, ...)
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_incidents_agent ON agent_incidents(agent_id, created_at DESC);
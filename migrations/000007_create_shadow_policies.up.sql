@@ -0,0 +1,32 @@
+-- Теневой (кандидатный) набор политик: оценивается шлюзом параллельно с активным,
+-- но не влияет на решение. Структура совпадает с policies.
+CREATE TABLE IF NOT EXISTS shadow_policies (
+    id UUID PRIMARY KEY,
+    agent_id VARCHAR(255) NOT NULL, -- UUID или '*'
+    capability_id VARCHAR(255) NOT NULL,
+    effect VARCHAR(20) NOT NULL,    -- ALLOW, DENY, SANDBOX, QUARANTINE
+    conditions JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_shadow_policies_lookup ON shadow_policies(agent_id, capability_id);
+
+-- Расхождения решений активной и теневой политики на реальном трафике
+CREATE TABLE IF NOT EXISTS policy_shadow_divergences (
+    id UUID PRIMARY KEY,
+    trace_id VARCHAR(255),
+    agent_id VARCHAR(255) NOT NULL,
+    capability_id VARCHAR(255) NOT NULL,
+    live_policy_id UUID,             -- NULL, если сработал Default Deny
+    shadow_policy_id UUID NOT NULL,
+    live_effect VARCHAR(20) NOT NULL,
+    shadow_effect VARCHAR(20) NOT NULL,
+    kind VARCHAR(20) NOT NULL,       -- would_deny, would_escalate, would_relax
+    risk_score INT NOT NULL DEFAULT 0,
+    risk_findings JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_shadow_divergences_time ON policy_shadow_divergences(created_at DESC);
+CREATE INDEX idx_shadow_divergences_policy ON policy_shadow_divergences(shadow_policy_id, created_at DESC);
@@ -0,0 +1,30 @@
+-- Версионирование политик: каждое изменение создает неизменяемый снимок
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS policy_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    policy_id UUID NOT NULL,         -- Без FK: история переживает удаление политики
+    version INT NOT NULL,
+    operation VARCHAR(20) NOT NULL,  -- CREATE, UPDATE, DELETE, ROLLBACK
+    agent_id VARCHAR(255) NOT NULL,
+    capability_id VARCHAR(255) NOT NULL,
+    effect VARCHAR(20) NOT NULL,
+    conditions JSONB,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE, -- Снимок фиксирует отсутствие политики
+    author VARCHAR(255) NOT NULL,    -- user_id из токена консоли
+    diff JSONB,                      -- Изменения относительно предыдущей версии
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (policy_id, version)
+);
+
+CREATE INDEX idx_policy_versions_time ON policy_versions(created_at);
+
+-- Исходная версия для уже существующих политик
+INSERT INTO policy_versions (policy_id, version, operation, agent_id, capability_id, effect, conditions, author, created_at)
+SELECT id, 1, 'CREATE', agent_id, capability_id, effect, conditions, 'system', created_at
+FROM policies
+ON CONFLICT (policy_id, version) DO NOTHING;
+
+-- Аудит фиксирует, какая версия политики приняла решение
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS policy_id VARCHAR(255);
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS policy_version INT NOT NULL DEFAULT 0;
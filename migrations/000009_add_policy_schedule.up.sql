@@ -0,0 +1,17 @@
+-- Временные политики: окно валидности, расписание и break-glass доступы
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP WITH TIME ZONE;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS valid_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS schedule JSONB;      -- {"days": ["mon"], "start": "09:00", "end": "18:00", "timezone": "Europe/Moscow"}
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS break_glass BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_policies_break_glass ON policies(valid_until) WHERE break_glass;
+
+-- Снимки версий хранят те же поля, чтобы откат восстанавливал временные рамки
+ALTER TABLE policy_versions ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP WITH TIME ZONE;
+ALTER TABLE policy_versions ADD COLUMN IF NOT EXISTS valid_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE policy_versions ADD COLUMN IF NOT EXISTS schedule JSONB;
+ALTER TABLE policy_versions ADD COLUMN IF NOT EXISTS break_glass BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Решения, принятые по break-glass доступу, явно помечаются в аудите
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS break_glass BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_audit_break_glass ON audit_logs(timestamp DESC) WHERE break_glass;
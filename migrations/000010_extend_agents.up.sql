@@ -0,0 +1,21 @@
+-- Реестр агентов: владельцы, команда, окружение, метки и мягкое удаление.
+-- Колонки scopes/metadata/last_activity уже читаются консолью, но отсутствовали в схеме.
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS owners JSONB NOT NULL DEFAULT '[]';   -- ["alice@corp.io"]
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS team VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS environment VARCHAR(20) NOT NULL DEFAULT 'dev';
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';   -- {"cost-center": "42"}
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS scopes JSONB NOT NULL DEFAULT '[]';   -- Разрешенные Capability ID
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS last_activity TIMESTAMP WITH TIME ZONE;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS created_by VARCHAR(255) NOT NULL DEFAULT 'system';
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;   -- Мягкое удаление (decommission)
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+
+ALTER TABLE agents DROP CONSTRAINT IF EXISTS agents_environment_check;
+ALTER TABLE agents ADD CONSTRAINT agents_environment_check CHECK (environment IN ('dev', 'staging', 'prod'));
+
+-- Имя уникально среди действующих агентов: после вывода из эксплуатации его можно переиспользовать
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agents_name_active ON agents(name) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_agents_team ON agents(team) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_agents_labels_gin ON agents USING GIN (labels);
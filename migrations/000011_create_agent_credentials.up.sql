@@ -0,0 +1,18 @@
+-- Учетные данные агентов для OAuth2 Client Credentials.
+-- client_id агента — его UUID, секретов может быть несколько: при ротации старый
+-- секрет получает expires_at и продолжает действовать до конца льготного периода.
+CREATE TABLE IF NOT EXISTS agent_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    agent_id UUID NOT NULL REFERENCES agents(id),
+    secret_hash VARCHAR(255) NOT NULL, -- Хеш bcrypt, сам секрет показывается один раз
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_by VARCHAR(255) NOT NULL DEFAULT 'system',
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL — бессрочно (до следующей ротации)
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_credentials_active ON agent_credentials(agent_id) WHERE revoked_at IS NULL;
+
+-- Время жизни токенов агента. NULL — значение по умолчанию из auth.agent_tokens.default_ttl
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS token_ttl_seconds INTEGER CHECK (token_ttl_seconds > 0);
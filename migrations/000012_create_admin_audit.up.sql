@@ -0,0 +1,17 @@
+-- Журнал административных действий консоли (RBAC).
+-- Пока фиксируются отказы: кто, с какой ролью и какое право пытался использовать.
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT '',
+    action VARCHAR(100) NOT NULL,          -- Требуемое право: policies:write, approvals:decide
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    outcome VARCHAR(20) NOT NULL,          -- denied
+    remote_addr VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_created ON admin_audit(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_user ON admin_audit(user_id, created_at DESC);
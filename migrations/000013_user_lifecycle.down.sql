@@ -0,0 +1,12 @@
+-- Прежняя версия консоли не умеет создавать администратора (-bootstrap-admin):
+-- возвращаем администратора из 000001, только если других администраторов не осталось.
+INSERT INTO users (username, email, password_hash, role)
+SELECT 'admin', 'admin@spaceai.io', '$2a$10$wuM1jVI4ebmjWzheO1tyP.5rGl6LxzBBg5r2v5bEk2KrLc/I3JE.a', 'admin'
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN IF EXISTS created_by;
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS failed_login_attempts;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
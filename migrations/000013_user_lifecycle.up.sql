@@ -0,0 +1,12 @@
+-- Жизненный цикл пользователей консоли: отключение, блокировка после неудачных входов, смена пароля.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_by VARCHAR(255) NOT NULL DEFAULT 'system';
+
+-- Удаляем администратора с паролем по умолчанию из 000001, если пароль так и не сменили.
+-- Новый администратор создается командой `console -bootstrap-admin <username>`.
+DELETE FROM users
+WHERE username = 'admin'
+  AND password_hash = '$2a$10$wuM1jVI4ebmjWzheO1tyP.5rGl6LxzBBg5r2v5bEk2KrLc/I3JE.a';
@@ -0,0 +1,7 @@
+-- Внешние учетные записи (вход через OIDC). Локальные пользователи: auth_provider = 'local'.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_provider VARCHAR(20) NOT NULL DEFAULT 'local';
+-- Стабильный идентификатор у IdP: "{issuer}|{sub}" (username и email у IdP могут меняться)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id VARCHAR(512);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(auth_provider, external_id)
+    WHERE external_id IS NOT NULL;
@@ -0,0 +1,13 @@
+-- Журнал административных действий: кроме отказов RBAC фиксируются все изменяющие вызовы консоли
+-- с объектом изменения и его состоянием до и после.
+ALTER TABLE admin_audit
+    ADD COLUMN IF NOT EXISTS target_type VARCHAR(50) NOT NULL DEFAULT '',  -- agent, policy, approval, user...
+    ADD COLUMN IF NOT EXISTS target_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS status INT NOT NULL DEFAULT 0,                -- HTTP-статус ответа
+    ADD COLUMN IF NOT EXISTS before_state JSONB,
+    ADD COLUMN IF NOT EXISTS after_state JSONB;
+
+COMMENT ON COLUMN admin_audit.outcome IS 'denied | success | failed';
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_target ON admin_audit(target_type, target_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_action ON admin_audit(action, created_at DESC);
@@ -0,0 +1,33 @@
+-- Цепочка хешей журнала аудита: изменение или удаление строк audit_logs обнаруживается проверкой.
+-- Строки, записанные до миграции, в цепочку не входят (chain_partition IS NULL).
+ALTER TABLE audit_logs
+    ADD COLUMN IF NOT EXISTS chain_partition VARCHAR(100), -- Партиция цепочки (обычно инстанс шлюза)
+    ADD COLUMN IF NOT EXISTS chain_seq BIGINT,             -- Номер события в партиции: 1, 2, 3...
+    ADD COLUMN IF NOT EXISTS prev_hash CHAR(64),
+    ADD COLUMN IF NOT EXISTS hash CHAR(64);                -- SHA-256(prev_hash || каноническое событие)
+
+-- Уникальность номера: две записи с одним chain_seq — это форк цепочки
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_chain ON audit_logs(chain_partition, chain_seq)
+    WHERE chain_partition IS NOT NULL;
+
+-- Голова каждой партиции. Блокируется (FOR UPDATE) на время записи пакета,
+-- поэтому несколько писателей одной партиции выстраиваются в одну цепочку.
+CREATE TABLE IF NOT EXISTS audit_chain_heads (
+    partition VARCHAR(100) PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Контрольные точки: голова партиции, подписанная закрытым ключом консоли (JWS RS256)
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id BIGSERIAL PRIMARY KEY,
+    partition VARCHAR(100) NOT NULL,
+    seq BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL,
+    key_id VARCHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_partition ON audit_checkpoints(partition, seq);
@@ -0,0 +1,12 @@
+-- Индексы для Console API выборки аудита (GET /v1/audit)
+
+-- Сортировка по умолчанию и keyset-пагинация: (timestamp, id) без фильтров
+CREATE INDEX IF NOT EXISTS idx_audit_timestamp_id ON audit_logs(timestamp DESC, id DESC);
+
+-- Хронология запроса (GET /v1/audit/traces/{trace_id}) читается по времени
+CREATE INDEX IF NOT EXISTS idx_audit_trace_timestamp ON audit_logs(trace_id, timestamp);
+DROP INDEX IF EXISTS idx_audit_trace_id;
+
+-- Расследования по политике и по исходу
+CREATE INDEX IF NOT EXISTS idx_audit_policy_timestamp ON audit_logs(policy_id, timestamp DESC) WHERE policy_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_status_timestamp ON audit_logs(status, timestamp DESC);
@@ -0,0 +1,10 @@
+-- Курсоры форвардера аудита в SIEM: последнее доставленное событие каждой партиции цепочки.
+-- Курсор сдвигается только после успешной отправки (at-least-once). Строка блокируется
+-- (FOR UPDATE SKIP LOCKED) на время отправки, поэтому реплики консоли не шлют одно и то же.
+CREATE TABLE IF NOT EXISTS audit_forward_cursors (
+    consumer VARCHAR(100) NOT NULL,  -- Имя форвардера (audit.forwarder.name)
+    partition VARCHAR(100) NOT NULL, -- Партиция цепочки (audit_chain_heads.partition)
+    seq BIGINT NOT NULL DEFAULT 0,   -- Последний доставленный chain_seq
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (consumer, partition)
+);
@@ -0,0 +1,99 @@
+-- Партиционирование audit_logs по времени (PARTITION BY RANGE (timestamp)).
+-- Срок хранения выполняется удалением целых партиций (DROP TABLE вместо DELETE: без
+-- раздувания таблицы и долгого VACUUM). Партиции наперед создает и удаляет по сроку
+-- консоль (audit.retention); имена партиций кодируют границы: audit_logs_pYYYYMMDD (сутки)
+-- или audit_logs_pYYYYMM (месяц), см. audit/partition.go.
+
+ALTER TABLE audit_logs RENAME TO audit_logs_legacy;
+ALTER INDEX IF EXISTS audit_logs_pkey RENAME TO audit_logs_legacy_pkey;
+
+CREATE TABLE audit_logs (
+    id UUID NOT NULL,
+    trace_id UUID NOT NULL,
+    agent_id UUID NOT NULL,
+    capability_id VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    response JSONB,
+    mode VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    duration_ms INT NOT NULL,
+    timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    risk_score INT NOT NULL DEFAULT 0,
+    risk_findings JSONB,
+    policy_id VARCHAR(255),
+    policy_version INT NOT NULL DEFAULT 0,
+    break_glass BOOLEAN NOT NULL DEFAULT FALSE,
+    chain_partition VARCHAR(100),
+    chain_seq BIGINT,
+    prev_hash CHAR(64),
+    hash CHAR(64),
+    -- Ключ партиционирования обязан входить в PK
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- Строки вне всех партиций (партиция не создана вовремя, часы шлюза ушли вперед).
+-- Менеджер партиций переносит их в партицию при ее создании.
+CREATE TABLE audit_logs_default PARTITION OF audit_logs DEFAULT;
+
+-- Партиции по месяцам для уже накопленных данных и текущего месяца.
+-- Дальше консоль создает партиции заданной гранулярности, не пересекающиеся с этими.
+DO $$
+DECLARE
+    m DATE;
+BEGIN
+    m := date_trunc('month', COALESCE((SELECT MIN(timestamp) FROM audit_logs_legacy), NOW()) AT TIME ZONE 'UTC')::DATE;
+    WHILE m <= date_trunc('month', NOW() AT TIME ZONE 'UTC')::DATE LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF audit_logs FOR VALUES FROM (%L) TO (%L)',
+            'audit_logs_p' || to_char(m, 'YYYYMM'),
+            m::TEXT || ' 00:00:00+00',
+            (m + INTERVAL '1 month')::DATE::TEXT || ' 00:00:00+00');
+        m := (m + INTERVAL '1 month')::DATE;
+    END LOOP;
+END $$;
+
+INSERT INTO audit_logs (id, trace_id, agent_id, capability_id, payload, response, mode, status, duration_ms,
+    timestamp, risk_score, risk_findings, policy_id, policy_version, break_glass,
+    chain_partition, chain_seq, prev_hash, hash)
+SELECT id, trace_id, agent_id, capability_id, payload, response, mode, status, duration_ms,
+    COALESCE(timestamp, NOW()), risk_score, risk_findings, policy_id, policy_version, break_glass,
+    chain_partition, chain_seq, prev_hash, hash
+FROM audit_logs_legacy;
+
+DROP TABLE audit_logs_legacy;
+
+-- Индексы на родительской таблице наследуются всеми партициями (в том числе будущими)
+CREATE INDEX idx_audit_agent_timestamp ON audit_logs(agent_id, timestamp DESC);
+CREATE INDEX idx_audit_payload_gin ON audit_logs USING GIN (payload);
+CREATE INDEX idx_audit_risk_score ON audit_logs(risk_score DESC, timestamp DESC) WHERE risk_score > 0;
+CREATE INDEX idx_audit_break_glass ON audit_logs(timestamp DESC) WHERE break_glass;
+CREATE INDEX idx_audit_timestamp_id ON audit_logs(timestamp DESC, id DESC);
+CREATE INDEX idx_audit_trace_timestamp ON audit_logs(trace_id, timestamp);
+CREATE INDEX idx_audit_policy_timestamp ON audit_logs(policy_id, timestamp DESC) WHERE policy_id IS NOT NULL;
+CREATE INDEX idx_audit_status_timestamp ON audit_logs(status, timestamp DESC);
+-- Уникальный индекс по (chain_partition, chain_seq) невозможен без ключа партиционирования:
+-- номера выдаются под блокировкой головы (audit_chain_heads), а форк ловит auditctl verify (duplicate)
+CREATE INDEX idx_audit_chain ON audit_logs(chain_partition, chain_seq) WHERE chain_partition IS NOT NULL;
+
+-- Якорь цепочки: последнее удаленное по сроку событие партиции цепочки, подписанное консолью.
+-- Проверка цепочки начинается с якоря, а не с первого события.
+CREATE TABLE IF NOT EXISTS audit_chain_anchors (
+    partition VARCHAR(100) PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL,
+    key_id VARCHAR(64) NOT NULL DEFAULT '',
+    signature TEXT NOT NULL DEFAULT '', -- Пусто, если у консоли нет закрытого ключа
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Архивы удаленных партиций (gzip NDJSON в audit.retention.archive.dir)
+CREATE TABLE IF NOT EXISTS audit_archives (
+    partition VARCHAR(100) PRIMARY KEY, -- Имя партиции хранения (audit_logs_p...)
+    range_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    range_to TIMESTAMP WITH TIME ZONE NOT NULL,
+    path TEXT NOT NULL,
+    row_count BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    restored_at TIMESTAMP WITH TIME ZONE -- Восстановлен для расследования: партиция не удаляется, пока не снят
+);
@@ -0,0 +1,12 @@
+-- События выше якоря, удаленные по сроку раньше более ранних номеров: номера цепочки идут в порядке
+-- записи, а партиции хранения — по времени события (например, событие из спула с прошлым временем).
+-- Подписанный hash связывает цепочку через пропуск, поэтому auditctl verify не считает его gap.
+CREATE TABLE IF NOT EXISTS audit_chain_pruned (
+    partition VARCHAR(100) NOT NULL,
+    seq BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL,
+    key_id VARCHAR(64) NOT NULL DEFAULT '',
+    signature TEXT NOT NULL DEFAULT '', -- Пусто, если у консоли нет закрытого ключа
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (partition, seq)
+);
@@ -0,0 +1,10 @@
+-- Одна теневая политика на пару агент+способность: при нескольких кандидатах порядок
+-- их оценки не определен. Из существующих дублей остается последняя измененная.
+DELETE FROM shadow_policies s
+USING shadow_policies newer
+WHERE newer.agent_id = s.agent_id
+  AND newer.capability_id = s.capability_id
+  AND (newer.updated_at, newer.id) > (s.updated_at, s.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shadow_policies_agent_capability ON shadow_policies(agent_id, capability_id);
+DROP INDEX IF EXISTS idx_shadow_policies_lookup;